@@ -0,0 +1,160 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+)
+
+var crlf = []byte("\r\n")
+
+// header 是邮件头中的一个字段，raw 是包含折行及末尾 CRLF 的原始内容。
+type header struct {
+	name string
+	raw  string
+}
+
+// normalizeLineEndings 将单独的 LF 转换为 CRLF。
+func normalizeLineEndings(msg []byte) []byte {
+	if !bytes.Contains(msg, []byte("\n")) {
+		return msg
+	}
+
+	msg = bytes.ReplaceAll(msg, crlf, []byte("\n"))
+
+	return bytes.ReplaceAll(msg, []byte("\n"), crlf)
+}
+
+// splitMessage 拆分邮件头和邮件正文。msg 的换行符必须是 CRLF。
+func splitMessage(msg []byte) (headers []header, body []byte) {
+	var rawHeaders []byte
+
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		rawHeaders, body = msg[:i+2], msg[i+4:]
+	} else {
+		// 没有正文。
+		rawHeaders = msg
+	}
+
+	for line := range strings.Lines(string(rawHeaders)) {
+		// 以空白字符开头的行是上一个字段的折行。
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].raw += line
+			continue
+		}
+
+		name, _, _ := strings.Cut(line, ":")
+		headers = append(headers, header{name: strings.TrimSpace(name), raw: line})
+	}
+
+	return
+}
+
+// canonicalizeBody 按 RFC 6376 第 3.4.3 / 3.4.4 节规范化邮件正文。
+func canonicalizeBody(body []byte, c Canonicalization) []byte {
+	if c == CanonicalizationRelaxed {
+		lines := bytes.SplitAfter(body, crlf)
+
+		var buf bytes.Buffer
+		for _, line := range lines {
+			line, hasCRLF := bytes.CutSuffix(line, crlf)
+			buf.Write(bytes.TrimRight(compressWSP(line), " "))
+
+			if hasCRLF {
+				buf.Write(crlf)
+			} else if len(line) > 0 {
+				// 最后一行没有 CRLF。
+				buf.Write(crlf)
+			}
+		}
+
+		body = buf.Bytes()
+	}
+
+	// 删除末尾的空行。
+	for bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+		body = body[:len(body)-2]
+	}
+
+	if c == CanonicalizationRelaxed {
+		if bytes.Equal(body, crlf) {
+			return nil
+		}
+
+		return body
+	}
+
+	// simple: 空正文规范化为一个 CRLF。
+	if len(body) == 0 || bytes.Equal(body, crlf) {
+		return crlf
+	}
+
+	if !bytes.HasSuffix(body, crlf) {
+		body = append(body, crlf...)
+	}
+
+	return body
+}
+
+// canonicalizeHeader 按 RFC 6376 第 3.4.1 / 3.4.2 节规范化邮件头字段，raw 包含末尾的 CRLF。
+func canonicalizeHeader(raw string, c Canonicalization) string {
+	if c == CanonicalizationSimple {
+		return raw
+	}
+
+	name, value, _ := strings.Cut(raw, ":")
+	name = strings.ToLower(strings.TrimRight(name, " \t"))
+
+	// 合并折行。
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	value = strings.Trim(string(compressWSP([]byte(value))), " ")
+
+	return name + ":" + value + "\r\n"
+}
+
+// compressWSP 将连续的空白字符（空格、tab）替换为一个空格。
+func compressWSP(b []byte) []byte {
+	var out []byte
+	inWSP := false
+
+	for _, c := range b {
+		if c == ' ' || c == '\t' {
+			if !inWSP {
+				out = append(out, ' ')
+			}
+
+			inWSP = true
+
+			continue
+		}
+
+		inWSP = false
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// parseCanonicalization 解析 `c=` 标签的值，例如 `relaxed/simple`。
+// 省略 body 的规范化方式时为 simple。
+func parseCanonicalization(s string) (headerCanon, bodyCanon Canonicalization, err error) {
+	h, b, found := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "/")
+	if !found {
+		b = string(CanonicalizationSimple)
+	}
+
+	if h == "" {
+		h = string(CanonicalizationSimple)
+	}
+
+	headerCanon, bodyCanon = Canonicalization(h), Canonicalization(b)
+
+	if !headerCanon.valid() || !bodyCanon.valid() {
+		err = ErrInvalidCanonicalization
+	}
+
+	return
+}
+
+func (c Canonicalization) valid() bool {
+	return c == CanonicalizationSimple || c == CanonicalizationRelaxed
+}
@@ -0,0 +1,92 @@
+package dkim
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizeBody(t *testing.T) {
+	// 示例邮件正文来自 RFC 6376 附录 A 及 RFC 8463 附录 A（多了一个空格及末尾的空行）。
+	body := []byte("Hi.\r\n\r\nWe lost the game.  Are you hungry yet?\r\n\r\nJoe.\r\n\r\n\r\n")
+
+	bh := func(b []byte) string {
+		sum := sha256.Sum256(b)
+
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	assert.Equal(t, "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=", bh(canonicalizeBody(body, CanonicalizationRelaxed)))
+	assert.Equal(t, "4bLNXImK9drULnmePzZNEBleUanJCX5PIsDIFoH4KTQ=", bh(canonicalizeBody(body, CanonicalizationSimple)))
+
+	tests := []struct {
+		body    string
+		simple  string
+		relaxed string
+	}{
+		{"", "\r\n", ""},
+		{"\r\n", "\r\n", ""},
+		{"\r\n\r\n", "\r\n", ""},
+		{"abc", "abc\r\n", "abc\r\n"},
+		{" a \t b \r\n\r\n", " a \t b \r\n", " a b\r\n"},
+		{"a\r\n \r\n\t\r\n", "a\r\n \r\n\t\r\n", "a\r\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.simple, string(canonicalizeBody([]byte(tt.body), CanonicalizationSimple)), "simple: %q", tt.body)
+		assert.Equal(t, tt.relaxed, string(canonicalizeBody([]byte(tt.body), CanonicalizationRelaxed)), "relaxed: %q", tt.body)
+	}
+}
+
+func TestCanonicalizeHeader(t *testing.T) {
+	tests := []struct {
+		raw     string
+		relaxed string
+	}{
+		{"From: Joe <joe@example.com>\r\n", "from:Joe <joe@example.com>\r\n"},
+		{"SubjecT :  Is  dinner\r\n\tready? \r\n", "subject:Is dinner ready?\r\n"},
+		{"X-Empty:\r\n", "x-empty:\r\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.raw, canonicalizeHeader(tt.raw, CanonicalizationSimple))
+		assert.Equal(t, tt.relaxed, canonicalizeHeader(tt.raw, CanonicalizationRelaxed))
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	msg := normalizeLineEndings([]byte("From: a@example.com\nSubject: hello\n world\n\nbody\n"))
+	headers, body := splitMessage(msg)
+
+	assert.Equal(t, []header{
+		{name: "From", raw: "From: a@example.com\r\n"},
+		{name: "Subject", raw: "Subject: hello\r\n world\r\n"},
+	}, headers)
+	assert.Equal(t, "body\r\n", string(body))
+
+	headers, body = splitMessage([]byte("From: a@example.com\r\n"))
+	assert.Len(t, headers, 1)
+	assert.Empty(t, body)
+}
+
+func TestParseCanonicalization(t *testing.T) {
+	h, b, err := parseCanonicalization("relaxed/simple")
+	assert.Nil(t, err)
+	assert.Equal(t, CanonicalizationRelaxed, h)
+	assert.Equal(t, CanonicalizationSimple, b)
+
+	h, b, err = parseCanonicalization("relaxed")
+	assert.Nil(t, err)
+	assert.Equal(t, CanonicalizationRelaxed, h)
+	assert.Equal(t, CanonicalizationSimple, b)
+
+	h, b, err = parseCanonicalization("")
+	assert.Nil(t, err)
+	assert.Equal(t, CanonicalizationSimple, h)
+	assert.Equal(t, CanonicalizationSimple, b)
+
+	_, _, err = parseCanonicalization("relaxed/nowsp")
+	assert.ErrorIs(t, err, ErrInvalidCanonicalization)
+}
@@ -0,0 +1,82 @@
+// Package dkim 实现 DKIM（DomainKeys Identified Mail）签名及校验。
+//
+// 支持 RSA-SHA256 及 Ed25519-SHA256（RFC 8463）算法，以及 simple / relaxed
+// 两种规范化（canonicalization）方式。
+//
+// FYI
+//
+//   - https://datatracker.ietf.org/doc/html/rfc6376
+//   - https://datatracker.ietf.org/doc/html/rfc8463
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+type Canonicalization string
+
+const (
+	CanonicalizationSimple  Canonicalization = "simple"
+	CanonicalizationRelaxed Canonicalization = "relaxed"
+)
+
+const (
+	AlgorithmRSASHA256     = "rsa-sha256"
+	AlgorithmEd25519SHA256 = "ed25519-sha256"
+
+	headerName = "DKIM-Signature"
+)
+
+var (
+	ErrInvalidPrivateKey        = errors.New("dkim: invalid private key")
+	ErrUnsupportedKeyType       = errors.New("dkim: unsupported key type, only RSA and Ed25519 keys are supported")
+	ErrInvalidCanonicalization  = errors.New("dkim: invalid canonicalization")
+	ErrMissingFromHeader        = errors.New("dkim: message has no From header")
+	ErrInvalidSigningParameters = errors.New("dkim: domain and selector are required")
+)
+
+// ParsePrivateKey 解析 PEM 格式的私钥，支持：
+//
+//   - `RSA PRIVATE KEY`: PKCS #1 格式的 RSA 私钥，即 dnsutils.GenDKIMKey 生成的格式。
+//   - `PRIVATE KEY`: PKCS #8 格式的 RSA 或 Ed25519 私钥，例如
+//     `openssl genpkey -algorithm ed25519` 生成的私钥。
+func ParsePrivateKey(privateKeyPEM string) (key crypto.Signer, err error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var k any
+		k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			break
+		}
+
+		switch k := k.(type) {
+		case *rsa.PrivateKey:
+			key = k
+		case ed25519.PrivateKey:
+			key = k
+		default:
+			return nil, ErrUnsupportedKeyType
+		}
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block type %q", ErrInvalidPrivateKey, block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, err)
+	}
+
+	return
+}
@@ -0,0 +1,236 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSignedHeaders 是默认签名的邮件头，邮件中不存在的邮件头会被忽略。
+var DefaultSignedHeaders = []string{
+	"From",
+	"To",
+	"Cc",
+	"Subject",
+	"Date",
+	"Message-ID",
+	"Reply-To",
+	"In-Reply-To",
+	"References",
+	"List-Unsubscribe",
+	"List-Unsubscribe-Post",
+	"MIME-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+var now = time.Now
+
+// Signer 使用指定的域名、selector 和私钥对邮件进行 DKIM 签名，可以并发使用。
+type Signer struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+
+	headerCanon Canonicalization
+	bodyCanon   Canonicalization
+	headers     []string
+	expiration  time.Duration
+	identity    string
+}
+
+type Option func(s *Signer)
+
+// WithSignedHeaders 指定要签名的邮件头（`h=` 标签），默认为 DefaultSignedHeaders。
+// `From` 总是会被签名。
+func WithSignedHeaders(headers ...string) Option {
+	return func(s *Signer) {
+		s.headers = headers
+	}
+}
+
+// WithCanonicalization 指定邮件头和邮件正文的规范化方式（`c=` 标签），默认为 `relaxed/relaxed`。
+func WithCanonicalization(header, body Canonicalization) Option {
+	return func(s *Signer) {
+		s.headerCanon = header
+		s.bodyCanon = body
+	}
+}
+
+// WithExpiration 指定签名的有效期（`x=` 标签），默认不过期。
+func WithExpiration(d time.Duration) Option {
+	return func(s *Signer) {
+		s.expiration = d
+	}
+}
+
+// WithIdentity 指定签名者的身份（`i=` 标签），通常是邮件地址，其域名必须是签名域名
+// 或其子域名。
+func WithIdentity(identity string) Option {
+	return func(s *Signer) {
+		s.identity = identity
+	}
+}
+
+// NewSigner 返回一个 Signer。privateKeyPEM 是 PEM 格式的私钥（参考 ParsePrivateKey），
+// 根据私钥类型使用 rsa-sha256 或 ed25519-sha256 算法。
+func NewSigner(domain, selector, privateKeyPEM string, opts ...Option) (s *Signer, err error) {
+	if domain == "" || selector == "" {
+		return nil, ErrInvalidSigningParameters
+	}
+
+	key, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return
+	}
+
+	s = &Signer{
+		domain:      strings.ToLower(domain),
+		selector:    selector,
+		key:         key,
+		headerCanon: CanonicalizationRelaxed,
+		bodyCanon:   CanonicalizationRelaxed,
+		headers:     DefaultSignedHeaders,
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		s.algorithm = AlgorithmRSASHA256
+	case ed25519.PrivateKey:
+		s.algorithm = AlgorithmEd25519SHA256
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if !s.headerCanon.valid() || !s.bodyCanon.valid() {
+		return nil, ErrInvalidCanonicalization
+	}
+
+	return
+}
+
+// Sign 对邮件签名，返回在开头添加了 `DKIM-Signature:` 邮件头的邮件。
+// 邮件中单独的 LF 换行符会被转换为 CRLF。
+func (s *Signer) Sign(msg []byte) (signed []byte, err error) {
+	msg = normalizeLineEndings(msg)
+	headers, body := splitMessage(msg)
+
+	// From 总是第一个签名。
+	names := []string{"From"}
+	for _, name := range s.headers {
+		if !strings.EqualFold(name, "From") {
+			names = append(names, name)
+		}
+	}
+
+	picked := pickHeaders(headers, names)
+	if len(picked) == 0 || !strings.EqualFold(picked[0].name, "From") {
+		return nil, ErrMissingFromHeader
+	}
+
+	names = names[:0]
+	for _, h := range picked {
+		names = append(names, h.name)
+	}
+
+	bh := sha256.Sum256(canonicalizeBody(body, s.bodyCanon))
+
+	ts := now().Unix()
+
+	tags := []string{
+		"v=1",
+		"a=" + s.algorithm,
+		"c=" + string(s.headerCanon) + "/" + string(s.bodyCanon),
+		"d=" + s.domain,
+		"s=" + s.selector,
+		"t=" + strconv.FormatInt(ts, 10),
+	}
+
+	if s.expiration > 0 {
+		tags = append(tags, "x="+strconv.FormatInt(ts+int64(s.expiration.Seconds()), 10))
+	}
+
+	if s.identity != "" {
+		tags = append(tags, "i="+s.identity)
+	}
+
+	tags = append(tags,
+		"h="+strings.Join(names, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(bh[:]),
+		"b=",
+	)
+
+	// 每个标签单独一行，避免超过 78 个字符的建议行长度。
+	sigHeader := headerName + ": " + strings.Join(tags, ";\r\n\t")
+
+	digest := headersDigest(picked, sigHeader, s.headerCanon)
+
+	var sig []byte
+	switch s.algorithm {
+	case AlgorithmEd25519SHA256:
+		// RFC 8463: Ed25519 对 SHA-256 摘要签名，而不是直接对数据签名。
+		sig, err = s.key.Sign(rand.Reader, digest, crypto.Hash(0))
+	default:
+		sig, err = s.key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("dkim: failed to sign message: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(sigHeader) + len(msg) + 512)
+	buf.WriteString(sigHeader)
+	buf.WriteString(base64.StdEncoding.EncodeToString(sig))
+	buf.Write(crlf)
+	buf.Write(msg)
+
+	signed = buf.Bytes()
+
+	return
+}
+
+// pickHeaders 按 names 的顺序返回要签名（或校验）的邮件头。同名邮件头出现多次时，
+// 每次从下往上取一个尚未使用的邮件头；不存在的邮件头被忽略（RFC 6376 第 5.4.2 节）。
+func pickHeaders(headers []header, names []string) (picked []header) {
+	used := make([]bool, len(headers))
+
+	for _, name := range names {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				picked = append(picked, headers[i])
+
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// headersDigest 计算要签名（或校验）的邮件头的 SHA-256 摘要。
+// sigHeader 是 `b=` 标签值为空的 DKIM-Signature 邮件头，不带末尾的 CRLF。
+func headersDigest(headers []header, sigHeader string, c Canonicalization) []byte {
+	h := sha256.New()
+
+	for _, hdr := range headers {
+		h.Write([]byte(canonicalizeHeader(hdr.raw, c)))
+	}
+
+	sig := canonicalizeHeader(sigHeader+"\r\n", c)
+	h.Write([]byte(strings.TrimSuffix(sig, "\r\n")))
+
+	return h.Sum(nil)
+}
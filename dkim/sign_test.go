@@ -0,0 +1,162 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+const testMessage = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject:  Is dinner\r\n ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+// splitSignature 返回签名后邮件中的 DKIM-Signature 邮件头（不含 b= 标签的值）和 b= 标签的值。
+func splitSignature(t *testing.T, signed []byte) (sigHeader string, sig []byte) {
+	t.Helper()
+
+	s := string(signed)
+	assert.True(t, strings.HasPrefix(s, "DKIM-Signature: "))
+
+	line, _, _ := strings.Cut(s, "\r\nFrom: ")
+
+	// b= 是最后一个标签。
+	i := strings.LastIndex(line, "\tb=")
+	assert.True(t, i > 0)
+
+	sigHeader = line[:i+len("\tb=")]
+	b64 := line[i+len("\tb="):]
+
+	sig, err := base64.StdEncoding.DecodeString(b64)
+	assert.Nil(t, err)
+
+	return
+}
+
+func TestSignRSA(t *testing.T) {
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer func() { now = time.Now }()
+
+	privateKey, publicKey, err := dnsutils.GenDKIMKey(1024)
+	assert.Nil(t, err)
+
+	s, err := NewSigner("football.example.com", "brisbane", privateKey,
+		WithSignedHeaders("To", "Subject", "Date", "Message-ID", "Reply-To"),
+		WithExpiration(time.Hour),
+	)
+	assert.Nil(t, err)
+
+	signed, err := s.Sign([]byte(testMessage))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(signed), "\r\n"+testMessage))
+
+	sigHeader, sig := splitSignature(t, signed)
+	assert.Equal(t, "DKIM-Signature: v=1;\r\n\ta=rsa-sha256;\r\n\tc=relaxed/relaxed;\r\n\td=football.example.com;\r\n\ts=brisbane;\r\n\t"+
+		"t=1700000000;\r\n\tx=1700003600;\r\n\th=From:To:Subject:Date:Message-ID;\r\n\t"+
+		"bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n\tb=", sigHeader)
+
+	// 按 relaxed 规范化后的邮件头，Reply-To 不存在，不参与签名。
+	data := "from:Joe SixPack <joe@football.example.com>\r\n" +
+		"to:Suzie Q <suzie@shopping.example.net>\r\n" +
+		"subject:Is dinner ready?\r\n" +
+		"date:Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"message-id:<20030712040037.46341.5F8J@football.example.com>\r\n" +
+		"dkim-signature:v=1; a=rsa-sha256; c=relaxed/relaxed; d=football.example.com; s=brisbane; " +
+		"t=1700000000; x=1700003600; h=From:To:Subject:Date:Message-ID; " +
+		"bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=; b="
+	digest := sha256.Sum256([]byte(data))
+
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	assert.Nil(t, err)
+	pub, err := x509.ParsePKIXPublicKey(der)
+	assert.Nil(t, err)
+
+	assert.Nil(t, rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sig))
+}
+
+func TestSignEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.Nil(t, err)
+	privateKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	s, err := NewSigner("football.example.com", "brisbane", privateKeyPEM,
+		WithSignedHeaders("Subject"),
+		WithCanonicalization(CanonicalizationSimple, CanonicalizationSimple),
+		WithIdentity("joe@football.example.com"),
+	)
+	assert.Nil(t, err)
+
+	// LF 换行符被转换为 CRLF。
+	signed, err := s.Sign([]byte(strings.ReplaceAll(testMessage, "\r\n", "\n")))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(signed), "\r\n"+testMessage))
+
+	sigHeader, sig := splitSignature(t, signed)
+	assert.Contains(t, sigHeader, "a=ed25519-sha256;")
+	assert.Contains(t, sigHeader, "c=simple/simple;")
+	assert.Contains(t, sigHeader, "i=joe@football.example.com;")
+	assert.Contains(t, sigHeader, "h=From:Subject;")
+	assert.Contains(t, sigHeader, "bh=4bLNXImK9drULnmePzZNEBleUanJCX5PIsDIFoH4KTQ=;")
+
+	// simple 规范化不修改邮件头。
+	data := "From: Joe SixPack <joe@football.example.com>\r\n" +
+		"Subject:  Is dinner\r\n ready?\r\n" +
+		sigHeader
+	digest := sha256.Sum256([]byte(data))
+
+	assert.True(t, ed25519.Verify(pub, digest[:], sig))
+}
+
+func TestSignRepeatedHeaders(t *testing.T) {
+	headers, _ := splitMessage([]byte("Received: 1\r\nFrom: a@example.com\r\nReceived: 2\r\nReceived: 3\r\n\r\n"))
+
+	// 同名邮件头从下往上选取。
+	picked := pickHeaders(headers, []string{"From", "Received", "Received", "X-Missing", "from"})
+	assert.Equal(t, []header{
+		{name: "From", raw: "From: a@example.com\r\n"},
+		{name: "Received", raw: "Received: 3\r\n"},
+		{name: "Received", raw: "Received: 2\r\n"},
+	}, picked)
+}
+
+func TestSignErrors(t *testing.T) {
+	privateKey, _, err := dnsutils.GenDKIMKey(1024)
+	assert.Nil(t, err)
+
+	_, err = NewSigner("", "dkim", privateKey)
+	assert.ErrorIs(t, err, ErrInvalidSigningParameters)
+
+	_, err = NewSigner("example.com", "dkim", "not a key")
+	assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+
+	_, err = NewSigner("example.com", "dkim", privateKey, WithCanonicalization("nowsp", CanonicalizationSimple))
+	assert.ErrorIs(t, err, ErrInvalidCanonicalization)
+
+	s, err := NewSigner("example.com", "dkim", privateKey)
+	assert.Nil(t, err)
+
+	_, err = s.Sign([]byte("Subject: no from\r\n\r\nbody\r\n"))
+	assert.ErrorIs(t, err, ErrMissingFromHeader)
+}
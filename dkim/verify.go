@@ -0,0 +1,526 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+// Status 是 DKIM 签名的校验结果，取值与 Authentication-Results 邮件头（RFC 8601）相同。
+type Status string
+
+const (
+	StatusPass      Status = "pass"
+	StatusFail      Status = "fail"
+	StatusNeutral   Status = "neutral"
+	StatusTempError Status = "temperror"
+	StatusPermError Status = "permerror"
+)
+
+// DefaultMinRSAKeyBits 是允许的最短 RSA 公钥长度（RFC 8301 第 3.2 节）。
+const DefaultMinRSAKeyBits = 1024
+
+var (
+	ErrMalformedSignature   = errors.New("dkim: malformed signature")
+	ErrUnsupportedAlgorithm = errors.New("dkim: unsupported algorithm")
+	ErrSignatureExpired     = errors.New("dkim: signature expired")
+	ErrFromNotSigned        = errors.New("dkim: From header is not signed")
+	ErrIdentityMismatch     = errors.New("dkim: identity is not in the signing domain")
+	ErrKeyNotFound          = errors.New("dkim: public key not found")
+	ErrKeyRevoked           = errors.New("dkim: public key revoked")
+	ErrKeyUnavailable       = errors.New("dkim: public key unavailable")
+	ErrInvalidPublicKey     = errors.New("dkim: invalid public key")
+	ErrKeyTooShort          = errors.New("dkim: public key too short")
+	ErrBodyHashMismatch     = errors.New("dkim: body hash did not verify")
+	ErrSignatureMismatch    = errors.New("dkim: signature did not verify")
+)
+
+// KeyLookupFunc 查询 `<selector>._domainkey.<domain>` 的 DKIM 公钥 TXT 记录，
+// 函数签名与 dnsutils.LookupDKIM 相同：
+//
+//   - 记录不存在时 notfound 为 true；
+//   - 查询失败（例如 DNS 服务器超时）时 errStr 为错误信息。
+type KeyLookupFunc func(domain, selector string) (notfound bool, records []string, errStr string)
+
+// Result 是一个 DKIM-Signature 邮件头的校验结果。
+type Result struct {
+	Status    Status
+	Domain    string // `d=`
+	Selector  string // `s=`
+	Identity  string // `i=`，默认为 `@` + Domain
+	Algorithm string // `a=`
+
+	// Testing 表示公钥记录带有 `t=y` 标记，即签名者在测试 DKIM，
+	// 校验失败时不应与未签名的邮件区别对待。
+	Testing bool
+
+	// Err 是校验未通过的原因，Status 为 StatusPass 时为 nil。
+	Err error
+}
+
+// Verifier 用于校验邮件的 DKIM 签名，可以并发使用。
+type Verifier struct {
+	lookup        KeyLookupFunc
+	minRSAKeyBits int
+}
+
+type VerifierOption func(v *Verifier)
+
+// WithKeyLookup 指定查询公钥的函数，默认为 dnsutils.LookupDKIM。
+func WithKeyLookup(f KeyLookupFunc) VerifierOption {
+	return func(v *Verifier) {
+		v.lookup = f
+	}
+}
+
+// WithMinRSAKeyBits 指定允许的最短 RSA 公钥长度，默认为 DefaultMinRSAKeyBits。
+func WithMinRSAKeyBits(bits int) VerifierOption {
+	return func(v *Verifier) {
+		v.minRSAKeyBits = bits
+	}
+}
+
+func NewVerifier(opts ...VerifierOption) *Verifier {
+	v := &Verifier{
+		lookup:        dnsutils.LookupDKIM,
+		minRSAKeyBits: DefaultMinRSAKeyBits,
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+// Verify 使用默认的 Verifier 校验邮件的所有 DKIM 签名，参考 Verifier.Verify。
+func Verify(msg []byte) []Result {
+	return NewVerifier().Verify(msg)
+}
+
+// Verify 校验邮件中的所有 DKIM-Signature 邮件头，按邮件头出现的顺序返回每个签名的
+// 校验结果。邮件没有签名时返回空 slice（即 Authentication-Results 中的 `dkim=none`）。
+func (v *Verifier) Verify(msg []byte) (results []Result) {
+	msg = normalizeLineEndings(msg)
+	headers, body := splitMessage(msg)
+
+	for _, h := range headers {
+		if strings.EqualFold(h.name, headerName) {
+			results = append(results, v.verifySignature(h, headers, body))
+		}
+	}
+
+	return
+}
+
+// signature 是解析后的 DKIM-Signature 邮件头。
+type signature struct {
+	algorithm   string
+	headerCanon Canonicalization
+	bodyCanon   Canonicalization
+	domain      string
+	selector    string
+	identity    string
+	headers     []string
+	bodyHash    []byte
+	sig         []byte
+	bodyLength  int64 // `l=`，-1 表示没有此标签
+	expiration  int64 // `x=`，0 表示没有此标签
+}
+
+func (v *Verifier) verifySignature(h header, headers []header, body []byte) (r Result) {
+	sig, err := parseSignature(h.raw)
+	if sig != nil {
+		r.Domain = sig.domain
+		r.Selector = sig.selector
+		r.Identity = sig.identity
+		r.Algorithm = sig.algorithm
+	}
+
+	if err != nil {
+		r.Status, r.Err = StatusPermError, err
+
+		return
+	}
+
+	if sig.algorithm != AlgorithmRSASHA256 && sig.algorithm != AlgorithmEd25519SHA256 {
+		r.Status, r.Err = StatusNeutral, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, sig.algorithm)
+
+		return
+	}
+
+	if sig.expiration > 0 && now().Unix() > sig.expiration {
+		r.Status, r.Err = StatusNeutral, ErrSignatureExpired
+
+		return
+	}
+
+	key, err := v.lookupKey(sig)
+	if key != nil {
+		r.Testing = key.testing
+	}
+
+	if err != nil {
+		r.Status = StatusPermError
+		if errors.Is(err, ErrKeyUnavailable) {
+			r.Status = StatusTempError
+		}
+
+		r.Err = err
+
+		return
+	}
+
+	// 校验邮件正文。
+	canonBody := canonicalizeBody(body, sig.bodyCanon)
+	if sig.bodyLength >= 0 {
+		if sig.bodyLength > int64(len(canonBody)) {
+			r.Status, r.Err = StatusPermError, fmt.Errorf("%w: body length is longer than the body", ErrMalformedSignature)
+
+			return
+		}
+
+		canonBody = canonBody[:sig.bodyLength]
+	}
+
+	bh := sha256.Sum256(canonBody)
+	if !bytes.Equal(bh[:], sig.bodyHash) {
+		r.Status, r.Err = StatusFail, ErrBodyHashMismatch
+
+		return
+	}
+
+	// 校验邮件头。
+	sigHeader := stripSignatureValue(strings.TrimSuffix(h.raw, "\r\n"))
+	digest := headersDigest(pickHeaders(headers, sig.headers), sigHeader, sig.headerCanon)
+
+	switch pub := key.publicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig.sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, sig.sig) {
+			err = ErrSignatureMismatch
+		}
+	}
+
+	if err != nil {
+		r.Status, r.Err = StatusFail, ErrSignatureMismatch
+
+		return
+	}
+
+	r.Status = StatusPass
+
+	return
+}
+
+// parseSignature 解析 DKIM-Signature 邮件头（RFC 6376 第 3.5 节）。
+// 即使返回错误，也会尽可能返回已解析的 signature，用于填充 Result。
+func parseSignature(raw string) (sig *signature, err error) {
+	_, value, _ := strings.Cut(raw, ":")
+
+	tags, err := parseTags(value)
+	if err != nil {
+		return
+	}
+
+	sig = &signature{
+		algorithm:  strings.ToLower(tags["a"]),
+		domain:     strings.ToLower(tags["d"]),
+		selector:   tags["s"],
+		identity:   tags["i"],
+		bodyLength: -1,
+	}
+
+	if sig.identity == "" && sig.domain != "" {
+		sig.identity = "@" + sig.domain
+	}
+
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, found := tags[name]; !found {
+			err = fmt.Errorf("%w: missing required tag %s=", ErrMalformedSignature, name)
+
+			return
+		}
+	}
+
+	if tags["v"] != "1" {
+		err = fmt.Errorf("%w: unsupported version %q", ErrMalformedSignature, tags["v"])
+
+		return
+	}
+
+	sig.headerCanon, sig.bodyCanon, err = parseCanonicalization(tags["c"])
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrMalformedSignature, err)
+
+		return
+	}
+
+	sig.bodyHash, err = decodeBase64(tags["bh"])
+	if err != nil {
+		err = fmt.Errorf("%w: invalid bh= tag: %w", ErrMalformedSignature, err)
+
+		return
+	}
+
+	sig.sig, err = decodeBase64(tags["b"])
+	if err != nil {
+		err = fmt.Errorf("%w: invalid b= tag: %w", ErrMalformedSignature, err)
+
+		return
+	}
+
+	for name := range strings.SplitSeq(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			sig.headers = append(sig.headers, name)
+		}
+	}
+
+	fromSigned := false
+	for _, name := range sig.headers {
+		if strings.EqualFold(name, "From") {
+			fromSigned = true
+		}
+	}
+
+	if !fromSigned {
+		err = ErrFromNotSigned
+
+		return
+	}
+
+	// i= 的域名必须与 d= 相同，或是其子域名。
+	_, idDomain, _ := strings.Cut(sig.identity, "@")
+	idDomain = strings.ToLower(idDomain)
+	if idDomain != sig.domain && !strings.HasSuffix(idDomain, "."+sig.domain) {
+		err = ErrIdentityMismatch
+
+		return
+	}
+
+	if l, found := tags["l"]; found {
+		sig.bodyLength, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || sig.bodyLength < 0 {
+			err = fmt.Errorf("%w: invalid l= tag", ErrMalformedSignature)
+
+			return
+		}
+	}
+
+	var ts int64
+	if t, found := tags["t"]; found {
+		ts, err = strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("%w: invalid t= tag", ErrMalformedSignature)
+
+			return
+		}
+	}
+
+	if x, found := tags["x"]; found {
+		sig.expiration, err = strconv.ParseInt(x, 10, 64)
+		if err != nil || sig.expiration <= ts {
+			err = fmt.Errorf("%w: invalid x= tag", ErrMalformedSignature)
+
+			return
+		}
+	}
+
+	return
+}
+
+// publicKey 是解析后的 DKIM 公钥记录。
+type publicKey struct {
+	publicKey crypto.PublicKey
+	testing   bool // t=y
+	strict    bool // t=s
+}
+
+// lookupKey 查询并解析签名使用的公钥（RFC 6376 第 3.6.1 节）。
+func (v *Verifier) lookupKey(sig *signature) (key *publicKey, err error) {
+	notfound, records, errStr := v.lookup(sig.domain, sig.selector)
+	if errStr != "" {
+		err = fmt.Errorf("%w: %s", ErrKeyUnavailable, errStr)
+
+		return
+	}
+
+	if notfound || len(records) == 0 {
+		err = ErrKeyNotFound
+
+		return
+	}
+
+	key, err = parsePublicKey(records[0])
+	if err != nil {
+		return
+	}
+
+	wantType := "rsa"
+	if sig.algorithm == AlgorithmEd25519SHA256 {
+		wantType = "ed25519"
+	}
+
+	switch pub := key.publicKey.(type) {
+	case *rsa.PublicKey:
+		if wantType != "rsa" {
+			err = fmt.Errorf("%w: key type does not match algorithm %s", ErrInvalidPublicKey, sig.algorithm)
+		} else if pub.N.BitLen() < v.minRSAKeyBits {
+			err = fmt.Errorf("%w: %d bits", ErrKeyTooShort, pub.N.BitLen())
+		}
+	case ed25519.PublicKey:
+		if wantType != "ed25519" {
+			err = fmt.Errorf("%w: key type does not match algorithm %s", ErrInvalidPublicKey, sig.algorithm)
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	if key.strict && !strings.EqualFold(sig.identity[strings.Index(sig.identity, "@")+1:], sig.domain) {
+		err = ErrIdentityMismatch
+	}
+
+	return
+}
+
+// parsePublicKey 解析 DKIM 公钥 TXT 记录，例如 `v=DKIM1; k=rsa; p=MIIBIjANBgkq...`。
+func parsePublicKey(record string) (key *publicKey, err error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	if v, found := tags["v"]; found && v != "DKIM1" {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidPublicKey, v)
+	}
+
+	p, found := tags["p"]
+	if !found {
+		return nil, fmt.Errorf("%w: missing p= tag", ErrInvalidPublicKey)
+	}
+
+	if p == "" {
+		return nil, ErrKeyRevoked
+	}
+
+	der, err := decodeBase64(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	key = &publicKey{}
+
+	for flag := range strings.SplitSeq(tags["t"], ":") {
+		switch strings.TrimSpace(flag) {
+		case "y":
+			key.testing = true
+		case "s":
+			key.strict = true
+		}
+	}
+
+	switch k := strings.ToLower(tags["k"]); k {
+	case "", "rsa":
+		var pub any
+		pub, err = x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			// 部分记录使用 PKCS #1 格式（RSAPublicKey）。
+			pub, err = x509.ParsePKCS1PublicKey(der)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not a RSA key", ErrInvalidPublicKey)
+		}
+
+		key.publicKey = rsaPub
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid ed25519 key size %d", ErrInvalidPublicKey, len(der))
+		}
+
+		key.publicKey = ed25519.PublicKey(der)
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %q", ErrInvalidPublicKey, k)
+	}
+
+	return
+}
+
+// parseTags 解析 `tag=value; tag=value` 格式的标签列表（RFC 6376 第 3.2 节），
+// 标签名称区分大小写，重复的标签视为错误。
+func parseTags(s string) (tags map[string]string, err error) {
+	tags = make(map[string]string)
+
+	for spec := range strings.SplitSeq(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(spec, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: invalid tag %q", ErrMalformedSignature, spec)
+		}
+
+		name = strings.TrimSpace(name)
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("%w: duplicate tag %s=", ErrMalformedSignature, name)
+		}
+
+		tags[name] = strings.TrimSpace(unfold(value))
+	}
+
+	return
+}
+
+// unfold 删除折行的 CRLF。
+func unfold(s string) string {
+	return strings.NewReplacer("\r\n", "", "\n", "").Replace(s)
+}
+
+// decodeBase64 解码可能包含空白字符（折行）的 base64 字符串。
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// stripSignatureValue 删除 DKIM-Signature 邮件头中 `b=` 标签的值（包括周围的空白字符），
+// 用于计算签名的摘要（RFC 6376 第 3.7 节）。
+func stripSignatureValue(raw string) string {
+	name, value, _ := strings.Cut(raw, ":")
+
+	specs := strings.Split(value, ";")
+	for i, spec := range specs {
+		tag, _, found := strings.Cut(spec, "=")
+		if found && strings.TrimSpace(unfold(tag)) == "b" {
+			specs[i] = spec[:len(tag)+1]
+		}
+	}
+
+	return name + ":" + strings.Join(specs, ";")
+}
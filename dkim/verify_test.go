@@ -0,0 +1,244 @@
+package dkim
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+// rfc8463Message 是 RFC 8463 附录 A.3 中使用 Ed25519-SHA256 签名的示例邮件。
+const rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+const rfc8463Key = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+// fakeLookup 返回一个 KeyLookupFunc，records 的 key 为 `<selector>._domainkey.<domain>`。
+func fakeLookup(records map[string]string) KeyLookupFunc {
+	return func(domain, selector string) (notfound bool, txts []string, errStr string) {
+		name := selector + "._domainkey." + domain
+		if name == "fail._domainkey."+domain {
+			return false, nil, "i/o timeout"
+		}
+
+		txt, found := records[name]
+		if !found {
+			return true, nil, ""
+		}
+
+		return false, []string{txt}, ""
+	}
+}
+
+func TestVerifyRFC8463(t *testing.T) {
+	v := NewVerifier(WithKeyLookup(fakeLookup(map[string]string{
+		"brisbane._domainkey.football.example.com": rfc8463Key,
+	})))
+
+	results := v.Verify([]byte(rfc8463Message))
+	assert.Equal(t, []Result{{
+		Status:    StatusPass,
+		Domain:    "football.example.com",
+		Selector:  "brisbane",
+		Identity:  "@football.example.com",
+		Algorithm: AlgorithmEd25519SHA256,
+	}}, results)
+
+	// LF 换行符。
+	results = v.Verify([]byte(strings.ReplaceAll(rfc8463Message, "\r\n", "\n")))
+	assert.Equal(t, StatusPass, results[0].Status)
+
+	// 修改邮件正文。
+	results = v.Verify([]byte(strings.Replace(rfc8463Message, "hungry", "thirsty", 1)))
+	assert.Equal(t, StatusFail, results[0].Status)
+	assert.ErrorIs(t, results[0].Err, ErrBodyHashMismatch)
+
+	// relaxed 规范化允许修改空白字符。
+	results = v.Verify([]byte(strings.Replace(rfc8463Message, "Subject: Is dinner", "Subject:  Is \t dinner", 1)))
+	assert.Equal(t, StatusPass, results[0].Status)
+
+	// 修改已签名的邮件头。
+	results = v.Verify([]byte(strings.Replace(rfc8463Message, "Subject: Is dinner", "Subject: Is lunch", 1)))
+	assert.Equal(t, StatusFail, results[0].Status)
+	assert.ErrorIs(t, results[0].Err, ErrSignatureMismatch)
+
+	// 添加已签名（oversigned）的邮件头。
+	results = v.Verify([]byte(strings.Replace(rfc8463Message, "\r\n\r\nHi.", "\r\nSubject: spam\r\n\r\nHi.", 1)))
+	assert.Equal(t, StatusFail, results[0].Status)
+
+	// 添加未签名的邮件头。
+	results = v.Verify([]byte(strings.Replace(rfc8463Message, "\r\n\r\nHi.", "\r\nX-Spam: no\r\n\r\nHi.", 1)))
+	assert.Equal(t, StatusPass, results[0].Status)
+}
+
+func TestVerifySigned(t *testing.T) {
+	rsaKey, rsaPub, err := dnsutils.GenDKIMKey(1024)
+	assert.Nil(t, err)
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	assert.Nil(t, err)
+	edKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	v := NewVerifier(WithKeyLookup(fakeLookup(map[string]string{
+		"rsa._domainkey.football.example.com": "v=DKIM1; k=rsa; p=" + rsaPub,
+		"ed._domainkey.football.example.com":  "v=DKIM1; k=ed25519; t=y; p=" + base64.StdEncoding.EncodeToString(edPub),
+	})))
+
+	canons := []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed}
+
+	for _, hc := range canons {
+		for _, bc := range canons {
+			rsaSigner, err := NewSigner("football.example.com", "rsa", rsaKey, WithCanonicalization(hc, bc))
+			assert.Nil(t, err)
+
+			edSigner, err := NewSigner("football.example.com", "ed", edKey,
+				WithCanonicalization(hc, bc),
+				WithIdentity("joe@sub.football.example.com"),
+			)
+			assert.Nil(t, err)
+
+			signed, err := rsaSigner.Sign([]byte(testMessage))
+			assert.Nil(t, err)
+
+			signed, err = edSigner.Sign(signed)
+			assert.Nil(t, err)
+
+			results := v.Verify(signed)
+			assert.Len(t, results, 2)
+
+			// Ed25519 签名在前。
+			assert.Equal(t, StatusPass, results[0].Status, "%s/%s: %v", hc, bc, results[0].Err)
+			assert.Equal(t, AlgorithmEd25519SHA256, results[0].Algorithm)
+			assert.Equal(t, "joe@sub.football.example.com", results[0].Identity)
+			assert.True(t, results[0].Testing)
+
+			assert.Equal(t, StatusPass, results[1].Status, "%s/%s: %v", hc, bc, results[1].Err)
+			assert.Equal(t, AlgorithmRSASHA256, results[1].Algorithm)
+			assert.False(t, results[1].Testing)
+		}
+	}
+
+	// RSA 公钥长度不足。
+	signer, err := NewSigner("football.example.com", "rsa", rsaKey)
+	assert.Nil(t, err)
+
+	signed, err := signer.Sign([]byte(testMessage))
+	assert.Nil(t, err)
+
+	results := NewVerifier(
+		WithKeyLookup(fakeLookup(map[string]string{"rsa._domainkey.football.example.com": "p=" + rsaPub})),
+		WithMinRSAKeyBits(2048),
+	).Verify(signed)
+	assert.Equal(t, StatusPermError, results[0].Status)
+	assert.ErrorIs(t, results[0].Err, ErrKeyTooShort)
+
+	// 签名过期。
+	signer, err = NewSigner("football.example.com", "rsa", rsaKey, WithExpiration(time.Hour))
+	assert.Nil(t, err)
+
+	signed, err = signer.Sign([]byte(testMessage))
+	assert.Nil(t, err)
+
+	now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { now = time.Now }()
+
+	results = v.Verify(signed)
+	assert.Equal(t, StatusNeutral, results[0].Status)
+	assert.ErrorIs(t, results[0].Err, ErrSignatureExpired)
+}
+
+func TestVerifyErrors(t *testing.T) {
+	v := NewVerifier(WithKeyLookup(fakeLookup(map[string]string{
+		"brisbane._domainkey.football.example.com": rfc8463Key,
+		"revoked._domainkey.football.example.com":  "v=DKIM1; k=ed25519; p=",
+		"rsa._domainkey.football.example.com":      "v=DKIM1; k=rsa; p=" + strings.TrimPrefix(rfc8463Key, "v=DKIM1; k=ed25519; p="),
+		"strict._domainkey.football.example.com":   "v=DKIM1; k=ed25519; t=s; " + strings.TrimPrefix(rfc8463Key, "v=DKIM1; k=ed25519; "),
+	})))
+
+	assert.Empty(t, v.Verify([]byte(testMessage)))
+
+	tests := []struct {
+		from, to string
+		status   Status
+		err      error
+	}{
+		{"s=brisbane", "s=missing", StatusPermError, ErrKeyNotFound},
+		{"s=brisbane", "s=fail", StatusTempError, ErrKeyUnavailable},
+		{"s=brisbane", "s=revoked", StatusPermError, ErrKeyRevoked},
+		{"s=brisbane", "s=rsa", StatusPermError, ErrInvalidPublicKey},
+		{"i=@football.example.com;\r\n q=dns/txt; s=brisbane", "i=@sub.football.example.com;\r\n q=dns/txt; s=strict", StatusPermError, ErrIdentityMismatch},
+		{"i=@football.example.com", "i=joe@sub.football.example.com", StatusFail, ErrSignatureMismatch},
+		{"i=@football.example.com", "i=@example.com", StatusPermError, ErrIdentityMismatch},
+		{"a=ed25519-sha256", "a=rsa-sha1", StatusNeutral, ErrUnsupportedAlgorithm},
+		{"h=from : to :\r\n subject : date : message-id : from", "h=to :\r\n subject : date : message-id : to", StatusPermError, ErrFromNotSigned},
+		{"v=1", "v=2", StatusPermError, ErrMalformedSignature},
+		{"c=relaxed/relaxed", "c=relaxed/nowsp", StatusPermError, ErrMalformedSignature},
+		{"d=football.example.com; ", "", StatusPermError, ErrMalformedSignature},
+		{"q=dns/txt;", "q=dns/txt; q=dns/txt;", StatusPermError, ErrMalformedSignature},
+		{"t=1528637909;", "t=1528637909; l=1000;", StatusPermError, ErrMalformedSignature},
+		{"t=1528637909;", "t=1528637909; x=1528637900;", StatusPermError, ErrMalformedSignature},
+	}
+
+	for _, tt := range tests {
+		msg := strings.Replace(rfc8463Message, tt.from, tt.to, 1)
+		results := v.Verify([]byte(msg))
+
+		if assert.Len(t, results, 1, tt.to) {
+			assert.Equal(t, tt.status, results[0].Status, tt.to)
+			assert.NotNil(t, results[0].Err, tt.to)
+
+			if tt.err != nil {
+				assert.ErrorIs(t, results[0].Err, tt.err, tt.to)
+			}
+		}
+	}
+}
+
+func TestStripSignatureValue(t *testing.T) {
+	assert.Equal(t,
+		"DKIM-Signature: v=1; bh=abc=;\r\n b=",
+		stripSignatureValue("DKIM-Signature: v=1; bh=abc=;\r\n b=xyz\r\n uvw=="))
+
+	assert.Equal(t,
+		"DKIM-Signature: v=1; b=; d=example.com",
+		stripSignatureValue("DKIM-Signature: v=1; b=xyz; d=example.com"))
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags(" v=DKIM1;\r\n\tk = rsa ; p=abc\r\n def;")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"v": "DKIM1", "k": "rsa", "p": "abc def"}, tags)
+
+	_, err = parseTags("v=DKIM1; v=DKIM1")
+	assert.ErrorIs(t, err, ErrMalformedSignature)
+
+	_, err = parseTags("v=DKIM1; invalid")
+	assert.ErrorIs(t, err, ErrMalformedSignature)
+}
@@ -0,0 +1,379 @@
+package dmarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/iredmail/goutils/dkim"
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+// Result 是 DMARC 校验结果，取值与 Authentication-Results 邮件头（RFC 8601）相同。
+type Result string
+
+const (
+	ResultPass      Result = "pass"
+	ResultFail      Result = "fail"
+	ResultNone      Result = "none"
+	ResultTempError Result = "temperror"
+	ResultPermError Result = "permerror"
+)
+
+const defaultTimeout = 10 * time.Second
+
+var (
+	ErrNoRecord        = errors.New("dmarc: no DMARC record published")
+	ErrMultipleRecords = errors.New("dmarc: multiple DMARC records published")
+	ErrTemporary       = errors.New("dmarc: temporary DNS error")
+
+	regxDMARC = regexp.MustCompile(`(?i)^v\s*=\s*DMARC1\s*(;|$)`)
+
+	// randIntN 用于 pct= 抽样，测试时可替换。
+	randIntN = rand.IntN
+)
+
+type options struct {
+	resolver dnsutils.Resolver
+	timeout  time.Duration
+}
+
+type Option func(o *options)
+
+// WithResolver 指定 DNS 查询使用的 Resolver，默认为 net.DefaultResolver。
+func WithResolver(r dnsutils.Resolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithTimeout 指定 DNS 查询的总超时时间，默认为 10 秒。
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		resolver: net.DefaultResolver,
+		timeout:  defaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// OrganizationalDomain 使用内置的 Public Suffix List（golang.org/x/net/publicsuffix）
+// 返回域名的组织域名（RFC 7489 第 3.2 节），例如 `mail.example.co.uk` 返回 `example.co.uk`。
+// 域名本身是公共后缀时返回域名本身。
+func OrganizationalDomain(domain string) string {
+	domain = normalizeDomain(domain)
+
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return org
+}
+
+// Aligned 检查两个域名在指定的对齐模式下是否对齐（RFC 7489 第 3.1 节）：
+// strict 模式要求域名完全相同，relaxed 模式要求组织域名相同。
+func Aligned(a, b string, mode Alignment) bool {
+	a, b = normalizeDomain(a), normalizeDomain(b)
+	if a == "" || b == "" {
+		return false
+	}
+
+	if mode == AlignmentStrict {
+		return a == b
+	}
+
+	return OrganizationalDomain(a) == OrganizationalDomain(b)
+}
+
+// Lookup 查询域名的 DMARC 记录（RFC 7489 第 6.6.3 节）：先查询 `_dmarc.<domain>`，
+// 没有记录时再查询组织域名的 `_dmarc.<组织域名>`。policyDomain 是找到记录的域名。
+//
+// 没有记录时返回 ErrNoRecord，DNS 查询失败时返回 ErrTemporary。有多条记录时返回
+// ErrMultipleRecords，并且不再查询组织域名。记录有语法错误时同时返回 r 和 Parse 的错误。
+func Lookup(domain string, opts ...Option) (r *Record, policyDomain string, err error) {
+	o := newOptions(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	return lookup(ctx, o.resolver, domain)
+}
+
+func lookup(ctx context.Context, resolver dnsutils.Resolver, domain string) (r *Record, policyDomain string, err error) {
+	domain = normalizeDomain(domain)
+
+	candidates := []string{domain}
+	if org := OrganizationalDomain(domain); org != domain {
+		candidates = append(candidates, org)
+	}
+
+	for _, d := range candidates {
+		var txt string
+		txt, err = lookupRecord(ctx, resolver, d)
+		if errors.Is(err, ErrNoRecord) {
+			continue
+		}
+
+		if errors.Is(err, ErrMultipleRecords) {
+			policyDomain = d
+		}
+
+		if err != nil {
+			return
+		}
+
+		policyDomain = d
+		r, err = Parse(txt)
+
+		return
+	}
+
+	return
+}
+
+// lookupRecord 查询 `_dmarc.<domain>` 的 DMARC 记录。有多条记录时返回 ErrMultipleRecords。
+func lookupRecord(ctx context.Context, resolver dnsutils.Resolver, domain string) (txt string, err error) {
+	txts, err := resolver.LookupTXT(ctx, "_dmarc."+domain)
+	if err != nil {
+		if dnsutils.IsNotFound(err) {
+			return "", ErrNoRecord
+		}
+
+		return "", fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+
+	var records []string
+	for _, t := range txts {
+		if regxDMARC.MatchString(t) {
+			records = append(records, t)
+		}
+	}
+
+	switch len(records) {
+	case 0:
+		err = ErrNoRecord
+	case 1:
+		txt = records[0]
+	default:
+		err = ErrMultipleRecords
+	}
+
+	return
+}
+
+// SPFResult 是参与 DMARC 校验的 SPF 结果。
+type SPFResult struct {
+	// Domain 是 SPF 校验的域名，即 MAIL FROM 地址的域名（MAIL FROM 为空时是 HELO 主机名）。
+	Domain string
+	Result dnsutils.SPFResult
+}
+
+// Evaluation 是 DMARC 校验的详细结果。
+type Evaluation struct {
+	Result Result
+
+	// Disposition 是邮件的最终处理方式，考虑了 pct= 抽样。Result 不是 fail 时为 PolicyNone。
+	Disposition Policy
+
+	// Policy 是适用于 From 域名的策略（p=、sp= 或 np=），未考虑 pct= 抽样。
+	Policy Policy
+
+	// SampledOut 表示邮件因 pct= 抽样未被应用策略，Disposition 降低了一级。
+	SampledOut bool
+
+	FromDomain           string
+	OrganizationalDomain string
+	PolicyDomain         string // 找到 DMARC 记录的域名
+	Record               *Record
+
+	SPFAligned  bool
+	DKIMAligned bool
+
+	// DKIMDomain 是通过校验且对齐的 DKIM 签名域名（d=）。
+	DKIMDomain string
+
+	// Reasons 是便于用户理解的校验过程说明，例如 SPF 通过但未对齐的原因。
+	Reasons []string
+
+	// Err 是结果为 none、temperror 或 permerror 的原因，
+	// 以及 DMARC 记录中的语法错误（此时仍使用记录中有效的部分）。
+	Err error
+}
+
+// Evaluate 按 RFC 7489 第 6.6 节校验邮件是否通过 DMARC。
+//
+//   - fromDomain 是邮件头 From 地址的域名。
+//   - spf 是 SPF 校验结果（参考 dnsutils.CheckHost）。
+//   - dkimResults 是所有 DKIM 签名的校验结果（参考 dkim.Verifier）。
+func Evaluate(fromDomain string, spf SPFResult, dkimResults []dkim.Result, opts ...Option) (e Evaluation) {
+	o := newOptions(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	e.FromDomain = normalizeDomain(fromDomain)
+	e.OrganizationalDomain = OrganizationalDomain(e.FromDomain)
+	e.Disposition = PolicyNone
+
+	if e.FromDomain == "" {
+		e.Result, e.Err = ResultPermError, errors.New("dmarc: empty From domain")
+		e.reason("The message has no valid From domain.")
+
+		return
+	}
+
+	r, policyDomain, err := lookup(ctx, o.resolver, e.FromDomain)
+	e.Record, e.PolicyDomain, e.Err = r, policyDomain, err
+
+	switch {
+	case errors.Is(err, ErrNoRecord):
+		e.Result = ResultNone
+		e.reason("No DMARC record is published for %s or its organizational domain %s.", e.FromDomain, e.OrganizationalDomain)
+
+		return
+	case errors.Is(err, ErrMultipleRecords):
+		// RFC 7489 第 6.6.3 节第 5 步：有多条记录时不应用 DMARC。
+		e.Result = ResultNone
+		e.reason("Multiple DMARC records are published for %s, DMARC is not applied.", policyDomain)
+
+		return
+	case errors.Is(err, ErrMissingPolicy):
+		// RFC 7489 第 6.6.3 节第 6 步：没有有效的策略及 rua= 时不应用 DMARC。
+		e.Result = ResultNone
+		e.reason("The DMARC record of %s has no valid policy, DMARC is not applied: %v.", policyDomain, err)
+
+		return
+	case errors.Is(err, ErrTemporary):
+		e.Result = ResultTempError
+		e.reason("Failed to query the DMARC record of %s: %v.", e.FromDomain, err)
+
+		return
+	case r == nil:
+		e.Result = ResultPermError
+		e.reason("The DMARC record of %s is invalid: %v.", policyDomain, err)
+
+		return
+	case err != nil:
+		e.reason("The DMARC record of %s has errors, invalid tags are ignored: %v.", policyDomain, err)
+	}
+
+	// SPF 对齐。
+	switch {
+	case spf.Result != dnsutils.SPFPass:
+		e.reason("SPF did not pass (%s) for %s.", resultString(string(spf.Result)), domainString(spf.Domain))
+	case Aligned(spf.Domain, e.FromDomain, r.SPFAlignment):
+		e.SPFAligned = true
+		e.reason("SPF passed for %s and is aligned with %s (aspf=%s).", spf.Domain, e.FromDomain, r.SPFAlignment)
+	default:
+		e.reason("SPF passed for %s but is not aligned with %s (aspf=%s).", spf.Domain, e.FromDomain, r.SPFAlignment)
+	}
+
+	// DKIM 对齐，任意一个通过校验且对齐的签名即可。
+	if len(dkimResults) == 0 {
+		e.reason("The message has no DKIM signature.")
+	}
+
+	for _, dr := range dkimResults {
+		switch {
+		case dr.Status != dkim.StatusPass:
+			e.reason("DKIM signature of %s did not pass (%s).", domainString(dr.Domain), dr.Status)
+		case Aligned(dr.Domain, e.FromDomain, r.DKIMAlignment):
+			if !e.DKIMAligned {
+				e.DKIMAligned, e.DKIMDomain = true, normalizeDomain(dr.Domain)
+			}
+
+			e.reason("DKIM signature of %s passed and is aligned with %s (adkim=%s).", dr.Domain, e.FromDomain, r.DKIMAlignment)
+		default:
+			e.reason("DKIM signature of %s passed but is not aligned with %s (adkim=%s).", dr.Domain, e.FromDomain, r.DKIMAlignment)
+		}
+	}
+
+	// 适用的策略。
+	e.Policy = r.Policy
+	if policyDomain != e.FromDomain {
+		e.Policy = r.SubdomainPolicy
+		if r.NonExistentPolicy != r.SubdomainPolicy && !domainExists(ctx, o.resolver, e.FromDomain) {
+			e.Policy = r.NonExistentPolicy
+		}
+	}
+
+	if e.SPFAligned || e.DKIMAligned {
+		e.Result = ResultPass
+		e.reason("DMARC passed.")
+
+		return
+	}
+
+	e.Result = ResultFail
+	e.Disposition = e.Policy
+
+	// pct= 抽样：未被抽中的邮件降低一级处理（RFC 7489 第 6.6.4 节）。
+	if r.Percent < 100 && randIntN(100) >= r.Percent {
+		e.SampledOut = true
+
+		switch e.Policy {
+		case PolicyReject:
+			e.Disposition = PolicyQuarantine
+		case PolicyQuarantine:
+			e.Disposition = PolicyNone
+		}
+	}
+
+	e.reason("DMARC failed: neither SPF nor DKIM produced an aligned pass, policy %s is applied.", e.Disposition)
+
+	return
+}
+
+func (e *Evaluation) reason(format string, args ...any) {
+	e.Reasons = append(e.Reasons, fmt.Sprintf(format, args...))
+}
+
+// domainExists 检查域名是否存在（RFC 9091 第 2.1 节），任何 A、AAAA 或 MX 记录都视为存在；
+// DNS 查询失败时也视为存在。
+func domainExists(ctx context.Context, resolver dnsutils.Resolver, domain string) bool {
+	if _, err := resolver.LookupIP(ctx, "ip", domain); !dnsutils.IsNotFound(err) {
+		return true
+	}
+
+	_, err := resolver.LookupMX(ctx, domain)
+
+	return !dnsutils.IsNotFound(err)
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+func domainString(domain string) string {
+	if domain == "" {
+		return "an unknown domain"
+	}
+
+	return domain
+}
+
+func resultString(result string) string {
+	if result == "" {
+		return "none"
+	}
+
+	return result
+}
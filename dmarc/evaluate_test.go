@@ -0,0 +1,186 @@
+package dmarc
+
+import (
+	"math/rand/v2"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dkim"
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+func testZone() *dnsutils.MemoryResolver {
+	return &dnsutils.MemoryResolver{
+		TXT: map[string][]string{
+			"_dmarc.example.com":    {"v=DMARC1; p=reject; sp=quarantine; np=reject; rua=mailto:dmarc@example.com"},
+			"_dmarc.strict.example": {"v=DMARC1; p=reject; adkim=s; aspf=s"},
+			"_dmarc.example.co.uk":  {"v=DMARC1; p=quarantine; pct=50"},
+			"_dmarc.multiple.example": {
+				"v=DMARC1; p=reject",
+				"v=DMARC1; p=none",
+			},
+			"_dmarc.twice.example.com": {
+				"v=DMARC1; p=none",
+				"v=DMARC1; p=none",
+			},
+			"_dmarc.broken.example":  {"v=DMARC1; p=bogus"},
+			"_dmarc.partial.example": {"v=DMARC1; p=bogus; rua=mailto:dmarc@partial.example"},
+			"_dmarc.spf.example":     {"v=spf1 -all"},
+		},
+		IP: map[string][]net.IP{
+			"mail.example.com": {net.ParseIP("192.0.2.1")},
+		},
+		Errors: map[string]error{
+			"_dmarc.temp.example": &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+		},
+	}
+}
+
+func TestOrganizationalDomain(t *testing.T) {
+	tests := map[string]string{
+		"example.com":            "example.com",
+		"Mail.Example.COM.":      "example.com",
+		"a.b.example.co.uk":      "example.co.uk",
+		"co.uk":                  "co.uk",
+		"com":                    "com",
+		"foo.bar.example.com.au": "example.com.au",
+	}
+
+	for domain, want := range tests {
+		assert.Equal(t, want, OrganizationalDomain(domain), domain)
+	}
+
+	assert.True(t, Aligned("mail.example.com", "example.com", AlignmentRelaxed))
+	assert.False(t, Aligned("mail.example.com", "example.com", AlignmentStrict))
+	assert.True(t, Aligned("Example.com", "example.com.", AlignmentStrict))
+	assert.False(t, Aligned("example.co.uk", "other.co.uk", AlignmentRelaxed))
+	assert.False(t, Aligned("", "example.com", AlignmentRelaxed))
+}
+
+func TestLookup(t *testing.T) {
+	zone := testZone()
+
+	r, policyDomain, err := Lookup("example.com", WithResolver(zone))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", policyDomain)
+	assert.Equal(t, PolicyReject, r.Policy)
+
+	// 使用组织域名的记录。
+	r, policyDomain, err = Lookup("a.b.example.com", WithResolver(zone))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", policyDomain)
+	assert.Equal(t, PolicyQuarantine, r.SubdomainPolicy)
+
+	_, _, err = Lookup("none.example", WithResolver(zone))
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	_, _, err = Lookup("spf.example", WithResolver(zone))
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	_, policyDomain, err = Lookup("multiple.example", WithResolver(zone))
+	assert.NotErrorIs(t, err, ErrNoRecord)
+	assert.ErrorIs(t, err, ErrMultipleRecords)
+	assert.Equal(t, "multiple.example", policyDomain)
+
+	r, policyDomain, err = Lookup("sub.multiple.example", WithResolver(zone))
+	assert.ErrorIs(t, err, ErrMultipleRecords)
+	assert.Nil(t, r)
+	assert.Equal(t, "multiple.example", policyDomain)
+
+	// 有多条记录时不再查询组织域名。
+	r, policyDomain, err = Lookup("twice.example.com", WithResolver(zone))
+	assert.ErrorIs(t, err, ErrMultipleRecords)
+	assert.Nil(t, r)
+	assert.Equal(t, "twice.example.com", policyDomain)
+
+	_, _, err = Lookup("temp.example", WithResolver(zone))
+	assert.ErrorIs(t, err, ErrTemporary)
+}
+
+func TestEvaluate(t *testing.T) {
+	zone := testZone()
+
+	pass := func(domain string) dkim.Result { return dkim.Result{Status: dkim.StatusPass, Domain: domain} }
+	fail := func(domain string) dkim.Result { return dkim.Result{Status: dkim.StatusFail, Domain: domain} }
+
+	tests := []struct {
+		name        string
+		from        string
+		spf         SPFResult
+		dkim        []dkim.Result
+		result      Result
+		disposition Policy
+		policy      Policy
+		spfAligned  bool
+		dkimAligned bool
+	}{
+		{"spf aligned", "example.com", SPFResult{"bounce.example.com", dnsutils.SPFPass}, nil, ResultPass, PolicyNone, PolicyReject, true, false},
+		{"dkim aligned", "example.com", SPFResult{"other.net", dnsutils.SPFPass}, []dkim.Result{fail("example.com"), pass("mail.example.com")}, ResultPass, PolicyNone, PolicyReject, false, true},
+		{"not aligned", "example.com", SPFResult{"other.net", dnsutils.SPFPass}, []dkim.Result{pass("other.net")}, ResultFail, PolicyReject, PolicyReject, false, false},
+		{"spf fail", "example.com", SPFResult{"example.com", dnsutils.SPFFail}, []dkim.Result{fail("example.com")}, ResultFail, PolicyReject, PolicyReject, false, false},
+		{"subdomain policy", "mail.example.com", SPFResult{"other.net", dnsutils.SPFNone}, nil, ResultFail, PolicyQuarantine, PolicyQuarantine, false, false},
+		{"non-existent subdomain", "nx.example.com", SPFResult{"other.net", dnsutils.SPFNone}, nil, ResultFail, PolicyReject, PolicyReject, false, false},
+		{"strict spf", "strict.example", SPFResult{"mail.strict.example", dnsutils.SPFPass}, []dkim.Result{pass("mail.strict.example")}, ResultFail, PolicyReject, PolicyReject, false, false},
+		{"strict dkim", "strict.example", SPFResult{"mail.strict.example", dnsutils.SPFPass}, []dkim.Result{pass("Strict.Example")}, ResultPass, PolicyNone, PolicyReject, false, true},
+		{"multiple records", "multiple.example", SPFResult{}, nil, ResultNone, PolicyNone, "", false, false},
+		{"multiple records of organizational domain", "sub.multiple.example", SPFResult{}, nil, ResultNone, PolicyNone, "", false, false},
+		{"no record", "none.example", SPFResult{}, nil, ResultNone, PolicyNone, "", false, false},
+		{"temperror", "temp.example", SPFResult{}, nil, ResultTempError, PolicyNone, "", false, false},
+		{"permerror", "", SPFResult{}, nil, ResultPermError, PolicyNone, "", false, false},
+	}
+
+	for _, tt := range tests {
+		e := Evaluate(tt.from, tt.spf, tt.dkim, WithResolver(zone))
+
+		assert.Equal(t, tt.result, e.Result, tt.name)
+		assert.Equal(t, tt.disposition, e.Disposition, tt.name)
+		assert.Equal(t, tt.policy, e.Policy, tt.name)
+		assert.Equal(t, tt.spfAligned, e.SPFAligned, tt.name)
+		assert.Equal(t, tt.dkimAligned, e.DKIMAligned, tt.name)
+		assert.NotEmpty(t, e.Reasons, tt.name)
+	}
+
+	e := Evaluate("example.com", SPFResult{"other.net", dnsutils.SPFPass}, []dkim.Result{pass("example.com")}, WithResolver(zone))
+	assert.Equal(t, "example.com", e.DKIMDomain)
+	assert.Equal(t, "example.com", e.PolicyDomain)
+	assert.Equal(t, []string{
+		"SPF passed for other.net but is not aligned with example.com (aspf=r).",
+		"DKIM signature of example.com passed and is aligned with example.com (adkim=r).",
+		"DMARC passed.",
+	}, e.Reasons)
+
+	// 没有有效的 p= 及 rua= 时不应用 DMARC。
+	e = Evaluate("broken.example", SPFResult{"other.net", dnsutils.SPFPass}, nil, WithResolver(zone))
+	assert.Equal(t, ResultNone, e.Result)
+	assert.Equal(t, PolicyNone, e.Disposition)
+	assert.ErrorIs(t, e.Err, ErrInvalidPolicy)
+	assert.ErrorIs(t, e.Err, ErrMissingPolicy)
+
+	// 记录有语法错误时仍然使用有效的部分，p= 无效但 rua= 有效时视为 p=none。
+	e = Evaluate("partial.example", SPFResult{"other.net", dnsutils.SPFPass}, nil, WithResolver(zone))
+	assert.Equal(t, ResultFail, e.Result)
+	assert.Equal(t, PolicyNone, e.Disposition)
+	assert.ErrorIs(t, e.Err, ErrInvalidPolicy)
+}
+
+func TestEvaluatePercent(t *testing.T) {
+	zone := testZone()
+	defer func() { randIntN = rand.IntN }()
+
+	// pct=50，抽中。
+	randIntN = func(int) int { return 10 }
+	e := Evaluate("www.example.co.uk", SPFResult{}, nil, WithResolver(zone))
+	assert.Equal(t, ResultFail, e.Result)
+	assert.Equal(t, PolicyQuarantine, e.Disposition)
+	assert.False(t, e.SampledOut)
+
+	// 未抽中，quarantine 降低为 none。
+	randIntN = func(int) int { return 70 }
+	e = Evaluate("www.example.co.uk", SPFResult{}, nil, WithResolver(zone))
+	assert.Equal(t, ResultFail, e.Result)
+	assert.Equal(t, PolicyQuarantine, e.Policy)
+	assert.Equal(t, PolicyNone, e.Disposition)
+	assert.True(t, e.SampledOut)
+}
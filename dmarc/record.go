@@ -0,0 +1,299 @@
+// Package dmarc 实现 DMARC（RFC 7489）记录解析、策略查询及对齐（alignment）校验。
+//
+// FYI
+//
+//   - https://datatracker.ietf.org/doc/html/rfc7489
+//   - https://datatracker.ietf.org/doc/html/rfc9091 (np= 标签)
+package dmarc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Policy 是 p=、sp=、np= 标签的值，也是邮件的最终处理方式（disposition）。
+type Policy string
+
+const (
+	PolicyNone       Policy = "none"
+	PolicyQuarantine Policy = "quarantine"
+	PolicyReject     Policy = "reject"
+)
+
+// Alignment 是 adkim=、aspf= 标签的值。
+type Alignment string
+
+const (
+	AlignmentRelaxed Alignment = "r"
+	AlignmentStrict  Alignment = "s"
+)
+
+const (
+	DefaultPercent        = 100
+	DefaultReportInterval = 86400
+)
+
+var (
+	ErrNotDMARCRecord       = errors.New("dmarc: not a DMARC record, must start with v=DMARC1")
+	ErrInvalidPolicy        = errors.New("dmarc: invalid policy")
+	ErrMissingPolicy        = errors.New("dmarc: missing valid policy (p= or sp=) and rua=")
+	ErrInvalidPercent       = errors.New("dmarc: invalid pct=, must be an integer between 0 and 100")
+	ErrInvalidAlignment     = errors.New("dmarc: invalid alignment mode, must be r or s")
+	ErrInvalidReportURI     = errors.New("dmarc: invalid report URI")
+	ErrInvalidFailureOption = errors.New("dmarc: invalid fo=, must be a colon-separated list of 0, 1, d, s")
+	ErrInvalidInterval      = errors.New("dmarc: invalid ri=, must be a non-negative integer")
+	ErrDuplicateTag         = errors.New("dmarc: duplicate tag")
+)
+
+// ReportURI 是 rua=、ruf= 中的一个报告地址，例如 `mailto:dmarc@example.com!10m`。
+type ReportURI struct {
+	URI     string // 例如 `mailto:dmarc@example.com`
+	MaxSize uint64 // 报告的最大字节数，0 表示不限制
+}
+
+// Address 返回 mailto: URI 中的邮件地址，其它 URI 返回空字符串。
+func (u ReportURI) Address() string {
+	addr, found := strings.CutPrefix(u.URI, "mailto:")
+	if !found {
+		return ""
+	}
+
+	if unescaped, err := url.PathUnescape(addr); err == nil {
+		addr = unescaped
+	}
+
+	return addr
+}
+
+// Record 是解析后的 DMARC 记录，未指定的标签为默认值。
+type Record struct {
+	Policy              Policy    // p=
+	SubdomainPolicy     Policy    // sp=，默认与 p= 相同
+	NonExistentPolicy   Policy    // np=，默认与 sp= 相同
+	Percent             int       // pct=，默认为 100
+	DKIMAlignment       Alignment // adkim=，默认为 r
+	SPFAlignment        Alignment // aspf=，默认为 r
+	AggregateReportURIs []ReportURI
+	FailureReportURIs   []ReportURI
+	FailureOptions      []string // fo=，默认为 `0`
+	ReportFormat        string   // rf=，默认为 `afrf`
+	ReportInterval      uint32   // ri=，默认为 86400 秒
+}
+
+// Parse 解析 DMARC 记录，例如 `v=DMARC1; p=reject; rua=mailto:dmarc@example.com`。
+//
+// 记录不是以 `v=DMARC1` 开头时返回 ErrNotDMARCRecord 且 r 为 nil。其它无效的标签值
+// 使用默认值代替，所有错误通过 errors.Join 合并后返回，此时 r 不为 nil，调用者可以
+// 使用 r 并展示 err 中的每一个问题。
+//
+// 按 RFC 7489 第 6.6.3 节，p= 缺失或无效、或者 sp= 无效时：rua= 有效则视为 p=none，
+// 否则返回 ErrMissingPolicy，此时不应对邮件应用 DMARC。
+func Parse(txt string) (r *Record, err error) {
+	specs := strings.Split(txt, ";")
+
+	version, value, _ := strings.Cut(specs[0], "=")
+	if strings.TrimSpace(version) != "v" || strings.TrimSpace(value) != "DMARC1" {
+		return nil, ErrNotDMARCRecord
+	}
+
+	r = &Record{
+		Percent:        DefaultPercent,
+		DKIMAlignment:  AlignmentRelaxed,
+		SPFAlignment:   AlignmentRelaxed,
+		FailureOptions: []string{"0"},
+		ReportFormat:   "afrf",
+		ReportInterval: DefaultReportInterval,
+	}
+
+	var errs []error
+	var hasSubdomainPolicy, invalidSubdomainPolicy, hasNonExistentPolicy bool
+	seen := make(map[string]bool)
+
+	for _, spec := range specs[1:] {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(spec, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("%w: %s=", ErrDuplicateTag, name))
+
+			continue
+		}
+
+		seen[name] = true
+
+		switch name {
+		case "p":
+			r.Policy, err = parsePolicy(name, value)
+		case "sp":
+			r.SubdomainPolicy, err = parsePolicy(name, value)
+			hasSubdomainPolicy, invalidSubdomainPolicy = err == nil, err != nil
+		case "np":
+			r.NonExistentPolicy, err = parsePolicy(name, value)
+			hasNonExistentPolicy = err == nil
+		case "pct":
+			var pct int
+			pct, err = strconv.Atoi(value)
+			if err != nil || pct < 0 || pct > 100 {
+				err = fmt.Errorf("%w: %q", ErrInvalidPercent, value)
+			} else {
+				r.Percent = pct
+			}
+		case "adkim":
+			r.DKIMAlignment, err = parseAlignment(name, value)
+		case "aspf":
+			r.SPFAlignment, err = parseAlignment(name, value)
+		case "rua":
+			r.AggregateReportURIs, err = parseReportURIs(name, value)
+		case "ruf":
+			r.FailureReportURIs, err = parseReportURIs(name, value)
+		case "fo":
+			r.FailureOptions, err = parseFailureOptions(value)
+		case "rf":
+			r.ReportFormat = value
+		case "ri":
+			var ri uint64
+			ri, err = strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				err = fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+			} else {
+				r.ReportInterval = uint32(ri)
+			}
+		}
+
+		// 忽略未知的标签。
+		if err != nil {
+			errs = append(errs, err)
+			err = nil
+		}
+	}
+
+	if r.Policy == "" || invalidSubdomainPolicy {
+		if len(r.AggregateReportURIs) == 0 {
+			errs = append(errs, ErrMissingPolicy)
+		}
+
+		r.Policy = PolicyNone
+		hasSubdomainPolicy, hasNonExistentPolicy = false, false
+	}
+
+	if r.DKIMAlignment == "" {
+		r.DKIMAlignment = AlignmentRelaxed
+	}
+
+	if r.SPFAlignment == "" {
+		r.SPFAlignment = AlignmentRelaxed
+	}
+
+	if len(r.FailureOptions) == 0 {
+		r.FailureOptions = []string{"0"}
+	}
+
+	if !hasSubdomainPolicy {
+		r.SubdomainPolicy = r.Policy
+	}
+
+	if !hasNonExistentPolicy {
+		r.NonExistentPolicy = r.SubdomainPolicy
+	}
+
+	err = errors.Join(errs...)
+
+	return
+}
+
+func parsePolicy(name, value string) (Policy, error) {
+	p := Policy(strings.ToLower(value))
+	if p != PolicyNone && p != PolicyQuarantine && p != PolicyReject {
+		return "", fmt.Errorf("%w: %s=%s", ErrInvalidPolicy, name, value)
+	}
+
+	return p, nil
+}
+
+func parseAlignment(name, value string) (Alignment, error) {
+	a := Alignment(strings.ToLower(value))
+	if a != AlignmentRelaxed && a != AlignmentStrict {
+		return "", fmt.Errorf("%w: %s=%s", ErrInvalidAlignment, name, value)
+	}
+
+	return a, nil
+}
+
+// parseReportURIs 解析逗号分隔的报告地址列表，地址后可以带有 `!<size>[kmgt]` 大小限制。
+func parseReportURIs(name, value string) (uris []ReportURI, err error) {
+	for s := range strings.SplitSeq(value, ",") {
+		s = strings.TrimSpace(s)
+
+		var u ReportURI
+
+		uri, size, hasSize := strings.Cut(s, "!")
+		if hasSize {
+			u.MaxSize, err = parseSize(size)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s=%s", ErrInvalidReportURI, name, s)
+			}
+		}
+
+		u.URI = uri
+
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" || (parsed.Scheme == "mailto" && !strings.Contains(u.Address(), "@")) {
+			return nil, fmt.Errorf("%w: %s=%s", ErrInvalidReportURI, name, s)
+		}
+
+		uris = append(uris, u)
+	}
+
+	return
+}
+
+func parseSize(s string) (uint64, error) {
+	multiplier := uint64(1)
+
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			multiplier = 1 << 10
+		case 'm', 'M':
+			multiplier = 1 << 20
+		case 'g', 'G':
+			multiplier = 1 << 30
+		case 't', 'T':
+			multiplier = 1 << 40
+		}
+
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return size * multiplier, nil
+}
+
+func parseFailureOptions(value string) (opts []string, err error) {
+	for opt := range strings.SplitSeq(value, ":") {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		if !slices.Contains([]string{"0", "1", "d", "s"}, opt) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidFailureOption, value)
+		}
+
+		opts = append(opts, opt)
+	}
+
+	return
+}
@@ -0,0 +1,94 @@
+package dmarc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse("v=DMARC1; p=reject")
+	assert.Nil(t, err)
+	assert.Equal(t, &Record{
+		Policy:            PolicyReject,
+		SubdomainPolicy:   PolicyReject,
+		NonExistentPolicy: PolicyReject,
+		Percent:           100,
+		DKIMAlignment:     AlignmentRelaxed,
+		SPFAlignment:      AlignmentRelaxed,
+		FailureOptions:    []string{"0"},
+		ReportFormat:      "afrf",
+		ReportInterval:    86400,
+	}, r)
+
+	r, err = Parse("v=DMARC1;p=quarantine; sp=none; np=reject; pct=25; adkim=s; ASPF=S; " +
+		"rua=mailto:dmarc@example.com!10m, mailto:reports%40example.net; ruf=mailto:forensic@example.com; " +
+		"fo=1:d; ri=3600; x-unknown=1;")
+	assert.Nil(t, err)
+	assert.Equal(t, PolicyQuarantine, r.Policy)
+	assert.Equal(t, PolicyNone, r.SubdomainPolicy)
+	assert.Equal(t, PolicyReject, r.NonExistentPolicy)
+	assert.Equal(t, 25, r.Percent)
+	assert.Equal(t, AlignmentStrict, r.DKIMAlignment)
+	assert.Equal(t, AlignmentStrict, r.SPFAlignment)
+	assert.Equal(t, []ReportURI{
+		{URI: "mailto:dmarc@example.com", MaxSize: 10 << 20},
+		{URI: "mailto:reports%40example.net"},
+	}, r.AggregateReportURIs)
+	assert.Equal(t, "reports@example.net", r.AggregateReportURIs[1].Address())
+	assert.Equal(t, []ReportURI{{URI: "mailto:forensic@example.com"}}, r.FailureReportURIs)
+	assert.Equal(t, []string{"1", "d"}, r.FailureOptions)
+	assert.Equal(t, uint32(3600), r.ReportInterval)
+
+	// sp= 未指定时 np= 默认与 sp= 相同。
+	r, err = Parse("v=DMARC1; p=none; sp=quarantine")
+	assert.Nil(t, err)
+	assert.Equal(t, PolicyQuarantine, r.NonExistentPolicy)
+
+	for _, txt := range []string{"", "p=reject", "v=DMARC2; p=reject", "v=spf1 -all", " p=reject; v=DMARC1"} {
+		r, err = Parse(txt)
+		assert.Nil(t, r, txt)
+		assert.ErrorIs(t, err, ErrNotDMARCRecord, txt)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	r, err := Parse("v=DMARC1; p=block; pct=200; adkim=x; rua=dmarc@example.com; fo=2; ri=-1; p=none")
+	assert.NotNil(t, r)
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	assert.ErrorIs(t, err, ErrInvalidPercent)
+	assert.ErrorIs(t, err, ErrInvalidAlignment)
+	assert.ErrorIs(t, err, ErrInvalidReportURI)
+	assert.ErrorIs(t, err, ErrInvalidFailureOption)
+	assert.ErrorIs(t, err, ErrInvalidInterval)
+	assert.ErrorIs(t, err, ErrDuplicateTag)
+	assert.ErrorIs(t, err, ErrMissingPolicy)
+
+	// 无效的值使用默认值。
+	assert.Equal(t, PolicyNone, r.Policy)
+	assert.Equal(t, 100, r.Percent)
+	assert.Equal(t, AlignmentRelaxed, r.DKIMAlignment)
+	assert.Empty(t, r.AggregateReportURIs)
+	assert.Equal(t, []string{"0"}, r.FailureOptions)
+	assert.Equal(t, uint32(86400), r.ReportInterval)
+
+	// p= 缺失但 rua= 有效时视为 p=none。
+	r, err = Parse("v=DMARC1; rua=mailto:dmarc@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, PolicyNone, r.Policy)
+
+	// sp= 无效时与 p= 无效相同。
+	r, err = Parse("v=DMARC1; p=reject; sp=block")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	assert.ErrorIs(t, err, ErrMissingPolicy)
+
+	r, err = Parse("v=DMARC1; p=reject; sp=block; rua=mailto:dmarc@example.com")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	assert.NotErrorIs(t, err, ErrMissingPolicy)
+	assert.Equal(t, PolicyNone, r.Policy)
+	assert.Equal(t, PolicyNone, r.SubdomainPolicy)
+	assert.Equal(t, PolicyNone, r.NonExistentPolicy)
+
+	_, err = Parse("v=DMARC1; p=none; rua=mailto:dmarc@example.com!10x")
+	assert.ErrorIs(t, err, ErrInvalidReportURI)
+}
@@ -0,0 +1,224 @@
+package dmarcreport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iredmail/goutils"
+	"github.com/iredmail/goutils/dkim"
+	"github.com/iredmail/goutils/dmarc"
+)
+
+// EvaluationLog 是收到一封邮件时记录的 DMARC 校验信息，用于生成聚合报告。
+type EvaluationLog struct {
+	Time     time.Time
+	SourceIP string
+
+	EnvelopeTo   string // 收件人地址的域名
+	EnvelopeFrom string // MAIL FROM 地址的域名，为空时 SPF 校验的是 HELO 主机名
+
+	SPF        dmarc.SPFResult
+	DKIM       []dkim.Result
+	Evaluation dmarc.Evaluation // dmarc.Evaluate 的返回值
+}
+
+// Reporter 是生成聚合报告的组织信息。
+type Reporter struct {
+	OrgName          string // 例如 `Example Inc.`
+	Email            string // 发送报告的邮件地址，例如 `dmarc-noreply@example.com`
+	ExtraContactInfo string
+}
+
+// Generate 根据 [begin, end) 时间范围内的校验记录生成聚合报告，每个策略域名
+// （Evaluation.PolicyDomain）生成一份。没有找到 DMARC 记录的邮件不生成报告。
+//
+// 来源 IP、身份标识及校验结果完全相同的邮件合并为一条记录。
+func (rp Reporter) Generate(begin, end time.Time, logs []EvaluationLog) (feedbacks []*Feedback) {
+	byDomain := make(map[string]*Feedback)
+	recordIndex := make(map[*Feedback]map[string]int)
+
+	for _, l := range logs {
+		e := l.Evaluation
+		if e.Record == nil || e.PolicyDomain == "" {
+			continue
+		}
+
+		if l.Time.Before(begin) || !l.Time.Before(end) {
+			continue
+		}
+
+		f, ok := byDomain[e.PolicyDomain]
+		if !ok {
+			f = rp.newFeedback(e.PolicyDomain, e.Record, begin, end)
+			byDomain[e.PolicyDomain] = f
+			recordIndex[f] = make(map[string]int)
+			feedbacks = append(feedbacks, f)
+		}
+
+		r := newRecord(l)
+		key := recordKey(r)
+
+		if i, found := recordIndex[f][key]; found {
+			f.Records[i].Row.Count++
+
+			continue
+		}
+
+		recordIndex[f][key] = len(f.Records)
+		f.Records = append(f.Records, r)
+	}
+
+	return
+}
+
+func (rp Reporter) newFeedback(domain string, r *dmarc.Record, begin, end time.Time) *Feedback {
+	return &Feedback{
+		Version: "1.0",
+		ReportMetadata: ReportMetadata{
+			OrgName:          rp.OrgName,
+			Email:            rp.Email,
+			ExtraContactInfo: rp.ExtraContactInfo,
+			ReportID:         fmt.Sprintf("%s.%d.%d", domain, begin.Unix(), end.Unix()),
+			DateRange: DateRange{
+				Begin: begin.Unix(),
+				End:   end.Unix(),
+			},
+		},
+		PolicyPublished: PolicyPublished{
+			Domain: domain,
+			ADKIM:  string(r.DKIMAlignment),
+			ASPF:   string(r.SPFAlignment),
+			P:      string(r.Policy),
+			SP:     string(r.SubdomainPolicy),
+			NP:     string(r.NonExistentPolicy),
+			Pct:    r.Percent,
+			Fo:     strings.Join(r.FailureOptions, ":"),
+		},
+	}
+}
+
+func newRecord(l EvaluationLog) (r Record) {
+	e := l.Evaluation
+
+	r.Row = Row{
+		SourceIP: l.SourceIP,
+		Count:    1,
+		PolicyEvaluated: PolicyEvaluated{
+			Disposition: string(dmarc.PolicyNone),
+			DKIM:        passOrFail(e.DKIMAligned),
+			SPF:         passOrFail(e.SPFAligned),
+		},
+	}
+
+	if e.Disposition != "" {
+		r.Row.PolicyEvaluated.Disposition = string(e.Disposition)
+	}
+
+	if e.SampledOut {
+		r.Row.PolicyEvaluated.Reasons = []PolicyOverrideReason{{Type: "sampled_out"}}
+	}
+
+	r.Identifiers = Identifiers{
+		EnvelopeTo:   lower(l.EnvelopeTo),
+		EnvelopeFrom: lower(l.EnvelopeFrom),
+		HeaderFrom:   e.FromDomain,
+	}
+
+	for _, d := range l.DKIM {
+		r.AuthResults.DKIM = append(r.AuthResults.DKIM, DKIMAuthResult{
+			Domain:   lower(d.Domain),
+			Selector: d.Selector,
+			Result:   string(d.Status),
+		})
+	}
+
+	spf := SPFAuthResult{
+		Domain: lower(l.SPF.Domain),
+		Scope:  "mfrom",
+		Result: string(l.SPF.Result),
+	}
+
+	if l.EnvelopeFrom == "" {
+		spf.Scope = "helo"
+	}
+
+	if spf.Result == "" {
+		spf.Result = "none"
+	}
+
+	r.AuthResults.SPF = []SPFAuthResult{spf}
+
+	return
+}
+
+// recordKey 返回用于合并记录的键，除 count 外的所有字段都相同的记录视为同一条。
+func recordKey(r Record) string {
+	r.Row.Count = 0
+	b, _ := xml.Marshal(r)
+
+	return string(b)
+}
+
+func passOrFail(pass bool) string {
+	if pass {
+		return "pass"
+	}
+
+	return "fail"
+}
+
+// Marshal 返回带有 XML 声明的报告内容。
+func (f *Feedback) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+
+	b.WriteString("\n")
+
+	return b.Bytes(), nil
+}
+
+// Gzip 返回 gzip 压缩后的报告内容，可作为邮件附件发送，文件名参考 Filename。
+func (f *Feedback) Gzip() ([]byte, error) {
+	data, err := f.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return goutils.CompressWithGzip(data)
+}
+
+// Filename 返回 RFC 7489 第 7.2.1.1 节规定的 gzip 附件文件名，
+// 格式为 `<receiver>!<policy-domain>!<begin>!<end>.xml.gz`，receiver 是报告邮件地址的域名。
+func (f *Feedback) Filename() string {
+	return strings.Join([]string{
+		f.receiver(),
+		f.PolicyPublished.Domain,
+		strconv.FormatInt(f.ReportMetadata.DateRange.Begin, 10),
+		strconv.FormatInt(f.ReportMetadata.DateRange.End, 10),
+	}, "!") + ".xml.gz"
+}
+
+// Subject 返回 RFC 7489 第 7.2.1.1 节建议的报告邮件标题。
+func (f *Feedback) Subject() string {
+	return fmt.Sprintf("Report Domain: %s Submitter: %s Report-ID: <%s>",
+		f.PolicyPublished.Domain, f.receiver(), f.ReportMetadata.ReportID)
+}
+
+func (f *Feedback) receiver() string {
+	_, domain, found := strings.Cut(f.ReportMetadata.Email, "@")
+	if !found {
+		return lower(f.ReportMetadata.OrgName)
+	}
+
+	return lower(domain)
+}
@@ -0,0 +1,128 @@
+package dmarcreport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dkim"
+	"github.com/iredmail/goutils/dmarc"
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+func TestGenerate(t *testing.T) {
+	record, err := dmarc.Parse("v=DMARC1; p=reject; pct=50; rua=mailto:dmarc@example.com")
+	assert.Nil(t, err)
+
+	begin := time.Unix(1700006400, 0)
+	end := begin.Add(24 * time.Hour)
+
+	pass := EvaluationLog{
+		Time:         begin.Add(time.Hour),
+		SourceIP:     "192.0.2.1",
+		EnvelopeTo:   "example.net",
+		EnvelopeFrom: "example.com",
+		SPF:          dmarc.SPFResult{Domain: "example.com", Result: dnsutils.SPFPass},
+		DKIM:         []dkim.Result{{Status: dkim.StatusPass, Domain: "example.com", Selector: "dkim"}},
+		Evaluation: dmarc.Evaluation{
+			Result:       dmarc.ResultPass,
+			Disposition:  dmarc.PolicyNone,
+			FromDomain:   "example.com",
+			PolicyDomain: "example.com",
+			Record:       record,
+			SPFAligned:   true,
+			DKIMAligned:  true,
+		},
+	}
+
+	fail := EvaluationLog{
+		Time:     begin.Add(2 * time.Hour),
+		SourceIP: "198.51.100.7",
+		SPF:      dmarc.SPFResult{Domain: "spammer.example", Result: dnsutils.SPFSoftFail},
+		Evaluation: dmarc.Evaluation{
+			Result:       dmarc.ResultFail,
+			Disposition:  dmarc.PolicyQuarantine,
+			SampledOut:   true,
+			FromDomain:   "mail.example.com",
+			PolicyDomain: "example.com",
+			Record:       record,
+		},
+	}
+
+	noRecord := EvaluationLog{
+		Time:       begin.Add(time.Hour),
+		SourceIP:   "192.0.2.9",
+		Evaluation: dmarc.Evaluation{Result: dmarc.ResultNone, FromDomain: "none.example"},
+	}
+
+	outOfRange := pass
+	outOfRange.Time = end
+
+	rp := Reporter{OrgName: "Example Net", Email: "dmarc-noreply@Example.NET"}
+	feedbacks := rp.Generate(begin, end, []EvaluationLog{pass, fail, pass, noRecord, outOfRange})
+	assert.Len(t, feedbacks, 1)
+
+	f := feedbacks[0]
+	assert.Equal(t, "example.com.1700006400.1700092800", f.ReportMetadata.ReportID)
+	assert.Equal(t, PolicyPublished{Domain: "example.com", ADKIM: "r", ASPF: "r", P: "reject", SP: "reject", NP: "reject", Pct: 50, Fo: "0"}, f.PolicyPublished)
+	assert.Equal(t, "example.net!example.com!1700006400!1700092800.xml.gz", f.Filename())
+	assert.Equal(t, "Report Domain: example.com Submitter: example.net Report-ID: <example.com.1700006400.1700092800>", f.Subject())
+
+	assert.Equal(t, []Record{
+		{
+			Row: Row{
+				SourceIP:        "192.0.2.1",
+				Count:           2,
+				PolicyEvaluated: PolicyEvaluated{Disposition: "none", DKIM: "pass", SPF: "pass"},
+			},
+			Identifiers: Identifiers{EnvelopeTo: "example.net", EnvelopeFrom: "example.com", HeaderFrom: "example.com"},
+			AuthResults: AuthResults{
+				DKIM: []DKIMAuthResult{{Domain: "example.com", Selector: "dkim", Result: "pass"}},
+				SPF:  []SPFAuthResult{{Domain: "example.com", Scope: "mfrom", Result: "pass"}},
+			},
+		},
+		{
+			Row: Row{
+				SourceIP: "198.51.100.7",
+				Count:    1,
+				PolicyEvaluated: PolicyEvaluated{
+					Disposition: "quarantine",
+					DKIM:        "fail",
+					SPF:         "fail",
+					Reasons:     []PolicyOverrideReason{{Type: "sampled_out"}},
+				},
+			},
+			Identifiers: Identifiers{HeaderFrom: "mail.example.com"},
+			AuthResults: AuthResults{
+				SPF: []SPFAuthResult{{Domain: "spammer.example", Scope: "helo", Result: "softfail"}},
+			},
+		},
+	}, f.Records)
+
+	// 生成的报告可以被解析。
+	gz, err := f.Gzip()
+	assert.Nil(t, err)
+
+	parsed, err := ParseAttachment(gz)
+	assert.Nil(t, err)
+	assert.Len(t, parsed, 1)
+	assert.Equal(t, f.ReportMetadata, parsed[0].ReportMetadata)
+	assert.Equal(t, f.PolicyPublished, parsed[0].PolicyPublished)
+	assert.Equal(t, f.Records, parsed[0].Records)
+	assert.Equal(t, "1.0", parsed[0].Version)
+
+	assert.Empty(t, rp.Generate(begin, end, []EvaluationLog{noRecord}))
+
+	// pct=0 不能被省略，否则会被当作默认值 100。
+	record, err = dmarc.Parse("v=DMARC1; p=quarantine; pct=0")
+	assert.Nil(t, err)
+	pass.Evaluation.Record = record
+
+	feedbacks = rp.Generate(begin, end, []EvaluationLog{pass})
+	assert.Len(t, feedbacks, 1)
+
+	xml, err := feedbacks[0].Marshal()
+	assert.Nil(t, err)
+	assert.Contains(t, string(xml), "<pct>0</pct>")
+}
@@ -0,0 +1,233 @@
+package dmarcreport
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/jhillyerd/enmime/v2"
+
+	"github.com/iredmail/goutils/dmarc"
+)
+
+// MaxReportSize 是解压后单个 XML 报告允许的最大字节数，防止压缩炸弹。
+const MaxReportSize = 32 << 20
+
+var (
+	ErrNotReport      = errors.New("dmarcreport: not a DMARC aggregate report")
+	ErrReportTooLarge = errors.New("dmarcreport: report exceeds the size limit")
+	ErrNoReportFound  = errors.New("dmarcreport: no aggregate report found in message")
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZip  = []byte("PK\x03\x04")
+)
+
+// Parse 解析一份 XML 格式的聚合报告。
+func Parse(r io.Reader) (f *Feedback, err error) {
+	data, err := readLimited(r)
+	if err != nil {
+		return
+	}
+
+	return parseXML(data)
+}
+
+// ParseAttachment 解析一个报告附件，根据内容自动识别 XML、gzip 或 zip 格式。
+// zip 文件中可以包含多份报告，因此返回列表。
+func ParseAttachment(data []byte) (feedbacks []*Feedback, err error) {
+	switch {
+	case bytes.HasPrefix(data, magicGzip):
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotReport, err)
+		}
+		defer zr.Close()
+
+		f, err := Parse(zr)
+		if err != nil {
+			return nil, err
+		}
+
+		feedbacks = append(feedbacks, f)
+	case bytes.HasPrefix(data, magicZip):
+		return parseZip(data)
+	default:
+		f, err := parseXML(data)
+		if err != nil {
+			return nil, err
+		}
+
+		feedbacks = append(feedbacks, f)
+	}
+
+	return
+}
+
+// ParseMessage 从邮件（RFC 5322）中提取并解析所有聚合报告附件。
+// 邮件中没有可解析的报告时返回 ErrNoReportFound，并附带每个附件的解析错误。
+func ParseMessage(r io.Reader) (feedbacks []*Feedback, err error) {
+	env, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		return
+	}
+
+	var errs []error
+	var parts []*enmime.Part
+	parts = append(parts, env.Attachments...)
+	parts = append(parts, env.Inlines...)
+	parts = append(parts, env.OtherParts...)
+
+	for _, p := range parts {
+		if !isReportPart(p) {
+			continue
+		}
+
+		fs, err := ParseAttachment(p.Content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.FileName, err))
+
+			continue
+		}
+
+		feedbacks = append(feedbacks, fs...)
+	}
+
+	if len(feedbacks) == 0 {
+		err = errors.Join(append([]error{ErrNoReportFound}, errs...)...)
+	}
+
+	return
+}
+
+// isReportPart 根据 Content-Type 和文件名判断邮件的某个部分是否可能是聚合报告。
+func isReportPart(p *enmime.Part) bool {
+	switch strings.ToLower(p.ContentType) {
+	case "application/gzip", "application/x-gzip",
+		"application/zip", "application/x-zip-compressed",
+		"application/xml", "text/xml":
+		return true
+	}
+
+	name := strings.ToLower(p.FileName)
+	for _, ext := range []string{".xml", ".gz", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseZip(data []byte) (feedbacks []*Feedback, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotReport, err)
+	}
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".xml") {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := Parse(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+
+		feedbacks = append(feedbacks, f)
+	}
+
+	if len(feedbacks) == 0 {
+		err = fmt.Errorf("%w: no XML file in zip archive", ErrNotReport)
+	}
+
+	return
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxReportSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxReportSize {
+		return nil, ErrReportTooLarge
+	}
+
+	return data, nil
+}
+
+func parseXML(data []byte) (f *Feedback, err error) {
+	// 报告中没有 <pct> 时为默认值 100（RFC 7489 附录 C），而不是 0。
+	f = &Feedback{PolicyPublished: PolicyPublished{Pct: dmarc.DefaultPercent}}
+	if err = xml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotReport, err)
+	}
+
+	f.normalize()
+
+	if f.ReportMetadata.ReportID == "" || f.PolicyPublished.Domain == "" {
+		return nil, fmt.Errorf("%w: missing report_id or policy domain", ErrNotReport)
+	}
+
+	return
+}
+
+// normalize 去掉各字段两端的空白，并将域名、结果统一为小写。
+func (f *Feedback) normalize() {
+	m := &f.ReportMetadata
+	m.OrgName = strings.TrimSpace(m.OrgName)
+	m.Email = strings.TrimSpace(m.Email)
+	m.ExtraContactInfo = strings.TrimSpace(m.ExtraContactInfo)
+	m.ReportID = strings.TrimSpace(m.ReportID)
+
+	p := &f.PolicyPublished
+	p.Domain = lower(p.Domain)
+	p.ADKIM, p.ASPF = lower(p.ADKIM), lower(p.ASPF)
+	p.P, p.SP, p.NP = lower(p.P), lower(p.SP), lower(p.NP)
+	p.Fo = strings.TrimSpace(p.Fo)
+
+	for i := range f.Records {
+		r := &f.Records[i]
+		r.Row.SourceIP = strings.TrimSpace(r.Row.SourceIP)
+
+		pe := &r.Row.PolicyEvaluated
+		pe.Disposition, pe.DKIM, pe.SPF = lower(pe.Disposition), lower(pe.DKIM), lower(pe.SPF)
+		for j := range pe.Reasons {
+			pe.Reasons[j].Type = lower(pe.Reasons[j].Type)
+			pe.Reasons[j].Comment = strings.TrimSpace(pe.Reasons[j].Comment)
+		}
+
+		id := &r.Identifiers
+		id.EnvelopeTo, id.EnvelopeFrom, id.HeaderFrom = lower(id.EnvelopeTo), lower(id.EnvelopeFrom), lower(id.HeaderFrom)
+
+		for j := range r.AuthResults.DKIM {
+			d := &r.AuthResults.DKIM[j]
+			d.Domain, d.Selector, d.Result = lower(d.Domain), strings.TrimSpace(d.Selector), lower(d.Result)
+			d.HumanResult = strings.TrimSpace(d.HumanResult)
+		}
+
+		for j := range r.AuthResults.SPF {
+			s := &r.AuthResults.SPF[j]
+			s.Domain, s.Scope, s.Result = lower(s.Domain), lower(s.Scope), lower(s.Result)
+		}
+	}
+}
+
+func lower(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,215 @@
+package dmarcreport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils"
+)
+
+const testReport = `<?xml version="1.0" encoding="UTF-8" ?>
+<feedback>
+  <report_metadata>
+    <org_name>google.com</org_name>
+    <email>noreply-dmarc-support@google.com</email>
+    <extra_contact_info>https://support.google.com/a/answer/2466580</extra_contact_info>
+    <report_id>5717107811868587391</report_id>
+    <date_range>
+      <begin>1700006400</begin>
+      <end>1700092799</end>
+    </date_range>
+  </report_metadata>
+  <policy_published>
+    <domain>Example.com</domain>
+    <adkim>r</adkim>
+    <aspf>r</aspf>
+    <p>reject</p>
+    <sp>reject</sp>
+    <pct>100</pct>
+  </policy_published>
+  <record>
+    <row>
+      <source_ip>192.0.2.1</source_ip>
+      <count>10</count>
+      <policy_evaluated>
+        <disposition>none</disposition>
+        <dkim>pass</dkim>
+        <spf>pass</spf>
+      </policy_evaluated>
+    </row>
+    <identifiers>
+      <header_from>example.com</header_from>
+    </identifiers>
+    <auth_results>
+      <dkim>
+        <domain>example.com</domain>
+        <selector>dkim</selector>
+        <result>pass</result>
+      </dkim>
+      <spf>
+        <domain>example.com</domain>
+        <result>pass</result>
+      </spf>
+    </auth_results>
+  </record>
+  <record>
+    <row>
+      <source_ip>198.51.100.7</source_ip>
+      <count>3</count>
+      <policy_evaluated>
+        <disposition>reject</disposition>
+        <dkim>fail</dkim>
+        <spf>fail</spf>
+      </policy_evaluated>
+    </row>
+    <identifiers>
+      <header_from>example.com</header_from>
+    </identifiers>
+    <auth_results>
+      <spf>
+        <domain>spammer.example</domain>
+        <result>softfail</result>
+      </spf>
+    </auth_results>
+  </record>
+  <record>
+    <row>
+      <source_ip>192.0.2.1</source_ip>
+      <count>2</count>
+      <policy_evaluated>
+        <disposition>none</disposition>
+        <dkim>fail</dkim>
+        <spf>PASS</spf>
+        <reason>
+          <type>forwarded</type>
+        </reason>
+      </policy_evaluated>
+    </row>
+    <identifiers>
+      <header_from>mail.example.com</header_from>
+    </identifiers>
+    <auth_results>
+      <spf>
+        <domain>mail.example.com</domain>
+        <result>pass</result>
+      </spf>
+    </auth_results>
+  </record>
+</feedback>
+`
+
+func assertTestReport(t *testing.T, f *Feedback) {
+	assert.Equal(t, "google.com", f.ReportMetadata.OrgName)
+	assert.Equal(t, "5717107811868587391", f.ReportMetadata.ReportID)
+	assert.Equal(t, int64(1700006400), f.ReportMetadata.DateRange.Begin)
+	assert.Equal(t, "2023-11-15T00:00:00Z", f.ReportMetadata.DateRange.BeginTime().Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, "example.com", f.PolicyPublished.Domain)
+	assert.Equal(t, "reject", f.PolicyPublished.P)
+	assert.Equal(t, 100, f.PolicyPublished.Pct)
+	assert.Len(t, f.Records, 3)
+	assert.Equal(t, int64(15), f.TotalCount())
+	assert.Equal(t, "pass", f.Records[2].Row.PolicyEvaluated.SPF)
+	assert.Equal(t, []PolicyOverrideReason{{Type: "forwarded"}}, f.Records[2].Row.PolicyEvaluated.Reasons)
+	assert.Equal(t, []DKIMAuthResult{{Domain: "example.com", Selector: "dkim", Result: "pass"}}, f.Records[0].AuthResults.DKIM)
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(testReport))
+	assert.Nil(t, err)
+	assertTestReport(t, f)
+
+	// 没有 <pct> 时为默认值 100，<pct>0</pct> 保持为 0。
+	f, err = Parse(strings.NewReader(strings.Replace(testReport, "<pct>100</pct>", "", 1)))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, f.PolicyPublished.Pct)
+
+	f, err = Parse(strings.NewReader(strings.Replace(testReport, "<pct>100</pct>", "<pct>0</pct>", 1)))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, f.PolicyPublished.Pct)
+
+	for _, s := range []string{"", "not xml", "<foo></foo>", "<feedback></feedback>"} {
+		_, err = Parse(strings.NewReader(s))
+		assert.ErrorIs(t, err, ErrNotReport, s)
+	}
+}
+
+func TestParseAttachment(t *testing.T) {
+	gz, err := goutils.CompressWithGzip([]byte(testReport))
+	assert.Nil(t, err)
+
+	fs, err := ParseAttachment(gz)
+	assert.Nil(t, err)
+	assert.Len(t, fs, 1)
+	assertTestReport(t, fs[0])
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("google.com!example.com!1700006400!1700092799.xml")
+	assert.Nil(t, err)
+	_, _ = w.Write([]byte(testReport))
+	_, _ = zw.Create("README.txt")
+	assert.Nil(t, zw.Close())
+
+	fs, err = ParseAttachment(b.Bytes())
+	assert.Nil(t, err)
+	assert.Len(t, fs, 1)
+	assertTestReport(t, fs[0])
+
+	fs, err = ParseAttachment([]byte(testReport))
+	assert.Nil(t, err)
+	assert.Len(t, fs, 1)
+
+	_, err = ParseAttachment([]byte{0x1f, 0x8b, 0x00})
+	assert.ErrorIs(t, err, ErrNotReport)
+}
+
+func TestParseMessage(t *testing.T) {
+	gz, err := goutils.CompressWithGzip([]byte(testReport))
+	assert.Nil(t, err)
+
+	msg := "From: noreply-dmarc-support@google.com\r\n" +
+		"To: dmarc@example.com\r\n" +
+		"Subject: Report domain: example.com Submitter: google.com Report-ID: 5717107811868587391\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"This is an aggregate report from google.com.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/gzip; name=\"google.com!example.com!1700006400!1700092799.xml.gz\"\r\n" +
+		"Content-Disposition: attachment; filename=\"google.com!example.com!1700006400!1700092799.xml.gz\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(gz) + "\r\n" +
+		"--b1--\r\n"
+
+	fs, err := ParseMessage(strings.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Len(t, fs, 1)
+	assertTestReport(t, fs[0])
+
+	// 整封邮件就是一个附件。
+	msg = "From: dmarc@example.net\r\n" +
+		"Subject: report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: application/gzip\r\n" +
+		"Content-Disposition: attachment; filename=\"report.xml.gz\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(gz) + "\r\n"
+
+	fs, err = ParseMessage(strings.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Len(t, fs, 1)
+
+	msg = "From: someone@example.net\r\nSubject: hi\r\n\r\nhello\r\n"
+	_, err = ParseMessage(strings.NewReader(msg))
+	assert.ErrorIs(t, err, ErrNoReportFound)
+}
@@ -0,0 +1,211 @@
+// Package dmarcreport 解析、存储及生成 DMARC 聚合报告（aggregate report，RFC 7489 第 7.2 节）。
+//
+// 聚合报告是 XML 格式（RFC 7489 附录 C），通常以 gzip 或 zip 压缩后作为邮件附件发送到
+// DMARC 记录中 rua= 指定的地址。
+//
+// FYI
+//
+//   - https://datatracker.ietf.org/doc/html/rfc7489#section-7.2
+//   - https://datatracker.ietf.org/doc/html/rfc7489#appendix-C
+package dmarcreport
+
+import (
+	"encoding/xml"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Feedback 是一份聚合报告，对应 XML 中的 `<feedback>` 元素。
+type Feedback struct {
+	XMLName         xml.Name        `xml:"feedback"`
+	Version         string          `xml:"version,omitempty"`
+	ReportMetadata  ReportMetadata  `xml:"report_metadata"`
+	PolicyPublished PolicyPublished `xml:"policy_published"`
+	Records         []Record        `xml:"record"`
+}
+
+// ReportMetadata 是报告发送方及报告周期等信息。
+type ReportMetadata struct {
+	OrgName          string    `xml:"org_name"`
+	Email            string    `xml:"email"`
+	ExtraContactInfo string    `xml:"extra_contact_info,omitempty"`
+	ReportID         string    `xml:"report_id"`
+	DateRange        DateRange `xml:"date_range"`
+	Errors           []string  `xml:"error,omitempty"`
+}
+
+// DateRange 是报告周期，值为 UNIX 时间戳（UTC）。
+type DateRange struct {
+	Begin int64 `xml:"begin"`
+	End   int64 `xml:"end"`
+}
+
+// BeginTime 返回报告周期的开始时间。
+func (d DateRange) BeginTime() time.Time { return time.Unix(d.Begin, 0).UTC() }
+
+// EndTime 返回报告周期的结束时间。
+func (d DateRange) EndTime() time.Time { return time.Unix(d.End, 0).UTC() }
+
+// PolicyPublished 是报告周期内查询到的 DMARC 记录。
+type PolicyPublished struct {
+	Domain string `xml:"domain"`
+	ADKIM  string `xml:"adkim,omitempty"`
+	ASPF   string `xml:"aspf,omitempty"`
+	P      string `xml:"p"`
+	SP     string `xml:"sp,omitempty"`
+	NP     string `xml:"np,omitempty"` // RFC 9091
+	Pct    int    `xml:"pct"`          // pct=0 有意义，不能省略；解析时缺失则为 100
+	Fo     string `xml:"fo,omitempty"`
+}
+
+// Record 是同一来源 IP 且校验结果相同的一组邮件。
+type Record struct {
+	Row         Row         `xml:"row"`
+	Identifiers Identifiers `xml:"identifiers"`
+	AuthResults AuthResults `xml:"auth_results"`
+}
+
+type Row struct {
+	SourceIP        string          `xml:"source_ip"`
+	Count           int64           `xml:"count"`
+	PolicyEvaluated PolicyEvaluated `xml:"policy_evaluated"`
+}
+
+// PolicyEvaluated 是 DMARC 校验结果。DKIM 和 SPF 是对齐后的结果，值为 `pass` 或 `fail`。
+type PolicyEvaluated struct {
+	Disposition string                 `xml:"disposition"`
+	DKIM        string                 `xml:"dkim"`
+	SPF         string                 `xml:"spf"`
+	Reasons     []PolicyOverrideReason `xml:"reason,omitempty"`
+}
+
+// PolicyOverrideReason 是未按发布的策略处理邮件的原因，例如 `sampled_out`、`forwarded`。
+type PolicyOverrideReason struct {
+	Type    string `xml:"type"`
+	Comment string `xml:"comment,omitempty"`
+}
+
+type Identifiers struct {
+	EnvelopeTo   string `xml:"envelope_to,omitempty"`
+	EnvelopeFrom string `xml:"envelope_from,omitempty"`
+	HeaderFrom   string `xml:"header_from"`
+}
+
+// AuthResults 是未考虑对齐的原始 DKIM、SPF 校验结果。
+type AuthResults struct {
+	DKIM []DKIMAuthResult `xml:"dkim,omitempty"`
+	SPF  []SPFAuthResult  `xml:"spf"`
+}
+
+type DKIMAuthResult struct {
+	Domain      string `xml:"domain"`
+	Selector    string `xml:"selector,omitempty"`
+	Result      string `xml:"result"`
+	HumanResult string `xml:"human_result,omitempty"`
+}
+
+type SPFAuthResult struct {
+	Domain string `xml:"domain"`
+	Scope  string `xml:"scope,omitempty"` // `helo` 或 `mfrom`
+	Result string `xml:"result"`
+}
+
+// Passed 表示该组邮件通过了 DMARC 校验，即对齐的 DKIM 或 SPF 结果为 pass。
+func (r Record) Passed() bool {
+	return strings.EqualFold(r.Row.PolicyEvaluated.DKIM, "pass") ||
+		strings.EqualFold(r.Row.PolicyEvaluated.SPF, "pass")
+}
+
+// SourceSummary 是一个来源 IP 的统计结果。
+type SourceSummary struct {
+	SourceIP string
+
+	Total int64 // 邮件总数
+	Pass  int64 // 通过 DMARC 校验的邮件数
+	Fail  int64 // 未通过 DMARC 校验的邮件数
+
+	DKIMPass int64 // DKIM 对齐且通过的邮件数
+	SPFPass  int64 // SPF 对齐且通过的邮件数
+
+	// Dispositions 是每种处理方式（none、quarantine、reject）的邮件数。
+	Dispositions map[string]int64
+
+	// HeaderFroms 是该来源 IP 发送的邮件中出现的 From 域名。
+	HeaderFroms []string
+}
+
+// TotalCount 返回报告中的邮件总数。
+func (f *Feedback) TotalCount() (total int64) {
+	for _, r := range f.Records {
+		total += r.Row.Count
+	}
+
+	return
+}
+
+// Summary 按来源 IP 统计通过、未通过 DMARC 校验的邮件数，按邮件总数降序排列。
+func (f *Feedback) Summary() []SourceSummary {
+	return Summarize(f.Records)
+}
+
+// Summarize 按来源 IP 统计通过、未通过 DMARC 校验的邮件数，按邮件总数降序排列，
+// 邮件数相同时按 IP 排列。可用于合并统计多份报告的记录。
+func Summarize(records []Record) (summaries []SourceSummary) {
+	index := make(map[string]int)
+
+	for _, r := range records {
+		ip := r.Row.SourceIP
+
+		i, ok := index[ip]
+		if !ok {
+			i = len(summaries)
+			index[ip] = i
+			summaries = append(summaries, SourceSummary{
+				SourceIP:     ip,
+				Dispositions: make(map[string]int64),
+			})
+		}
+
+		s := &summaries[i]
+		count := r.Row.Count
+		pe := r.Row.PolicyEvaluated
+
+		s.Total += count
+		if r.Passed() {
+			s.Pass += count
+		} else {
+			s.Fail += count
+		}
+
+		if strings.EqualFold(pe.DKIM, "pass") {
+			s.DKIMPass += count
+		}
+
+		if strings.EqualFold(pe.SPF, "pass") {
+			s.SPFPass += count
+		}
+
+		if pe.Disposition != "" {
+			s.Dispositions[strings.ToLower(pe.Disposition)] += count
+		}
+
+		if from := strings.ToLower(r.Identifiers.HeaderFrom); from != "" && !slices.Contains(s.HeaderFroms, from) {
+			s.HeaderFroms = append(s.HeaderFroms, from)
+		}
+	}
+
+	slices.SortStableFunc(summaries, func(a, b SourceSummary) int {
+		if a.Total != b.Total {
+			if a.Total > b.Total {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(a.SourceIP, b.SourceIP)
+	})
+
+	return
+}
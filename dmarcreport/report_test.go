@@ -0,0 +1,34 @@
+package dmarcreport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	f, err := Parse(strings.NewReader(testReport))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []SourceSummary{
+		{
+			SourceIP:     "192.0.2.1",
+			Total:        12,
+			Pass:         12,
+			DKIMPass:     10,
+			SPFPass:      12,
+			Dispositions: map[string]int64{"none": 12},
+			HeaderFroms:  []string{"example.com", "mail.example.com"},
+		},
+		{
+			SourceIP:     "198.51.100.7",
+			Total:        3,
+			Fail:         3,
+			Dispositions: map[string]int64{"reject": 3},
+			HeaderFroms:  []string{"example.com"},
+		},
+	}, f.Summary())
+
+	assert.Empty(t, Summarize(nil))
+}
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS `dmarc_reports` (
+    `id`                    BIGINT UNSIGNED AUTO_INCREMENT,
+    `org_name`              VARCHAR(255) NOT NULL DEFAULT '',
+    `email`                 VARCHAR(255) NOT NULL DEFAULT '',
+    `extra_contact_info`    TEXT,
+    `report_id`             VARCHAR(255) NOT NULL DEFAULT '',
+    `date_begin`            BIGINT NOT NULL DEFAULT 0,
+    `date_end`              BIGINT NOT NULL DEFAULT 0,
+    `errors`                TEXT,
+    `domain`                VARCHAR(255) NOT NULL DEFAULT '',
+    `adkim`                 VARCHAR(10) NOT NULL DEFAULT '',
+    `aspf`                  VARCHAR(10) NOT NULL DEFAULT '',
+    `p`                     VARCHAR(20) NOT NULL DEFAULT '',
+    `sp`                    VARCHAR(20) NOT NULL DEFAULT '',
+    `np`                    VARCHAR(20) NOT NULL DEFAULT '',
+    `pct`                   INT NOT NULL DEFAULT 0,
+    `fo`                    VARCHAR(20) NOT NULL DEFAULT '',
+    `total`                 BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_dmarc_reports_org_name_report_id` (`org_name`, `report_id`),
+    INDEX `idx_dmarc_reports_domain` (`domain`),
+    INDEX `idx_dmarc_reports_date_begin` (`date_begin`)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `dmarc_report_records` (
+    `id`            BIGINT UNSIGNED AUTO_INCREMENT,
+    `report_pk`     BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    `source_ip`     VARCHAR(45) NOT NULL DEFAULT '',
+    `count`         BIGINT NOT NULL DEFAULT 0,
+    `disposition`   VARCHAR(20) NOT NULL DEFAULT '',
+    `dkim`          VARCHAR(20) NOT NULL DEFAULT '',
+    `spf`           VARCHAR(20) NOT NULL DEFAULT '',
+    `reasons`       TEXT,
+    `envelope_to`   VARCHAR(255) NOT NULL DEFAULT '',
+    `envelope_from` VARCHAR(255) NOT NULL DEFAULT '',
+    `header_from`   VARCHAR(255) NOT NULL DEFAULT '',
+    `dkim_results`  TEXT,
+    `spf_results`   TEXT,
+    PRIMARY KEY (`id`),
+    INDEX `idx_dmarc_report_records_report_pk` (`report_pk`),
+    INDEX `idx_dmarc_report_records_source_ip` (`source_ip`)
+) ENGINE=InnoDB;
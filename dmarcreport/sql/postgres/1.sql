@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS dmarc_reports (
+    id                  BIGSERIAL PRIMARY KEY,
+    org_name            VARCHAR(255) NOT NULL DEFAULT '',
+    email               VARCHAR(255) NOT NULL DEFAULT '',
+    extra_contact_info  TEXT NOT NULL DEFAULT '',
+    report_id           VARCHAR(255) NOT NULL DEFAULT '',
+    date_begin          BIGINT NOT NULL DEFAULT 0,
+    date_end            BIGINT NOT NULL DEFAULT 0,
+    errors              TEXT NOT NULL DEFAULT '',
+    domain              VARCHAR(255) NOT NULL DEFAULT '',
+    adkim               VARCHAR(10) NOT NULL DEFAULT '',
+    aspf                VARCHAR(10) NOT NULL DEFAULT '',
+    p                   VARCHAR(20) NOT NULL DEFAULT '',
+    sp                  VARCHAR(20) NOT NULL DEFAULT '',
+    np                  VARCHAR(20) NOT NULL DEFAULT '',
+    pct                 INTEGER NOT NULL DEFAULT 0,
+    fo                  VARCHAR(20) NOT NULL DEFAULT '',
+    total               BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dmarc_reports_org_name_report_id ON dmarc_reports (org_name, report_id);
+CREATE INDEX IF NOT EXISTS idx_dmarc_reports_domain ON dmarc_reports (domain);
+CREATE INDEX IF NOT EXISTS idx_dmarc_reports_date_begin ON dmarc_reports (date_begin);
+
+CREATE TABLE IF NOT EXISTS dmarc_report_records (
+    id              BIGSERIAL PRIMARY KEY,
+    report_pk       BIGINT NOT NULL DEFAULT 0,
+    source_ip       VARCHAR(45) NOT NULL DEFAULT '',
+    count           BIGINT NOT NULL DEFAULT 0,
+    disposition     VARCHAR(20) NOT NULL DEFAULT '',
+    dkim            VARCHAR(20) NOT NULL DEFAULT '',
+    spf             VARCHAR(20) NOT NULL DEFAULT '',
+    reasons         TEXT NOT NULL DEFAULT '',
+    envelope_to     VARCHAR(255) NOT NULL DEFAULT '',
+    envelope_from   VARCHAR(255) NOT NULL DEFAULT '',
+    header_from     VARCHAR(255) NOT NULL DEFAULT '',
+    dkim_results    TEXT NOT NULL DEFAULT '',
+    spf_results     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_dmarc_report_records_report_pk ON dmarc_report_records (report_pk);
+CREATE INDEX IF NOT EXISTS idx_dmarc_report_records_source_ip ON dmarc_report_records (source_ip);
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS dmarc_reports (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    org_name            TEXT NOT NULL DEFAULT '',
+    email               TEXT NOT NULL DEFAULT '',
+    extra_contact_info  TEXT NOT NULL DEFAULT '',
+    report_id           TEXT NOT NULL DEFAULT '',
+    date_begin          INTEGER NOT NULL DEFAULT 0,
+    date_end            INTEGER NOT NULL DEFAULT 0,
+    errors              TEXT NOT NULL DEFAULT '',
+    domain              TEXT NOT NULL DEFAULT '',
+    adkim               TEXT NOT NULL DEFAULT '',
+    aspf                TEXT NOT NULL DEFAULT '',
+    p                   TEXT NOT NULL DEFAULT '',
+    sp                  TEXT NOT NULL DEFAULT '',
+    np                  TEXT NOT NULL DEFAULT '',
+    pct                 INTEGER NOT NULL DEFAULT 0,
+    fo                  TEXT NOT NULL DEFAULT '',
+    total               INTEGER NOT NULL DEFAULT 0
+) STRICT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dmarc_reports_org_name_report_id ON dmarc_reports (org_name, report_id);
+CREATE INDEX IF NOT EXISTS idx_dmarc_reports_domain ON dmarc_reports (domain);
+CREATE INDEX IF NOT EXISTS idx_dmarc_reports_date_begin ON dmarc_reports (date_begin);
+
+CREATE TABLE IF NOT EXISTS dmarc_report_records (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    report_pk       INTEGER NOT NULL DEFAULT 0,
+    source_ip       TEXT NOT NULL DEFAULT '',
+    count           INTEGER NOT NULL DEFAULT 0,
+    disposition     TEXT NOT NULL DEFAULT '',
+    dkim            TEXT NOT NULL DEFAULT '',
+    spf             TEXT NOT NULL DEFAULT '',
+    reasons         TEXT NOT NULL DEFAULT '',
+    envelope_to     TEXT NOT NULL DEFAULT '',
+    envelope_from   TEXT NOT NULL DEFAULT '',
+    header_from     TEXT NOT NULL DEFAULT '',
+    dkim_results    TEXT NOT NULL DEFAULT '',
+    spf_results     TEXT NOT NULL DEFAULT ''
+) STRICT;
+
+CREATE INDEX IF NOT EXISTS idx_dmarc_report_records_report_pk ON dmarc_report_records (report_pk);
+CREATE INDEX IF NOT EXISTS idx_dmarc_report_records_source_ip ON dmarc_report_records (source_ip);
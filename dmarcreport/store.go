@@ -0,0 +1,404 @@
+package dmarcreport
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+	"unicode/utf8"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
+
+	"github.com/iredmail/goutils/sqlutils"
+)
+
+// SchemaVersion 是当前 SQL 表结构版本，对应 `sql/<dialect>/<version>.sql`。
+const SchemaVersion = 1
+
+// schemaVersionKey 是 `system` 表中记录表结构版本的 key，与程序自身的表结构版本分开记录。
+const schemaVersionKey = "dmarcreport_sql_schema_version"
+
+const (
+	tableReports = "dmarc_reports"
+	tableRecords = "dmarc_report_records"
+)
+
+var ErrDuplicateReport = errors.New("dmarcreport: report already exists")
+
+//go:embed sql
+var sqlFiles embed.FS
+
+// Store 使用 goqu 将聚合报告存储到 SQLite、MySQL 或 PostgreSQL 数据库。
+type Store struct {
+	gdb *goqu.Database
+}
+
+// NewStore 创建或升级数据表后返回 Store。
+//
+// 注意：
+//   - 表结构版本记录在 `system` 表中（参考 sqlutils.UpgradeSQLSchemaWithKey），使用单独的 key，
+//     因此可以与使用 sqlutils.UpgradeSQLSchema 的程序共用同一个数据库。
+//   - SQL 文件包含多条语句，MySQL 的 DSN 需要设置 `multiStatements=true`。
+//   - goqu 的 dialect 名称应为 `sqlite`、`mysql` 或 `postgres`。
+func NewStore(dbName string, gdb *goqu.Database) (s *Store, err error) {
+	sub, err := SQLFiles(gdb.Dialect())
+	if err != nil {
+		return
+	}
+
+	if err = sqlutils.UpgradeSQLSchemaWithKey(dbName, gdb, schemaVersionKey, sub, SchemaVersion, ".sql"); err != nil {
+		return
+	}
+
+	s = &Store{gdb: gdb}
+
+	return
+}
+
+// SQLFiles 返回指定 dialect 的 SQL 文件，供自行管理表结构的程序使用。
+func SQLFiles(dialect string) (fs.FS, error) {
+	switch dialect {
+	case "sqlite", "sqlite3":
+		return fs.Sub(sqlFiles, "sql/sqlite")
+	case "mysql":
+		return fs.Sub(sqlFiles, "sql/mysql")
+	case "postgres":
+		return fs.Sub(sqlFiles, "sql/postgres")
+	}
+
+	return nil, fmt.Errorf("unsupported dialect type: %s", dialect)
+}
+
+type reportRow struct {
+	ID               int64  `db:"id" goqu:"skipinsert"`
+	OrgName          string `db:"org_name"`
+	Email            string `db:"email"`
+	ExtraContactInfo string `db:"extra_contact_info"`
+	ReportID         string `db:"report_id"`
+	DateBegin        int64  `db:"date_begin"`
+	DateEnd          int64  `db:"date_end"`
+	Errors           string `db:"errors"` // JSON
+	Domain           string `db:"domain"`
+	ADKIM            string `db:"adkim"`
+	ASPF             string `db:"aspf"`
+	P                string `db:"p"`
+	SP               string `db:"sp"`
+	NP               string `db:"np"`
+	Pct              int    `db:"pct"`
+	Fo               string `db:"fo"`
+	Total            int64  `db:"total"`
+}
+
+type recordRow struct {
+	ID           int64  `db:"id" goqu:"skipinsert"`
+	ReportPK     int64  `db:"report_pk"`
+	SourceIP     string `db:"source_ip"`
+	Count        int64  `db:"count"`
+	Disposition  string `db:"disposition"`
+	DKIM         string `db:"dkim"`
+	SPF          string `db:"spf"`
+	Reasons      string `db:"reasons"` // JSON
+	EnvelopeTo   string `db:"envelope_to"`
+	EnvelopeFrom string `db:"envelope_from"`
+	HeaderFrom   string `db:"header_from"`
+	DKIMResults  string `db:"dkim_results"` // JSON
+	SPFResults   string `db:"spf_results"`  // JSON
+}
+
+// ReportInfo 是已存储报告的概要信息。
+type ReportInfo struct {
+	ID       int64 // 数据库中的主键
+	OrgName  string
+	Email    string
+	ReportID string
+	Domain   string
+	Begin    time.Time
+	End      time.Time
+	Total    int64 // 邮件总数
+}
+
+// Save 存储一份报告，返回报告在数据库中的主键。
+// 同一发送方（org_name）的同一 report_id 已存在时返回 ErrDuplicateReport。
+func (s *Store) Save(f *Feedback) (id int64, err error) {
+	m, p := f.ReportMetadata, f.PolicyPublished
+
+	// 报告来自不可信的第三方，超过字段长度（参考 sql/*/1.sql）的值被截断，
+	// 否则 MySQL（strict 模式）和 PostgreSQL 会拒绝插入。
+	row := reportRow{
+		OrgName:          truncate(m.OrgName, 255),
+		Email:            truncate(m.Email, 255),
+		ExtraContactInfo: m.ExtraContactInfo,
+		ReportID:         truncate(m.ReportID, 255),
+		DateBegin:        m.DateRange.Begin,
+		DateEnd:          m.DateRange.End,
+		Errors:           toJSON(m.Errors),
+		Domain:           truncate(p.Domain, 255),
+		ADKIM:            truncate(p.ADKIM, 10),
+		ASPF:             truncate(p.ASPF, 10),
+		P:                truncate(p.P, 20),
+		SP:               truncate(p.SP, 20),
+		NP:               truncate(p.NP, 20),
+		Pct:              p.Pct,
+		Fo:               truncate(p.Fo, 20),
+		Total:            f.TotalCount(),
+	}
+
+	err = s.gdb.WithTx(func(tx *goqu.TxDatabase) error {
+		count, err := tx.From(tableReports).
+			Where(goqu.Ex{
+				"org_name":  row.OrgName,
+				"report_id": row.ReportID,
+			}).
+			Count()
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return fmt.Errorf("%w: %s %s", ErrDuplicateReport, row.OrgName, row.ReportID)
+		}
+
+		id, err = insertReturningID(tx, tx.Insert(tableReports).Prepared(true).Rows(row))
+		if err != nil {
+			return err
+		}
+
+		if len(f.Records) == 0 {
+			return nil
+		}
+
+		rows := make([]recordRow, 0, len(f.Records))
+		for _, r := range f.Records {
+			pe := r.Row.PolicyEvaluated
+
+			rows = append(rows, recordRow{
+				ReportPK:     id,
+				SourceIP:     truncate(r.Row.SourceIP, 45),
+				Count:        r.Row.Count,
+				Disposition:  truncate(pe.Disposition, 20),
+				DKIM:         truncate(pe.DKIM, 20),
+				SPF:          truncate(pe.SPF, 20),
+				Reasons:      toJSON(pe.Reasons),
+				EnvelopeTo:   truncate(r.Identifiers.EnvelopeTo, 255),
+				EnvelopeFrom: truncate(r.Identifiers.EnvelopeFrom, 255),
+				HeaderFrom:   truncate(r.Identifiers.HeaderFrom, 255),
+				DKIMResults:  toJSON(r.AuthResults.DKIM),
+				SPFResults:   toJSON(r.AuthResults.SPF),
+			})
+		}
+
+		_, err = tx.Insert(tableRecords).Prepared(true).Rows(rows).Executor().Exec()
+
+		return err
+	})
+
+	if err != nil {
+		id = 0
+	}
+
+	return
+}
+
+// truncate 将 s 截断为最多 n 个字符（而不是字节），与 VARCHAR(n) 的长度单位相同。
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// insertReturningID 执行插入并返回新记录的主键。PostgreSQL 不支持 LastInsertId，使用 RETURNING。
+func insertReturningID(tx *goqu.TxDatabase, ds *goqu.InsertDataset) (id int64, err error) {
+	if tx.Dialect() == "postgres" {
+		_, err = ds.Returning("id").Executor().ScanVal(&id)
+
+		return
+	}
+
+	res, err := ds.Executor().Exec()
+	if err != nil {
+		return
+	}
+
+	return res.LastInsertId()
+}
+
+// Get 返回指定主键的报告，未找到时 found 为 false。
+func (s *Store) Get(id int64) (f *Feedback, found bool, err error) {
+	var row reportRow
+
+	found, err = s.gdb.From(tableReports).
+		Where(goqu.Ex{"id": id}).
+		ScanStruct(&row)
+	if err != nil || !found {
+		return
+	}
+
+	f = &Feedback{
+		ReportMetadata: ReportMetadata{
+			OrgName:          row.OrgName,
+			Email:            row.Email,
+			ExtraContactInfo: row.ExtraContactInfo,
+			ReportID:         row.ReportID,
+			DateRange:        DateRange{Begin: row.DateBegin, End: row.DateEnd},
+		},
+		PolicyPublished: PolicyPublished{
+			Domain: row.Domain,
+			ADKIM:  row.ADKIM,
+			ASPF:   row.ASPF,
+			P:      row.P,
+			SP:     row.SP,
+			NP:     row.NP,
+			Pct:    row.Pct,
+			Fo:     row.Fo,
+		},
+	}
+
+	if err = fromJSON(row.Errors, &f.ReportMetadata.Errors); err != nil {
+		return
+	}
+
+	f.Records, err = s.records(goqu.Ex{"report_pk": id})
+
+	return
+}
+
+// List 返回指定域名在 [begin, end) 时间范围内开始的报告，按开始时间降序排列。
+// domain 为空时返回所有域名的报告。
+func (s *Store) List(domain string, begin, end time.Time) (infos []ReportInfo, err error) {
+	var rows []reportRow
+
+	err = s.gdb.From(tableReports).
+		Where(reportFilter(domain, begin, end)).
+		Order(goqu.C("date_begin").Desc(), goqu.C("id").Desc()).
+		ScanStructs(&rows)
+	if err != nil {
+		return
+	}
+
+	for _, row := range rows {
+		infos = append(infos, ReportInfo{
+			ID:       row.ID,
+			OrgName:  row.OrgName,
+			Email:    row.Email,
+			ReportID: row.ReportID,
+			Domain:   row.Domain,
+			Begin:    DateRange{Begin: row.DateBegin}.BeginTime(),
+			End:      DateRange{End: row.DateEnd}.EndTime(),
+			Total:    row.Total,
+		})
+	}
+
+	return
+}
+
+// Summary 按来源 IP 统计指定域名在 [begin, end) 时间范围内开始的所有报告，参考 Summarize。
+func (s *Store) Summary(domain string, begin, end time.Time) (summaries []SourceSummary, err error) {
+	ids := s.gdb.From(tableReports).
+		Select("id").
+		Where(reportFilter(domain, begin, end))
+
+	records, err := s.records(goqu.Ex{"report_pk": goqu.Op{"in": ids}})
+	if err != nil {
+		return
+	}
+
+	summaries = Summarize(records)
+
+	return
+}
+
+// Delete 删除指定主键的报告。
+func (s *Store) Delete(id int64) error {
+	return s.gdb.WithTx(func(tx *goqu.TxDatabase) error {
+		_, err := tx.Delete(tableRecords).Where(goqu.Ex{"report_pk": id}).Executor().Exec()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Delete(tableReports).Where(goqu.Ex{"id": id}).Executor().Exec()
+
+		return err
+	})
+}
+
+func reportFilter(domain string, begin, end time.Time) exp.ExpressionList {
+	where := goqu.And(
+		goqu.C("date_begin").Gte(begin.Unix()),
+		goqu.C("date_begin").Lt(end.Unix()),
+	)
+
+	if domain != "" {
+		where = where.Append(goqu.C("domain").Eq(lower(domain)))
+	}
+
+	return where
+}
+
+func (s *Store) records(where goqu.Ex) (records []Record, err error) {
+	var rows []recordRow
+
+	err = s.gdb.From(tableRecords).
+		Where(where).
+		Order(goqu.C("id").Asc()).
+		ScanStructs(&rows)
+	if err != nil {
+		return
+	}
+
+	for _, row := range rows {
+		r := Record{
+			Row: Row{
+				SourceIP: row.SourceIP,
+				Count:    row.Count,
+				PolicyEvaluated: PolicyEvaluated{
+					Disposition: row.Disposition,
+					DKIM:        row.DKIM,
+					SPF:         row.SPF,
+				},
+			},
+			Identifiers: Identifiers{
+				EnvelopeTo:   row.EnvelopeTo,
+				EnvelopeFrom: row.EnvelopeFrom,
+				HeaderFrom:   row.HeaderFrom,
+			},
+		}
+
+		if err = errors.Join(
+			fromJSON(row.Reasons, &r.Row.PolicyEvaluated.Reasons),
+			fromJSON(row.DKIMResults, &r.AuthResults.DKIM),
+			fromJSON(row.SPFResults, &r.AuthResults.SPF),
+		); err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return
+}
+
+// toJSON 将列表编码为 JSON 存储到 TEXT 字段，空列表存储为空字符串。
+func toJSON[T any](v []T) string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(v)
+
+	return string(b)
+}
+
+func fromJSON[T any](s string, v *[]T) error {
+	if s == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(s), v)
+}
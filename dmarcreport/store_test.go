@@ -0,0 +1,147 @@
+package dmarcreport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+
+	"github.com/iredmail/goutils/sqlutils"
+)
+
+func setupStore(t *testing.T) (*Store, func()) {
+	dbFile, err := os.CreateTemp("", "goutils_dmarcreport_test_*.db")
+	assert.Nil(t, err)
+	_ = dbFile.Close()
+
+	sqliteDB, err := sqlutils.InitSQLiteDB(dbFile.Name(), nil, 0, 0)
+	assert.Nil(t, err)
+
+	gdb := goqu.New("sqlite", sqliteDB)
+
+	s, err := NewStore("", gdb)
+	assert.Nil(t, err)
+
+	// 再次打开时不会重复创建数据表。
+	_, err = NewStore("", gdb)
+	assert.Nil(t, err)
+
+	return s, func() {
+		_ = sqliteDB.Close()
+		_ = os.Remove(dbFile.Name())
+	}
+}
+
+func TestNewStoreWithSystemTable(t *testing.T) {
+	sqliteDB, err := sqlutils.InitSQLiteDB(filepath.Join(t.TempDir(), "app.db"), nil, 0, 0)
+	assert.Nil(t, err)
+	defer sqliteDB.Close()
+
+	gdb := goqu.New("sqlite", sqliteDB)
+
+	// 程序已经使用 UpgradeSQLSchema 管理自己的数据表，版本为 3。
+	assert.Nil(t, sqlutils.UpgradeSQLSchema("", gdb, nil, 3, ".sql"))
+
+	s, err := NewStore("", gdb)
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+
+	f, err := Parse(strings.NewReader(testReport))
+	assert.Nil(t, err)
+
+	id, err := s.Save(f)
+	assert.Nil(t, err)
+	assert.Positive(t, id)
+
+	var versions []sqlutils.KVInt
+	err = gdb.From("system").Order(goqu.C("k").Asc()).ScanStructs(&versions)
+	assert.Nil(t, err)
+	assert.Equal(t, []sqlutils.KVInt{
+		{K: schemaVersionKey, V: SchemaVersion},
+		{K: "sql_schema_version", V: 3},
+	}, versions)
+}
+
+func TestStore(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	f, err := Parse(strings.NewReader(testReport))
+	assert.Nil(t, err)
+	f.ReportMetadata.Errors = []string{"something went wrong"}
+
+	id, err := s.Save(f)
+	assert.Nil(t, err)
+	assert.Positive(t, id)
+
+	_, err = s.Save(f)
+	assert.ErrorIs(t, err, ErrDuplicateReport)
+
+	got, found, err := s.Get(id)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, f.ReportMetadata, got.ReportMetadata)
+	assert.Equal(t, f.PolicyPublished, got.PolicyPublished)
+	assert.Equal(t, f.Records, got.Records)
+
+	_, found, err = s.Get(id + 100)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	begin := time.Unix(1700000000, 0)
+	end := time.Unix(1700100000, 0)
+
+	infos, err := s.List("EXAMPLE.com", begin, end)
+	assert.Nil(t, err)
+	assert.Equal(t, []ReportInfo{{
+		ID:       id,
+		OrgName:  "google.com",
+		Email:    "noreply-dmarc-support@google.com",
+		ReportID: "5717107811868587391",
+		Domain:   "example.com",
+		Begin:    time.Unix(1700006400, 0).UTC(),
+		End:      time.Unix(1700092799, 0).UTC(),
+		Total:    15,
+	}}, infos)
+
+	infos, err = s.List("other.example", begin, end)
+	assert.Nil(t, err)
+	assert.Empty(t, infos)
+
+	infos, err = s.List("", end, end.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, infos)
+
+	summaries, err := s.Summary("example.com", begin, end)
+	assert.Nil(t, err)
+	assert.Equal(t, f.Summary(), summaries)
+
+	assert.Nil(t, s.Delete(id))
+	_, found, err = s.Get(id)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	summaries, err = s.Summary("", begin, end)
+	assert.Nil(t, err)
+	assert.Empty(t, summaries)
+	// 超过字段长度的值被截断。
+	f.ReportMetadata.OrgName = strings.Repeat("组织", 200)
+	f.ReportMetadata.ReportID = strings.Repeat("x", 300)
+	f.PolicyPublished.P = strings.Repeat("p", 30)
+	f.Records[0].Row.SourceIP = strings.Repeat("1", 50)
+
+	id, err = s.Save(f)
+	assert.Nil(t, err)
+
+	got, _, err = s.Get(id)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("组织", 200)[:len("组织")*127]+"组", got.ReportMetadata.OrgName)
+	assert.Equal(t, strings.Repeat("x", 255), got.ReportMetadata.ReportID)
+	assert.Equal(t, strings.Repeat("p", 20), got.PolicyPublished.P)
+	assert.Equal(t, strings.Repeat("1", 45), got.Records[0].Row.SourceIP)
+}
@@ -123,10 +123,25 @@ func LookupMX(domain string) (notfound bool, records []MXRecord, errStr string)
 	ctx, cancel := context.WithTimeout(context.Background(), defaultDNSQueryTimeout)
 	defer cancel()
 
-	var mxs []*net.MX
-	mxs, err := net.DefaultResolver.LookupMX(ctx, domain)
-	notfound, errStr = IsDNSErrorNoSuchHost(err)
-	if notfound || err != nil {
+	notfound, records, err := LookupMXWithResolver(ctx, net.DefaultResolver, domain)
+	if err != nil {
+		errStr = err.Error()
+	}
+
+	return
+}
+
+// LookupMXWithResolver 与 LookupMX 相同，但使用指定的 Resolver 查询，返回的记录按优先级排序。
+//
+// 域名没有 MX 记录时 notfound 为 true，err 为 nil。
+// Null MX 记录（RFC 7505，即 `0 .`）的 MX 为空字符串。
+func LookupMXWithResolver(ctx context.Context, r Resolver, domain string) (notfound bool, records []MXRecord, err error) {
+	mxs, err := r.LookupMX(ctx, domain)
+	if err != nil {
+		if notfound, _ = IsDNSErrorNoSuchHost(err); notfound || IsNotFound(err) {
+			return true, nil, nil
+		}
+
 		return
 	}
 
@@ -138,7 +153,7 @@ func LookupMX(domain string) (notfound bool, records []MXRecord, errStr string)
 	}
 
 	// Sort by mx priority
-	slices.SortFunc(records, func(a, b MXRecord) int {
+	slices.SortStableFunc(records, func(a, b MXRecord) int {
 		return cmp.Compare(a.Priority, b.Priority)
 	})
 
@@ -1,6 +1,8 @@
 package dnsutils
 
 import (
+	"context"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,3 +22,31 @@ func TestLookupRecursiveSPF(t *testing.T) {
 	assert.Equal(t, totalQueries, 2)
 	assert.Equal(t, records, []string{"v=spf1 redirect=_spf.google.com"})
 }
+
+func TestLookupMXWithResolver(t *testing.T) {
+	r := &MemoryResolver{
+		MX: map[string][]*net.MX{
+			"example.com.": {{Host: "mx2.example.com.", Pref: 20}, {Host: "mx1.example.com.", Pref: 10}},
+			"null.test":    {{Host: ".", Pref: 0}},
+		},
+		Errors: map[string]error{"servfail.test": &net.DNSError{Err: "server misbehaving", Name: "servfail.test"}},
+	}
+
+	notfound, records, err := LookupMXWithResolver(context.Background(), r, "example.com")
+	assert.Nil(t, err)
+	assert.False(t, notfound)
+	assert.Equal(t, []MXRecord{{MX: "mx1.example.com", Priority: 10}, {MX: "mx2.example.com", Priority: 20}}, records)
+
+	_, records, err = LookupMXWithResolver(context.Background(), r, "null.test")
+	assert.Nil(t, err)
+	assert.Equal(t, []MXRecord{{MX: "", Priority: 0}}, records)
+
+	notfound, records, err = LookupMXWithResolver(context.Background(), r, "nonexistent.test")
+	assert.Nil(t, err)
+	assert.True(t, notfound)
+	assert.Empty(t, records)
+
+	notfound, _, err = LookupMXWithResolver(context.Background(), r, "servfail.test")
+	assert.NotNil(t, err)
+	assert.False(t, notfound)
+}
@@ -0,0 +1,90 @@
+package dnsutils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Resolver 是 DNS 查询接口，`*net.Resolver`（包括 net.DefaultResolver）实现了此接口。
+// 测试时可以使用 MemoryResolver 代替真实的 DNS 查询。
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// IsNotFound 检查 DNS 查询错误是否表示记录不存在（NXDOMAIN 或没有此类型的记录）。
+func IsNotFound(err error) bool {
+	if dnsErr, ok := errors.AsType[*net.DNSError](err); ok {
+		return dnsErr.IsNotFound
+	}
+
+	return false
+}
+
+// MemoryResolver 是基于内存数据的 Resolver，用于测试。
+// 域名不区分大小写，末尾的 `.` 会被忽略；不存在的记录返回 IsNotFound 为 true 的错误。
+type MemoryResolver struct {
+	TXT map[string][]string
+	IP  map[string][]net.IP // A 和 AAAA 记录
+	MX  map[string][]*net.MX
+	PTR map[string][]string // key 是 IP 地址，例如 `192.0.2.1`
+
+	// Errors 中的域名（小写）或 IP 地址查询任何记录都返回对应的错误，用于模拟查询失败。
+	Errors map[string]error
+}
+
+func (r *MemoryResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return memoryLookup(r, r.TXT, name)
+}
+
+func (r *MemoryResolver) LookupIP(_ context.Context, network, host string) (ips []net.IP, err error) {
+	all, err := memoryLookup(r, r.IP, host)
+	if err != nil {
+		return
+	}
+
+	for _, ip := range all {
+		isIPv4 := ip.To4() != nil
+		if network == "ip" || (network == "ip4" && isIPv4) || (network == "ip6" && !isIPv4) {
+			ips = append(ips, ip)
+		}
+	}
+
+	if len(ips) == 0 {
+		err = notFoundError(host)
+	}
+
+	return
+}
+
+func (r *MemoryResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	return memoryLookup(r, r.MX, name)
+}
+
+func (r *MemoryResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	return memoryLookup(r, r.PTR, addr)
+}
+
+func memoryLookup[T any](r *MemoryResolver, records map[string][]T, name string) ([]T, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if err, found := r.Errors[name]; found {
+		return nil, err
+	}
+
+	for k, v := range records {
+		if strings.EqualFold(strings.TrimSuffix(k, "."), name) && len(v) > 0 {
+			return v, nil
+		}
+	}
+
+	return nil, notFoundError(name)
+}
+
+func notFoundError(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
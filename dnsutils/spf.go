@@ -0,0 +1,754 @@
+package dnsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SPFResult 是 SPF 校验结果（RFC 7208 第 2.6 节）。
+type SPFResult string
+
+const (
+	SPFPass      SPFResult = "pass"
+	SPFFail      SPFResult = "fail"
+	SPFSoftFail  SPFResult = "softfail"
+	SPFNeutral   SPFResult = "neutral"
+	SPFNone      SPFResult = "none"
+	SPFTempError SPFResult = "temperror"
+	SPFPermError SPFResult = "permerror"
+)
+
+const (
+	// SPFMaxLookups 是一次 SPF 校验中允许的最大 DNS 查询次数（include、a、mx、ptr、
+	// exists 及 redirect），超过时结果为 permerror（RFC 7208 第 4.6.4 节）。
+	SPFMaxLookups = 10
+
+	// SPFMaxVoidLookups 是允许的最大无结果（NXDOMAIN 或没有记录）DNS 查询次数。
+	SPFMaxVoidLookups = 2
+
+	// spfMaxNames 是 mx 和 ptr 机制中最多处理的 MX / PTR 记录数量。
+	spfMaxNames = 10
+
+	// spfTimeout 是一次 SPF 校验的总超时时间。
+	spfTimeout = 20 * time.Second
+)
+
+var (
+	ErrSPFSyntax            = errors.New("spf: invalid record")
+	ErrSPFMultipleRecords   = errors.New("spf: multiple SPF records")
+	ErrSPFTooManyLookups    = errors.New("spf: too many DNS lookups")
+	ErrSPFTooManyVoid       = errors.New("spf: too many void DNS lookups")
+	ErrSPFIncludeNoRecord   = errors.New("spf: included domain has no SPF record")
+	ErrSPFRedirectNoRecord  = errors.New("spf: redirect domain has no SPF record")
+	ErrSPFTemporaryDNSError = errors.New("spf: temporary DNS error")
+
+	regxSPFVersion = regexp.MustCompile(`(?i)^v=spf1( |$)`)
+	regxSPFCIDR    = regexp.MustCompile(`^(.*?)(?:/(\d+))?(?://(\d+))?$`)
+	regxSPFName    = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]*$`)
+)
+
+// SPFCheckResult 是 CheckHost 的返回值。
+type SPFCheckResult struct {
+	Result SPFResult
+
+	// Mechanism 是匹配的机制，例如 `ip4:192.0.2.0/24`、`-all`、`include:_spf.example.com`。
+	// 没有匹配任何机制时为 `default`，使用了 redirect 时为 redirect 的域名中匹配的机制。
+	Mechanism string
+
+	// Explanation 是结果为 fail 时 `exp=` 修饰符指定的说明文字。
+	Explanation string
+
+	// Err 是结果为 temperror 或 permerror 的原因。
+	Err error
+}
+
+type spfChecker struct {
+	ctx      context.Context
+	resolver Resolver
+	timeout  time.Duration
+
+	ip       net.IP
+	sender   string
+	helo     string
+	receiver string
+
+	lookups     int
+	voidLookups int
+
+	validatedName string // `p` 宏的值，首次使用时查询
+}
+
+type SPFOption func(c *spfChecker)
+
+// WithSPFResolver 指定 DNS 查询使用的 Resolver，默认为 net.DefaultResolver。
+func WithSPFResolver(r Resolver) SPFOption {
+	return func(c *spfChecker) {
+		c.resolver = r
+	}
+}
+
+// WithSPFHelo 指定 SMTP 会话中 HELO / EHLO 的主机名，用于 `%{h}` 宏。
+func WithSPFHelo(helo string) SPFOption {
+	return func(c *spfChecker) {
+		c.helo = helo
+	}
+}
+
+// WithSPFReceiver 指定执行 SPF 校验的主机名，用于 explanation 中的 `%{r}` 宏。
+func WithSPFReceiver(receiver string) SPFOption {
+	return func(c *spfChecker) {
+		c.receiver = receiver
+	}
+}
+
+// WithSPFTimeout 指定 SPF 校验的总超时时间，默认为 20 秒。
+func WithSPFTimeout(d time.Duration) SPFOption {
+	return func(c *spfChecker) {
+		c.timeout = d
+	}
+}
+
+// CheckHost 按 RFC 7208 的 check_host() 函数校验 IP 地址 ip 是否允许以 domain 的名义发送邮件。
+//
+//   - domain 通常是 sender（MAIL FROM 地址）的域名；MAIL FROM 为空时是 HELO 主机名。
+//   - sender 是 MAIL FROM 地址，为空或不包含 `@` 时使用 `postmaster@<domain>`。
+func CheckHost(ip net.IP, domain, sender string, opts ...SPFOption) (r SPFCheckResult) {
+	c := &spfChecker{
+		resolver: net.DefaultResolver,
+		timeout:  spfTimeout,
+		ip:       ip,
+		sender:   sender,
+		helo:     domain,
+		receiver: "unknown",
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		c.ip = ip4
+	}
+
+	local, senderDomain, found := strings.Cut(c.sender, "@")
+	if !found {
+		local, senderDomain = "", c.sender
+	}
+
+	if senderDomain == "" {
+		senderDomain = domain
+	}
+
+	if local == "" {
+		local = "postmaster"
+	}
+
+	c.sender = local + "@" + senderDomain
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	c.ctx = ctx
+
+	return c.checkHost(domain, true)
+}
+
+// checkHost 校验 domain 的 SPF 记录，include 和 redirect 会递归调用。
+// wantExp 表示结果为 fail 时是否需要查询 exp= 说明文字。
+func (c *spfChecker) checkHost(domain string, wantExp bool) (r SPFCheckResult) {
+	domain = strings.TrimSuffix(domain, ".")
+	if !isSPFDomain(domain) {
+		r.Result = SPFNone
+
+		return
+	}
+
+	record, err := c.lookupSPF(domain)
+	if err != nil {
+		r.Result, r.Err = SPFTempError, err
+		if errors.Is(err, ErrSPFMultipleRecords) {
+			r.Result = SPFPermError
+		}
+
+		return
+	}
+
+	if record == "" {
+		r.Result = SPFNone
+
+		return
+	}
+
+	rec, err := parseSPFRecord(record)
+	if err != nil {
+		r.Result, r.Err = SPFPermError, err
+
+		return
+	}
+
+	for _, term := range rec.terms {
+		matched, err := c.match(term, domain)
+		if err != nil {
+			r.Result, r.Err, r.Mechanism = spfErrorResult(err), err, term.raw
+
+			return
+		}
+
+		if matched {
+			r.Result, r.Mechanism = term.result(), term.raw
+
+			if r.Result == SPFFail && wantExp && rec.exp != "" {
+				r.Explanation = c.explain(rec.exp, domain)
+			}
+
+			return
+		}
+	}
+
+	if rec.redirect != "" {
+		if err = c.countLookup(); err != nil {
+			r.Result, r.Err = SPFPermError, err
+
+			return
+		}
+
+		target, err := c.expandDomainSpec(rec.redirect, domain)
+		if err != nil {
+			r.Result, r.Err = spfErrorResult(err), err
+
+			return
+		}
+
+		r = c.checkHost(target, wantExp)
+		if r.Result == SPFNone {
+			r.Result, r.Err = SPFPermError, fmt.Errorf("%w: %s", ErrSPFRedirectNoRecord, target)
+		}
+
+		return
+	}
+
+	r.Result, r.Mechanism = SPFNeutral, "default"
+
+	return
+}
+
+// lookupSPF 查询 domain 的 SPF 记录，没有记录时返回空字符串。
+func (c *spfChecker) lookupSPF(domain string) (record string, err error) {
+	txts, err := c.resolver.LookupTXT(c.ctx, domain)
+	if err != nil {
+		if IsNotFound(err) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("%w: %w", ErrSPFTemporaryDNSError, err)
+	}
+
+	var records []string
+	for _, txt := range txts {
+		if regxSPFVersion.MatchString(txt) {
+			records = append(records, txt)
+		}
+	}
+
+	if len(records) > 1 {
+		return "", fmt.Errorf("%w: %s", ErrSPFMultipleRecords, domain)
+	}
+
+	if len(records) == 1 {
+		record = records[0]
+	}
+
+	return
+}
+
+// match 检查 ip 是否匹配机制。
+func (c *spfChecker) match(t spfTerm, domain string) (matched bool, err error) {
+	switch t.mechanism {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		return t.network.Contains(c.ip), nil
+	}
+
+	// 以下机制都需要查询 DNS。
+	if err = c.countLookup(); err != nil {
+		return
+	}
+
+	target := domain
+	if t.domainSpec != "" {
+		target, err = c.expandDomainSpec(t.domainSpec, domain)
+		if err != nil {
+			return
+		}
+	}
+
+	switch t.mechanism {
+	case "include":
+		r := c.checkHost(target, false)
+
+		switch r.Result {
+		case SPFPass:
+			matched = true
+		case SPFTempError, SPFPermError:
+			err = r.Err
+		case SPFNone:
+			err = fmt.Errorf("%w: %s", ErrSPFIncludeNoRecord, target)
+		}
+	case "a":
+		matched, err = c.matchHost(target, t)
+	case "mx":
+		var mxs []*net.MX
+		mxs, err = lookup(c, func() ([]*net.MX, error) { return c.resolver.LookupMX(c.ctx, target) })
+		if err != nil {
+			return
+		}
+
+		if len(mxs) > spfMaxNames {
+			err = fmt.Errorf("%w: more than %d MX records", ErrSPFTooManyLookups, spfMaxNames)
+
+			return
+		}
+
+		for _, mx := range mxs {
+			matched, err = c.matchHost(mx.Host, t)
+			if matched || err != nil {
+				return
+			}
+		}
+	case "ptr":
+		for _, name := range c.validatedNames() {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			target = strings.ToLower(target)
+
+			if name == target || strings.HasSuffix(name, "."+target) {
+				matched = true
+
+				break
+			}
+		}
+	case "exists":
+		// exists 总是查询 A 记录，即使 ip 是 IPv6 地址。
+		var ips []net.IP
+		ips, err = lookup(c, func() ([]net.IP, error) { return c.resolver.LookupIP(c.ctx, "ip4", target) })
+		matched = len(ips) > 0
+	}
+
+	return
+}
+
+// matchHost 检查 ip 是否在 host 的 A（IPv4）或 AAAA（IPv6）记录的网段中。
+func (c *spfChecker) matchHost(host string, t spfTerm) (matched bool, err error) {
+	network, prefix := "ip6", t.cidr6
+	if c.ip.To4() != nil {
+		network, prefix = "ip4", t.cidr4
+	}
+
+	ips, err := lookup(c, func() ([]net.IP, error) { return c.resolver.LookupIP(c.ctx, network, host) })
+	if err != nil {
+		return
+	}
+
+	for _, ip := range ips {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		ipnet := net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}
+		if ipnet.Contains(c.ip) {
+			return true, nil
+		}
+	}
+
+	return
+}
+
+// lookup 执行 DNS 查询并统计无结果的查询。记录不存在时返回空结果，不返回错误。
+func lookup[T any](c *spfChecker, query func() ([]T, error)) (records []T, err error) {
+	records, err = query()
+	if err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", ErrSPFTemporaryDNSError, err)
+	}
+
+	if len(records) == 0 {
+		c.voidLookups++
+		if c.voidLookups > SPFMaxVoidLookups {
+			return nil, ErrSPFTooManyVoid
+		}
+	}
+
+	return records, nil
+}
+
+// countLookup 统计需要查询 DNS 的机制及修饰符，超过 SPFMaxLookups 时返回错误。
+func (c *spfChecker) countLookup() error {
+	c.lookups++
+	if c.lookups > SPFMaxLookups {
+		return ErrSPFTooManyLookups
+	}
+
+	return nil
+}
+
+// validatedNames 返回 ip 经过正向解析确认的 PTR 主机名（RFC 7208 第 5.5 节），
+// 查询失败时返回空结果。
+func (c *spfChecker) validatedNames() (names []string) {
+	ptrs, err := c.resolver.LookupAddr(c.ctx, c.ip.String())
+	if err != nil {
+		return
+	}
+
+	network := "ip6"
+	if c.ip.To4() != nil {
+		network = "ip4"
+	}
+
+	for i, ptr := range ptrs {
+		if i >= spfMaxNames {
+			break
+		}
+
+		ips, err := c.resolver.LookupIP(c.ctx, network, ptr)
+		if err != nil {
+			continue
+		}
+
+		for _, ip := range ips {
+			if ip.Equal(c.ip) {
+				names = append(names, ptr)
+
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// explain 查询并展开 exp= 指定的说明文字，任何错误都返回空字符串（RFC 7208 第 6.2 节）。
+func (c *spfChecker) explain(domainSpec, domain string) string {
+	target, err := c.expandDomainSpec(domainSpec, domain)
+	if err != nil {
+		return ""
+	}
+
+	txts, err := c.resolver.LookupTXT(c.ctx, target)
+	if err != nil || len(txts) != 1 {
+		return ""
+	}
+
+	var words []string
+	for word := range strings.SplitSeq(txts[0], " ") {
+		expanded, err := expandSPFMacro(word, spfExpMacroLetters, c.macroValue(domain))
+		if err != nil {
+			return ""
+		}
+
+		words = append(words, expanded)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// expandDomainSpec 展开 domain-spec 中的宏。结果超过 253 个字符时从左侧删除标签（RFC 7208 第 7.3 节）。
+func (c *spfChecker) expandDomainSpec(spec, domain string) (target string, err error) {
+	target, err = expandSPFMacro(spec, spfMacroLetters, c.macroValue(domain))
+	if err != nil {
+		return
+	}
+
+	target = strings.TrimSuffix(target, ".")
+	for len(target) > 253 {
+		_, after, found := strings.Cut(target, ".")
+		if !found {
+			break
+		}
+
+		target = after
+	}
+
+	return
+}
+
+// macroValue 返回宏的值（RFC 7208 第 7.2 节）。
+func (c *spfChecker) macroValue(domain string) func(letter byte) (string, error) {
+	return func(letter byte) (string, error) {
+		switch letter {
+		case 's':
+			return c.sender, nil
+		case 'l':
+			local, _, _ := strings.Cut(c.sender, "@")
+
+			return local, nil
+		case 'o':
+			_, d, _ := strings.Cut(c.sender, "@")
+
+			return d, nil
+		case 'd':
+			return domain, nil
+		case 'i':
+			if c.ip.To4() != nil {
+				return c.ip.String(), nil
+			}
+
+			// IPv6 地址使用点分隔的半字节格式。
+			nibbles := make([]string, 0, 32)
+			for _, b := range c.ip.To16() {
+				nibbles = append(nibbles, strconv.FormatUint(uint64(b>>4), 16), strconv.FormatUint(uint64(b&0xf), 16))
+			}
+
+			return strings.Join(nibbles, "."), nil
+		case 'p':
+			if c.validatedName == "" {
+				c.validatedName = "unknown"
+				if names := c.validatedNames(); len(names) > 0 {
+					c.validatedName = strings.TrimSuffix(names[0], ".")
+				}
+			}
+
+			return c.validatedName, nil
+		case 'v':
+			if c.ip.To4() != nil {
+				return "in-addr", nil
+			}
+
+			return "ip6", nil
+		case 'h':
+			return c.helo, nil
+		case 'c':
+			return c.ip.String(), nil
+		case 'r':
+			return c.receiver, nil
+		case 't':
+			return strconv.FormatInt(time.Now().Unix(), 10), nil
+		}
+
+		return "", fmt.Errorf("%w: invalid macro letter %q", ErrSPFSyntax, letter)
+	}
+}
+
+// spfErrorResult 返回错误对应的 SPF 结果。
+func spfErrorResult(err error) SPFResult {
+	if errors.Is(err, ErrSPFTemporaryDNSError) {
+		return SPFTempError
+	}
+
+	return SPFPermError
+}
+
+// isSPFDomain 检查域名是否可以用于 SPF 查询：至少包含两个标签，每个标签 1 到 63 个字符。
+func isSPFDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// spfTerm 是 SPF 记录中的一个机制（directive）。
+type spfTerm struct {
+	raw        string
+	qualifier  byte
+	mechanism  string
+	domainSpec string
+	network    *net.IPNet // ip4、ip6
+	cidr4      int
+	cidr6      int
+}
+
+func (t spfTerm) result() SPFResult {
+	switch t.qualifier {
+	case '-':
+		return SPFFail
+	case '~':
+		return SPFSoftFail
+	case '?':
+		return SPFNeutral
+	default:
+		return SPFPass
+	}
+}
+
+type spfRecord struct {
+	terms    []spfTerm
+	redirect string
+	exp      string
+}
+
+// parseSPFRecord 解析 SPF 记录，任何语法错误都返回 ErrSPFSyntax（RFC 7208 第 4.6 节）。
+func parseSPFRecord(record string) (rec spfRecord, err error) {
+	fields := strings.Fields(record)
+	seen := make(map[string]bool)
+
+	for _, field := range fields[1:] {
+		// 修饰符：name=value，name 中不能包含 `:` 和 `/`。
+		if name, value, found := strings.Cut(field, "="); found && regxSPFName.MatchString(name) {
+			name = strings.ToLower(name)
+
+			if name == "redirect" || name == "exp" {
+				if seen[name] {
+					return rec, fmt.Errorf("%w: duplicate modifier %s", ErrSPFSyntax, name)
+				}
+
+				seen[name] = true
+
+				if err = validateSPFMacro(value); err != nil {
+					return
+				}
+			}
+
+			switch name {
+			case "redirect":
+				rec.redirect = value
+			case "exp":
+				rec.exp = value
+			}
+
+			// 忽略未知的修饰符。
+			continue
+		}
+
+		var t spfTerm
+		t, err = parseSPFTerm(field)
+		if err != nil {
+			return
+		}
+
+		rec.terms = append(rec.terms, t)
+	}
+
+	// 包含 all 时忽略 redirect。
+	for _, t := range rec.terms {
+		if t.mechanism == "all" {
+			rec.redirect = ""
+		}
+	}
+
+	return
+}
+
+func parseSPFTerm(field string) (t spfTerm, err error) {
+	t = spfTerm{raw: field, qualifier: '+', cidr4: 32, cidr6: 128}
+
+	s := field
+	if strings.ContainsRune("+-~?", rune(s[0])) {
+		t.qualifier = s[0]
+		s = s[1:]
+	}
+
+	name, arg, hasArg := strings.Cut(s, ":")
+	if !hasArg {
+		// `a/24`、`mx//64`
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			name, arg = s[:i], s[i:]
+		}
+	}
+
+	t.mechanism = strings.ToLower(name)
+
+	invalid := fmt.Errorf("%w: invalid mechanism %q", ErrSPFSyntax, field)
+
+	switch t.mechanism {
+	case "all":
+		if arg != "" || hasArg {
+			return t, invalid
+		}
+	case "include", "exists":
+		if !hasArg || arg == "" {
+			return t, invalid
+		}
+
+		t.domainSpec = arg
+	case "ptr":
+		if hasArg && arg == "" {
+			return t, invalid
+		}
+
+		t.domainSpec = arg
+	case "a", "mx":
+		m := regxSPFCIDR.FindStringSubmatch(arg)
+		if m == nil || (hasArg && m[1] == "") || (!hasArg && m[1] != "") {
+			return t, invalid
+		}
+
+		t.domainSpec = m[1]
+
+		if m[2] != "" {
+			t.cidr4, err = strconv.Atoi(m[2])
+			if err != nil || t.cidr4 > 32 {
+				return t, invalid
+			}
+		}
+
+		if m[3] != "" {
+			t.cidr6, err = strconv.Atoi(m[3])
+			if err != nil || t.cidr6 > 128 {
+				return t, invalid
+			}
+		}
+	case "ip4", "ip6":
+		if !hasArg {
+			return t, invalid
+		}
+
+		addr, prefix, hasPrefix := strings.Cut(arg, "/")
+		ip := net.ParseIP(addr)
+
+		bits := 32
+		if t.mechanism == "ip6" {
+			bits = 128
+		}
+
+		if ip == nil || (t.mechanism == "ip4") != (ip.To4() != nil && !strings.Contains(addr, ":")) {
+			return t, invalid
+		}
+
+		size := bits
+		if hasPrefix {
+			size, err = strconv.Atoi(prefix)
+			if err != nil || size < 0 || size > bits || strings.HasPrefix(prefix, "0") && prefix != "0" {
+				return t, invalid
+			}
+		}
+
+		if bits == 32 {
+			ip = ip.To4()
+		}
+
+		mask := net.CIDRMask(size, bits)
+		t.network = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	default:
+		return t, fmt.Errorf("%w: unknown mechanism %q", ErrSPFSyntax, field)
+	}
+
+	if t.domainSpec != "" {
+		err = validateSPFMacro(t.domainSpec)
+	}
+
+	return
+}
+
+// validateSPFMacro 检查 domain-spec 的宏语法。
+func validateSPFMacro(s string) error {
+	_, err := expandSPFMacro(s, spfMacroLetters, func(byte) (string, error) { return "x", nil })
+
+	return err
+}
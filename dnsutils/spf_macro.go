@@ -0,0 +1,164 @@
+package dnsutils
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// spfMacroLetters 是 domain-spec 中允许使用的宏。
+	spfMacroLetters = "slodipvh"
+
+	// spfExpMacroLetters 是 explanation 字符串（exp= 查询到的 TXT 记录）中允许使用的宏。
+	spfExpMacroLetters = spfMacroLetters + "crt"
+
+	spfMacroDelimiters = ".-+,/_="
+)
+
+// expandSPFMacro 展开 SPF 宏字符串（RFC 7208 第 7 节），例如 `%{ir}.%{v}._spf.%{d}`。
+//
+// letters 是允许使用的宏，value 返回宏的值。
+func expandSPFMacro(s, letters string, value func(letter byte) (string, error)) (expanded string, err error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			if c < 0x21 || c > 0x7e {
+				return "", fmt.Errorf("%w: invalid character in macro string %q", ErrSPFSyntax, s)
+			}
+
+			b.WriteByte(c)
+
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("%w: incomplete macro %q", ErrSPFSyntax, s)
+		}
+
+		i++
+
+		switch s[i] {
+		case '%':
+			b.WriteByte('%')
+		case '_':
+			b.WriteByte(' ')
+		case '-':
+			b.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("%w: incomplete macro %q", ErrSPFSyntax, s)
+			}
+
+			var v string
+			v, err = expandSPFMacroExpr(s[i+1:i+end], letters, value)
+			if err != nil {
+				return
+			}
+
+			b.WriteString(v)
+			i += end
+		default:
+			return "", fmt.Errorf("%w: invalid macro %q", ErrSPFSyntax, s)
+		}
+	}
+
+	expanded = b.String()
+
+	return
+}
+
+// expandSPFMacroExpr 展开 `%{...}` 中的宏表达式：宏字母、可选的数字及 `r`（transformers），
+// 以及可选的分隔符，例如 `ir`、`d2`、`l-`。
+func expandSPFMacroExpr(expr, letters string, value func(letter byte) (string, error)) (string, error) {
+	if expr == "" {
+		return "", fmt.Errorf("%w: empty macro", ErrSPFSyntax)
+	}
+
+	letter := expr[0]
+	lower := letter | 0x20 // 转换为小写
+	if !strings.ContainsRune(letters, rune(lower)) {
+		return "", fmt.Errorf("%w: invalid macro letter %q", ErrSPFSyntax, letter)
+	}
+
+	rest := expr[1:]
+
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+
+	keep := 0
+	if digits > 0 {
+		var err error
+		keep, err = strconv.Atoi(rest[:digits])
+		if err != nil || keep == 0 {
+			return "", fmt.Errorf("%w: invalid macro transformer %q", ErrSPFSyntax, expr)
+		}
+	}
+
+	rest = rest[digits:]
+
+	reverse := false
+	if strings.HasPrefix(rest, "r") || strings.HasPrefix(rest, "R") {
+		reverse = true
+		rest = rest[1:]
+	}
+
+	delimiters := "."
+	if rest != "" {
+		for _, c := range rest {
+			if !strings.ContainsRune(spfMacroDelimiters, c) {
+				return "", fmt.Errorf("%w: invalid macro delimiter %q", ErrSPFSyntax, expr)
+			}
+		}
+
+		delimiters = rest
+	}
+
+	v, err := value(lower)
+	if err != nil {
+		return "", err
+	}
+
+	if keep > 0 || reverse || delimiters != "." {
+		parts := strings.FieldsFunc(v, func(r rune) bool { return strings.ContainsRune(delimiters, r) })
+		if reverse {
+			slices.Reverse(parts)
+		}
+
+		if keep > 0 && keep < len(parts) {
+			parts = parts[len(parts)-keep:]
+		}
+
+		v = strings.Join(parts, ".")
+	}
+
+	// 大写的宏需要进行 URL 编码。
+	if letter != lower {
+		v = urlEscape(v)
+	}
+
+	return v, nil
+}
+
+// urlEscape 对 RFC 3986 中 unreserved 以外的字符进行百分号编码。
+func urlEscape(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
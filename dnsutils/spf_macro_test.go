@@ -0,0 +1,66 @@
+package dnsutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandSPFMacro(t *testing.T) {
+	// 示例来自 RFC 7208 第 7.4 节。
+	c := &spfChecker{
+		ip:       net.ParseIP("192.0.2.3").To4(),
+		sender:   "strong-bad@email.example.com",
+		resolver: &MemoryResolver{},
+	}
+
+	tests := map[string]string{
+		"%{s}":                              "strong-bad@email.example.com",
+		"%{o}":                              "email.example.com",
+		"%{d}":                              "email.example.com",
+		"%{d4}":                             "email.example.com",
+		"%{d3}":                             "email.example.com",
+		"%{d2}":                             "example.com",
+		"%{d1}":                             "com",
+		"%{dr}":                             "com.example.email",
+		"%{d2r}":                            "example.email",
+		"%{l}":                              "strong-bad",
+		"%{l-}":                             "strong.bad",
+		"%{lr}":                             "strong-bad",
+		"%{lr-}":                            "bad.strong",
+		"%{l1r-}":                           "strong",
+		"%{ir}.%{v}._spf.%{d2}":             "3.2.0.192.in-addr._spf.example.com",
+		"%{lr-}.lp._spf.%{d2}":              "bad.strong.lp._spf.example.com",
+		"%{lr-}.lp.%{ir}.%{v}._spf.%{d2}":   "bad.strong.lp.3.2.0.192.in-addr._spf.example.com",
+		"%{ir}.%{v}.%{l1r-}.lp._spf.%{d2}":  "3.2.0.192.in-addr.strong.lp._spf.example.com",
+		"%{d2}.trusted-domains.example.net": "example.com.trusted-domains.example.net",
+		"%%%_%-":                            "% %20",
+		"%{S}":                              "strong-bad%40email.example.com",
+		"%{p}":                              "unknown",
+	}
+
+	for spec, want := range tests {
+		got, err := c.expandDomainSpec(spec, "email.example.com")
+		assert.Nil(t, err, spec)
+		assert.Equal(t, want, got, spec)
+	}
+
+	c.ip = net.ParseIP("2001:db8::cb01")
+	got, err := c.expandDomainSpec("%{ir}.%{v}._spf.%{d2}", "email.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.b.c.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6._spf.example.com", got)
+
+	for _, spec := range []string{"%", "%{", "%{x}", "%{d0}", "%{d*}", "%a", "%{}", "a b"} {
+		_, err = c.expandDomainSpec(spec, "email.example.com")
+		assert.ErrorIs(t, err, ErrSPFSyntax, spec)
+	}
+
+	// c、r、t 仅允许在 explanation 中使用。
+	_, err = c.expandDomainSpec("%{c}", "email.example.com")
+	assert.ErrorIs(t, err, ErrSPFSyntax)
+
+	got, err = expandSPFMacro("%{c}", spfExpMacroLetters, c.macroValue("email.example.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::cb01", got)
+}
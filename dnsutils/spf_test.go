@@ -0,0 +1,196 @@
+package dnsutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ips(addrs ...string) (ips []net.IP) {
+	for _, addr := range addrs {
+		ips = append(ips, net.ParseIP(addr))
+	}
+
+	return
+}
+
+func testSPFZone() *MemoryResolver {
+	return &MemoryResolver{
+		TXT: map[string][]string{
+			"example.com": {
+				"google-site-verification=xxx",
+				"v=spf1 ip4:192.0.2.0/28 ip6:2001:db8::/64 a mx/30 include:_spf.example.net ptr exists:%{ir}.list.example.org -all exp=explain.example.com",
+			},
+			"explain.example.com": {"%{i} is not one of %{d}'s designated mail servers."},
+
+			"_spf.example.net":     {"v=spf1 ip4:198.51.100.0/24 ~all"},
+			"soft.example.com":     {"v=spf1 a:mail.example.com ~all"},
+			"neutral.example.com":  {"v=spf1 ?ip4:192.0.2.1"},
+			"redirect.example.com": {"v=spf1 ip4:203.0.113.1 redirect=example.com"},
+			"redirect-all.example.com": {
+				"v=spf1 ip4:203.0.113.1 redirect=missing.example.com -all",
+			},
+			"cidr.example.com":         {"v=spf1 a:mail.example.com/24//64 -all"},
+			"mx-only.example.com":      {"v=spf1 mx:example.com -all"},
+			"multiple.example.com":     {"v=spf1 -all", "v=spf1 +all"},
+			"syntax.example.com":       {"v=spf1 ip4:192.0.2.1 foo:bar -all"},
+			"badcidr.example.com":      {"v=spf1 ip4:192.0.2.1/33 -all"},
+			"dup.example.com":          {"v=spf1 redirect=a.example.com redirect=b.example.com"},
+			"bad-include.example.com":  {"v=spf1 include:missing.example.com -all"},
+			"bad-redirect.example.com": {"v=spf1 redirect=missing.example.com"},
+			"temp-include.example.com": {"v=spf1 include:temp.example.com -all"},
+			"void.example.com":         {"v=spf1 a:v1.example.com a:v2.example.com a:v3.example.com -all"},
+			"unknown-mod.example.com":  {"v=spf1 foo=bar +all"},
+			"helo.example.com":         {"v=spf1 exists:%{h}.allowed.example.org -all"},
+			"v4-only.example.com":      {"v=spf1"},
+			"uppercase.example.com":    {"V=SPF1 +ALL"},
+			"spf2.example.com":         {"v=spf10 +all"},
+			"loop.example.com":         {"v=spf1 include:loop.example.com -all"},
+		},
+		IP: map[string][]net.IP{
+			"example.com":                             ips("192.0.2.100", "2001:db8:1::100"),
+			"mail.example.com":                        ips("192.0.2.200", "2001:db8:2::200"),
+			"mx1.example.com":                         ips("192.0.2.128"),
+			"mx2.example.com":                         ips("192.0.2.132"),
+			"host.example.com":                        ips("192.0.2.250"),
+			"spoofed.example.com":                     ips("192.0.2.251"),
+			"1.1.1.198.list.example.org":              ips("127.0.0.2"),
+			"trusted.example.com.allowed.example.org": ips("127.0.0.2"),
+		},
+		MX: map[string][]*net.MX{
+			"example.com": {{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}},
+		},
+		PTR: map[string][]string{
+			"192.0.2.250": {"host.example.com."},
+			"192.0.2.252": {"spoofed.example.com."}, // 正向解析的 IP 地址不同
+		},
+		Errors: map[string]error{
+			"temp.example.com": &net.DNSError{Err: "server misbehaving", Name: "temp.example.com", IsTemporary: true},
+		},
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	zone := testSPFZone()
+
+	tests := []struct {
+		ip, domain string
+		result     SPFResult
+		mechanism  string
+		err        error
+	}{
+		{"192.0.2.1", "example.com", SPFPass, "ip4:192.0.2.0/28", nil},
+		{"::ffff:192.0.2.15", "example.com", SPFPass, "ip4:192.0.2.0/28", nil},
+		{"2001:db8::1", "example.com", SPFPass, "ip6:2001:db8::/64", nil},
+		{"192.0.2.100", "example.com", SPFPass, "a", nil},
+		{"2001:db8:1::100", "example.com", SPFPass, "a", nil},
+		{"192.0.2.131", "example.com", SPFPass, "mx/30", nil},
+		{"192.0.2.136", "example.com", SPFFail, "-all", nil},
+		{"198.51.100.7", "example.com", SPFPass, "include:_spf.example.net", nil},
+		{"192.0.2.250", "example.com", SPFPass, "ptr", nil},
+		{"192.0.2.252", "example.com", SPFFail, "-all", nil},
+		{"198.1.1.1", "example.com", SPFPass, "exists:%{ir}.list.example.org", nil},
+
+		{"192.0.2.200", "soft.example.com", SPFPass, "a:mail.example.com", nil},
+		{"192.0.2.1", "soft.example.com", SPFSoftFail, "~all", nil},
+		{"192.0.2.1", "neutral.example.com", SPFNeutral, "?ip4:192.0.2.1", nil},
+		{"192.0.2.2", "neutral.example.com", SPFNeutral, "default", nil},
+		{"192.0.2.200", "v4-only.example.com", SPFNeutral, "default", nil},
+
+		{"203.0.113.1", "redirect.example.com", SPFPass, "ip4:203.0.113.1", nil},
+		{"192.0.2.1", "redirect.example.com", SPFPass, "ip4:192.0.2.0/28", nil},
+		{"192.0.2.136", "redirect.example.com", SPFFail, "-all", nil},
+		// 包含 all 时忽略 redirect。
+		{"192.0.2.1", "redirect-all.example.com", SPFFail, "-all", nil},
+
+		{"192.0.2.1", "cidr.example.com", SPFPass, "a:mail.example.com/24//64", nil},
+		{"2001:db8:2::1", "cidr.example.com", SPFPass, "a:mail.example.com/24//64", nil},
+		{"2001:db8:3::1", "cidr.example.com", SPFFail, "-all", nil},
+		{"192.0.2.128", "mx-only.example.com", SPFPass, "mx:example.com", nil},
+
+		{"192.0.2.1", "unknown-mod.example.com", SPFPass, "+all", nil},
+		{"192.0.2.1", "uppercase.example.com", SPFPass, "+ALL", nil},
+
+		{"192.0.2.1", "none.example.com", SPFNone, "", nil},
+		{"192.0.2.1", "spf2.example.com", SPFNone, "", nil},
+		{"192.0.2.1", "localhost", SPFNone, "", nil},
+		{"192.0.2.1", "temp.example.com", SPFTempError, "", ErrSPFTemporaryDNSError},
+		{"192.0.2.1", "temp-include.example.com", SPFTempError, "include:temp.example.com", ErrSPFTemporaryDNSError},
+
+		{"192.0.2.1", "multiple.example.com", SPFPermError, "", ErrSPFMultipleRecords},
+		{"192.0.2.1", "syntax.example.com", SPFPermError, "", ErrSPFSyntax},
+		{"192.0.2.1", "badcidr.example.com", SPFPermError, "", ErrSPFSyntax},
+		{"192.0.2.1", "dup.example.com", SPFPermError, "", ErrSPFSyntax},
+		{"192.0.2.1", "bad-include.example.com", SPFPermError, "include:missing.example.com", ErrSPFIncludeNoRecord},
+		{"192.0.2.1", "bad-redirect.example.com", SPFPermError, "", ErrSPFRedirectNoRecord},
+		{"192.0.2.1", "void.example.com", SPFPermError, "a:v3.example.com", ErrSPFTooManyVoid},
+		{"192.0.2.1", "loop.example.com", SPFPermError, "include:loop.example.com", ErrSPFTooManyLookups},
+	}
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s %s", tt.ip, tt.domain)
+		r := CheckHost(net.ParseIP(tt.ip), tt.domain, "user@"+tt.domain, WithSPFResolver(zone))
+
+		assert.Equal(t, tt.result, r.Result, name)
+		assert.Equal(t, tt.mechanism, r.Mechanism, name)
+
+		if tt.err != nil {
+			assert.ErrorIs(t, r.Err, tt.err, name)
+		} else {
+			assert.Nil(t, r.Err, name)
+		}
+	}
+}
+
+func TestCheckHostExplanation(t *testing.T) {
+	zone := testSPFZone()
+
+	r := CheckHost(net.ParseIP("192.0.2.136"), "example.com", "user@example.com", WithSPFResolver(zone))
+	assert.Equal(t, SPFFail, r.Result)
+	assert.Equal(t, "192.0.2.136 is not one of example.com's designated mail servers.", r.Explanation)
+
+	// redirect 使用目标域名的 exp=。
+	r = CheckHost(net.ParseIP("192.0.2.136"), "redirect.example.com", "user@example.com", WithSPFResolver(zone))
+	assert.Equal(t, SPFFail, r.Result)
+	assert.Equal(t, "192.0.2.136 is not one of example.com's designated mail servers.", r.Explanation)
+
+	// 没有 exp= 修饰符。
+	r = CheckHost(net.ParseIP("192.0.2.1"), "redirect-all.example.com", "", WithSPFResolver(zone))
+	assert.Equal(t, SPFFail, r.Result)
+	assert.Empty(t, r.Explanation)
+}
+
+func TestCheckHostHelo(t *testing.T) {
+	zone := testSPFZone()
+
+	r := CheckHost(net.ParseIP("192.0.2.1"), "helo.example.com", "", WithSPFResolver(zone), WithSPFHelo("trusted.example.com"))
+	assert.Equal(t, SPFPass, r.Result)
+
+	r = CheckHost(net.ParseIP("192.0.2.1"), "helo.example.com", "", WithSPFResolver(zone), WithSPFHelo("other.example.com"))
+	assert.Equal(t, SPFFail, r.Result)
+}
+
+func TestMemoryResolver(t *testing.T) {
+	zone := testSPFZone()
+
+	txts, err := zone.LookupTXT(t.Context(), "Example.COM.")
+	assert.Nil(t, err)
+	assert.Len(t, txts, 2)
+
+	_, err = zone.LookupTXT(t.Context(), "none.example.com")
+	assert.True(t, IsNotFound(err))
+
+	found, err := zone.LookupIP(t.Context(), "ip6", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, ips("2001:db8:1::100"), found)
+
+	_, err = zone.LookupIP(t.Context(), "ip6", "mx1.example.com")
+	assert.True(t, IsNotFound(err))
+
+	_, err = zone.LookupMX(t.Context(), "temp.example.com")
+	assert.False(t, IsNotFound(err))
+	assert.True(t, errors.As(err, new(*net.DNSError)))
+}
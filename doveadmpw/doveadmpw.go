@@ -2,59 +2,114 @@ package doveadmpw
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os/exec"
+	"slices"
 	"strings"
+
+	"github.com/iredmail/goutils/pwhash"
+	"github.com/iredmail/goutils/respcode"
 )
 
+// nativeSchemes 是由 pwhash 直接处理（不调用 doveadm）的算法，pwhash 生成的哈希
+// 与 `doveadm pw` 的格式完全相同。可以带有编码后缀，如 `SHA256.HEX`。
+//
+// 注意：Dovecot 的 `MD5` 是 MD5-CRYPT 的别名，`CRYPT` 是 DES crypt，`PLAIN-MD5`
+// 哈希带有前缀，均与 pwhash 不同，因此这些算法仍然调用 doveadm。
+var nativeSchemes = []string{
+	pwhash.SchemePlain,
+	pwhash.SchemeSHA,
+	pwhash.SchemeSSHA,
+	pwhash.SchemeSHA256,
+	pwhash.SchemeSSHA256,
+	pwhash.SchemeSHA512,
+	pwhash.SchemeSSHA512,
+	pwhash.SchemeSHA256Crypt,
+	pwhash.SchemeSHA512Crypt,
+	pwhash.SchemeMD5Crypt,
+	pwhash.SchemeBcrypt,
+	pwhash.SchemeArgon2I,
+	pwhash.SchemeArgon2ID,
+	pwhash.SchemeCramMD5,
+	pwhash.SchemeNTLM,
+}
+
+// doveadmBinary 是 doveadm 命令的路径。
+var doveadmBinary = "doveadm"
+
+var errInvalidPassword = errors.New("password contains line break")
+
+// isNativeScheme 检查算法（不区分大小写，可带编码后缀）是否由 pwhash 直接处理。
+func isNativeScheme(scheme string) bool {
+	name, _, _ := strings.Cut(strings.ToUpper(scheme), ".")
+
+	return slices.Contains(nativeSchemes, name)
+}
+
+// schemeOf 返回密码哈希的 `{SCHEME}` 前缀中的算法名称，没有前缀时返回空字符串。
+func schemeOf(hash string) string {
+	after, found := strings.CutPrefix(hash, "{")
+	if !found {
+		return ""
+	}
+
+	scheme, _, found := strings.Cut(after, "}")
+	if !found {
+		return ""
+	}
+
+	return scheme
+}
+
+// GeneratePassword 生成密码哈希，格式与 `doveadm pw -s <scheme>` 相同，带有 `{SCHEME}` 前缀。
+//
+// pwhash 支持的算法直接使用 pwhash 生成，不依赖 Dovecot；其它算法调用 doveadm。
 func GeneratePassword(scheme, password string) (hash string, err error) {
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
+	if isNativeScheme(scheme) {
+		return pwhash.GeneratePassword(scheme, password)
+	}
 
-	cmd := exec.Command("doveadm", "pw", "-s", scheme, "-p", password)
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	err = cmd.Run()
+	// doveadm 要求输入两次密码。
+	stdout, err := runDoveadm(password, 2, "pw", "-s", scheme)
 	if err != nil {
-		err = fmt.Errorf("stdout: %s, stderr: %s, err: %w", stdout.String(), stderr.String(), err)
-
 		return
 	}
 
 	// output: {SSHA}DVRj4taRESdmMKQ5oaCs69t7D3ZkHtMk
-	hash = stdout.String()
-	hash = strings.TrimRight(hash, "\n")
+	hash = lastLine(stdout)
 
 	return
 }
 
+// VerifyPassword 校验密码，效果与 `doveadm pw -t <hash>` 相同。
+//
+// pwhash 支持的算法直接使用 pwhash 校验，不依赖 Dovecot；其它算法调用 doveadm。
 func VerifyPassword(hash, plain string) (matched bool, err error) {
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-
-	cmd := exec.Command("doveadm", "pw", "-t", hash, "-p", plain)
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	if isNativeScheme(schemeOf(hash)) {
+		return pwhash.VerifyPassword(hash, plain)
+	}
 
-	err = cmd.Run()
+	stdout, err := runDoveadm(plain, 1, "pw", "-t", hash)
 	if err != nil {
-		return false, fmt.Errorf("stdout: %s, stderr: %s, err: %w", stdout.String(), stderr.String(), err)
+		return false, err
 	}
 
 	// Sample doveadm-pw output:
 	//
 	// - matched / verified:
 	//
-	//	$ doveadm pw -t '{SSHA}Ix...' -p 'HHiJ...'
+	//	$ doveadm pw -t '{SSHA}Ix...'
+	//	Enter password to verify:
 	//	{SSHA}Ix... (verified)
 	//
 	// - mismatch:
 	//
-	//	$ doveadm pw -t '{SSHA}Ix...' -p 'HHiJ...'
+	//	$ doveadm pw -t '{SSHA}Ix...'
+	//	Enter password to verify:
 	//	Fatal: reverse password verification check failed: Password mismatch
 	//
-	out := strings.TrimSpace(stdout.String())
-	if strings.HasSuffix(out, "(verified)") {
+	if strings.HasSuffix(lastLine(stdout), "(verified)") {
 		matched = true
 
 		return
@@ -62,3 +117,48 @@ func VerifyPassword(hash, plain string) (matched bool, err error) {
 
 	return
 }
+
+// runDoveadm 执行 doveadm 命令，password 通过 stdin 传入 repeat 次，而不是使用
+// `-p` 参数，避免密码出现在进程列表（如 `ps` 的输出）中。
+func runDoveadm(password string, repeat int, args ...string) (out string, err error) {
+	if len(password) == 0 {
+		err = respcode.ErrEmptyPassword
+
+		return
+	}
+
+	// doveadm 按行读取密码。
+	if strings.ContainsAny(password, "\r\n") {
+		err = errInvalidPassword
+
+		return
+	}
+
+	stdin := strings.Repeat(password+"\n", repeat)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.Command(doveadmBinary, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("stdout: %s, stderr: %s, err: %w", stdout.String(), stderr.String(), err)
+
+		return
+	}
+
+	out = stdout.String()
+
+	return
+}
+
+// lastLine 返回最后一个非空行（doveadm 可能会先输出提示信息）。
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
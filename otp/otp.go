@@ -0,0 +1,254 @@
+// Package otp 实现一次性密码（OTP）：
+//
+//   - HOTP: RFC 4226，基于计数器的一次性密码。
+//   - TOTP: RFC 6238，基于时间的一次性密码，兼容 Google Authenticator 等应用。
+//
+// 此外还提供 otpauth:// URI（用于生成二维码）、base32 编码的密钥、防止 code 被
+// 重复使用的 UsedCodeStore，以及哈希保存的一次性恢复码（recovery code）。
+//
+// FYI
+//
+//   - https://datatracker.ietf.org/doc/html/rfc4226
+//   - https://datatracker.ietf.org/doc/html/rfc6238
+//   - https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/iredmail/goutils/respcode"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+const (
+	DefaultDigits     = 6
+	DefaultPeriod     = 30 * time.Second
+	DefaultSkew       = 1
+	DefaultSecretSize = 20 // 字节，即 160 bits，RFC 4226 推荐的长度。
+)
+
+// now 返回当前时间，测试时可替换。
+var now = time.Now
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type options struct {
+	algorithm Algorithm
+	digits    int
+	period    time.Duration
+	skew      uint
+}
+
+type Option func(o *options)
+
+// WithAlgorithm 设置 HMAC 算法，默认为 AlgorithmSHA1。
+// 注意：部分 Authenticator 应用只支持 SHA1。
+func WithAlgorithm(a Algorithm) Option {
+	return func(o *options) {
+		o.algorithm = a
+	}
+}
+
+// WithDigits 设置 code 的位数，只支持 6 或 8，默认为 6。
+func WithDigits(digits int) Option {
+	return func(o *options) {
+		if digits == 6 || digits == 8 {
+			o.digits = digits
+		}
+	}
+}
+
+// WithPeriod 设置 TOTP 每个 code 的有效时长，默认为 30 秒。
+func WithPeriod(period time.Duration) Option {
+	return func(o *options) {
+		if period >= time.Second {
+			o.period = period
+		}
+	}
+}
+
+// WithSkew 设置校验时允许的误差窗口，默认为 1。
+//
+//   - TOTP: 允许前后各 skew 个时间段的 code，用于容忍客户端与服务器的时间差。
+//   - HOTP: 允许客户端的计数器比服务器超前 skew 次（look-ahead window）。
+func WithSkew(skew uint) Option {
+	return func(o *options) {
+		o.skew = skew
+	}
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		algorithm: AlgorithmSHA1,
+		digits:    DefaultDigits,
+		period:    DefaultPeriod,
+		skew:      DefaultSkew,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+func (o options) newHash() func() hash.Hash {
+	switch o.algorithm {
+	case AlgorithmSHA256:
+		return sha256.New
+	case AlgorithmSHA512:
+		return sha512.New
+	}
+
+	return sha1.New
+}
+
+// GenerateSecret 生成随机密钥，返回 base32 编码（不带 `=` 填充）的字符串。
+// 可选参数 size 指定密钥的字节数，默认为 DefaultSecretSize。
+func GenerateSecret(size ...int) (secret string, err error) {
+	n := DefaultSecretSize
+	if len(size) > 0 && size[0] > 0 {
+		n = size[0]
+	}
+
+	b := make([]byte, n)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	secret = b32.EncodeToString(b)
+
+	return
+}
+
+// DecodeSecret 解码 base32 编码的密钥。忽略大小写、空格、`-` 及末尾的 `=` 填充，
+// 兼容用户手动输入的密钥（例如 `jbsw y3dp ehpk 3pxp`）。
+func DecodeSecret(secret string) (key []byte, err error) {
+	secret = strings.ToUpper(secret)
+	secret = strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret)
+
+	key, err = b32.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, respcode.ErrInvalidOtpSecret
+	}
+
+	return
+}
+
+// HOTP 根据密钥和计数器计算 code（RFC 4226）。
+func HOTP(key []byte, counter uint64, opts ...Option) string {
+	return hotp(key, counter, newOptions(opts...))
+}
+
+func hotp(key []byte, counter uint64, o options) string {
+	mac := hmac.New(o.newHash(), key)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation.
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range o.digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", o.digits, code%mod)
+}
+
+// ValidateHOTP 校验 HOTP code。counter 是服务器保存的下一个计数器的值，允许客户端
+// 超前 skew 次（见 WithSkew）。
+//
+// 校验成功时返回 next，即调用者应保存的下一个计数器的值。
+func ValidateHOTP(key []byte, code string, counter uint64, opts ...Option) (next uint64, ok bool) {
+	o := newOptions(opts...)
+	code = normalizeCode(code)
+	next = counter
+
+	// 检查所有候选值，不提前返回，使耗时与 code 是否正确无关。
+	for i := uint64(0); i <= uint64(o.skew); i++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, counter+i, o)), []byte(code)) == 1 && !ok {
+			next, ok = counter+i+1, true
+		}
+	}
+
+	return
+}
+
+// TOTP 计算时间 t 对应的 code（RFC 6238）。
+func TOTP(key []byte, t time.Time, opts ...Option) string {
+	o := newOptions(opts...)
+
+	return hotp(key, timeCounter(t, o.period), o)
+}
+
+func timeCounter(t time.Time, period time.Duration) uint64 {
+	return uint64(t.Unix() / int64(period/time.Second))
+}
+
+// ValidateTOTP 校验时间 t 的 TOTP code，允许前后各 skew 个时间段（见 WithSkew）。
+//
+// 校验成功时返回 code 对应的计数器（即时间段的序号），可用于防止 code 被重复使用，
+// 见 VerifyTOTP。
+func ValidateTOTP(key []byte, code string, t time.Time, opts ...Option) (counter uint64, ok bool) {
+	o := newOptions(opts...)
+	code = normalizeCode(code)
+	current := timeCounter(t, o.period)
+
+	// 与 ValidateHOTP 一样检查所有候选值，不提前返回。
+	for i := -int64(o.skew); i <= int64(o.skew); i++ {
+		c := uint64(int64(current) + i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, c, o)), []byte(code)) == 1 && !ok {
+			counter, ok = c, true
+		}
+	}
+
+	return
+}
+
+// VerifyTOTP 校验当前时间的 TOTP code，并通过 store 拒绝已使用过的 code
+// （RFC 6238 第 5.2 节）。key 是 store 中区分账号的名称，例如邮件地址。
+//
+// code 无效或已被使用时返回 respcode.ErrInvalidOtpCode。
+func VerifyTOTP(ctx context.Context, store UsedCodeStore, key string, secret []byte, code string, opts ...Option) error {
+	counter, ok := ValidateTOTP(secret, code, now(), opts...)
+	if !ok {
+		return respcode.ErrInvalidOtpCode
+	}
+
+	ok, err := store.Use(ctx, key, counter)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return respcode.ErrInvalidOtpCode
+	}
+
+	return nil
+}
+
+// normalizeCode 删除用户输入的 code 中的空格，例如 `123 456`。
+func normalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
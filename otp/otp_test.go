@@ -0,0 +1,157 @@
+package otp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/respcode"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, Appendix D.
+	key := []byte("12345678901234567890")
+	codes := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for i, code := range codes {
+		assert.Equal(t, code, HOTP(key, uint64(i)))
+	}
+
+	next, ok := ValidateHOTP(key, "755224", 0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), next)
+
+	// Look-ahead window.
+	next, ok = ValidateHOTP(key, "359152", 1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), next)
+
+	next, ok = ValidateHOTP(key, "969429", 1)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), next)
+
+	_, ok = ValidateHOTP(key, "969429", 1, WithSkew(2))
+	assert.True(t, ok)
+
+	_, ok = ValidateHOTP(key, "287082", 2)
+	assert.False(t, ok)
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238, Appendix B.
+	keys := map[Algorithm][]byte{
+		AlgorithmSHA1:   []byte("12345678901234567890"),
+		AlgorithmSHA256: []byte("12345678901234567890123456789012"),
+		AlgorithmSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	vectors := []struct {
+		unix  int64
+		codes map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{AlgorithmSHA1: "94287082", AlgorithmSHA256: "46119246", AlgorithmSHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{AlgorithmSHA1: "07081804", AlgorithmSHA256: "68084774", AlgorithmSHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{AlgorithmSHA1: "14050471", AlgorithmSHA256: "67062674", AlgorithmSHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{AlgorithmSHA1: "89005924", AlgorithmSHA256: "91819424", AlgorithmSHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{AlgorithmSHA1: "69279037", AlgorithmSHA256: "90698825", AlgorithmSHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{AlgorithmSHA1: "65353130", AlgorithmSHA256: "77737706", AlgorithmSHA512: "47863826"}},
+	}
+
+	for _, v := range vectors {
+		for alg, code := range v.codes {
+			opts := []Option{WithAlgorithm(alg), WithDigits(8)}
+			at := time.Unix(v.unix, 0)
+
+			assert.Equal(t, code, TOTP(keys[alg], at, opts...), alg)
+
+			_, ok := ValidateTOTP(keys[alg], code, at, opts...)
+			assert.True(t, ok)
+		}
+	}
+
+	// Skew.
+	key := keys[AlgorithmSHA1]
+	at := time.Unix(1111111111, 0)
+	code := TOTP(key, at)
+	assert.Len(t, code, 6)
+
+	counter, ok := ValidateTOTP(key, code, at.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1111111111/30), counter)
+
+	_, ok = ValidateTOTP(key, code, at.Add(-30*time.Second))
+	assert.True(t, ok)
+
+	_, ok = ValidateTOTP(key, code, at.Add(60*time.Second))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(key, code, at.Add(30*time.Second), WithSkew(0))
+	assert.False(t, ok)
+
+	// User input with spaces.
+	_, ok = ValidateTOTP(key, code[:3]+" "+code[3:], at)
+	assert.True(t, ok)
+
+	// Period.
+	code = TOTP(key, at, WithPeriod(60*time.Second))
+	assert.Equal(t, HOTP(key, uint64(at.Unix()/60)), code)
+}
+
+func TestSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret, 32)
+	assert.False(t, strings.Contains(secret, "="))
+
+	key, err := DecodeSecret(secret)
+	assert.Nil(t, err)
+	assert.Len(t, key, DefaultSecretSize)
+
+	secret, err = GenerateSecret(10)
+	assert.Nil(t, err)
+	assert.Len(t, secret, 16)
+
+	key, err = DecodeSecret("gezd gnbv-gy3t qojq")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1234567890"), key)
+
+	key, err = DecodeSecret("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("12345678901234567890"), key)
+
+	_, err = DecodeSecret("not base32!")
+	assert.Equal(t, respcode.ErrInvalidOtpSecret, err)
+
+	_, err = DecodeSecret("")
+	assert.Equal(t, respcode.ErrInvalidOtpSecret, err)
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	defer func() { now = time.Now }()
+
+	key := []byte("12345678901234567890")
+	at := time.Unix(1111111111, 0)
+	now = func() time.Time { return at }
+
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	code := TOTP(key, at)
+	assert.Nil(t, VerifyTOTP(ctx, store, "user@example.com", key, code))
+
+	// Replay.
+	assert.Equal(t, respcode.ErrInvalidOtpCode, VerifyTOTP(ctx, store, "user@example.com", key, code))
+
+	// Another account.
+	assert.Nil(t, VerifyTOTP(ctx, store, "other@example.com", key, code))
+
+	// Older code is rejected after a newer one was used.
+	now = func() time.Time { return at.Add(30 * time.Second) }
+	assert.Nil(t, VerifyTOTP(ctx, store, "user@example.com", key, TOTP(key, now())))
+	assert.Equal(t, respcode.ErrInvalidOtpCode, VerifyTOTP(ctx, store, "user@example.com", key, TOTP(key, at)))
+
+	assert.Equal(t, respcode.ErrInvalidOtpCode, VerifyTOTP(ctx, store, "user@example.com", key, "000000"))
+}
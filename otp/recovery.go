@@ -0,0 +1,96 @@
+package otp
+
+import (
+	"crypto/rand"
+	"strings"
+
+	"github.com/iredmail/goutils/pwhash"
+)
+
+const (
+	// DefaultRecoveryCodes 是 GenerateRecoveryCodes 默认生成的恢复码数量。
+	DefaultRecoveryCodes = 10
+
+	// 恢复码由 16 个小写 base32 字符（80 bits）组成，每 4 个字符以 `-` 分隔，
+	// 例如 `abcd-efgh-ijkl-mnop`。
+	recoveryCodeLength    = 16
+	recoveryCodeGroupSize = 4
+	recoveryCodeAlphabet  = "abcdefghijklmnopqrstuvwxyz234567"
+
+	// 恢复码是足够长的随机字符串，无需使用 argon2 / bcrypt 等慢速算法。
+	recoveryCodeScheme = pwhash.SchemeSSHA512
+)
+
+// GenerateRecoveryCodes 生成 n 个一次性恢复码，用于用户无法使用 Authenticator 应用时登录。
+//
+// codes 应只显示给用户一次，hashes 是对应的密码哈希（`{SSHA512}`），由调用者保存。
+// n 不大于 0 时使用 DefaultRecoveryCodes。
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	if n <= 0 {
+		n = DefaultRecoveryCodes
+	}
+
+	for range n {
+		var code, hash string
+
+		code, err = genRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hash, err = pwhash.GeneratePassword(recoveryCodeScheme, normalizeRecoveryCode(code))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	return
+}
+
+func genRecoveryCode() (code string, err error) {
+	b := make([]byte, recoveryCodeLength)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 && i%recoveryCodeGroupSize == 0 {
+			sb.WriteByte('-')
+		}
+
+		// 字母表长度为 32，取模不会导致分布不均。
+		sb.WriteByte(recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+	}
+
+	code = sb.String()
+
+	return
+}
+
+// normalizeRecoveryCode 忽略用户输入的恢复码中的大小写、空格和 `-`。
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// VerifyRecoveryCode 检查恢复码是否与 hashes 中的某个哈希匹配，返回匹配的哈希的
+// 索引，调用者应删除该哈希，使恢复码只能使用一次。没有匹配时返回 -1。
+func VerifyRecoveryCode(code string, hashes []string) (index int) {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLength {
+		return -1
+	}
+
+	index = -1
+	for i, hash := range hashes {
+		// 检查所有哈希，不提前返回。
+		if matched, _ := pwhash.VerifyPassword(hash, code); matched && index < 0 {
+			index = i
+		}
+	}
+
+	return
+}
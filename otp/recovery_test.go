@@ -0,0 +1,41 @@
+package otp
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(0)
+	assert.Nil(t, err)
+	assert.Len(t, codes, DefaultRecoveryCodes)
+	assert.Len(t, hashes, DefaultRecoveryCodes)
+
+	re := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := make(map[string]bool)
+
+	for i, code := range codes {
+		assert.Regexp(t, re, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+
+		assert.True(t, strings.HasPrefix(hashes[i], "{SSHA512}"))
+		assert.Equal(t, i, VerifyRecoveryCode(code, hashes))
+	}
+
+	// User input.
+	assert.Equal(t, 3, VerifyRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[3], "-", " "))+" ", hashes))
+
+	assert.Equal(t, -1, VerifyRecoveryCode("aaaa-bbbb-cccc-dddd", hashes))
+	assert.Equal(t, -1, VerifyRecoveryCode("", hashes))
+	assert.Equal(t, -1, VerifyRecoveryCode(codes[0], nil))
+	assert.Equal(t, -1, VerifyRecoveryCode(codes[0], hashes[1:]))
+
+	codes, hashes, err = GenerateRecoveryCodes(3)
+	assert.Nil(t, err)
+	assert.Len(t, codes, 3)
+	assert.Len(t, hashes, 3)
+}
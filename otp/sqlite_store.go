@@ -0,0 +1,82 @@
+package otp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultSQLiteTableName 是 SQLiteStore 默认使用的 SQL 表名。
+const DefaultSQLiteTableName = "otp_used_codes"
+
+// ErrEmptyTableName is returned when given table name is empty
+var ErrEmptyTableName = errors.New("table name must not be empty")
+
+// Making sure that we're adhering to the UsedCodeStore interface.
+var _ UsedCodeStore = (*SQLiteStore)(nil)
+
+// SQLiteStore 是保存在 SQLite 数据库中的 UsedCodeStore。
+type SQLiteStore struct {
+	conn *sql.DB
+
+	useQuery string // Use()
+}
+
+// NewSQLiteStore 创建 SQLiteStore，如果 SQL 表不存在则自动创建。
+// conn 通常是 sqlutils.InitSQLiteDB 返回的数据库连接；可选参数 tableName 默认为
+// DefaultSQLiteTableName。
+func NewSQLiteStore(conn *sql.DB, tableName ...string) (store *SQLiteStore, err error) {
+	table := DefaultSQLiteTableName
+	if len(tableName) > 0 {
+		table = strings.TrimSpace(tableName[0])
+	}
+
+	if table == "" {
+		err = ErrEmptyTableName
+
+		return
+	}
+
+	// Create SQLite table if not exists.
+	_, err = conn.Exec(fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            key        TEXT NOT NULL PRIMARY KEY,
+            counter    INTEGER NOT NULL DEFAULT 0,
+            updated_at INTEGER NOT NULL DEFAULT 0
+        ) STRICT;`,
+		table,
+	))
+
+	if err != nil {
+		return
+	}
+
+	store = &SQLiteStore{
+		conn: conn,
+		// 只有新的 counter 更大时才更新，通过受影响的行数判断 code 是否已使用过。
+		useQuery: fmt.Sprintf(`
+			INSERT INTO %s (key, counter, updated_at)
+			            VALUES ($1, $2, unixepoch())
+			ON CONFLICT (key) DO UPDATE SET counter = excluded.counter, updated_at = unixepoch()
+			WHERE excluded.counter > %s.counter
+		`, table, table),
+	}
+
+	return
+}
+
+// Use 记录 key 使用了 counter 对应的 code，见 UsedCodeStore。
+func (s *SQLiteStore) Use(ctx context.Context, key string, counter uint64) (ok bool, err error) {
+	// SQLite 的 INTEGER 是有符号的 64 位整数，TOTP 的计数器不会超出范围。
+	res, err := s.conn.ExecContext(ctx, s.useQuery, key, int64(counter))
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	ok = err == nil && n > 0
+
+	return
+}
@@ -0,0 +1,33 @@
+package otp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/sqlutils"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	conn, err := sqlutils.InitSQLiteDB(filepath.Join(t.TempDir(), "otp.db"), nil, 0, 0)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	store, err := NewSQLiteStore(conn)
+	assert.Nil(t, err)
+
+	testUsedCodeStore(t, store)
+
+	// Table already exists.
+	_, err = NewSQLiteStore(conn)
+	assert.Nil(t, err)
+
+	_, err = NewSQLiteStore(conn, " ")
+	assert.Equal(t, ErrEmptyTableName, err)
+
+	store, err = NewSQLiteStore(conn, "custom_otp")
+	assert.Nil(t, err)
+
+	testUsedCodeStore(t, store)
+}
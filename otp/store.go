@@ -0,0 +1,43 @@
+package otp
+
+import (
+	"context"
+	"sync"
+)
+
+// UsedCodeStore 记录每个账号最后一次校验成功的 code 对应的计数器，用于拒绝已使用
+// 过的 code（防止重放攻击）。
+type UsedCodeStore interface {
+	// Use 记录 key 使用了 counter 对应的 code。如果 counter 不大于已记录的值
+	// （即 code 已使用过，或比已使用的 code 更旧），返回 false。
+	// 实现必须是原子操作，以免并发的请求同时使用同一个 code。
+	Use(ctx context.Context, key string, counter uint64) (ok bool, err error)
+}
+
+// Making sure that we're adhering to the UsedCodeStore interface.
+var _ UsedCodeStore = (*MemoryStore)(nil)
+
+// MemoryStore 是保存在内存中的 UsedCodeStore，适用于单进程的程序及测试。
+// 程序重启后记录会丢失。
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]uint64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]uint64)}
+}
+
+func (s *MemoryStore) Use(_ context.Context, key string, counter uint64) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, found := s.counters[key]; found && counter <= last {
+		return
+	}
+
+	s.counters[key] = counter
+	ok = true
+
+	return
+}
@@ -0,0 +1,57 @@
+package otp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testUsedCodeStore(t *testing.T, store UsedCodeStore) {
+	ctx := context.Background()
+
+	ok, err := store.Use(ctx, "user@example.com", 100)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = store.Use(ctx, "user@example.com", 100)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = store.Use(ctx, "user@example.com", 99)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = store.Use(ctx, "user@example.com", 101)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = store.Use(ctx, "other@example.com", 100)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// Concurrent requests with same code, only one succeeds.
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if ok, err := store.Use(ctx, "user@example.com", 200); err == nil && ok {
+				succeeded.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), succeeded.Load())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testUsedCodeStore(t, NewMemoryStore())
+}
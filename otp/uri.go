@@ -0,0 +1,58 @@
+package otp
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TOTPURI 生成 `otpauth://totp/...` 格式的 URI，通常转换为二维码供 Authenticator
+// 应用扫描。secret 是 base32 编码的密钥（见 GenerateSecret）。
+//
+// 例如：otpauth://totp/iRedMail:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=iRedMail&algorithm=SHA1&digits=6&period=30
+func TOTPURI(issuer, accountName, secret string, opts ...Option) string {
+	o := newOptions(opts...)
+
+	v := uriValues(issuer, secret, o)
+	v.Set("period", strconv.Itoa(int(o.period.Seconds())))
+
+	return genURI("totp", issuer, accountName, v)
+}
+
+// HOTPURI 生成 `otpauth://hotp/...` 格式的 URI，counter 是初始计数器的值。
+func HOTPURI(issuer, accountName, secret string, counter uint64, opts ...Option) string {
+	o := newOptions(opts...)
+
+	v := uriValues(issuer, secret, o)
+	v.Set("counter", strconv.FormatUint(counter, 10))
+
+	return genURI("hotp", issuer, accountName, v)
+}
+
+func uriValues(issuer, secret string, o options) url.Values {
+	v := url.Values{}
+	v.Set("secret", strings.TrimRight(strings.ToUpper(secret), "="))
+	if issuer != "" {
+		v.Set("issuer", issuer)
+	}
+	v.Set("algorithm", string(o.algorithm))
+	v.Set("digits", strconv.Itoa(o.digits))
+
+	return v
+}
+
+func genURI(typ, issuer, accountName string, v url.Values) string {
+	label := accountName
+	if issuer != "" {
+		label = issuer + ":" + accountName
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     typ,
+		Path:     "/" + label,
+		RawQuery: strings.ReplaceAll(v.Encode(), "+", "%20"),
+	}
+
+	return u.String()
+}
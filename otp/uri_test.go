@@ -0,0 +1,37 @@
+package otp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("iRedMail", "user@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/iRedMail:user@example.com?algorithm=SHA1&digits=6&issuer=iRedMail&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+
+	uri = TOTPURI("ACME Co", "john doe", "jbswy3dpehpk3pxp====",
+		WithAlgorithm(AlgorithmSHA256), WithDigits(8), WithPeriod(60*time.Second))
+
+	u, err := url.Parse(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/ACME Co:john doe", u.Path)
+	assert.Equal(t, "ACME Co", u.Query().Get("issuer"))
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "SHA256", u.Query().Get("algorithm"))
+	assert.Equal(t, "8", u.Query().Get("digits"))
+	assert.Equal(t, "60", u.Query().Get("period"))
+	assert.NotContains(t, uri, "+")
+
+	uri = TOTPURI("", "user@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/user@example.com?algorithm=SHA1&digits=6&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
+
+func TestHOTPURI(t *testing.T) {
+	uri := HOTPURI("iRedMail", "user@example.com", "JBSWY3DPEHPK3PXP", 5)
+	assert.Equal(t, "otpauth://hotp/iRedMail:user@example.com?algorithm=SHA1&counter=5&digits=6&issuer=iRedMail&secret=JBSWY3DPEHPK3PXP", uri)
+}
@@ -0,0 +1,159 @@
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2 hash in the PHC string format used by the reference implementation,
+// libsodium and Dovecot:
+//
+//	$argon2id$v=19$m=65536,t=3,p=1$<base64 salt>$<base64 key>
+//
+// FYI
+//
+//	- https://datatracker.ietf.org/doc/html/rfc9106
+//	- https://doc.dovecot.org/configuration_manual/authentication/password_schemes/
+
+const (
+	argon2VariantI  = "argon2i"
+	argon2VariantID = "argon2id"
+)
+
+// 从已保存的哈希中解析出的参数的上限，避免格式错误或恶意的哈希导致校验密码时
+// 占用过多的内存和 CPU。
+const (
+	argon2MaxMemory      = 1024 * 1024 // KiB，即 1 GiB
+	argon2MaxIterations  = 256
+	argon2MaxParallelism = 64
+	argon2MinSaltLength  = 8
+)
+
+var errInvalidArgon2Hash = errors.New("invalid argon2 hash")
+
+func argon2Key(variant string, password, salt []byte, p Params) []byte {
+	if variant == argon2VariantI {
+		return argon2.Key(password, salt, p.Argon2Iterations, p.Argon2Memory, p.Argon2Parallelism, p.Argon2KeyLength)
+	}
+
+	return argon2.IDKey(password, salt, p.Argon2Iterations, p.Argon2Memory, p.Argon2Parallelism, p.Argon2KeyLength)
+}
+
+// genArgon2Password 生成不带 scheme 前缀的 argon2 哈希。
+func genArgon2Password(variant, plain string, p Params) (hash string, err error) {
+	salt := make([]byte, p.Argon2SaltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+
+	key := argon2Key(variant, []byte(plain), salt, p)
+
+	hash = fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		variant, argon2.Version,
+		p.Argon2Memory, p.Argon2Iterations, p.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return
+}
+
+// decodeArgon2Hash 解析不带 scheme 前缀的 argon2 哈希。
+func decodeArgon2Hash(hash string) (variant string, p Params, salt, key []byte, err error) {
+	vals := strings.Split(hash, "$")
+	if len(vals) != 6 || vals[0] != "" {
+		err = errInvalidArgon2Hash
+
+		return
+	}
+
+	variant = vals[1]
+	if variant != argon2VariantI && variant != argon2VariantID {
+		err = errInvalidArgon2Hash
+
+		return
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(vals[2], "v=%d", &version); err != nil {
+		return
+	}
+
+	if version != argon2.Version {
+		err = fmt.Errorf("unsupported argon2 version: %d", version)
+
+		return
+	}
+
+	if _, err = fmt.Sscanf(vals[3], "m=%d,t=%d,p=%d", &p.Argon2Memory, &p.Argon2Iterations, &p.Argon2Parallelism); err != nil {
+		return
+	}
+
+	if p.Argon2Memory < 1 || p.Argon2Memory > argon2MaxMemory ||
+		p.Argon2Iterations < 1 || p.Argon2Iterations > argon2MaxIterations ||
+		p.Argon2Parallelism < 1 || p.Argon2Parallelism > argon2MaxParallelism {
+		err = errInvalidArgon2Hash
+
+		return
+	}
+
+	if salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[4]); err != nil {
+		return
+	}
+
+	if key, err = base64.RawStdEncoding.Strict().DecodeString(vals[5]); err != nil {
+		return
+	}
+
+	if len(salt) < argon2MinSaltLength || len(key) == 0 {
+		err = errInvalidArgon2Hash
+
+		return
+	}
+
+	p.Argon2SaltLength = uint32(len(salt))
+	p.Argon2KeyLength = uint32(len(key))
+
+	return
+}
+
+// verifyArgon2Password 校验 argon2i / argon2id 哈希，hash 可以带 scheme 前缀。
+func verifyArgon2Password(plain, hash string) (matched bool, err error) {
+	if scheme, h := extractSchemeAndHash(hash); scheme != "" {
+		hash = h
+	}
+
+	variant, p, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return
+	}
+
+	calculated := argon2Key(variant, []byte(plain), salt, p)
+
+	return subtle.ConstantTimeCompare(calculated, key) == 1, nil
+}
+
+// GenArgon2IPassword 生成 argon2i 哈希，参数为 DefaultParams。
+// 如果 prefixScheme 为 true，则哈希带有 `{ARGON2I}` 前缀。
+func GenArgon2IPassword(plain string, prefixScheme ...bool) (hash string, err error) {
+	hash, err = genArgon2Password(argon2VariantI, plain, DefaultParams)
+	if err != nil {
+		return
+	}
+
+	if len(prefixScheme) > 0 && prefixScheme[0] {
+		hash = "{" + SchemeArgon2I + "}" + hash
+	}
+
+	return
+}
+
+func VerifyArgon2IPassword(plain, hash string) (matched bool, err error) {
+	return verifyArgon2Password(plain, hash)
+}
@@ -0,0 +1,66 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenArgon2IPassword(t *testing.T) {
+	hash, err := GenArgon2IPassword("plainPassword", true)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{ARGON2I}$argon2i$v=19$"))
+
+	matched, err := VerifyArgon2IPassword("plainPassword", hash)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	matched, err = VerifyArgon2IPassword("wrong", hash)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+}
+
+func TestVerifyArgon2PasswordMalformed(t *testing.T) {
+	const (
+		salt = "c29tZXNhbHRzb21lc2FsdA" // somesaltsomesalt
+		key  = "RdescudvJCsgt3ub+b+dWRWJTmaaJObGAAAAAAAAAAA"
+	)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"zero iterations", "$argon2i$v=19$m=65536,t=0,p=1$" + salt + "$" + key},
+		{"zero memory", "$argon2id$v=19$m=0,t=3,p=1$" + salt + "$" + key},
+		{"zero parallelism", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key},
+		{"huge memory", "$argon2id$v=19$m=4294967295,t=3,p=1$" + salt + "$" + key},
+		{"huge iterations", "$argon2id$v=19$m=65536,t=4294967295,p=1$" + salt + "$" + key},
+		{"huge parallelism", "$argon2id$v=19$m=65536,t=3,p=255$" + salt + "$" + key},
+		{"parallelism overflow", "$argon2id$v=19$m=65536,t=3,p=256$" + salt + "$" + key},
+		{"negative memory", "$argon2id$v=19$m=-1,t=3,p=1$" + salt + "$" + key},
+		{"short salt", "$argon2id$v=19$m=65536,t=3,p=1$c2FsdA$" + key},
+		{"empty salt", "$argon2id$v=19$m=65536,t=3,p=1$$" + key},
+		{"empty key", "$argon2id$v=19$m=65536,t=3,p=1$" + salt + "$"},
+		{"invalid key", "$argon2id$v=19$m=65536,t=3,p=1$" + salt + "$!!!"},
+		{"unsupported version", "$argon2id$v=16$m=65536,t=3,p=1$" + salt + "$" + key},
+		{"unknown variant", "$argon2d$v=19$m=65536,t=3,p=1$" + salt + "$" + key},
+		{"missing fields", "$argon2id$v=19$m=65536,t=3,p=1$" + salt},
+	}
+
+	for _, tt := range tests {
+		for _, prefix := range []string{"{ARGON2I}", "{ARGON2ID}", ""} {
+			hash := prefix + tt.hash
+
+			assert.NotPanics(t, func() {
+				matched, err := VerifyPassword(hash, "x")
+				assert.NotNil(t, err, tt.name)
+				assert.False(t, matched, tt.name)
+			}, tt.name)
+
+			matched, err := VerifyArgon2IDPassword("x", hash)
+			assert.NotNil(t, err, tt.name)
+			assert.False(t, matched, tt.name)
+		}
+	}
+}
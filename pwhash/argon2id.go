@@ -1,13 +1,9 @@
 package pwhash
 
-import (
-	"strings"
-
-	"github.com/alexedwards/argon2id"
-)
-
+// GenArgon2IDPassword 生成 argon2id 哈希，参数为 DefaultParams。
+// 如果 prefixScheme 为 true，则哈希带有 `{ARGON2ID}` 前缀。
 func GenArgon2IDPassword(plain string, prefixScheme ...bool) (hash string, err error) {
-	hash, err = argon2id.CreateHash(plain, argon2id.DefaultParams)
+	hash, err = genArgon2Password(argon2VariantID, plain, DefaultParams)
 	if err != nil {
 		return
 	}
@@ -20,9 +16,5 @@ func GenArgon2IDPassword(plain string, prefixScheme ...bool) (hash string, err e
 }
 
 func VerifyArgon2IDPassword(plain, hash string) (matched bool, err error) {
-	if strings.HasPrefix(hash, "{ARGON2ID}") || strings.HasPrefix(hash, "{argon2id}") {
-		hash = hash[10:]
-	}
-
-	return argon2id.ComparePasswordAndHash(plain, hash)
+	return verifyArgon2Password(plain, hash)
 }
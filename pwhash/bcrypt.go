@@ -35,8 +35,14 @@ func IsBcryptHash(s string) (ok bool, hash string) {
 	return
 }
 
-func GenerateBcryptPassword(plain string) (hash string, err error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+// GenerateBcryptPassword 生成 `{BLF-CRYPT}` 哈希。可选参数 cost 默认为 bcrypt.DefaultCost。
+func GenerateBcryptPassword(plain string, cost ...int) (hash string, err error) {
+	c := bcrypt.DefaultCost
+	if len(cost) > 0 && cost[0] > 0 {
+		c = cost[0]
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), c)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,94 @@
+package pwhash
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding"
+	"encoding/binary"
+)
+
+// CRAM-MD5 scheme.
+// The hash is not a digest of the password but the HMAC-MD5 intermediate
+// context (MD5 states after processing the outer and inner padded keys),
+// which allows Dovecot to do CRAM-MD5 authentication without storing the
+// plain password. Default encoding is HEX.
+//
+// FYI
+//
+//	- https://datatracker.ietf.org/doc/html/rfc2195
+//	- https://doc.dovecot.org/configuration_manual/authentication/password_schemes/
+
+// appendMD5State 计算一个 64 字节数据块后的 MD5 内部状态，以小端字节序追加到 dst。
+func appendMD5State(dst, block []byte) []byte {
+	h := md5.New()
+	h.Write(block)
+
+	// 序列化格式：`md5\x01` + 4 个大端 uint32 状态值 + 缓冲区 + 长度。
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	for i := range 4 {
+		dst = binary.LittleEndian.AppendUint32(dst, binary.BigEndian.Uint32(state[4+i*4:]))
+	}
+
+	return dst
+}
+
+// cramMD5Context 返回与 Dovecot `hmac_md5_get_cram_context()` 相同的 32 字节上下文。
+func cramMD5Context(password []byte) []byte {
+	key := password
+	if len(key) > md5.BlockSize {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+
+	ipad := make([]byte, md5.BlockSize)
+	opad := make([]byte, md5.BlockSize)
+	copy(ipad, key)
+	copy(opad, key)
+
+	for i := range md5.BlockSize {
+		ipad[i] ^= 0x36
+		opad[i] ^= 0x5c
+	}
+
+	ctx := make([]byte, 0, 32)
+	ctx = appendMD5State(ctx, opad)
+	ctx = appendMD5State(ctx, ipad)
+
+	return ctx
+}
+
+// GenerateCramMD5Password 生成 `{CRAM-MD5}` 格式的哈希（默认十六进制编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateCramMD5Password(password string, encoding ...string) (challenge string, err error) {
+	enc := EncodingHex
+	scheme := SchemeCramMD5
+	if len(encoding) > 0 && encoding[0] != "" {
+		enc = encoding[0]
+		scheme = schemeWithEncoding(scheme, enc)
+	}
+
+	return "{" + scheme + "}" + encodeDigest(cramMD5Context([]byte(password)), enc), nil
+}
+
+func VerifyCramMD5Password(challengePassword, plainPassword string) bool {
+	scheme, hashed := extractSchemeAndHash(challengePassword)
+	if scheme == "" {
+		hashed = challengePassword
+	}
+
+	_, enc := splitSchemeEncoding(scheme)
+	if enc == "" {
+		enc = EncodingHex
+	}
+
+	raw, err := decodeDigest(hashed, enc)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(raw, cramMD5Context([]byte(plainPassword))) == 1
+}
@@ -0,0 +1,69 @@
+package pwhash
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreMD5 restores a MD5 hash which has processed exactly one 64-byte
+// block, from the little-endian state saved in CRAM-MD5 context.
+func restoreMD5(state []byte) []byte {
+	b := []byte("md5\x01")
+	for i := range 4 {
+		b = binary.BigEndian.AppendUint32(b, binary.LittleEndian.Uint32(state[i*4:]))
+	}
+
+	b = append(b, make([]byte, md5.BlockSize)...)
+	b = binary.BigEndian.AppendUint64(b, md5.BlockSize)
+
+	return b
+}
+
+func TestCramMD5(t *testing.T) {
+	// Sample hash from Dovecot document.
+	assert.True(t, VerifyCramMD5Password("{CRAM-MD5}e02d374fde0dc75a17a557039a3a5338c7743304777dccd376f332bee68d2cf6", "test"))
+
+	for _, plain := range []string{"password", goutils.GenRandomString(12), strings.Repeat("long", 20)} {
+		hash, err := GenerateCramMD5Password(plain)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(hash, "{CRAM-MD5}"))
+		assert.True(t, VerifyCramMD5Password(hash, plain))
+		assert.False(t, VerifyCramMD5Password(hash, plain+"x"))
+
+		// The context must be usable to compute HMAC-MD5 of any challenge.
+		_, hexContext := extractSchemeAndHash(hash)
+		context, err := hex.DecodeString(hexContext)
+		assert.Nil(t, err)
+		assert.Len(t, context, 32)
+
+		challenge := []byte("<1896.697170952@postoffice.example.net>")
+
+		inner := md5.New()
+		assert.Nil(t, inner.(encoding.BinaryUnmarshaler).UnmarshalBinary(restoreMD5(context[16:])))
+		inner.Write(challenge)
+
+		outer := md5.New()
+		assert.Nil(t, outer.(encoding.BinaryUnmarshaler).UnmarshalBinary(restoreMD5(context[:16])))
+		outer.Write(inner.Sum(nil))
+
+		mac := hmac.New(md5.New, []byte(plain))
+		mac.Write(challenge)
+		assert.Equal(t, mac.Sum(nil), outer.Sum(nil))
+	}
+
+	hash, err := GeneratePassword("CRAM-MD5.b64", "password")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{CRAM-MD5.b64}"))
+
+	matched, err := VerifyPassword(hash, "password")
+	assert.Nil(t, err)
+	assert.True(t, matched)
+}
@@ -0,0 +1,40 @@
+package pwhash
+
+import (
+	"strings"
+)
+
+// GenerateCryptPassword 生成 `{CRYPT}$6$...` 格式的哈希（即 SHA512-CRYPT 算法）。
+func GenerateCryptPassword(plain string, rounds ...int) (hash string, err error) {
+	hash, err = GenerateSHA512CryptPassword(plain, rounds...)
+	if err != nil {
+		return
+	}
+
+	_, hash = extractSchemeAndHash(hash)
+
+	return "{" + SchemeCrypt + "}" + hash, nil
+}
+
+// VerifyCryptPassword 校验 `{CRYPT}` 哈希。Dovecot 使用 libc `crypt()` 校验，因此根据哈希前缀
+// 选择算法：`$1$`（MD5-CRYPT）、`$5$`（SHA256-CRYPT）、`$6$`（SHA512-CRYPT）、
+// `$2a$`/`$2b$`/`$2x$`/`$2y$`（BLF-CRYPT）。不支持传统的 DES crypt。
+func VerifyCryptPassword(challengePassword, plainPassword string) bool {
+	_, hash := extractSchemeAndHash(challengePassword)
+	if hash == "" {
+		hash = challengePassword
+	}
+
+	switch {
+	case strings.HasPrefix(hash, md5CryptMagic):
+		return VerifyMD5CryptPassword(hash, plainPassword)
+	case strings.HasPrefix(hash, sha256CryptMagic):
+		return VerifySHA256CryptPassword(hash, plainPassword)
+	case strings.HasPrefix(hash, sha512CryptMagic):
+		return VerifySHA512CryptPassword(hash, plainPassword)
+	case strings.HasPrefix(hash, "$2"):
+		return VerifyBcryptPassword("{"+SchemeBcrypt+"}"+hash, plainPassword)
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrypt(t *testing.T) {
+	data := map[string]string{
+		"password":     "{CRYPT}$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"Hello world!": "{CRYPT}$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+		"test2":        "{CRYPT}$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu",
+	}
+
+	for plain, hashed := range data {
+		assert.True(t, VerifyCryptPassword(hashed, plain), hashed)
+		assert.False(t, VerifyCryptPassword(hashed, plain+"x"), hashed)
+
+		matched, err := VerifyPassword(hashed, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched, hashed)
+	}
+
+	// DES crypt is not supported.
+	assert.False(t, VerifyCryptPassword("{CRYPT}abJnggxhB/yWI", "test"))
+
+	plain := goutils.GenRandomString(12)
+	for _, scheme := range []string{SchemeCrypt, SchemeSHA256Crypt, SchemeSHA512Crypt, SchemeMD5Crypt} {
+		hash, err := GeneratePassword(scheme, plain)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(hash, "{"+scheme+"}$"))
+
+		matched, err := VerifyPassword(hash, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched, hash)
+	}
+}
@@ -0,0 +1,138 @@
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// Dovecot 允许在 scheme 名称后追加编码后缀来指定哈希的编码方式，例如：
+//
+//   - `{SHA256.HEX}`: 十六进制编码
+//   - `{SHA256.b64}`: base64 编码
+//
+// 不带后缀时使用 scheme 的默认编码（SHA 系列为 base64，CRAM-MD5 / NTLM 为十六进制）。
+//
+// FYI https://doc.dovecot.org/configuration_manual/authentication/password_schemes/
+const (
+	EncodingHex    = "HEX"
+	EncodingBase64 = "B64"
+)
+
+// secureCompare 以固定时间比较两个字符串，用于比较长度不固定的值（如明文密码）。
+// 先计算 SHA256 再比较，避免因长度不同而提前返回。
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// verifyHexDigest 以固定时间比较十六进制编码（不区分大小写）的摘要。
+func verifyHexDigest(hexDigest string, digest []byte) bool {
+	decoded, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(decoded, digest) == 1
+}
+
+// splitSchemeEncoding 拆分 scheme 名称和编码后缀。例如：`SHA.HEX` -> `SHA`, `HEX`。
+// 注意：返回的名称和编码都是大写的。
+func splitSchemeEncoding(scheme string) (name, encoding string) {
+	name, encoding, _ = strings.Cut(strings.ToUpper(scheme), ".")
+
+	return
+}
+
+// schemeWithEncoding 返回带编码后缀的 scheme 名称，后缀格式与 `doveadm pw` 一致。
+func schemeWithEncoding(scheme, encoding string) string {
+	switch strings.ToUpper(encoding) {
+	case EncodingHex:
+		return scheme + ".HEX"
+	case EncodingBase64:
+		return scheme + ".b64"
+	}
+
+	return scheme
+}
+
+func encodeDigest(b []byte, encoding string) string {
+	if strings.ToUpper(encoding) == EncodingHex {
+		return hex.EncodeToString(b)
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeDigest(s, encoding string) ([]byte, error) {
+	if strings.ToUpper(encoding) == EncodingHex {
+		return hex.DecodeString(s)
+	}
+
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// genDigestPassword 生成 `{SCHEME[.ENCODING]}digest[salt]` 格式的哈希。
+//
+//   - saltLength 为 0 表示不加 salt。
+//   - encoding 为空时使用 defaultEncoding，且 scheme 名称不带编码后缀。
+func genDigestPassword(newHash func() hash.Hash, scheme, defaultEncoding string, password []byte, saltLength int, encoding ...string) (challenge string, err error) {
+	var salt []byte
+	if saltLength > 0 {
+		salt = make([]byte, saltLength)
+		if _, err = rand.Read(salt); err != nil {
+			return
+		}
+	}
+
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	digest := append(h.Sum(nil), salt...)
+
+	enc := defaultEncoding
+	if len(encoding) > 0 && encoding[0] != "" {
+		enc = encoding[0]
+		scheme = schemeWithEncoding(scheme, enc)
+	}
+
+	return "{" + scheme + "}" + encodeDigest(digest, enc), nil
+}
+
+// verifyDigestPassword 校验 genDigestPassword 生成的哈希。challengePassword 可以不带 scheme 前缀。
+//
+// 与 Dovecot 一致，默认编码为 base64 的无 salt 哈希如果长度与十六进制编码的长度一致，则按十六进制解码。
+func verifyDigestPassword(newHash func() hash.Hash, salted bool, defaultEncoding, challengePassword string, password []byte) bool {
+	scheme, hashed := extractSchemeAndHash(challengePassword)
+	if scheme == "" {
+		hashed = challengePassword
+	}
+
+	_, encoding := splitSchemeEncoding(scheme)
+	if encoding == "" {
+		encoding = defaultEncoding
+	}
+
+	size := newHash().Size()
+
+	raw, err := decodeDigest(hashed, encoding)
+	if !salted && (err != nil || len(raw) != size) && len(hashed) == size*2 {
+		raw, err = hex.DecodeString(hashed)
+	}
+
+	if err != nil || len(raw) < size || (!salted && len(raw) != size) {
+		return false
+	}
+
+	h := newHash()
+	h.Write(password)
+	h.Write(raw[size:])
+
+	return subtle.ConstantTimeCompare(h.Sum(nil), raw[:size]) == 1
+}
@@ -0,0 +1,163 @@
+package pwhash
+
+import (
+	"strings"
+)
+
+// HashInfo 是 Identify 识别密码哈希的结果。
+type HashInfo struct {
+	// Scheme 是识别出的算法名称（大写）。无法识别时为空。
+	// `{CRYPT}` 哈希返回实际使用的算法，例如 `{CRYPT}$6$...` 返回 SHA512-CRYPT。
+	Scheme string `json:"scheme"`
+
+	// Prefixed 表示哈希是否带有 `{SCHEME}` 前缀。
+	Prefixed bool `json:"prefixed"`
+
+	// Encoding 是哈希前缀中的编码后缀（EncodingHex 或 EncodingBase64），没有后缀时为空。
+	Encoding string `json:"encoding,omitempty"`
+
+	// Candidates 是不带前缀的哈希可能使用的所有算法，按可能性排序。
+	// 例如 32 个十六进制字符可能是 PLAIN-MD5、MD5 或 NTLM。
+	Candidates []string `json:"candidates,omitempty"`
+
+	// Params 是哈希中包含的参数，例如 bcrypt 的 cost。
+	Params Params `json:"params"`
+
+	// MeetsPolicy 表示哈希是否满足 Identify 的 policy 参数指定的策略。
+	// 未指定策略时总是 false。
+	MeetsPolicy bool `json:"meets_policy"`
+}
+
+// Ambiguous 表示不带前缀的哈希可能属于多个算法。
+func (i HashInfo) Ambiguous() bool {
+	return len(i.Candidates) > 1
+}
+
+// Identify 识别密码哈希使用的算法及其参数。
+//
+// 哈希带有 `{SCHEME}` 前缀时直接使用前缀中的算法；否则根据哈希格式（如 `$2y$`、
+// `$6$`、`$argon2id$`、32 个十六进制字符等）按 SupportedPasswordSchemes 的顺序
+// 识别，第一个匹配的算法作为 Scheme。
+//
+// 如果指定了 policy，则同时检查哈希是否满足策略（见 UpgradePolicy.NeedsUpgrade）。
+func Identify(hash string, policy ...UpgradePolicy) (info HashInfo) {
+	hash = strings.TrimSpace(hash)
+
+	scheme, h := extractSchemeAndHash(hash)
+	if strings.HasPrefix(hash, "{") && scheme != "" {
+		info.Prefixed = true
+		info.Scheme, info.Encoding = splitSchemeEncoding(scheme)
+		hash = h
+
+		if _, found := LookupScheme(info.Scheme); !found {
+			// 未知算法，仍然返回前缀中的名称，便于统计。
+			return
+		}
+
+		info.Candidates = []string{info.Scheme}
+	} else {
+		info.Candidates = identifyCandidates(hash)
+		if len(info.Candidates) == 0 {
+			return
+		}
+
+		info.Scheme = info.Candidates[0]
+	}
+
+	prefixed := "{" + schemeWithEncoding(info.Scheme, info.Encoding) + "}" + hash
+
+	scheme, params, err := ParseHashParams(prefixed)
+	if err == nil {
+		info.Scheme = scheme
+		info.Params = params
+	}
+
+	if len(policy) > 0 {
+		info.MeetsPolicy = err == nil && !policy[0].NeedsUpgrade(prefixed)
+	}
+
+	return
+}
+
+// identifyCandidates 返回能识别不带前缀的哈希的所有算法。
+// CRYPT 只在没有更具体的 crypt 算法匹配时才返回。
+func identifyCandidates(hash string) (candidates []string) {
+	if hash == "" {
+		return
+	}
+
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	for _, name := range SupportedPasswordSchemes {
+		s := schemes[name]
+		if s == nil || !s.Identify(hash) {
+			continue
+		}
+
+		if name == SchemeCrypt && len(candidates) > 0 {
+			continue
+		}
+
+		candidates = append(candidates, name)
+	}
+
+	return
+}
+
+// InventorySummary 是 Inventory 统计的结果。
+type InventorySummary struct {
+	Total      int `json:"total"`
+	Prefixed   int `json:"prefixed"`
+	Unprefixed int `json:"unprefixed"`
+	Ambiguous  int `json:"ambiguous"` // 不带前缀且可能属于多个算法
+	Unknown    int `json:"unknown"`   // 无法识别或不支持的算法
+
+	// Schemes 是每个算法的哈希数量，key 是算法名称。无法识别的哈希不统计在内。
+	Schemes map[string]int `json:"schemes"`
+
+	// MeetPolicy 和 NeedUpgrade 分别是满足和不满足策略的哈希数量。
+	// 仅在指定了 policy 时统计。
+	MeetPolicy  int `json:"meet_policy"`
+	NeedUpgrade int `json:"need_upgrade"`
+}
+
+// Inventory 批量识别密码哈希并返回统计结果，用于迁移前评估现有的密码哈希。
+// 如果指定了 policy，则同时统计满足和不满足策略的哈希数量。
+func Inventory(hashes []string, policy ...UpgradePolicy) (summary InventorySummary) {
+	summary.Schemes = make(map[string]int)
+
+	for _, hash := range hashes {
+		summary.Total++
+
+		info := Identify(hash, policy...)
+
+		if info.Prefixed {
+			summary.Prefixed++
+		} else {
+			summary.Unprefixed++
+		}
+
+		if info.Ambiguous() {
+			summary.Ambiguous++
+		}
+
+		if _, found := LookupScheme(info.Scheme); !found || info.Scheme == "" {
+			summary.Unknown++
+
+			continue
+		}
+
+		summary.Schemes[info.Scheme]++
+
+		if len(policy) > 0 {
+			if info.MeetsPolicy {
+				summary.MeetPolicy++
+			} else {
+				summary.NeedUpgrade++
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,79 @@
+package pwhash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentify(t *testing.T) {
+	// key is password hash, value is expected scheme.
+	data := map[string]string{
+		"{SSHA}abc":        SchemeSSHA,
+		"{ssha512.HEX}abc": SchemeSSHA512,
+		"{CRYPT}$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu":                                  SchemeBcrypt,
+		"$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu":                                         SchemeBcrypt,
+		"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/":                                                                   SchemeMD5Crypt,
+		"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5":                                            SchemeSHA256Crypt,
+		"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1": SchemeSHA512Crypt,
+		"$argon2id$v=19$m=16384,t=2,p=1$c29tZXNhbHRzb21lc2FsdA$RdescudvJCsgt3ub+b+dWRWJTmaaJObGAAAAAAAAAAA":    SchemeArgon2ID,
+		"$argon2i$v=19$m=16384,t=2,p=1$c29tZXNhbHRzb21lc2FsdA$RdescudvJCsgt3ub+b+dWRWJTmaaJObGAAAAAAAAAAA":     SchemeArgon2I,
+		"5f4dcc3b5aa765d61d8327deb882cf99":                                                                     SchemePlainMD5,
+		"W6ph5Mm5Pz8GgiULbPgzG37mj9g=":                                                                         SchemeSHA,
+		"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8":                                                             SchemeSHA,
+		"XohImNooBHFR0OVvjcYpJ3NgPQ1qq73WKhHvch0VQtg=":                                                         SchemeSHA256,
+		"DIzeh0gCRMTRu9dAH3C3rr7fWkRT0Bp2ZdtRqvTX3XJzYWx0c2FsdA==":                                             SchemeSSHA256,
+		"not a hash": "",
+	}
+
+	for hash, scheme := range data {
+		info := Identify(hash)
+		assert.Equal(t, scheme, info.Scheme, hash)
+	}
+
+	info := Identify("{SHA256.HEX}abc")
+	assert.True(t, info.Prefixed)
+	assert.Equal(t, EncodingHex, info.Encoding)
+
+	// 32 hex characters.
+	info = Identify("8846f7eaee8fb117ad06bdd830b7586c")
+	assert.False(t, info.Prefixed)
+	assert.True(t, info.Ambiguous())
+	assert.Equal(t, []string{SchemePlainMD5, SchemeMD5, SchemeNTLM}, info.Candidates)
+
+	// Parameters.
+	info = Identify("$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu")
+	assert.Equal(t, 10, info.Params.BcryptCost)
+	assert.False(t, info.Ambiguous())
+
+	info = Identify("$argon2id$v=19$m=16384,t=2,p=1$c29tZXNhbHRzb21lc2FsdA$RdescudvJCsgt3ub+b+dWRWJTmaaJObGAAAAAAAAAAA")
+	assert.Equal(t, uint32(16384), info.Params.Argon2Memory)
+	assert.Equal(t, uint32(2), info.Params.Argon2Iterations)
+
+	// Policy.
+	policy := UpgradePolicy{Scheme: SchemeBcrypt, MinBcryptCost: 10}
+	assert.True(t, Identify("$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu", policy).MeetsPolicy)
+	assert.False(t, Identify("{CRYPT}$2a$05$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu", policy).MeetsPolicy)
+	assert.False(t, Identify("5f4dcc3b5aa765d61d8327deb882cf99", policy).MeetsPolicy)
+}
+
+func TestInventory(t *testing.T) {
+	hashes := []string{
+		"{SSHA}DIzeh0gCRMTRu9dAH3C3rr7fWkRT",
+		"{BLF-CRYPT}$2y$12$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu",
+		"$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu",
+		"5f4dcc3b5aa765d61d8327deb882cf99",
+		"{UNKNOWN}xxx",
+		"???",
+	}
+
+	summary := Inventory(hashes, UpgradePolicy{Scheme: SchemeBcrypt, MinBcryptCost: 11})
+	assert.Equal(t, 6, summary.Total)
+	assert.Equal(t, 3, summary.Prefixed)
+	assert.Equal(t, 3, summary.Unprefixed)
+	assert.Equal(t, 1, summary.Ambiguous)
+	assert.Equal(t, 2, summary.Unknown)
+	assert.Equal(t, map[string]int{SchemeSSHA: 1, SchemeBcrypt: 2, SchemePlainMD5: 1}, summary.Schemes)
+	assert.Equal(t, 1, summary.MeetPolicy)
+	assert.Equal(t, 3, summary.NeedUpgrade)
+}
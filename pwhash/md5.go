@@ -3,7 +3,6 @@ package pwhash
 import (
 	"crypto/md5"
 	"fmt"
-	"strings"
 )
 
 func GenerateMD5Password(password string) string {
@@ -13,5 +12,12 @@ func GenerateMD5Password(password string) string {
 }
 
 func VerifyMD5Password(challengePassword, plainPassword string) bool {
-	return strings.EqualFold(GenerateMD5Password(plainPassword), challengePassword)
+	scheme, hash := extractSchemeAndHash(challengePassword)
+	if scheme != SchemeMD5 {
+		return false
+	}
+
+	digest := md5.Sum([]byte(plainPassword))
+
+	return verifyHexDigest(hash, digest[:])
 }
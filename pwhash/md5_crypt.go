@@ -0,0 +1,117 @@
+package pwhash
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"strings"
+)
+
+// MD5-CRYPT scheme (`$1$`), compatible with glibc `crypt(3)` and Dovecot.
+// It's weak and only kept for verifying legacy password hashes.
+
+const (
+	md5CryptMagic         = "$1$"
+	md5CryptSaltMaxLength = 8
+	md5CryptRounds        = 1000
+)
+
+// md5Crypt 实现 MD5-crypt 算法，返回不带 scheme 前缀的完整哈希，例如 `$1$salt$xxx`。
+func md5Crypt(password, salt []byte) string {
+	// Alternate sum.
+	h := md5.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	alt := h.Sum(nil)
+
+	h.Reset()
+	h.Write(password)
+	h.Write([]byte(md5CryptMagic))
+	h.Write(salt)
+	h.Write(repeatBytes(alt, len(password)))
+
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(password[:1])
+		}
+	}
+
+	final := h.Sum(nil)
+
+	for i := range md5CryptRounds {
+		h.Reset()
+
+		if i&1 != 0 {
+			h.Write(password)
+		} else {
+			h.Write(final)
+		}
+
+		if i%3 != 0 {
+			h.Write(salt)
+		}
+
+		if i%7 != 0 {
+			h.Write(password)
+		}
+
+		if i&1 != 0 {
+			h.Write(final)
+		} else {
+			h.Write(password)
+		}
+
+		final = h.Sum(nil)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(md5CryptMagic)
+	sb.Write(salt)
+	sb.WriteString("$")
+
+	for _, p := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		sb.Write(cryptB64From24Bit(final[p[0]], final[p[1]], final[p[2]], 4))
+	}
+
+	sb.Write(cryptB64From24Bit(0, 0, final[11], 2))
+
+	return sb.String()
+}
+
+// GenerateMD5CryptPassword 生成 `{MD5-CRYPT}$1$...` 格式的哈希。
+func GenerateMD5CryptPassword(plain string) (hash string, err error) {
+	salt, err := genCryptSalt(md5CryptSaltMaxLength)
+	if err != nil {
+		return
+	}
+
+	return "{" + SchemeMD5Crypt + "}" + md5Crypt([]byte(plain), []byte(salt)), nil
+}
+
+func VerifyMD5CryptPassword(challengePassword, plainPassword string) bool {
+	_, hash := extractSchemeAndHash(challengePassword)
+	if hash == "" {
+		hash = challengePassword
+	}
+
+	setting, found := strings.CutPrefix(hash, md5CryptMagic)
+	if !found {
+		return false
+	}
+
+	salt, digest, found := strings.Cut(setting, "$")
+	if !found || digest == "" {
+		return false
+	}
+
+	if len(salt) > md5CryptSaltMaxLength {
+		salt = salt[:md5CryptSaltMaxLength]
+	}
+
+	calculated := md5Crypt([]byte(plainPassword), []byte(salt))
+	calculated = calculated[strings.LastIndex(calculated, "$")+1:]
+
+	return subtle.ConstantTimeCompare([]byte(calculated), []byte(digest)) == 1
+}
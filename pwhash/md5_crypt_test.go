@@ -0,0 +1,28 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMD5Crypt(t *testing.T) {
+	// Test vectors generated with glibc `crypt(3)`.
+	data := map[string]string{
+		"password": "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"test1":    "{MD5-CRYPT}$1$abcdefgh$m0INEKWW1jrRTfpNdto3a/",
+	}
+
+	for plain, hashed := range data {
+		assert.True(t, VerifyMD5CryptPassword(hashed, plain))
+		assert.False(t, VerifyMD5CryptPassword(hashed, plain+"x"))
+	}
+
+	plain := goutils.GenRandomString(12)
+	hash, err := GenerateMD5CryptPassword(plain)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{MD5-CRYPT}$1$"))
+	assert.True(t, VerifyMD5CryptPassword(hash, plain))
+}
@@ -0,0 +1,30 @@
+package pwhash
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM scheme: MD4 digest of the UTF-16LE encoded password. Default encoding
+// is HEX. It's weak and only kept for compatibility with legacy hashes.
+
+func ntlmPassword(password string) []byte {
+	b := make([]byte, 0, len(password)*2)
+	for _, r := range utf16.Encode([]rune(password)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+
+	return b
+}
+
+// GenerateNTLMPassword 生成 `{NTLM}` 格式的哈希（默认十六进制编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateNTLMPassword(password string, encoding ...string) (challenge string, err error) {
+	return genDigestPassword(md4.New, SchemeNTLM, EncodingHex, ntlmPassword(password), 0, encoding...)
+}
+
+func VerifyNTLMPassword(challengePassword, plainPassword string) bool {
+	return verifyDigestPassword(md4.New, false, EncodingHex, challengePassword, ntlmPassword(plainPassword))
+}
@@ -0,0 +1,33 @@
+package pwhash
+
+import (
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNTLM(t *testing.T) {
+	data := map[string]string{
+		"{NTLM}8846f7eaee8fb117ad06bdd830b7586c": "password",
+		"{NTLM}8846F7EAEE8FB117AD06BDD830B7586C": "password",
+		"8846f7eaee8fb117ad06bdd830b7586c":       "password",
+	}
+
+	for hashed, plain := range data {
+		assert.True(t, VerifyNTLMPassword(hashed, plain))
+		assert.False(t, VerifyNTLMPassword(hashed, plain+"x"))
+	}
+
+	hash, err := GenerateNTLMPassword("password")
+	assert.Nil(t, err)
+	assert.Equal(t, "{NTLM}8846f7eaee8fb117ad06bdd830b7586c", hash)
+
+	plain := goutils.GenRandomString(12)
+	hash, err = GeneratePassword(SchemeNTLM+".b64", plain)
+	assert.Nil(t, err)
+
+	matched, err := VerifyPassword(hash, plain)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+}
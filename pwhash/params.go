@@ -0,0 +1,204 @@
+package pwhash
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/iredmail/goutils/respcode"
+)
+
+// Params 定义生成密码哈希时使用的参数，每个参数只对相应的算法生效。
+type Params struct {
+	// ARGON2I, ARGON2ID
+	Argon2Memory      uint32 // 内存大小，单位是 KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32 // 单位是字节
+	Argon2KeyLength   uint32 // 单位是字节
+
+	// BLF-CRYPT
+	BcryptCost int
+
+	// SHA256-CRYPT, SHA512-CRYPT
+	SHACryptRounds int
+}
+
+// DefaultParams 是 GeneratePassword 默认使用的参数。
+//
+// 注意：Dovecot 使用 libsodium 校验 argon2 哈希，而 libsodium 只支持 parallelism 为 1。
+var DefaultParams = Params{
+	Argon2Memory:      64 * 1024,
+	Argon2Iterations:  3,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+	BcryptCost:        bcrypt.DefaultCost,
+	SHACryptRounds:    shaCryptRoundsDefault,
+}
+
+type Option func(p *Params)
+
+// WithParams 使用 p 中的非零值覆盖默认参数。超出范围的值被限制在校验时允许的范围内，
+// 避免生成无法校验的哈希。
+func WithParams(p Params) Option {
+	return func(params *Params) {
+		if p.Argon2Memory > 0 {
+			params.Argon2Memory = min(p.Argon2Memory, argon2MaxMemory)
+		}
+
+		if p.Argon2Iterations > 0 {
+			params.Argon2Iterations = min(p.Argon2Iterations, argon2MaxIterations)
+		}
+
+		if p.Argon2Parallelism > 0 {
+			params.Argon2Parallelism = min(p.Argon2Parallelism, argon2MaxParallelism)
+		}
+
+		if p.Argon2SaltLength > 0 {
+			params.Argon2SaltLength = max(p.Argon2SaltLength, argon2MinSaltLength)
+		}
+
+		if p.Argon2KeyLength > 0 {
+			params.Argon2KeyLength = p.Argon2KeyLength
+		}
+
+		if p.BcryptCost > 0 {
+			WithBcryptCost(p.BcryptCost)(params)
+		}
+
+		if p.SHACryptRounds > 0 {
+			WithSHACryptRounds(p.SHACryptRounds)(params)
+		}
+	}
+}
+
+// WithArgon2 设置 argon2 的内存大小（KiB，最大 1 GiB）、迭代次数（最大 256）和并行度（最大 64）。
+func WithArgon2(memory, iterations uint32, parallelism uint8) Option {
+	return WithParams(Params{
+		Argon2Memory:      memory,
+		Argon2Iterations:  iterations,
+		Argon2Parallelism: parallelism,
+	})
+}
+
+// WithBcryptCost 设置 bcrypt 的 cost（4 - 31）。
+func WithBcryptCost(cost int) Option {
+	return func(p *Params) {
+		p.BcryptCost = min(max(cost, bcrypt.MinCost), bcrypt.MaxCost)
+	}
+}
+
+// WithSHACryptRounds 设置 SHA256-CRYPT / SHA512-CRYPT 的迭代次数。
+func WithSHACryptRounds(rounds int) Option {
+	return func(p *Params) {
+		p.SHACryptRounds = min(max(rounds, shaCryptRoundsMin), shaCryptRoundsMax)
+	}
+}
+
+func newParams(options ...Option) Params {
+	p := DefaultParams
+	for _, option := range options {
+		option(&p)
+	}
+
+	return p
+}
+
+// ParseHashParams 从密码哈希中解析出算法名称及其参数。
+//
+//   - `{CRYPT}` 哈希返回实际使用的算法，例如 `{CRYPT}$2y$...` 返回 BLF-CRYPT。
+//   - 不支持参数的算法（如 SSHA）返回空的 Params。
+//   - 哈希必须带有 `{SCHEME}` 前缀。
+func ParseHashParams(hashed string) (scheme string, p Params, err error) {
+	scheme, hash := extractSchemeAndHash(hashed)
+	scheme, _ = splitSchemeEncoding(scheme)
+
+	if _, found := LookupScheme(scheme); !found {
+		err = respcode.ErrUnsupportedPasswordScheme
+
+		return
+	}
+
+	if scheme == SchemeCrypt {
+		scheme = cryptSchemeOf(hash)
+	}
+
+	switch scheme {
+	case SchemeArgon2I, SchemeArgon2ID:
+		_, p, _, _, err = decodeArgon2Hash(hash)
+	case SchemeBcrypt:
+		p.BcryptCost, err = bcrypt.Cost([]byte(hash))
+	case SchemeSHA256Crypt, SchemeSHA512Crypt:
+		setting, found := strings.CutPrefix(hash, sha256CryptMagic)
+		if !found {
+			setting, found = strings.CutPrefix(hash, sha512CryptMagic)
+		}
+
+		rounds, _, _, _, ok := parseSHACryptSetting(setting)
+		if !found || !ok {
+			err = respcode.ErrInvalidPasswordScheme
+
+			return
+		}
+
+		p.SHACryptRounds = rounds
+	}
+
+	return
+}
+
+// CalibrateArgon2ID 根据当前主机的性能计算 argon2id 参数，使校验一次密码的
+// 耗时接近（不低于）target。
+//
+// 并行度固定为 1（兼容 Dovecot），优先使用 DefaultParams 的内存大小并增加
+// 迭代次数；如果一次迭代的耗时已远超 target，则减少内存（最少 8 MiB）。
+func CalibrateArgon2ID(target time.Duration) (p Params, err error) {
+	const minMemory = 8 * 1024
+	const maxIterations = 64
+
+	if target <= 0 {
+		err = respcode.ErrInvalidParam
+
+		return
+	}
+
+	p = DefaultParams
+	p.Argon2Parallelism = 1
+	p.Argon2Iterations = 1
+
+	password := []byte("calibrate")
+	salt := make([]byte, p.Argon2SaltLength)
+
+	measure := func() time.Duration {
+		start := time.Now()
+		argon2.IDKey(password, salt, p.Argon2Iterations, p.Argon2Memory, p.Argon2Parallelism, p.Argon2KeyLength)
+
+		return time.Since(start)
+	}
+
+	for {
+		elapsed := measure()
+
+		if elapsed >= target {
+			if p.Argon2Iterations == 1 && elapsed > target*2 && p.Argon2Memory/2 >= minMemory {
+				p.Argon2Memory /= 2
+
+				continue
+			}
+
+			return
+		}
+
+		if p.Argon2Iterations >= maxIterations {
+			return
+		}
+
+		// 根据单次迭代的耗时估算所需的迭代次数。
+		perIteration := max(elapsed/time.Duration(p.Argon2Iterations), time.Microsecond)
+		estimated := min(int64(target/perIteration)+1, maxIterations)
+		p.Argon2Iterations = min(max(uint32(estimated), p.Argon2Iterations+1), maxIterations)
+	}
+}
@@ -0,0 +1,120 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iredmail/goutils"
+	"github.com/iredmail/goutils/respcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParams(t *testing.T) {
+	plain := goutils.GenRandomString(12)
+
+	// Argon2
+	for _, scheme := range []string{SchemeArgon2I, SchemeArgon2ID} {
+		hash, err := GeneratePassword(scheme, plain, WithArgon2(16*1024, 2, 1))
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(hash, "{"+scheme+"}$"+strings.ToLower(scheme)+"$v=19$m=16384,t=2,p=1$"), hash)
+
+		matched, err := VerifyPassword(hash, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched)
+
+		s, p, err := ParseHashParams(hash)
+		assert.Nil(t, err)
+		assert.Equal(t, scheme, s)
+		assert.Equal(t, uint32(16*1024), p.Argon2Memory)
+		assert.Equal(t, uint32(2), p.Argon2Iterations)
+		assert.Equal(t, uint8(1), p.Argon2Parallelism)
+		assert.Equal(t, DefaultParams.Argon2SaltLength, p.Argon2SaltLength)
+		assert.Equal(t, DefaultParams.Argon2KeyLength, p.Argon2KeyLength)
+	}
+
+	hash, err := GenArgon2IPassword(plain, true)
+	assert.Nil(t, err)
+	matched, err := VerifyArgon2IPassword(plain, hash)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	// bcrypt
+	hash, err = GeneratePassword(SchemeBcrypt, plain, WithBcryptCost(5))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{BLF-CRYPT}$2a$05$"))
+
+	s, p, err := ParseHashParams(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeBcrypt, s)
+	assert.Equal(t, 5, p.BcryptCost)
+
+	s, p, err = ParseHashParams("{CRYPT}$2y$10$c5km82jGk1Iw75I5wL31Juw9mRQNW6XKVoLC5T.jB3yrxD1GYcWyu")
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeBcrypt, s)
+	assert.Equal(t, 10, p.BcryptCost)
+
+	// SHA-crypt
+	hash, err = GeneratePassword(SchemeSHA256Crypt, plain, WithSHACryptRounds(8000))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA256-CRYPT}$5$rounds=8000$"))
+
+	s, p, err = ParseHashParams(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeSHA256Crypt, s)
+	assert.Equal(t, 8000, p.SHACryptRounds)
+
+	s, p, err = ParseHashParams("{CRYPT}$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1")
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeSHA512Crypt, s)
+	assert.Equal(t, 5000, p.SHACryptRounds)
+
+	// Schemes without parameters.
+	s, p, err = ParseHashParams("{SSHA}abc")
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeSSHA, s)
+	assert.Equal(t, Params{}, p)
+
+	_, _, err = ParseHashParams("{UNKNOWN}abc")
+	assert.ErrorIs(t, err, respcode.ErrUnsupportedPasswordScheme)
+}
+
+func TestParamsLimits(t *testing.T) {
+	// 超出校验时允许范围的参数被限制在范围内。
+	p := newParams(WithArgon2(2<<20, 1000, 255), WithParams(Params{Argon2SaltLength: 4, BcryptCost: 50, SHACryptRounds: 1}))
+	assert.Equal(t, uint32(argon2MaxMemory), p.Argon2Memory)
+	assert.Equal(t, uint32(argon2MaxIterations), p.Argon2Iterations)
+	assert.Equal(t, uint8(argon2MaxParallelism), p.Argon2Parallelism)
+	assert.Equal(t, uint32(argon2MinSaltLength), p.Argon2SaltLength)
+	assert.Equal(t, 31, p.BcryptCost)
+	assert.Equal(t, shaCryptRoundsMin, p.SHACryptRounds)
+
+	// 使用上限生成的哈希可以校验（内存使用较小的值以加快测试）。
+	for _, scheme := range []string{SchemeArgon2I, SchemeArgon2ID} {
+		hash, err := GeneratePassword(scheme, "password", WithArgon2(1024, 1000, 255), WithParams(Params{Argon2SaltLength: 4}))
+		assert.Nil(t, err)
+		assert.Contains(t, hash, "$m=1024,t=256,p=64$")
+
+		matched, err := VerifyPassword(hash, "password")
+		assert.Nil(t, err, scheme)
+		assert.True(t, matched, scheme)
+	}
+}
+
+func TestCalibrateArgon2ID(t *testing.T) {
+	_, err := CalibrateArgon2ID(0)
+	assert.NotNil(t, err)
+
+	p, err := CalibrateArgon2ID(20 * time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(1), p.Argon2Parallelism)
+	assert.GreaterOrEqual(t, p.Argon2Memory, uint32(8*1024))
+	assert.GreaterOrEqual(t, p.Argon2Iterations, uint32(1))
+
+	hash, err := GeneratePassword(SchemeArgon2ID, "password", WithParams(p))
+	assert.Nil(t, err)
+
+	matched, err := VerifyPassword(hash, "password")
+	assert.Nil(t, err)
+	assert.True(t, matched)
+}
@@ -23,10 +23,7 @@ func VerifyPlainMD5Password(challengePassword, plainPassword string) bool {
 		challengePassword = challengePassword[11:]
 	}
 
-	challenge, err := GeneratePlainMD5Password(plainPassword)
-	if err != nil {
-		return false
-	}
+	digest := md5.Sum([]byte(plainPassword))
 
-	return strings.EqualFold(challenge, challengePassword)
+	return verifyHexDigest(challengePassword, digest[:])
 }
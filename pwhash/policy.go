@@ -0,0 +1,254 @@
+package pwhash
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iredmail/goutils/respcode"
+)
+
+//go:embed data/common_passwords.txt
+var commonPasswordsRaw string
+
+// commonPasswords 是内置的常见（弱）密码列表，均为小写。
+var commonPasswords = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	for line := range strings.Lines(commonPasswordsRaw) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			m[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return m
+}()
+
+// forbiddenSubstringMinLength 是禁止包含的字符串的最小长度，更短的字符串（如
+// 单个字母的用户名）会被忽略，否则几乎所有密码都无法通过检查。
+const forbiddenSubstringMinLength = 3
+
+// Policy 定义密码强度策略。值为 0 或 false 的字段表示不检查。
+type Policy struct {
+	MinLength int // 最小长度（字符数，不是字节数）
+	MaxLength int // 最大长度（字符数，不是字节数）
+
+	RequireLetter      bool // 必须包含字母
+	RequireUpperLetter bool // 必须包含大写字母
+	RequireLowerLetter bool // 必须包含小写字母
+	RequireNumber      bool // 必须包含数字
+	RequireSpecialChar bool // 必须包含特殊字符（非字母、非数字）
+
+	// ForbiddenSubstrings 是密码中不允许包含的字符串（不区分大小写）。
+	// 除此之外，Check 时 PolicyContext 里的用户名和域名也不允许出现在密码里。
+	ForbiddenSubstrings []string
+
+	// MaxRepeatedChars 是允许连续出现的相同字符的最大数量，例如 2 表示 `aa`
+	// 可以通过，`aaa` 不能通过。
+	MaxRepeatedChars int
+
+	// RejectCommonPasswords 拒绝内置的常见密码列表中的密码（不区分大小写）。
+	RejectCommonPasswords bool
+
+	// MinEntropy 是 EstimateEntropy 估算的最小熵（单位：bit）。
+	MinEntropy float64
+}
+
+// DefaultPolicy 是推荐的默认密码策略。
+var DefaultPolicy = Policy{
+	MinLength:             8,
+	MaxLength:             256,
+	RequireLetter:         true,
+	RequireNumber:         true,
+	MaxRepeatedChars:      3,
+	RejectCommonPasswords: true,
+	MinEntropy:            40,
+}
+
+// PolicyContext 是检查密码时的上下文信息，用于拒绝包含账号信息的密码。
+type PolicyContext struct {
+	// Username 可以是完整邮件地址，此时地址的用户名部分和域名部分都不允许出现在密码里。
+	Username string
+	Domain   string
+}
+
+// Check 根据策略检查密码，返回所有不满足的规则对应的 respcode 代码，例如
+// respcode.PasswordTooShort。全部满足时返回 nil。
+func (p Policy) Check(password string, ctx PolicyContext) (violations []string) {
+	length := utf8.RuneCountInString(password)
+
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, respcode.PasswordTooShort)
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, respcode.PasswordTooLong)
+	}
+
+	var hasLetter, hasUpper, hasLower, hasNumber, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasLetter, hasUpper = true, true
+		case unicode.IsLower(r):
+			hasLetter, hasLower = true, true
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasNumber = true
+		default:
+			hasSpecial = true
+		}
+	}
+
+	if p.RequireLetter && !hasLetter {
+		violations = append(violations, respcode.PasswordNoLetter)
+	}
+
+	if p.RequireUpperLetter && !hasUpper {
+		violations = append(violations, respcode.PasswordNoUpperLetter)
+	}
+
+	if p.RequireLowerLetter && !hasLower {
+		violations = append(violations, respcode.PasswordNoLowerLetter)
+	}
+
+	if p.RequireNumber && !hasNumber {
+		violations = append(violations, respcode.PasswordNoNumber)
+	}
+
+	if p.RequireSpecialChar && !hasSpecial {
+		violations = append(violations, respcode.PasswordNoSpecialChar)
+	}
+
+	if p.containsForbiddenSubstring(password, ctx) {
+		violations = append(violations, respcode.PasswordForbiddenString)
+	}
+
+	if p.MaxRepeatedChars > 0 && maxRepeatedChars(password) > p.MaxRepeatedChars {
+		violations = append(violations, respcode.PasswordRepeatedChars)
+	}
+
+	if p.RejectCommonPasswords && IsCommonPassword(password) {
+		violations = append(violations, respcode.PasswordTooCommon)
+	}
+
+	if p.MinEntropy > 0 && EstimateEntropy(password) < p.MinEntropy {
+		violations = append(violations, respcode.PasswordTooWeak)
+	}
+
+	return
+}
+
+func (p Policy) containsForbiddenSubstring(password string, ctx PolicyContext) bool {
+	forbidden := append([]string{}, p.ForbiddenSubstrings...)
+
+	username, domain, _ := strings.Cut(ctx.Username, "@")
+	forbidden = append(forbidden, username, domain, ctx.Domain)
+
+	// 同时检查域名的第一部分，例如 `example.com` 中的 `example`。
+	for _, d := range []string{domain, ctx.Domain} {
+		if label, _, found := strings.Cut(d, "."); found {
+			forbidden = append(forbidden, label)
+		}
+	}
+
+	lower := strings.ToLower(password)
+	for _, s := range forbidden {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if utf8.RuneCountInString(s) < forbiddenSubstringMinLength {
+			continue
+		}
+
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxRepeatedChars 返回连续出现的相同字符的最大数量。
+func maxRepeatedChars(s string) (n int) {
+	var prev rune
+	count := 0
+
+	for i, r := range []rune(s) {
+		if i > 0 && r == prev {
+			count++
+		} else {
+			count = 1
+		}
+
+		n = max(n, count)
+		prev = r
+	}
+
+	return
+}
+
+// IsCommonPassword 检查密码是否在内置的常见密码列表中（不区分大小写）。
+func IsCommonPassword(password string) bool {
+	_, found := commonPasswords[strings.ToLower(password)]
+
+	return found
+}
+
+// EstimateEntropy 根据密码包含的字符类别估算密码的熵（单位：bit），即
+// `长度 * log2(字符集大小)`。连续重复的字符只计算一次。
+//
+// 这只是粗略的估算，不考虑字典单词和键盘序列等模式，应结合常见密码列表使用。
+func EstimateEntropy(password string) float64 {
+	var pool int
+	var hasLower, hasUpper, hasNumber, hasSpecial, hasOther bool
+
+	length := 0
+	var prev rune
+	for i, r := range []rune(password) {
+		if i == 0 || r != prev {
+			length++
+		}
+		prev = r
+
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= '0' && r <= '9':
+			hasNumber = true
+		case r < utf8.RuneSelf:
+			hasSpecial = true
+		default:
+			hasOther = true
+		}
+	}
+
+	if hasLower {
+		pool += 26
+	}
+
+	if hasUpper {
+		pool += 26
+	}
+
+	if hasNumber {
+		pool += 10
+	}
+
+	if hasSpecial {
+		pool += 33
+	}
+
+	if hasOther {
+		pool += 100
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(length) * math.Log2(float64(pool))
+}
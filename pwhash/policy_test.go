@@ -0,0 +1,51 @@
+package pwhash
+
+import (
+	"testing"
+
+	"github.com/iredmail/goutils/respcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	ctx := PolicyContext{Username: "postmaster@example.com"}
+
+	// key is password, value is expected violations.
+	data := map[string][]string{
+		"Xk9#mQ2vLp7!":  nil,
+		"abc":           {respcode.PasswordTooShort, respcode.PasswordNoNumber, respcode.PasswordTooWeak},
+		"password":      {respcode.PasswordNoNumber, respcode.PasswordTooCommon, respcode.PasswordTooWeak},
+		"1234567890":    {respcode.PasswordNoLetter, respcode.PasswordTooCommon, respcode.PasswordTooWeak},
+		"Example2026xy": {respcode.PasswordForbiddenString},
+		"myPostmaster9": {respcode.PasswordForbiddenString},
+		"aaaab1Xyzqwvt": {respcode.PasswordRepeatedChars},
+	}
+
+	for password, violations := range data {
+		assert.Equal(t, violations, DefaultPolicy.Check(password, ctx), password)
+	}
+
+	p := Policy{
+		MaxLength:           10,
+		RequireUpperLetter:  true,
+		RequireLowerLetter:  true,
+		RequireSpecialChar:  true,
+		ForbiddenSubstrings: []string{"iredmail"},
+	}
+
+	assert.Nil(t, p.Check("Ab#", PolicyContext{}))
+	assert.Equal(t,
+		[]string{respcode.PasswordTooLong, respcode.PasswordNoUpperLetter, respcode.PasswordNoSpecialChar, respcode.PasswordForbiddenString},
+		p.Check("myiredmail01", PolicyContext{}),
+	)
+
+	// Short username is ignored.
+	assert.Nil(t, p.Check("Ab#x", PolicyContext{Username: "b"}))
+
+	assert.True(t, IsCommonPassword("QWERTY"))
+	assert.False(t, IsCommonPassword("Xk9#mQ2vLp7!"))
+
+	assert.Equal(t, float64(0), EstimateEntropy(""))
+	assert.Less(t, EstimateEntropy("aaaaaaaa"), EstimateEntropy("abcdefgh"))
+	assert.Less(t, EstimateEntropy("abcdefgh"), EstimateEntropy("abcDEF1#"))
+}
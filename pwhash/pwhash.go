@@ -1,7 +1,6 @@
 package pwhash
 
 import (
-	"slices"
 	"strings"
 
 	"github.com/iredmail/goutils/respcode"
@@ -14,12 +13,17 @@ const (
 	SchemePlainMD5    = "PLAIN-MD5"
 	SchemeSHA         = "SHA"
 	SchemeSSHA        = "SSHA"
+	SchemeSHA256      = "SHA256"
+	SchemeSSHA256     = "SSHA256"
 	SchemeSHA512      = "SHA512"
 	SchemeSSHA512     = "SSHA512"
+	SchemeSHA256Crypt = "SHA256-CRYPT"
 	SchemeSHA512Crypt = "SHA512-CRYPT"
+	SchemeMD5Crypt    = "MD5-CRYPT"
+	SchemeArgon2I     = "ARGON2I"
 	SchemeArgon2ID    = "ARGON2ID"
-	// SchemeCramMD5     = "CRAM-MD5"
-	// SchemeNTLM        = "NTLM"
+	SchemeCramMD5     = "CRAM-MD5"
+	SchemeNTLM        = "NTLM"
 
 	// SchemeBcrypt Blowfish crypt.
 	// bcrypt is not available in libc `crypt()` on old Linux distributions.
@@ -29,21 +33,9 @@ const (
 )
 
 var (
-	SupportedPasswordSchemes = []string{
-		SchemePlain,
-		SchemeCrypt,
-		SchemeMD5,
-		SchemePlainMD5,
-		SchemeSHA,
-		SchemeSSHA,
-		SchemeSHA512,
-		SchemeSSHA512,
-		SchemeSHA512Crypt,
-		SchemeBcrypt,
-		SchemeArgon2ID,
-		// SchemeCramMD5,
-		// SchemeNTLM,
-	}
+	// SupportedPasswordSchemes 是所有已注册的算法名称（大写），按注册顺序排列。
+	// 内置算法在包初始化时注册，自定义算法通过 Register 追加。
+	SupportedPasswordSchemes []string
 )
 
 // extractSchemeAndHash 从密码哈希中提取哈希算法名称及哈希字符串。例如：`{ssha}xxx` -> `SSHA`, `xxx`。
@@ -65,53 +57,43 @@ func extractSchemeAndHash(s string) (scheme, hash string) {
 }
 
 // GeneratePassword 加密密码。注意：带有哈希算法前缀，如 `{SSHA512}`。
-func GeneratePassword(scheme string, plainPassword string) (hash string, err error) {
+//
+// 对于基于摘要的算法（如 SHA、SSHA256、CRAM-MD5、NTLM 等），scheme 可以带有
+// Dovecot 兼容的编码后缀，如 `SHA256.HEX`、`SSHA512.b64`。
+//
+// 可选参数 options 用于设置 ARGON2I / ARGON2ID、BLF-CRYPT、SHA256-CRYPT /
+// SHA512-CRYPT 等算法的参数，未设置的参数使用 DefaultParams。
+func GeneratePassword(scheme string, plainPassword string, options ...Option) (hash string, err error) {
 	if len(plainPassword) == 0 {
 		err = respcode.ErrEmptyPassword
 
 		return
 	}
 
-	scheme = strings.ToUpper(scheme)
-
-	if !slices.Contains(SupportedPasswordSchemes, scheme) {
+	s, found := LookupScheme(scheme)
+	if !found {
 		err = respcode.ErrUnsupportedPasswordScheme
 
 		return
 	}
 
-	switch scheme {
-	case SchemePlain:
-		hash = "{PLAIN}" + plainPassword
-	// case SchemeCrypt:
-	// TODO
-	case SchemeMD5:
-		hash = GenerateMD5Password(plainPassword)
-	case SchemePlainMD5:
-		hash, err = GeneratePlainMD5Password(plainPassword)
-	// case SchemeSHA:
-	// TODO
-	case SchemeSSHA:
-		hash, err = GenerateSSHAPassword(plainPassword)
-	case SchemeSHA512:
-		hash, err = GenerateSHA512Password(plainPassword)
-	case SchemeSSHA512:
-		hash, err = GenerateSSHA512Password(plainPassword)
-	// case SchemeSHA512Crypt:
-	// TODO
-	case SchemeBcrypt:
-		hash, err = GenerateBcryptPassword(plainPassword)
-	case SchemeArgon2ID:
-		hash, err = GenArgon2IDPassword(plainPassword, true)
-	// case SchemeCramMD5:
-	// TODO
-	// case SchemeNTLM:
-	// TODO
-	default:
+	_, encoding := splitSchemeEncoding(scheme)
+	if encoding == "" {
+		if ps, ok := s.(ParamsScheme); ok {
+			return ps.GenerateWithParams(plainPassword, newParams(options...))
+		}
+
+		return s.Generate(plainPassword)
+	}
+
+	es, ok := s.(EncodableScheme)
+	if !ok || (encoding != EncodingHex && encoding != EncodingBase64) {
 		err = respcode.ErrUnsupportedPasswordScheme
+
+		return
 	}
 
-	return
+	return es.GenerateWithEncoding(plainPassword, encoding)
 }
 
 func VerifyPassword(hashedPassword, plainPassword string) (matched bool, err error) {
@@ -123,42 +105,12 @@ func VerifyPassword(hashedPassword, plainPassword string) (matched bool, err err
 
 	scheme, _ := extractSchemeAndHash(hashedPassword)
 
-	if !slices.Contains(SupportedPasswordSchemes, scheme) {
+	s, found := LookupScheme(scheme)
+	if !found {
 		err = respcode.ErrUnsupportedPasswordScheme
 
 		return
 	}
 
-	switch scheme {
-	case SchemePlain:
-		if hashedPassword == "{PLAIN}"+plainPassword || hashedPassword == "{plain}"+plainPassword {
-			matched = true
-		}
-	case SchemeCrypt:
-		// TODO
-	case SchemeMD5:
-		matched = VerifyMD5Password(hashedPassword, plainPassword)
-	case SchemePlainMD5:
-		matched = VerifyPlainMD5Password(hashedPassword, plainPassword)
-	case SchemeSHA:
-		// TODO
-	case SchemeSSHA:
-		matched = VerifySSHAPassword(hashedPassword, plainPassword)
-	case SchemeSHA512:
-		matched = VerifySHA512Password(hashedPassword, plainPassword)
-	case SchemeSSHA512:
-		matched = VerifySSHA512Password(hashedPassword, plainPassword)
-	case SchemeSHA512Crypt:
-		// TODO
-	case SchemeBcrypt:
-		matched = VerifyBcryptPassword(hashedPassword, plainPassword)
-	case SchemeArgon2ID:
-		matched, err = VerifyArgon2IDPassword(plainPassword, hashedPassword)
-		// case SchemeCramMD5:
-		// TODO
-		// case SchemeNTLM:
-		// TODO
-	}
-
-	return
+	return s.Verify(hashedPassword, plainPassword)
 }
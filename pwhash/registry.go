@@ -0,0 +1,315 @@
+package pwhash
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Scheme 定义一种密码哈希算法。
+//
+// 除内置的算法外，应用程序可以通过 Register 注册自定义的算法（例如某些厂商
+// 特有的加盐哈希），注册后即可通过 GeneratePassword / VerifyPassword 使用。
+type Scheme interface {
+	// Name 返回算法名称，即哈希前缀 `{SCHEME}` 中的名称，例如 `SSHA512`。
+	// 名称不区分大小写，且不能包含 `.`（用作编码后缀的分隔符）。
+	Name() string
+
+	// Generate 生成带有 `{SCHEME}` 前缀的密码哈希。
+	Generate(plain string) (hash string, err error)
+
+	// Verify 校验密码。hashed 是带有 `{SCHEME}` 前缀的完整哈希。
+	Verify(hashed, plain string) (matched bool, err error)
+
+	// Identify 检查不带 `{SCHEME}` 前缀的哈希字符串是否符合本算法的格式。
+	Identify(hash string) bool
+}
+
+// EncodableScheme 是支持 Dovecot 编码后缀（`.HEX`、`.b64`）的算法。
+type EncodableScheme interface {
+	Scheme
+
+	// GenerateWithEncoding 使用指定的编码（EncodingHex 或 EncodingBase64）生成哈希，
+	// 哈希前缀带有编码后缀，例如 `{SHA256.HEX}`。
+	GenerateWithEncoding(plain, encoding string) (hash string, err error)
+}
+
+// ParamsScheme 是支持自定义参数（如 cost、迭代次数）的算法。
+type ParamsScheme interface {
+	Scheme
+
+	// GenerateWithParams 使用指定的参数生成哈希。
+	GenerateWithParams(plain string, p Params) (hash string, err error)
+}
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = make(map[string]Scheme)
+)
+
+// Register 注册密码哈希算法，并将其名称追加到 SupportedPasswordSchemes。
+// 与 `database/sql.Register` 一样，应在程序初始化阶段调用；如果 s 为 nil、
+// 名称无效或已注册过，则 panic。
+func Register(s Scheme) {
+	if s == nil {
+		panic("pwhash: Register scheme is nil")
+	}
+
+	name := strings.ToUpper(s.Name())
+	if name == "" || strings.ContainsAny(name, ".{}") {
+		panic(fmt.Sprintf("pwhash: invalid scheme name %q", s.Name()))
+	}
+
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+
+	if _, found := schemes[name]; found {
+		panic("pwhash: Register called twice for scheme " + name)
+	}
+
+	schemes[name] = s
+	SupportedPasswordSchemes = append(SupportedPasswordSchemes, name)
+}
+
+// LookupScheme 返回指定名称（不区分大小写，可带编码后缀）的已注册算法。
+func LookupScheme(name string) (s Scheme, found bool) {
+	name, _ = splitSchemeEncoding(name)
+
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	s, found = schemes[name]
+
+	return
+}
+
+// funcScheme 用函数实现 Scheme 接口，用于注册内置算法。
+type funcScheme struct {
+	name     string
+	generate func(plain string) (string, error)
+	verify   func(hashed, plain string) (bool, error)
+	identify func(hash string) bool
+}
+
+func (s *funcScheme) Name() string                              { return s.name }
+func (s *funcScheme) Generate(plain string) (string, error)     { return s.generate(plain) }
+func (s *funcScheme) Verify(hashed, plain string) (bool, error) { return s.verify(hashed, plain) }
+func (s *funcScheme) Identify(hash string) bool                 { return s.identify(hash) }
+
+// funcEncodableScheme 是支持编码后缀的 funcScheme。
+type funcEncodableScheme struct {
+	funcScheme
+
+	generateWithEncoding func(plain string, encoding ...string) (string, error)
+}
+
+func (s *funcEncodableScheme) GenerateWithEncoding(plain, encoding string) (string, error) {
+	return s.generateWithEncoding(plain, encoding)
+}
+
+// funcParamsScheme 是支持自定义参数的 funcScheme。
+type funcParamsScheme struct {
+	funcScheme
+
+	generateWithParams func(plain string, p Params) (string, error)
+}
+
+func (s *funcParamsScheme) GenerateWithParams(plain string, p Params) (string, error) {
+	return s.generateWithParams(plain, p)
+}
+
+// newParamsScheme 返回支持自定义参数的内置算法，Generate 使用 DefaultParams。
+func newParamsScheme(name string, gen func(plain string, p Params) (string, error), verify func(hashed, plain string) (bool, error), identify func(hash string) bool) Scheme {
+	return &funcParamsScheme{
+		funcScheme: funcScheme{
+			name:     name,
+			generate: func(plain string) (string, error) { return gen(plain, DefaultParams) },
+			verify:   verify,
+			identify: identify,
+		},
+		generateWithParams: gen,
+	}
+}
+
+// genArgon2Func 返回使用指定 argon2 变体生成带前缀哈希的函数。
+func genArgon2Func(scheme, variant string) func(plain string, p Params) (string, error) {
+	return func(plain string, p Params) (string, error) {
+		hash, err := genArgon2Password(variant, plain, p)
+		if err != nil {
+			return "", err
+		}
+
+		return "{" + scheme + "}" + hash, nil
+	}
+}
+
+// verifyFunc 将 `func(hashed, plain string) bool` 形式的校验函数转换为 Scheme.Verify 的形式。
+func verifyFunc(f func(hashed, plain string) bool) func(hashed, plain string) (bool, error) {
+	return func(hashed, plain string) (bool, error) {
+		return f(hashed, plain), nil
+	}
+}
+
+// newDigestScheme 返回基于摘要、支持编码后缀的内置算法。
+func newDigestScheme(name string, gen func(plain string, encoding ...string) (string, error), verify func(hashed, plain string) bool, identify func(hash string) bool) Scheme {
+	return &funcEncodableScheme{
+		funcScheme: funcScheme{
+			name:     name,
+			generate: func(plain string) (string, error) { return gen(plain) },
+			verify:   verifyFunc(verify),
+			identify: identify,
+		},
+		generateWithEncoding: gen,
+	}
+}
+
+// identifyDigestMaxSaltLength 是识别加盐摘要时允许的最大 salt 长度，用于区分
+// 不同长度的摘要，例如 40 字节的哈希是 SSHA256（8 字节 salt）而不是 SSHA（20 字节 salt）。
+const identifyDigestMaxSaltLength = 16
+
+// identifyDigest 返回一个函数，检查哈希是否为指定长度的摘要（salted 表示摘要后带有 salt）。
+//
+// 全部由十六进制字符组成的字符串按十六进制解码，因为它几乎不可能是 base64 编码的摘要。
+func identifyDigest(size int, salted bool, defaultEncoding string) func(hash string) bool {
+	return func(hash string) bool {
+		raw, err := hex.DecodeString(hash)
+		if err != nil && defaultEncoding == EncodingBase64 {
+			raw, err = base64.StdEncoding.DecodeString(hash)
+		}
+
+		if err != nil {
+			return false
+		}
+
+		if salted {
+			return len(raw) > size && len(raw)-size <= identifyDigestMaxSaltLength
+		}
+
+		return len(raw) == size
+	}
+}
+
+func identifyPrefix(prefixes ...string) func(hash string) bool {
+	return func(hash string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(hash, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func verifyPlainPassword(hashed, plain string) bool {
+	scheme, hash := extractSchemeAndHash(hashed)
+	_, encoding := splitSchemeEncoding(scheme)
+
+	if encoding == "" {
+		return secureCompare(hash, plain)
+	}
+
+	decoded, err := decodeDigest(hash, encoding)
+
+	return err == nil && secureCompare(string(decoded), plain)
+}
+
+func genPlainPassword(plain string, encoding ...string) (string, error) {
+	if len(encoding) == 0 || encoding[0] == "" {
+		return "{" + SchemePlain + "}" + plain, nil
+	}
+
+	return "{" + schemeWithEncoding(SchemePlain, encoding[0]) + "}" + encodeDigest([]byte(plain), encoding[0]), nil
+}
+
+func init() {
+	// 注意：注册顺序即 SupportedPasswordSchemes 的顺序，也是 Identify 识别不带前缀的
+	// 哈希时的优先顺序，因此格式更具体的算法在前。
+	Register(newParamsScheme(SchemeArgon2ID,
+		genArgon2Func(SchemeArgon2ID, argon2VariantID),
+		func(hashed, plain string) (bool, error) { return VerifyArgon2IDPassword(plain, hashed) },
+		identifyPrefix("$argon2id$"),
+	))
+
+	Register(newParamsScheme(SchemeArgon2I,
+		genArgon2Func(SchemeArgon2I, argon2VariantI),
+		func(hashed, plain string) (bool, error) { return VerifyArgon2IPassword(plain, hashed) },
+		identifyPrefix("$argon2i$"),
+	))
+
+	Register(newParamsScheme(SchemeBcrypt,
+		func(plain string, p Params) (string, error) { return GenerateBcryptPassword(plain, p.BcryptCost) },
+		verifyFunc(VerifyBcryptPassword),
+		identifyPrefix("$2a$", "$2b$", "$2x$", "$2y$"),
+	))
+
+	Register(newParamsScheme(SchemeSHA512Crypt,
+		func(plain string, p Params) (string, error) {
+			return GenerateSHA512CryptPassword(plain, p.SHACryptRounds)
+		},
+		verifyFunc(VerifySHA512CryptPassword),
+		identifyPrefix(sha512CryptMagic),
+	))
+
+	Register(newParamsScheme(SchemeSHA256Crypt,
+		func(plain string, p Params) (string, error) {
+			return GenerateSHA256CryptPassword(plain, p.SHACryptRounds)
+		},
+		verifyFunc(VerifySHA256CryptPassword),
+		identifyPrefix(sha256CryptMagic),
+	))
+
+	Register(&funcScheme{
+		name:     SchemeMD5Crypt,
+		generate: GenerateMD5CryptPassword,
+		verify:   verifyFunc(VerifyMD5CryptPassword),
+		identify: identifyPrefix(md5CryptMagic),
+	})
+
+	Register(newParamsScheme(SchemeCrypt,
+		func(plain string, p Params) (string, error) { return GenerateCryptPassword(plain, p.SHACryptRounds) },
+		verifyFunc(VerifyCryptPassword),
+		identifyPrefix(md5CryptMagic, sha256CryptMagic, sha512CryptMagic, "$2a$", "$2b$", "$2x$", "$2y$"),
+	))
+
+	Register(newDigestScheme(SchemeSHA512, GenerateSHA512Password, VerifySHA512Password,
+		identifyDigest(sha512.Size, false, EncodingBase64)))
+	Register(newDigestScheme(SchemeSHA256, GenerateSHA256Password, VerifySHA256Password,
+		identifyDigest(sha256.Size, false, EncodingBase64)))
+	Register(newDigestScheme(SchemeSHA, GenerateSHAPassword, VerifySHAPassword,
+		identifyDigest(sha1.Size, false, EncodingBase64)))
+	Register(newDigestScheme(SchemeSSHA512, GenerateSSHA512Password, VerifySSHA512Password,
+		identifyDigest(sha512.Size, true, EncodingBase64)))
+	Register(newDigestScheme(SchemeSSHA256, GenerateSSHA256Password, VerifySSHA256Password,
+		identifyDigest(sha256.Size, true, EncodingBase64)))
+	Register(newDigestScheme(SchemeSSHA, GenerateSSHAPassword, VerifySSHAPassword,
+		identifyDigest(sha1.Size, true, EncodingBase64)))
+
+	Register(&funcScheme{
+		name:     SchemePlainMD5,
+		generate: GeneratePlainMD5Password,
+		verify:   verifyFunc(VerifyPlainMD5Password),
+		identify: identifyDigest(md5.Size, false, EncodingHex),
+	})
+
+	Register(&funcScheme{
+		name:     SchemeMD5,
+		generate: func(plain string) (string, error) { return GenerateMD5Password(plain), nil },
+		verify:   verifyFunc(VerifyMD5Password),
+		identify: identifyDigest(md5.Size, false, EncodingHex),
+	})
+
+	Register(newDigestScheme(SchemeNTLM, GenerateNTLMPassword, VerifyNTLMPassword,
+		identifyDigest(md5.Size, false, EncodingHex)))
+	Register(newDigestScheme(SchemeCramMD5, GenerateCramMD5Password, VerifyCramMD5Password,
+		identifyDigest(32, false, EncodingHex)))
+
+	Register(newDigestScheme(SchemePlain, genPlainPassword, verifyPlainPassword,
+		func(string) bool { return false }))
+}
@@ -0,0 +1,86 @@
+package pwhash
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils/respcode"
+	"github.com/stretchr/testify/assert"
+)
+
+// vendorScheme is a site-specific scheme: hex encoded SHA1 of a fixed salt
+// and the password.
+type vendorScheme struct{}
+
+func (vendorScheme) Name() string { return "vendor-sha1" }
+
+func (vendorScheme) Generate(plain string) (string, error) {
+	sum := sha1.Sum([]byte("vendor" + plain))
+
+	return "{VENDOR-SHA1}" + hex.EncodeToString(sum[:]), nil
+}
+
+func (s vendorScheme) Verify(hashed, plain string) (bool, error) {
+	hash, _ := s.Generate(plain)
+
+	return strings.EqualFold(hash, hashed), nil
+}
+
+func (vendorScheme) Identify(hash string) bool { return false }
+
+// restoreSchemes 在测试结束时恢复已注册的算法，避免影响其它测试。
+func restoreSchemes(t *testing.T) {
+	schemesMu.RLock()
+	saved := maps.Clone(schemes)
+	supported := slices.Clone(SupportedPasswordSchemes)
+	schemesMu.RUnlock()
+
+	t.Cleanup(func() {
+		schemesMu.Lock()
+		defer schemesMu.Unlock()
+
+		schemes = saved
+		SupportedPasswordSchemes = supported
+	})
+}
+
+func TestRegister(t *testing.T) {
+	restoreSchemes(t)
+
+	_, err := GeneratePassword("VENDOR-SHA1", "password")
+	assert.ErrorIs(t, err, respcode.ErrUnsupportedPasswordScheme)
+
+	Register(vendorScheme{})
+	assert.True(t, slices.Contains(SupportedPasswordSchemes, "VENDOR-SHA1"))
+
+	hash, err := GeneratePassword("vendor-sha1", "password")
+	assert.Nil(t, err)
+
+	matched, err := VerifyPassword(hash, "password")
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	matched, err = VerifyPassword(strings.ToLower(hash), "password")
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	// Encoding suffix is not supported by this scheme.
+	_, err = GeneratePassword("VENDOR-SHA1.HEX", "password")
+	assert.ErrorIs(t, err, respcode.ErrUnsupportedPasswordScheme)
+
+	assert.Panics(t, func() { Register(vendorScheme{}) })
+	assert.Panics(t, func() { Register(nil) })
+
+	// All builtin schemes are registered.
+	for _, name := range []string{SchemePlain, SchemeCrypt, SchemeMD5, SchemePlainMD5, SchemeSHA, SchemeSSHA,
+		SchemeSHA256, SchemeSSHA256, SchemeSHA512, SchemeSSHA512, SchemeSHA256Crypt, SchemeSHA512Crypt,
+		SchemeMD5Crypt, SchemeBcrypt, SchemeArgon2ID, SchemeCramMD5, SchemeNTLM} {
+		s, found := LookupScheme(name)
+		assert.True(t, found, name)
+		assert.Equal(t, name, s.Name())
+	}
+}
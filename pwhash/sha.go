@@ -0,0 +1,15 @@
+package pwhash
+
+import (
+	"crypto/sha1"
+)
+
+// GenerateSHAPassword 生成 `{SHA}` 格式的哈希（SHA1，默认 base64 编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateSHAPassword(password string, encoding ...string) (challenge string, err error) {
+	return genDigestPassword(sha1.New, SchemeSHA, EncodingBase64, []byte(password), 0, encoding...)
+}
+
+func VerifySHAPassword(challengePassword, plainPassword string) bool {
+	return verifyDigestPassword(sha1.New, false, EncodingBase64, challengePassword, []byte(plainPassword))
+}
@@ -0,0 +1,15 @@
+package pwhash
+
+import (
+	"crypto/sha256"
+)
+
+// GenerateSHA256Password 生成 `{SHA256}` 格式的哈希（默认 base64 编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateSHA256Password(password string, encoding ...string) (challenge string, err error) {
+	return genDigestPassword(sha256.New, SchemeSHA256, EncodingBase64, []byte(password), 0, encoding...)
+}
+
+func VerifySHA256Password(challengePassword, plainPassword string) bool {
+	return verifyDigestPassword(sha256.New, false, EncodingBase64, challengePassword, []byte(plainPassword))
+}
@@ -0,0 +1,284 @@
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SHA256-CRYPT and SHA512-CRYPT schemes, compatible with glibc `crypt(3)`
+// (`$5$` and `$6$`) and Dovecot.
+//
+// FYI
+//
+//	- https://www.akkadia.org/drepper/SHA-crypt.txt
+//	- https://doc.dovecot.org/configuration_manual/authentication/password_schemes/
+
+const (
+	shaCryptSaltMaxLength = 16
+	shaCryptRoundsDefault = 5000
+	shaCryptRoundsMin     = 1000
+	shaCryptRoundsMax     = 999999999
+	shaCryptRoundsPrefix  = "rounds="
+
+	sha256CryptMagic = "$5$"
+	sha512CryptMagic = "$6$"
+)
+
+// cryptAlphabet 是 crypt(3) 使用的 base64 字母表，与标准 base64 不同。
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	// 最终摘要编码时的字节顺序。每组 3 个字节编码为 4 个字符，最后不足 3 个字节的组单独处理。
+	sha256CryptPermutation = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+
+	sha512CryptPermutation = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// cryptB64From24Bit 将 3 个字节编码为 n 个 crypt(3) base64 字符（低位优先）。
+func cryptB64From24Bit(b2, b1, b0 byte, n int) []byte {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+
+	out := make([]byte, 0, n)
+	for range n {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+
+	return out
+}
+
+// genCryptSalt 生成指定长度的随机 salt，只包含 crypt(3) base64 字母表中的字符。
+func genCryptSalt(length int) (salt string, err error) {
+	b := make([]byte, length)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	for i := range b {
+		b[i] = cryptAlphabet[int(b[i])%len(cryptAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+// repeatBytes 重复 b 直到长度为 length。
+func repeatBytes(b []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		out = append(out, b[:min(len(b), length-len(out))]...)
+	}
+
+	return out
+}
+
+// parseSHACryptSetting 解析 `$5$` / `$6$` 之后的 `[rounds=N$]salt[$hash]` 部分。
+//
+//   - customRounds 表示哈希里是否明确指定了 `rounds=`，此时生成的哈希里也需要保留它。
+//   - salt 最多保留 16 个字符，多余的部分会被忽略（与 glibc 行为一致）。
+func parseSHACryptSetting(s string) (rounds int, customRounds bool, salt, hash string, ok bool) {
+	rounds = shaCryptRoundsDefault
+
+	if after, found := strings.CutPrefix(s, shaCryptRoundsPrefix); found {
+		v, rest, found := strings.Cut(after, "$")
+		if !found {
+			return
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return
+		}
+
+		rounds = min(max(n, shaCryptRoundsMin), shaCryptRoundsMax)
+		customRounds = true
+		s = rest
+	}
+
+	salt, hash, _ = strings.Cut(s, "$")
+	if len(salt) > shaCryptSaltMaxLength {
+		salt = salt[:shaCryptSaltMaxLength]
+	}
+
+	return rounds, customRounds, salt, hash, true
+}
+
+// shaCrypt 实现 SHA-crypt 算法，返回不带 scheme 前缀的完整哈希，例如 `$6$salt$xxx`。
+func shaCrypt(newHash func() hash.Hash, magic string, permutation [][3]int, password, salt []byte, rounds int, customRounds bool) string {
+	// Digest B.
+	h := newHash()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(password)
+	digestB := h.Sum(nil)
+	size := len(digestB)
+
+	// Digest A.
+	h.Reset()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(repeatBytes(digestB, len(password)))
+
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(digestB)
+		} else {
+			h.Write(password)
+		}
+	}
+
+	digestA := h.Sum(nil)
+
+	// Byte sequence P.
+	h.Reset()
+	for range len(password) {
+		h.Write(password)
+	}
+	seqP := repeatBytes(h.Sum(nil), len(password))
+
+	// Byte sequence S.
+	h.Reset()
+	for range 16 + int(digestA[0]) {
+		h.Write(salt)
+	}
+	seqS := repeatBytes(h.Sum(nil), len(salt))
+
+	digestC := digestA
+	for i := range rounds {
+		h.Reset()
+
+		if i&1 != 0 {
+			h.Write(seqP)
+		} else {
+			h.Write(digestC)
+		}
+
+		if i%3 != 0 {
+			h.Write(seqS)
+		}
+
+		if i%7 != 0 {
+			h.Write(seqP)
+		}
+
+		if i&1 != 0 {
+			h.Write(digestC)
+		} else {
+			h.Write(seqP)
+		}
+
+		digestC = h.Sum(nil)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(magic)
+
+	if customRounds {
+		sb.WriteString(shaCryptRoundsPrefix)
+		sb.WriteString(strconv.Itoa(rounds))
+		sb.WriteString("$")
+	}
+
+	sb.Write(salt)
+	sb.WriteString("$")
+
+	for _, p := range permutation {
+		sb.Write(cryptB64From24Bit(digestC[p[0]], digestC[p[1]], digestC[p[2]], 4))
+	}
+
+	if size == sha512.Size {
+		sb.Write(cryptB64From24Bit(0, 0, digestC[63], 2))
+	} else {
+		sb.Write(cryptB64From24Bit(0, digestC[31], digestC[30], 3))
+	}
+
+	return sb.String()
+}
+
+// genSHACryptPassword 生成 SHA-crypt 哈希。rounds 为空时使用默认的 5000 轮，且哈希中不包含 `rounds=`。
+func genSHACryptPassword(newHash func() hash.Hash, magic string, permutation [][3]int, plain string, rounds ...int) (hash string, err error) {
+	salt, err := genCryptSalt(shaCryptSaltMaxLength)
+	if err != nil {
+		return
+	}
+
+	n := shaCryptRoundsDefault
+	customRounds := false
+	if len(rounds) > 0 && rounds[0] > 0 {
+		n = min(max(rounds[0], shaCryptRoundsMin), shaCryptRoundsMax)
+		customRounds = true
+	}
+
+	return shaCrypt(newHash, magic, permutation, []byte(plain), []byte(salt), n, customRounds), nil
+}
+
+// verifySHACryptPassword 校验不带 scheme 前缀的 SHA-crypt 哈希。
+func verifySHACryptPassword(newHash func() hash.Hash, magic string, permutation [][3]int, hash, plain string) bool {
+	setting, found := strings.CutPrefix(hash, magic)
+	if !found {
+		return false
+	}
+
+	rounds, customRounds, salt, digest, ok := parseSHACryptSetting(setting)
+	if !ok || digest == "" {
+		return false
+	}
+
+	calculated := shaCrypt(newHash, magic, permutation, []byte(plain), []byte(salt), rounds, customRounds)
+	calculated = calculated[strings.LastIndex(calculated, "$")+1:]
+
+	return subtle.ConstantTimeCompare([]byte(calculated), []byte(digest)) == 1
+}
+
+// GenerateSHA256CryptPassword 生成 `{SHA256-CRYPT}$5$...` 格式的哈希。
+// 可选参数 rounds 指定迭代次数（1000 - 999999999），不指定时使用默认的 5000。
+func GenerateSHA256CryptPassword(plain string, rounds ...int) (hash string, err error) {
+	hash, err = genSHACryptPassword(sha256.New, sha256CryptMagic, sha256CryptPermutation, plain, rounds...)
+	if err != nil {
+		return
+	}
+
+	return "{" + SchemeSHA256Crypt + "}" + hash, nil
+}
+
+func VerifySHA256CryptPassword(challengePassword, plainPassword string) bool {
+	_, hash := extractSchemeAndHash(challengePassword)
+	if hash == "" {
+		hash = challengePassword
+	}
+
+	return verifySHACryptPassword(sha256.New, sha256CryptMagic, sha256CryptPermutation, hash, plainPassword)
+}
+
+// GenerateSHA512CryptPassword 生成 `{SHA512-CRYPT}$6$...` 格式的哈希。
+// 可选参数 rounds 指定迭代次数（1000 - 999999999），不指定时使用默认的 5000。
+func GenerateSHA512CryptPassword(plain string, rounds ...int) (hash string, err error) {
+	hash, err = genSHACryptPassword(sha512.New, sha512CryptMagic, sha512CryptPermutation, plain, rounds...)
+	if err != nil {
+		return
+	}
+
+	return "{" + SchemeSHA512Crypt + "}" + hash, nil
+}
+
+func VerifySHA512CryptPassword(challengePassword, plainPassword string) bool {
+	_, hash := extractSchemeAndHash(challengePassword)
+	if hash == "" {
+		hash = challengePassword
+	}
+
+	return verifySHACryptPassword(sha512.New, sha512CryptMagic, sha512CryptPermutation, hash, plainPassword)
+}
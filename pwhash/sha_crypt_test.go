@@ -0,0 +1,68 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSHACrypt(t *testing.T) {
+	// Test vectors generated with glibc `crypt(3)`.
+	// key is plain password, value is password hash.
+	data := map[string][]string{
+		"Hello world!": {
+			"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+			"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+			"{SHA256-CRYPT}$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+			"{SHA512-CRYPT}$6$rounds=5000$toolongsaltstrin$iGlL7EUUfzNQx59x3ydJZ.zXPMUu1dOynSEl/vcNhLlas77qD0DzRswhhB6LdrXTz250at0syAfUXra.XrxAI1",
+		},
+		"a much longer password than sixteen bytes": {
+			"{sha512-crypt}$6$rounds=1400$anotherlongsalts$scWdK1aV0kYJTECT/ZtozHUlkfGN0xuen7MxJY6dS/dUPlezS7RvmrLOh19LRDvHqbjeioc7umqbQuSP2dZ8d/",
+		},
+	}
+
+	for plain, hashes := range data {
+		for _, hashed := range hashes {
+			_, hash := extractSchemeAndHash(hashed)
+			if hash == "" {
+				hash = hashed
+			}
+
+			if strings.HasPrefix(hash, sha256CryptMagic) {
+				assert.True(t, VerifySHA256CryptPassword(hashed, plain), hashed)
+				assert.False(t, VerifySHA256CryptPassword(hashed, plain+"x"), hashed)
+			} else {
+				assert.True(t, VerifySHA512CryptPassword(hashed, plain), hashed)
+				assert.False(t, VerifySHA512CryptPassword(hashed, plain+"x"), hashed)
+			}
+		}
+	}
+
+	plain := goutils.GenRandomString(12)
+
+	hash, err := GenerateSHA256CryptPassword(plain)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA256-CRYPT}$5$"))
+	assert.True(t, VerifySHA256CryptPassword(hash, plain))
+
+	hash, err = GenerateSHA512CryptPassword(plain)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA512-CRYPT}$6$"))
+	assert.True(t, VerifySHA512CryptPassword(hash, plain))
+
+	// Custom rounds.
+	hash, err = GenerateSHA512CryptPassword(plain, 20000)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA512-CRYPT}$6$rounds=20000$"))
+	assert.True(t, VerifySHA512CryptPassword(hash, plain))
+
+	// Rounds lower than the minimum is raised to 1000.
+	hash, err = GenerateSHA256CryptPassword(plain, 10)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA256-CRYPT}$5$rounds=1000$"))
+	assert.True(t, VerifySHA256CryptPassword(hash, plain))
+}
@@ -0,0 +1,67 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSHA(t *testing.T) {
+	// key is password hash, value is plain password.
+	data := map[string]string{
+		"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=":                                                             "password",
+		"{SHA.b64}W6ph5Mm5Pz8GgiULbPgzG37mj9g=":                                                         "password",
+		"{SHA.HEX}5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8":                                             "password",
+		"{sha}5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8":                                                 "password",
+		"{SHA256}XohImNooBHFR0OVvjcYpJ3NgPQ1qq73WKhHvch0VQtg=":                                          "password",
+		"{SSHA256}DIzeh0gCRMTRu9dAH3C3rr7fWkRT0Bp2ZdtRqvTX3XJzYWx0c2FsdA==":                             "password",
+		"{SSHA256.HEX}0c8cde87480244c4d1bbd7401f70b7aebedf5a4453d01a7665db51aaf4d7dd7273616c7473616c74": "password",
+	}
+
+	for hashed, plain := range data {
+		matched, err := VerifyPassword(hashed, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched, hashed)
+
+		matched, err = VerifyPassword(hashed, plain+"x")
+		assert.Nil(t, err)
+		assert.False(t, matched, hashed)
+	}
+
+	plain := goutils.GenRandomString(12)
+
+	hash, err := GenerateSHAPassword(plain)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA}"))
+	assert.True(t, VerifySHAPassword(hash, plain))
+
+	// `{SHA}` is `{SSHA}` without salt.
+	assert.True(t, VerifySSHAPassword(hash, plain))
+
+	hash, err = GenerateSHA256Password(plain, EncodingHex)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SHA256.HEX}"))
+	assert.True(t, VerifySHA256Password(hash, plain))
+
+	hash, err = GenerateSSHA256Password(plain)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "{SSHA256}"))
+	assert.True(t, VerifySSHA256Password(hash, plain))
+
+	for _, scheme := range []string{"SHA", "SHA.HEX", "SHA.b64", "SHA256", "SSHA256.HEX", "SSHA.b64", "SHA512.HEX", "SSHA512.HEX", "PLAIN.b64"} {
+		hash, err = GeneratePassword(scheme, plain)
+		assert.Nil(t, err)
+
+		matched, err := VerifyPassword(hash, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched, hash)
+	}
+
+	_, err = GeneratePassword("BLF-CRYPT.HEX", plain)
+	assert.NotNil(t, err)
+
+	_, err = GeneratePassword("SHA.BASE32", plain)
+	assert.NotNil(t, err)
+}
@@ -1,60 +1,17 @@
 package pwhash
 
 import (
-	"bytes"
-	"crypto/rand"
 	"crypto/sha1"
-	"encoding/base64"
-	"strings"
 )
 
-func GenerateSSHAPassword(password string) (hashStr string, err error) {
-	passwordBytes := []byte(password)
-	salt := make([]byte, 8)
-	if _, err = rand.Read(salt); err != nil {
-		panic(err)
-	}
-
-	hash := sha1.New()
-	hash.Write(passwordBytes)
-	hash.Write(salt)
-	hashedPassword := hash.Sum(nil)
-
-	hashSSHA := append(hashedPassword, salt...)
-	hashStr = "{SSHA}" + base64.StdEncoding.EncodeToString(hashSSHA)
-
-	return
+// GenerateSSHAPassword 生成 `{SSHA}` 格式的哈希（默认 base64 编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateSSHAPassword(password string, encoding ...string) (hashStr string, err error) {
+	return genDigestPassword(sha1.New, SchemeSSHA, EncodingBase64, []byte(password), 8, encoding...)
 }
 
+// VerifySSHAPassword 校验 `{SSHA}` 哈希。
+// 注意：`{SHA}` 哈希相当于 salt 为空的 `{SSHA}`，因此也可以用此函数校验。
 func VerifySSHAPassword(challengePassword, plainPassword string) bool {
-	index := strings.LastIndex(challengePassword, "}")
-	if index < 0 {
-		return false
-	}
-
-	if strings.Index(challengePassword, "{SSHA}") == 0 ||
-		strings.Index(challengePassword, "{ssha}") == 0 {
-		challengePassword = challengePassword[6:]
-	} else if strings.Index(challengePassword, "{SHA}") == 0 ||
-		strings.Index(challengePassword, "{sha}") == 0 {
-		challengePassword = challengePassword[5:]
-	}
-
-	challengeBytes, err := base64.StdEncoding.DecodeString(challengePassword)
-	if err != nil {
-		return false
-	}
-
-	if len(challengeBytes) < sha1.Size {
-		return false
-	}
-
-	digest := challengeBytes[:sha1.Size]
-	salt := challengeBytes[sha1.Size:]
-	hash := sha1.New()
-	hash.Write([]byte(plainPassword))
-	hash.Write(salt)
-	hashedPassword := hash.Sum(nil)
-
-	return bytes.Equal(digest, hashedPassword)
+	return verifyDigestPassword(sha1.New, true, EncodingBase64, challengePassword, []byte(plainPassword))
 }
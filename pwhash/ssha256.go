@@ -0,0 +1,15 @@
+package pwhash
+
+import (
+	"crypto/sha256"
+)
+
+// GenerateSSHA256Password 生成 `{SSHA256}` 格式的哈希（默认 base64 编码）。
+// 可选参数 encoding 指定编码方式：EncodingHex 或 EncodingBase64。
+func GenerateSSHA256Password(password string, encoding ...string) (challenge string, err error) {
+	return genDigestPassword(sha256.New, SchemeSSHA256, EncodingBase64, []byte(password), 8, encoding...)
+}
+
+func VerifySSHA256Password(challengePassword, plainPassword string) bool {
+	return verifyDigestPassword(sha256.New, true, EncodingBase64, challengePassword, []byte(plainPassword))
+}
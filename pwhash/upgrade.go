@@ -0,0 +1,114 @@
+package pwhash
+
+import (
+	"slices"
+	"strings"
+)
+
+// UpgradePolicy 定义密码哈希的升级策略，用于在用户登录时将弱哈希（如 `{MD5}`、
+// `{SSHA}`）透明地升级为强哈希（如 `{ARGON2ID}`、`{BLF-CRYPT}`）。
+type UpgradePolicy struct {
+	// Scheme 是升级后使用的算法，例如 SchemeArgon2ID、SchemeBcrypt。
+	Scheme string
+
+	// AllowedSchemes 是无需升级的算法（只要参数不低于下面的最小值）。
+	// 为空时只有 Scheme 指定的算法无需升级。
+	AllowedSchemes []string
+
+	// MinBcryptCost 是 bcrypt 的最小 cost，同时也是生成新哈希时使用的 cost。
+	// 为 0 时使用 DefaultParams 里的值。
+	MinBcryptCost int
+
+	// Argon2 的最小参数，同时也是生成新哈希时使用的参数。
+	// 为 0 时使用 DefaultParams 里的值；MinArgon2Parallelism 为 0 时不检查并行度。
+	MinArgon2Memory      uint32 // KiB
+	MinArgon2Iterations  uint32
+	MinArgon2Parallelism uint8
+
+	// MinSHACryptRounds 是 SHA256-CRYPT / SHA512-CRYPT 的最小迭代次数，
+	// 同时也是生成新哈希时使用的迭代次数。为 0 时使用默认的 5000。
+	MinSHACryptRounds int
+}
+
+// params 返回生成新哈希时使用的参数，即策略中的最小值，未设置的使用 DefaultParams。
+func (p UpgradePolicy) params() Params {
+	return newParams(
+		WithParams(Params{
+			Argon2Memory:      p.MinArgon2Memory,
+			Argon2Iterations:  p.MinArgon2Iterations,
+			Argon2Parallelism: p.MinArgon2Parallelism,
+			BcryptCost:        p.MinBcryptCost,
+			SHACryptRounds:    p.MinSHACryptRounds,
+		}),
+	)
+}
+
+// cryptSchemeOf 返回 `{CRYPT}` 哈希实际使用的算法。例如：`$6$...` -> SHA512-CRYPT。
+func cryptSchemeOf(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, md5CryptMagic):
+		return SchemeMD5Crypt
+	case strings.HasPrefix(hash, sha256CryptMagic):
+		return SchemeSHA256Crypt
+	case strings.HasPrefix(hash, sha512CryptMagic):
+		return SchemeSHA512Crypt
+	case strings.HasPrefix(hash, "$2"):
+		return SchemeBcrypt
+	}
+
+	return SchemeCrypt
+}
+
+// NeedsUpgrade 检查密码哈希的算法或参数是否弱于策略要求。
+func (p UpgradePolicy) NeedsUpgrade(hashed string) bool {
+	scheme, params, err := ParseHashParams(hashed)
+	if err != nil {
+		return true
+	}
+
+	allowed := p.AllowedSchemes
+	if len(allowed) == 0 {
+		allowed = []string{p.Scheme}
+	}
+
+	if !slices.ContainsFunc(allowed, func(s string) bool { return strings.EqualFold(s, scheme) }) {
+		return true
+	}
+
+	want := p.params()
+
+	switch scheme {
+	case SchemeBcrypt:
+		return params.BcryptCost < want.BcryptCost
+	case SchemeArgon2I, SchemeArgon2ID:
+		if params.Argon2Memory < want.Argon2Memory || params.Argon2Iterations < want.Argon2Iterations {
+			return true
+		}
+
+		return p.MinArgon2Parallelism > 0 && params.Argon2Parallelism < p.MinArgon2Parallelism
+	case SchemeSHA256Crypt, SchemeSHA512Crypt:
+		return params.SHACryptRounds < want.SHACryptRounds
+	}
+
+	return false
+}
+
+// VerifyAndUpgrade 校验密码，如果密码正确且哈希弱于 policy 的要求，则使用
+// policy.Scheme 生成新哈希并通过 newHash 返回，调用者应保存新哈希。
+//
+// 如果 matched 为 true 但 err 不为 nil，表示密码正确但生成新哈希失败，
+// 调用者可以继续登录流程，仅记录错误即可。
+func VerifyAndUpgrade(hashed, plain string, policy UpgradePolicy) (matched bool, newHash string, err error) {
+	matched, err = VerifyPassword(hashed, plain)
+	if err != nil || !matched {
+		return
+	}
+
+	if !policy.NeedsUpgrade(hashed) {
+		return
+	}
+
+	newHash, err = GeneratePassword(policy.Scheme, plain, WithParams(policy.params()))
+
+	return
+}
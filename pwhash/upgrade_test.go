@@ -0,0 +1,77 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iredmail/goutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyAndUpgrade(t *testing.T) {
+	plain := goutils.GenRandomString(12)
+
+	policy := UpgradePolicy{
+		Scheme:          SchemeBcrypt,
+		AllowedSchemes:  []string{SchemeBcrypt, SchemeArgon2ID},
+		MinBcryptCost:   bcrypt.MinCost + 1,
+		MinArgon2Memory: 16 * 1024,
+	}
+
+	// Weak schemes are upgraded.
+	for _, scheme := range []string{SchemeMD5, SchemeSSHA, SchemeSHA512Crypt} {
+		hash, err := GeneratePassword(scheme, plain)
+		assert.Nil(t, err)
+
+		matched, newHash, err := VerifyAndUpgrade(hash, plain, policy)
+		assert.Nil(t, err)
+		assert.True(t, matched)
+		assert.True(t, strings.HasPrefix(newHash, "{BLF-CRYPT}$2a$05$"), newHash)
+
+		matched, err = VerifyPassword(newHash, plain)
+		assert.Nil(t, err)
+		assert.True(t, matched)
+
+		// New hash satisfies the policy.
+		assert.False(t, policy.NeedsUpgrade(newHash))
+
+		// Wrong password never returns a new hash.
+		matched, newHash, err = VerifyAndUpgrade(hash, plain+"x", policy)
+		assert.Nil(t, err)
+		assert.False(t, matched)
+		assert.Empty(t, newHash)
+	}
+
+	// bcrypt with lower cost.
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.MinCost)
+	assert.True(t, policy.NeedsUpgrade("{BLF-CRYPT}"+string(hashed)))
+	assert.True(t, policy.NeedsUpgrade("{CRYPT}"+string(hashed)))
+
+	// argon2id with lower memory.
+	policy.Scheme = SchemeArgon2ID
+	policy.MinArgon2Memory = 32 * 1024
+	policy.MinArgon2Parallelism = 1
+
+	weak := UpgradePolicy{Scheme: SchemeArgon2ID, MinArgon2Memory: 8 * 1024, MinArgon2Parallelism: 1}
+	_, hash, err := VerifyAndUpgrade("{PLAIN}"+plain, plain, weak)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(hash, "m=8192,"))
+	assert.True(t, policy.NeedsUpgrade(hash))
+
+	matched, newHash, err := VerifyAndUpgrade(hash, plain, policy)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+	assert.True(t, strings.HasPrefix(newHash, "{ARGON2ID}$argon2id$v=19$m=32768,t=3,p=1$"), newHash)
+	assert.False(t, policy.NeedsUpgrade(newHash))
+
+	// SHA512-CRYPT with lower rounds.
+	policy = UpgradePolicy{Scheme: SchemeSHA512Crypt, MinSHACryptRounds: 10000}
+	hash, _ = GenerateSHA512CryptPassword(plain)
+	assert.True(t, policy.NeedsUpgrade(hash))
+
+	_, newHash, err = VerifyAndUpgrade(hash, plain, policy)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(newHash, "{SHA512-CRYPT}$6$rounds=10000$"))
+	assert.False(t, policy.NeedsUpgrade(newHash))
+}
@@ -0,0 +1,89 @@
+package pwhash
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Credential 是 VerifyMany 要校验的一组密码哈希和明文密码。
+type Credential struct {
+	Hash  string // 带有 `{SCHEME}` 前缀的密码哈希
+	Plain string
+}
+
+// VerifyResult 是 VerifyMany 校验一组 Credential 的结果。
+type VerifyResult struct {
+	Matched bool
+	Err     error
+}
+
+// verifyCredential 校验一组 Credential，将 panic（例如自定义算法的 bug）转换为错误，
+// 避免一个异常的哈希导致整个程序退出。
+func verifyCredential(c Credential) (matched bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			matched = false
+			err = fmt.Errorf("pwhash: panic while verifying password: %v", r)
+		}
+	}()
+
+	return VerifyPassword(c.Hash, c.Plain)
+}
+
+// VerifyMany 并发校验多组密码，适用于批量检查已保存的密码哈希（例如检查用户是否
+// 使用了已泄露的密码）。
+//
+// 返回的 results 与 creds 一一对应。可选参数 workers 指定并发数，默认为 CPU 核数。
+// 如果 ctx 被取消，则停止校验并返回 ctx.Err()，未校验的 Credential 对应的
+// VerifyResult.Err 为 ctx.Err()。
+func VerifyMany(ctx context.Context, creds []Credential, workers ...int) (results []VerifyResult, err error) {
+	results = make([]VerifyResult, len(creds))
+
+	n := runtime.NumCPU()
+	if len(workers) > 0 && workers[0] > 0 {
+		n = workers[0]
+	}
+
+	n = min(n, len(creds))
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i].Matched, results[i].Err = verifyCredential(creds[i])
+			}
+		}()
+	}
+
+	next := 0
+
+loop:
+	for ; next < len(creds) && ctx.Err() == nil; next++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case jobs <- next:
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if next < len(creds) {
+		err = ctx.Err()
+
+		for i := next; i < len(creds); i++ {
+			results[i].Err = err
+		}
+	}
+
+	return
+}
@@ -0,0 +1,100 @@
+package pwhash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/respcode"
+)
+
+func TestVerifyMany(t *testing.T) {
+	ssha, err := GenerateSSHAPassword("password")
+	assert.Nil(t, err)
+
+	creds := []Credential{
+		{Hash: ssha, Plain: "password"},
+		{Hash: ssha, Plain: "123456"},
+		{Hash: "{PLAIN}password", Plain: "password"},
+		{Hash: "{MD5}5F4DCC3B5AA765D61D8327DEB882CF99", Plain: "password"},
+		{Hash: "{UNKNOWN}xxx", Plain: "password"},
+	}
+
+	for _, workers := range []int{0, 1, 2, 100} {
+		results, err := VerifyMany(context.Background(), creds, workers)
+		assert.Nil(t, err)
+		assert.Len(t, results, len(creds))
+
+		assert.True(t, results[0].Matched)
+		assert.False(t, results[1].Matched)
+		assert.True(t, results[2].Matched)
+		assert.True(t, results[3].Matched)
+		assert.False(t, results[4].Matched)
+		assert.Equal(t, respcode.ErrUnsupportedPasswordScheme, results[4].Err)
+	}
+
+	results, err := VerifyMany(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+
+	// Canceled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err = VerifyMany(ctx, creds)
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, results, len(creds))
+
+	for _, r := range results {
+		assert.False(t, r.Matched)
+		assert.Equal(t, context.Canceled, r.Err)
+	}
+}
+
+// panicScheme 校验密码时 panic。
+type panicScheme struct{ vendorScheme }
+
+func (panicScheme) Name() string { return "panic" }
+
+func (panicScheme) Verify(hashed, plain string) (bool, error) { panic("broken scheme") }
+
+func TestVerifyManyMalformed(t *testing.T) {
+	restoreSchemes(t)
+	Register(panicScheme{})
+
+	ssha, err := GenerateSSHAPassword("password")
+	assert.Nil(t, err)
+
+	creds := []Credential{
+		{Hash: "{ARGON2I}$argon2i$v=19$m=65536,t=0,p=1$c29tZXNhbHRzb21lc2FsdA$RdescudvJCsgt3ub+b+dWRWJTmaaJObGAAAAAAAAAAA", Plain: "x"},
+		{Hash: "{ARGON2ID}$argon2id$v=19$m=65536,t=3,p=1$c29tZXNhbHRzb21lc2FsdA$", Plain: "x"},
+		{Hash: "{PANIC}xxx", Plain: "x"},
+		{Hash: ssha, Plain: "password"},
+	}
+
+	results, err := VerifyMany(context.Background(), creds, 2)
+	assert.Nil(t, err)
+	assert.Len(t, results, len(creds))
+
+	for _, r := range results[:3] {
+		assert.False(t, r.Matched)
+		assert.NotNil(t, r.Err)
+	}
+
+	assert.ErrorContains(t, results[2].Err, "broken scheme")
+	assert.True(t, results[3].Matched)
+	assert.Nil(t, results[3].Err)
+}
+
+func TestConstantTimeCompare(t *testing.T) {
+	assert.True(t, secureCompare("password", "password"))
+	assert.False(t, secureCompare("password", "passwor"))
+	assert.False(t, secureCompare("", "password"))
+
+	// Upper case hex digest.
+	assert.True(t, VerifyMD5Password("{md5}5F4DCC3B5AA765D61D8327DEB882CF99", "password"))
+	assert.False(t, VerifyMD5Password("{SSHA}5f4dcc3b5aa765d61d8327deb882cf99", "password"))
+	assert.True(t, VerifyPlainMD5Password("{PLAIN-MD5}5F4DCC3B5AA765D61D8327DEB882CF99", "password"))
+	assert.False(t, VerifyPlainMD5Password("5f4dcc3b5aa765d61d8327deb882cf9", "password"))
+}
@@ -21,6 +21,16 @@ const (
 	SignedUp                = "SIGNED_UP"
 	PasswordMismatch        = "PASSWORD_MISMATCH"
 	PasswordTooShort        = "PASSWORD_TOO_SHORT"
+	PasswordTooLong         = "PASSWORD_TOO_LONG"
+	PasswordNoLetter        = "PASSWORD_NO_LETTER"
+	PasswordNoUpperLetter   = "PASSWORD_NO_UPPER_LETTER"
+	PasswordNoLowerLetter   = "PASSWORD_NO_LOWER_LETTER"
+	PasswordNoNumber        = "PASSWORD_NO_NUMBER"
+	PasswordNoSpecialChar   = "PASSWORD_NO_SPECIAL_CHAR"
+	PasswordForbiddenString = "PASSWORD_FORBIDDEN_STRING"
+	PasswordRepeatedChars   = "PASSWORD_REPEATED_CHARS"
+	PasswordTooCommon       = "PASSWORD_TOO_COMMON"
+	PasswordTooWeak         = "PASSWORD_TOO_WEAK"
 	InvalidPlatform         = "INVALID_PLATFORM"
 	InvalidBackend          = "INVALID_BACKEND"
 	InvalidComponent        = "INVALID_COMPONENT"
@@ -60,6 +70,7 @@ var (
 	ErrInvalidMailUser             = errors.New("INVALID_MAIL_USER")
 	ErrInvalidAPIKey               = errors.New("INVALID_API_KEY")
 	ErrInvalidOtpCode              = errors.New("INVALID_OTP_CODE")
+	ErrInvalidOtpSecret            = errors.New("INVALID_OTP_SECRET")
 	ErrInvalidComponent            = errors.New("INVALID_COMPONENT")
 	ErrInvalidUpdate               = errors.New("INVALID_UPDATE")
 	ErrInvalidUpgrade              = errors.New("INVALID_UPGRADE")
@@ -68,11 +79,16 @@ var (
 	ErrNotDeploying                = errors.New("NOT_DEPLOYING")
 	ErrPasswordMismatch            = errors.New(PasswordMismatch)
 	ErrPasswordTooShort            = errors.New(PasswordTooShort)
-	ErrPasswordTooLong             = errors.New("PASSWORD_TOO_LONG")
-	ErrPasswordNoLetter            = errors.New("PASSWORD_NO_LETTER")
-	ErrPasswordNoUpperLetter       = errors.New("PASSWORD_NO_UPPER_LETTER")
-	ErrPasswordNoNumber            = errors.New("PASSWORD_NO_NUMBER")
-	ErrPasswordNoSpecialChar       = errors.New("PASSWORD_NO_SPECIAL_CHAR")
+	ErrPasswordTooLong             = errors.New(PasswordTooLong)
+	ErrPasswordNoLetter            = errors.New(PasswordNoLetter)
+	ErrPasswordNoUpperLetter       = errors.New(PasswordNoUpperLetter)
+	ErrPasswordNoLowerLetter       = errors.New(PasswordNoLowerLetter)
+	ErrPasswordNoNumber            = errors.New(PasswordNoNumber)
+	ErrPasswordNoSpecialChar       = errors.New(PasswordNoSpecialChar)
+	ErrPasswordForbiddenString     = errors.New(PasswordForbiddenString)
+	ErrPasswordRepeatedChars       = errors.New(PasswordRepeatedChars)
+	ErrPasswordTooCommon           = errors.New(PasswordTooCommon)
+	ErrPasswordTooWeak             = errors.New(PasswordTooWeak)
 	ErrPermissionDenied            = errors.New(PermissionDenied)
 	ErrDomainExists                = errors.New("DOMAIN_EXISTS")
 	ErrAccountExists               = errors.New(AccountExists)
@@ -0,0 +1,239 @@
+package smtpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"slices"
+	"strings"
+)
+
+// SMTP 认证方式。
+const (
+	AuthPlain       = "PLAIN"
+	AuthLogin       = "LOGIN"
+	AuthCRAMMD5     = "CRAM-MD5"
+	AuthXOAuth2     = "XOAUTH2"
+	AuthOAuthBearer = "OAUTHBEARER" // RFC 7628
+)
+
+var (
+	// ErrInsecureAuth 表示拒绝在未加密的连接上发送明文密码或 OAuth token，参考 Config.AllowInsecureAuth。
+	ErrInsecureAuth = errors.New("smtpclient: refusing to authenticate over an unencrypted connection")
+
+	// ErrNoAuthMechanism 表示服务器不支持 AUTH，或者没有可用的认证方式。
+	ErrNoAuthMechanism = errors.New("smtpclient: no supported authentication mechanism")
+
+	// ErrUnknownAuthMechanism 表示 Config.AuthMechanism 不是支持的认证方式。
+	ErrUnknownAuthMechanism = errors.New("smtpclient: unknown authentication mechanism")
+)
+
+// TokenSource 提供 XOAUTH2、OAUTHBEARER 认证使用的 OAuth 2.0 access token。
+//
+// 每次建立新连接时都会调用 Token，实现者应自行缓存 token 并在过期前刷新，
+// 例如使用 golang.org/x/oauth2 的 TokenSource。
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticTokenSource 是固定不变的 access token，适用于测试或由调用者自行刷新 Config 的场景。
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// TokenSourceFunc 将普通函数转换为 TokenSource。
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// needAuth 检查是否配置了认证信息。
+func (cfg Config) needAuth() bool {
+	if cfg.TokenSource != nil {
+		return cfg.SMTPUser != ""
+	}
+
+	return cfg.SMTPUser != "" && cfg.SMTPPassword != ""
+}
+
+// authenticate 使用 Config 指定的认证方式进行认证，未指定时根据服务器支持的认证方式自动选择。
+func (cfg Config) authenticate(ctx context.Context, client *smtp.Client) error {
+	mech := strings.ToUpper(strings.TrimSpace(cfg.AuthMechanism))
+	if mech == "" {
+		ok, params := client.Extension("AUTH")
+		if !ok {
+			return fmt.Errorf("%w: server does not support AUTH", ErrNoAuthMechanism)
+		}
+
+		_, isTLS := client.TLSConnectionState()
+
+		mech = cfg.negotiateAuth(strings.Fields(strings.ToUpper(params)), isTLS)
+		if mech == "" {
+			return fmt.Errorf("%w: server supports %s", ErrNoAuthMechanism, params)
+		}
+	}
+
+	auth, err := cfg.newAuth(ctx, mech)
+	if err != nil {
+		return err
+	}
+
+	return client.Auth(auth)
+}
+
+// negotiateAuth 从服务器支持的认证方式中选择一个。
+//
+//   - 配置了 TokenSource 时使用 XOAUTH2 或 OAUTHBEARER。
+//   - 加密连接优先使用 PLAIN、LOGIN；未加密的连接优先使用不发送明文密码的 CRAM-MD5。
+func (cfg Config) negotiateAuth(advertised []string, isTLS bool) string {
+	var preferred []string
+
+	switch {
+	case cfg.TokenSource != nil:
+		preferred = []string{AuthXOAuth2, AuthOAuthBearer}
+	case isTLS:
+		preferred = []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+	default:
+		preferred = []string{AuthCRAMMD5, AuthPlain, AuthLogin}
+	}
+
+	for _, mech := range preferred {
+		if slices.Contains(advertised, mech) {
+			return mech
+		}
+	}
+
+	return ""
+}
+
+func (cfg Config) newAuth(ctx context.Context, mech string) (auth smtp.Auth, err error) {
+	var token string
+	if mech == AuthXOAuth2 || mech == AuthOAuthBearer {
+		if cfg.TokenSource == nil {
+			return nil, fmt.Errorf("smtpclient: %s requires a TokenSource", mech)
+		}
+
+		if token, err = cfg.TokenSource.Token(ctx); err != nil {
+			return nil, fmt.Errorf("smtpclient: failed in getting OAuth token: %w", err)
+		}
+	}
+
+	a := &saslAuth{
+		mech:          mech,
+		username:      cfg.SMTPUser,
+		password:      cfg.SMTPPassword,
+		token:         token,
+		host:          cfg.Host,
+		port:          cfg.Port,
+		allowInsecure: cfg.AllowInsecureAuth,
+	}
+
+	switch mech {
+	case AuthPlain, AuthLogin, AuthXOAuth2, AuthOAuthBearer:
+		auth = a
+	case AuthCRAMMD5:
+		auth = smtp.CRAMMD5Auth(cfg.SMTPUser, cfg.SMTPPassword)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownAuthMechanism, mech)
+	}
+
+	return
+}
+
+// saslAuth 实现 PLAIN、LOGIN、XOAUTH2 和 OAUTHBEARER 认证。
+//
+// 与 smtp.PlainAuth 不同，设置 allowInsecure 后允许在未加密的连接上认证。
+type saslAuth struct {
+	mech          string
+	username      string
+	password      string
+	token         string
+	host          string
+	port          string
+	allowInsecure bool
+
+	step int
+}
+
+func (a *saslAuth) Start(server *smtp.ServerInfo) (proto string, toServer []byte, err error) {
+	if !server.TLS && !a.allowInsecure && !isLocalhost(server.Name) {
+		return "", nil, ErrInsecureAuth
+	}
+
+	switch a.mech {
+	case AuthPlain:
+		// RFC 4616: [authzid] NUL authcid NUL passwd
+		toServer = []byte("\x00" + a.username + "\x00" + a.password)
+	case AuthLogin:
+		// 等待服务器提示输入用户名。
+	case AuthXOAuth2:
+		// https://developers.google.com/gmail/imap/xoauth2-protocol
+		toServer = []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01")
+	case AuthOAuthBearer:
+		// RFC 7628 第 3.1 节。
+		var b strings.Builder
+		b.WriteString("n,a=" + saslName(a.username) + ",\x01")
+		if a.host != "" {
+			b.WriteString("host=" + a.host + "\x01")
+		}
+		if a.port != "" {
+			b.WriteString("port=" + a.port + "\x01")
+		}
+		b.WriteString("auth=Bearer " + a.token + "\x01\x01")
+
+		toServer = []byte(b.String())
+	}
+
+	return a.mech, toServer, nil
+}
+
+func (a *saslAuth) Next(fromServer []byte, more bool) (toServer []byte, err error) {
+	if !more {
+		return nil, nil
+	}
+
+	a.step++
+
+	switch a.mech {
+	case AuthLogin:
+		// 大部分服务器提示 `Username:` 和 `Password:`，无法识别时按顺序发送。
+		prompt := bytes.ToLower(fromServer)
+		switch {
+		case bytes.Contains(prompt, []byte("username")), bytes.Contains(prompt, []byte("user name")):
+			return []byte(a.username), nil
+		case bytes.Contains(prompt, []byte("password")):
+			return []byte(a.password), nil
+		case a.step == 1:
+			return []byte(a.username), nil
+		case a.step == 2:
+			return []byte(a.password), nil
+		}
+	case AuthXOAuth2:
+		// 认证失败时服务器返回 JSON 格式的错误信息，客户端需要发送空响应，服务器随后返回 535。
+		if a.step == 1 {
+			return []byte{}, nil
+		}
+	case AuthOAuthBearer:
+		// RFC 7628 第 3.2.3 节：认证失败时客户端发送 %x01 结束认证。
+		if a.step == 1 {
+			return []byte{0x01}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("smtpclient: unexpected server challenge during %s authentication: %q", a.mech, fromServer)
+}
+
+// saslName 按 RFC 5801 转义 GS2 header 中的用户名。
+func saslName(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+// isLocalhost 与 net/smtp 相同，连接 localhost 时允许在未加密的连接上认证。
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,181 @@
+package smtpclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/smtptest"
+)
+
+func TestSASLAuth(t *testing.T) {
+	server := &smtp.ServerInfo{Name: "smtp.example.com", TLS: true}
+
+	tests := []struct {
+		mech    string
+		initial string
+	}{
+		{AuthPlain, "\x00user@example.com\x00secret"},
+		{AuthXOAuth2, "user=user@example.com\x01auth=Bearer ya29.token\x01\x01"},
+		{AuthOAuthBearer, "n,a=user@example.com,\x01host=smtp.example.com\x01port=587\x01auth=Bearer ya29.token\x01\x01"},
+	}
+
+	for _, tt := range tests {
+		a := &saslAuth{mech: tt.mech, username: "user@example.com", password: "secret", token: "ya29.token", host: "smtp.example.com", port: "587"}
+
+		proto, resp, err := a.Start(server)
+		assert.Nil(t, err, tt.mech)
+		assert.Equal(t, tt.mech, proto)
+		assert.Equal(t, tt.initial, string(resp), tt.mech)
+
+		resp, err = a.Next([]byte("2.7.0 Accepted"), false)
+		assert.Nil(t, err, tt.mech)
+		assert.Nil(t, resp, tt.mech)
+	}
+
+	// LOGIN
+	a := &saslAuth{mech: AuthLogin, username: "user", password: "secret"}
+	proto, resp, err := a.Start(server)
+	assert.Nil(t, err)
+	assert.Equal(t, AuthLogin, proto)
+	assert.Nil(t, resp)
+
+	resp, _ = a.Next([]byte("Username:"), true)
+	assert.Equal(t, "user", string(resp))
+	resp, _ = a.Next([]byte("Password:"), true)
+	assert.Equal(t, "secret", string(resp))
+	_, err = a.Next([]byte("Something else"), true)
+	assert.NotNil(t, err)
+
+	// 无法识别提示时按顺序发送。
+	a = &saslAuth{mech: AuthLogin, username: "user", password: "secret"}
+	resp, _ = a.Next([]byte("?"), true)
+	assert.Equal(t, "user", string(resp))
+	resp, _ = a.Next([]byte("?"), true)
+	assert.Equal(t, "secret", string(resp))
+
+	// 认证失败时的响应。
+	a = &saslAuth{mech: AuthXOAuth2}
+	resp, err = a.Next([]byte(`{"status":"401"}`), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, resp)
+
+	a = &saslAuth{mech: AuthOAuthBearer, username: "a=b,c"}
+	_, resp, _ = a.Start(&smtp.ServerInfo{Name: "localhost"})
+	assert.Equal(t, "n,a=a=3Db=2Cc,\x01auth=Bearer \x01\x01", string(resp))
+	resp, err = a.Next([]byte(`{"status":"invalid_token"}`), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01}, resp)
+
+	// 未加密的连接。
+	insecure := &smtp.ServerInfo{Name: "smtp.example.com"}
+	for _, mech := range []string{AuthPlain, AuthLogin, AuthXOAuth2, AuthOAuthBearer} {
+		_, _, err = (&saslAuth{mech: mech}).Start(insecure)
+		assert.Equal(t, ErrInsecureAuth, err, mech)
+
+		_, _, err = (&saslAuth{mech: mech, allowInsecure: true}).Start(insecure)
+		assert.Nil(t, err, mech)
+	}
+}
+
+func TestNegotiateAuth(t *testing.T) {
+	cfg := Config{SMTPUser: "user", SMTPPassword: "secret"}
+
+	assert.Equal(t, AuthPlain, cfg.negotiateAuth([]string{"LOGIN", "PLAIN", "CRAM-MD5"}, true))
+	assert.Equal(t, AuthCRAMMD5, cfg.negotiateAuth([]string{"LOGIN", "PLAIN", "CRAM-MD5"}, false))
+	assert.Equal(t, AuthLogin, cfg.negotiateAuth([]string{"LOGIN", "XOAUTH2"}, true))
+	assert.Equal(t, "", cfg.negotiateAuth([]string{"XOAUTH2"}, true))
+
+	cfg.TokenSource = StaticTokenSource("token")
+	assert.Equal(t, AuthXOAuth2, cfg.negotiateAuth([]string{"PLAIN", "OAUTHBEARER", "XOAUTH2"}, true))
+	assert.Equal(t, AuthOAuthBearer, cfg.negotiateAuth([]string{"PLAIN", "OAUTHBEARER"}, true))
+	assert.Equal(t, "", cfg.negotiateAuth([]string{"PLAIN", "LOGIN"}, true))
+}
+
+func TestClientAuth(t *testing.T) {
+	s, cfg := newTestServer(t,
+		smtptest.WithAuth("user", "secret"),
+		smtptest.WithAuth("user@example.com", "ya29.token"),
+		smtptest.WithAuthMechanisms("PLAIN", "LOGIN", "CRAM-MD5", "XOAUTH2", "OAUTHBEARER"),
+	)
+
+	send := func(cfg Config) error {
+		s.Reset()
+
+		return SendmailWithComposer(cfg, testComposer("user@example.com"))
+	}
+
+	// authCommand 返回 AUTH 命令的认证方式及解码后的 initial response。
+	authCommand := func() (mech, initial string) {
+		lines := commandLines(s, "AUTH ")
+		if !assert.Len(t, lines, 1) {
+			return
+		}
+
+		mech, encoded, _ := strings.Cut(strings.TrimPrefix(lines[0], "AUTH "), " ")
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		assert.Nil(t, err)
+
+		return mech, string(b)
+	}
+
+	// 未加密的连接自动选择 CRAM-MD5。
+	cfg.SMTPUser, cfg.SMTPPassword = "user", "secret"
+	assert.Nil(t, send(cfg))
+	mech, _ := authCommand()
+	assert.Equal(t, AuthCRAMMD5, mech)
+	assert.Equal(t, "user", s.Messages()[0].AuthUser)
+
+	cfg.AuthMechanism = "login"
+	assert.Nil(t, send(cfg))
+	mech, _ = authCommand()
+	assert.Equal(t, AuthLogin, mech)
+
+	cfg.AuthMechanism = AuthPlain
+	assert.Nil(t, send(cfg))
+	mech, initial := authCommand()
+	assert.Equal(t, AuthPlain, mech)
+	assert.Equal(t, "\x00user\x00secret", initial)
+
+	cfg.SMTPPassword = "wrong"
+	e, ok := IsSMTPError(send(cfg))
+	assert.True(t, ok)
+	assert.Equal(t, 535, e.Code)
+
+	cfg.AuthMechanism = "DIGEST-MD5"
+	assert.True(t, errors.Is(send(cfg), ErrUnknownAuthMechanism))
+
+	// OAuth
+	cfg = Config{Host: cfg.Host, Port: cfg.Port, Timeout: cfg.Timeout}
+	cfg.SMTPUser = "user@example.com"
+	cfg.TokenSource = TokenSourceFunc(func(context.Context) (string, error) { return "ya29.token", nil })
+	assert.Nil(t, send(cfg))
+	mech, initial = authCommand()
+	assert.Equal(t, AuthXOAuth2, mech)
+	assert.Equal(t, "user=user@example.com\x01auth=Bearer ya29.token\x01\x01", initial)
+	assert.Equal(t, "user@example.com", s.Messages()[0].AuthUser)
+
+	cfg.AuthMechanism = AuthOAuthBearer
+	assert.Nil(t, send(cfg))
+
+	cfg.TokenSource = StaticTokenSource("bad-token")
+	e, ok = IsSMTPError(send(cfg))
+	assert.True(t, ok)
+	assert.Equal(t, 535, e.Code)
+	mech, initial = authCommand()
+	assert.Equal(t, AuthOAuthBearer, mech)
+	assert.Equal(t, "n,a=user@example.com,\x01host=127.0.0.1\x01port="+cfg.Port+"\x01auth=Bearer bad-token\x01\x01", initial)
+
+	cfg.TokenSource = TokenSourceFunc(func(context.Context) (string, error) { return "", errors.New("expired") })
+	assert.ErrorContains(t, send(cfg), "expired")
+
+	// 没有可用的认证方式。
+	_, cfg = newTestServer(t, smtptest.WithAuth("user", "secret"), smtptest.WithAuthMechanisms("GSSAPI"))
+	cfg.SMTPUser, cfg.SMTPPassword = "user", "secret"
+	assert.True(t, errors.Is(send(cfg), ErrNoAuthMechanism))
+}
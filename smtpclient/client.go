@@ -0,0 +1,574 @@
+package smtpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 15 * time.Second
+
+	DefaultMaxIdleConns       = 2
+	DefaultIdleTimeout        = 30 * time.Second
+	DefaultMaxMessagesPerConn = 100
+)
+
+var ErrClientClosed = errors.New("smtpclient: client is closed")
+
+type ClientOption func(c *Client)
+
+// WithMaxIdleConns 设置最多保留的空闲连接数，默认为 DefaultMaxIdleConns。
+// 为 0 时不复用连接，每封邮件发送后立即断开。
+func WithMaxIdleConns(n int) ClientOption {
+	return func(c *Client) {
+		c.maxIdleConns = max(n, 0)
+	}
+}
+
+// WithMaxConns 设置最多同时使用的连接数（即并发发送的邮件数），超出的 Send 调用会
+// 等待，直到有连接空闲或 ctx 结束。默认为 0，表示不限制。
+func WithMaxConns(n int) ClientOption {
+	return func(c *Client) {
+		c.maxConns = max(n, 0)
+	}
+}
+
+// WithIdleTimeout 设置空闲连接的最长保留时间，默认为 DefaultIdleTimeout。
+// 应小于 SMTP 服务器的超时时间（例如 Postfix 的 `smtpd_timeout`，默认为 300 秒）。
+func WithIdleTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.idleTimeout = d
+	}
+}
+
+// WithMaxMessagesPerConn 设置每个连接最多发送的邮件数量，超出后断开连接，
+// 默认为 DefaultMaxMessagesPerConn。
+func WithMaxMessagesPerConn(n int) ClientOption {
+	return func(c *Client) {
+		c.maxMessagesPerConn = n
+	}
+}
+
+// Client 是可复用的 SMTP 客户端，可以被多个 goroutine 同时使用。
+//
+// Client 会保留已认证的连接用于发送后续的邮件（每封邮件之间发送 `RSET`），
+// 不再使用时应调用 Close 断开所有空闲连接。
+type Client struct {
+	cfg Config
+
+	maxIdleConns       int
+	maxConns           int
+	idleTimeout        time.Duration
+	maxMessagesPerConn int
+
+	// sem 限制同时使用的连接数，为 nil 时表示不限制。
+	sem chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// conn 是一个已完成握手（及 STARTTLS、认证）的 SMTP 连接。
+type conn struct {
+	netConn   net.Conn
+	client    *smtp.Client
+	ext       extensions
+	messages  int
+	idleSince time.Time
+
+	// broken 表示 ctx 结束时修改了截止时间，连接不能再复用。
+	broken bool
+}
+
+// NewClient 根据 cfg 创建 Client。注意：创建时不会连接 SMTP 服务器。
+func NewClient(cfg Config, opts ...ClientOption) *Client {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	c := &Client{
+		cfg:                cfg,
+		maxIdleConns:       DefaultMaxIdleConns,
+		idleTimeout:        DefaultIdleTimeout,
+		maxMessagesPerConn: DefaultMaxMessagesPerConn,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.maxConns > 0 {
+		c.sem = make(chan struct{}, c.maxConns)
+	}
+
+	return c
+}
+
+// Send 发送 composer 编写的邮件，收件人包括 To、Cc 和 Bcc。
+// 任何一个收件人被拒绝时都不发送邮件，并返回 *SMTPError。
+//
+// ctx 用于取消发送或设置超时，每次 SMTP 操作的超时时间仍然受 Config.Timeout 限制。
+func (c *Client) Send(ctx context.Context, composer *Composer) (err error) {
+	_, err = c.sendComposer(ctx, composer, false)
+
+	return
+}
+
+// SendWithReport 发送 composer 编写的邮件，与 Send 不同的是，部分收件人被拒绝时
+// 仍然发送给其它收件人，每个收件人的结果见返回的 DeliveryReport。
+//
+// 所有收件人都被拒绝时返回 ErrAllRecipientsRejected（包含第一个收件人被拒绝的
+// *SMTPError）。出错时 report 仍然包含出错前的结果。
+func (c *Client) SendWithReport(ctx context.Context, composer *Composer) (report *DeliveryReport, err error) {
+	return c.sendComposer(ctx, composer, true)
+}
+
+func (c *Client) sendComposer(ctx context.Context, composer *Composer, partial bool) (report *DeliveryReport, err error) {
+	fillFromAddress(c.cfg, composer)
+
+	// Export mail body before smtp connection, make sure it's valid email message.
+	msg, err := composer.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed in building email message from composer: %v", err)
+	}
+
+	var recipients []string
+	for _, addr := range composer.GetAllRecipients() {
+		recipients = append(recipients, addr.Address)
+	}
+
+	return c.send(ctx, composer.from.Address, recipients, msg, composer.envelope, partial)
+}
+
+// Close 断开所有空闲连接。正在发送邮件的连接在发送完成后断开。
+// Close 之后调用 Send 会返回 ErrClientClosed。
+func (c *Client) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	for _, cn := range idle {
+		cn.quit(c.cfg.Timeout)
+	}
+
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, from string, recipients []string, msg []byte, opts EnvelopeOptions, partial bool) (report *DeliveryReport, err error) {
+	return c.sendMessage(ctx, from, recipients, newMessage(msg), opts, partial)
+}
+
+func (c *Client) sendMessage(ctx context.Context, from string, recipients []string, msg message, opts EnvelopeOptions, partial bool) (report *DeliveryReport, err error) {
+	report = &DeliveryReport{From: from}
+
+	if len(recipients) == 0 {
+		return report, ErrNoRecipients
+	}
+
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+			defer func() { <-c.sem }()
+		case <-ctx.Done():
+			return report, ctx.Err()
+		}
+	}
+
+	cn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+
+	err = cn.withContext(ctx, c.cfg.Timeout, func() error {
+		return cn.sendMail(report, recipients, msg, opts, partial)
+	})
+
+	c.putConn(cn, err)
+
+	return
+}
+
+// getConn 返回一个空闲连接，没有可用的空闲连接时建立新连接。
+func (c *Client) getConn(ctx context.Context) (cn *conn, err error) {
+	for {
+		cn, err = c.popIdle()
+		if err != nil {
+			return
+		}
+
+		if cn == nil {
+			return c.dial(ctx)
+		}
+
+		// 复用的连接先发送 RSET 清除可能残留的事务，同时检查连接是否仍然可用。
+		err = cn.withContext(ctx, c.cfg.Timeout, cn.client.Reset)
+		if err == nil && !cn.broken {
+			return
+		}
+
+		cn.close()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) popIdle() (cn *conn, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	for len(c.idle) > 0 {
+		cn = c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+
+		if c.idleTimeout <= 0 || time.Since(cn.idleSince) < c.idleTimeout {
+			return
+		}
+
+		// 空闲时间太长，服务器可能已经断开连接。
+		go cn.close()
+	}
+
+	return nil, nil
+}
+
+// putConn 将使用完的连接放回空闲连接池，或者断开连接。
+func (c *Client) putConn(cn *conn, err error) {
+	// SMTP 服务器返回错误代码（如收件人不存在）时连接仍然可用，下次使用前会发送 RSET；
+	// 其它错误（如网络错误、超时）则直接断开连接。
+	if _, ok := IsSMTPError(err); (err != nil && !ok) || cn.broken {
+		cn.close()
+
+		return
+	}
+
+	cn.messages++
+	cn.idleSince = time.Now()
+
+	c.mu.Lock()
+	reuse := !c.closed &&
+		len(c.idle) < c.maxIdleConns &&
+		(c.maxMessagesPerConn <= 0 || cn.messages < c.maxMessagesPerConn)
+
+	if reuse {
+		c.idle = append(c.idle, cn)
+	}
+	c.mu.Unlock()
+
+	if !reuse {
+		cn.quit(c.cfg.Timeout)
+	}
+}
+
+// dial 建立新连接，并完成 STARTTLS 和认证。出错时关闭连接。
+func (c *Client) dial(ctx context.Context) (cn *conn, err error) {
+	cfg := c.cfg
+
+	netConn, err := cfg.dial(ctx)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = netConn.Close()
+		}
+	}()
+
+	cn = &conn{netConn: netConn}
+
+	err = cn.withContext(ctx, cfg.Timeout, func() (err error) {
+		// 开启 ssl 安全连接
+		if cfg.UseSSL {
+			tlsConn := tls.Client(netConn, cfg.tlsConfig())
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				return
+			}
+
+			cn.netConn = tlsConn
+		}
+
+		cn.client, err = smtp.NewClient(cn.netConn, cfg.Host)
+		if err != nil {
+			return toSMTPError(err)
+		}
+
+		if err = cn.client.Hello(cfg.heloName()); err != nil {
+			return toSMTPError(err)
+		}
+
+		if cfg.StartTLS {
+			if err = cn.client.StartTLS(cfg.tlsConfig()); err != nil {
+				return toSMTPError(err)
+			}
+		}
+
+		if cfg.needAuth() {
+			if err = cfg.authenticate(ctx, cn.client); err != nil {
+				return toSMTPError(err)
+			}
+		}
+
+		cn.ext = loadExtensions(cn.client)
+
+		return
+	})
+
+	if err != nil {
+		cn = nil
+	}
+
+	return
+}
+
+func (cfg Config) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: !cfg.VerifySSLCertificate,
+		ServerName:         cfg.Host,
+	}
+}
+
+// withContext 执行 fn，期间 SMTP 操作的超时时间为 timeout 或 ctx 的截止时间
+// （以较早者为准），ctx 被取消时立即中断。
+func (cn *conn) withContext(ctx context.Context, timeout time.Duration, fn func() error) (err error) {
+	deadline := time.Now().Add(timeout)
+	ctxDeadline, hasDeadline := ctx.Deadline()
+	if hasDeadline && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err = cn.netConn.SetDeadline(deadline); err != nil {
+		return
+	}
+
+	// ctx 被取消时将截止时间设置为过去的时间，使正在进行的读写操作立即返回。
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.netConn.SetDeadline(time.Unix(1, 0))
+	})
+
+	err = fn()
+
+	if !stop() {
+		// fn 已经完成（例如服务器已经接受了邮件）时仍然返回成功，但连接的截止时间可能
+		// 已被修改，不能再复用。
+		cn.broken = true
+	}
+
+	if err != nil {
+		// 因 ctx 结束而中断时返回 ctx 的错误，而不是 i/o timeout。
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var netErr net.Error
+		if hasDeadline && errors.As(err, &netErr) && netErr.Timeout() && !time.Now().Before(ctxDeadline) {
+			return context.DeadlineExceeded
+		}
+	}
+
+	return
+}
+
+// message 是要发送的邮件内容。
+type message struct {
+	r io.Reader
+
+	// size 是邮件大小，为 -1 时表示未知。
+	size int64
+
+	// eightBit 表示邮件可能包含 8 位字符，无法预先检查时（例如 SendRaw）为 true。
+	eightBit bool
+}
+
+func newMessage(msg []byte) message {
+	return message{r: bytes.NewReader(msg), size: int64(len(msg)), eightBit: !isASCII(string(msg))}
+}
+
+// sendMail 发送一封邮件。partial 为 true 时跳过被拒绝的收件人，只要有一个收件人
+// 被接受就发送邮件。SMTP 服务器返回的错误均为 *SMTPError。
+//
+// 服务器支持 PIPELINING 时一次性发送 MAIL FROM 和所有 RCPT TO 命令，再依次读取响应。
+func (cn *conn) sendMail(report *DeliveryReport, recipients []string, msg message, opts EnvelopeOptions, partial bool) (err error) {
+	mailCmd, err := cn.ext.mailCommandSize(report.From, recipients, msg.size, msg.eightBit, opts)
+	if err != nil {
+		return
+	}
+
+	cmds := []string{mailCmd}
+	for _, addr := range recipients {
+		cmds = append(cmds, cn.ext.rcptCommand(addr, opts))
+	}
+
+	text := cn.client.Text
+
+	// results 是每个命令的结果，SMTP 服务器返回的错误为 *textproto.Error。
+	var results []error
+	if cn.ext.pipelining {
+		ids := make([]uint, 0, len(cmds))
+		for _, cmd := range cmds {
+			id, err := text.Cmd("%s", cmd)
+			if err != nil {
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+
+		for _, id := range ids {
+			if err = readResponse(text, id); err != nil && !isProtocolError(err) {
+				return
+			}
+
+			results = append(results, err)
+		}
+	} else {
+		for _, cmd := range cmds {
+			id, err := text.Cmd("%s", cmd)
+			if err != nil {
+				return err
+			}
+
+			if err = readResponse(text, id); err != nil && !isProtocolError(err) {
+				return err
+			}
+
+			results = append(results, err)
+
+			// 发件人被拒绝时不再发送 RCPT TO。
+			if results[0] != nil {
+				break
+			}
+		}
+	}
+
+	if err = toSMTPError(results[0]); err != nil {
+		return
+	}
+
+	var firstRejected *SMTPError
+	for i, addr := range recipients {
+		result := RecipientResult{Address: addr, Accepted: true}
+
+		if err = toSMTPError(results[i+1]); err != nil {
+			e, _ := IsSMTPError(err)
+			if !partial {
+				return
+			}
+
+			result.Accepted = false
+			result.Err = e
+
+			if firstRejected == nil {
+				firstRejected = e
+			}
+		}
+
+		report.Recipients = append(report.Recipients, result)
+	}
+
+	err = nil
+
+	if len(report.Accepted()) == 0 {
+		if firstRejected != nil {
+			return fmt.Errorf("%w: %w", ErrAllRecipientsRejected, firstRejected)
+		}
+
+		return ErrAllRecipientsRejected
+	}
+
+	// 与 net/smtp 的 Client.Data 相同，但保留服务器接收邮件后的响应。
+	id, err := text.Cmd("DATA")
+	if err != nil {
+		return
+	}
+
+	text.StartResponse(id)
+	_, _, err = text.ReadResponse(354)
+	text.EndResponse(id)
+
+	if err != nil {
+		return toSMTPError(err)
+	}
+
+	// DotWriter 负责 dot-stuffing 并将 LF 转换为 CRLF。
+	w := text.DotWriter()
+	if _, err = io.Copy(w, msg.r); err != nil {
+		return fmt.Errorf("failed in writing mail body: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return
+	}
+
+	_, report.Response, err = text.ReadResponse(250)
+
+	return toSMTPError(err)
+}
+
+// readResponse 读取 id 对应命令的 2xx 响应。
+func readResponse(text *textproto.Conn, id uint) (err error) {
+	text.StartResponse(id)
+	defer text.EndResponse(id)
+
+	_, _, err = text.ReadResponse(2)
+
+	return
+}
+
+// isProtocolError 检查 err 是否为 SMTP 服务器返回的错误响应，而不是网络错误。
+func isProtocolError(err error) bool {
+	var tpErr *textproto.Error
+
+	return errors.As(err, &tpErr)
+}
+
+// loadExtensions 读取服务器 EHLO 响应中声明支持的扩展。
+func loadExtensions(client *smtp.Client) (ext extensions) {
+	_, ext.tls = client.TLSConnectionState()
+	ext.pipelining, _ = client.Extension("PIPELINING")
+	ext.smtputf8, _ = client.Extension("SMTPUTF8")
+	ext.eightBit, _ = client.Extension("8BITMIME")
+	ext.dsn, _ = client.Extension("DSN")
+	ext.requireTLS, _ = client.Extension("REQUIRETLS")
+
+	var size string
+	if ext.hasSize, size = client.Extension("SIZE"); ext.hasSize {
+		ext.size, _ = strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	}
+
+	return
+}
+
+// quit 发送 QUIT 并断开连接。
+func (cn *conn) quit(timeout time.Duration) {
+	_ = cn.netConn.SetDeadline(time.Now().Add(timeout))
+	_ = cn.client.Quit()
+	cn.close()
+}
+
+func (cn *conn) close() {
+	if cn.client != nil {
+		_ = cn.client.Close()
+	}
+
+	_ = cn.netConn.Close()
+}
@@ -0,0 +1,299 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/smtptest"
+)
+
+// newTestServer 启动测试用的 SMTP 服务器，返回连接该服务器的 Config。
+// 除 opts 指定的响应外，服务器拒绝 `unknown@` 收件人，临时拒绝 `tempfail@` 收件人，
+// 第一次临时拒绝 `greylist@` 收件人。
+func newTestServer(t *testing.T, opts ...smtptest.Option) (s *smtptest.Server, cfg Config) {
+	opts = append(opts,
+		smtptest.WithReply(smtptest.Reply{Command: "RCPT", Match: `unknown@`, Reply: "550 5.1.1 User unknown"}),
+		smtptest.WithReply(smtptest.Reply{Command: "RCPT", Match: `tempfail@`, Reply: "450 4.2.0 Greylisted, try again later"}),
+		smtptest.WithReply(smtptest.Reply{Command: "RCPT", Match: `greylist@`, Reply: "450 4.2.0 Greylisted, try again later", Times: 1}),
+	)
+
+	s, err := smtptest.NewServer(opts...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	cfg = Config{Host: s.Host(), Port: s.Port(), Timeout: 2 * time.Second}
+
+	return
+}
+
+// commandLines 返回服务器收到的以 prefix 开头的命令。
+func commandLines(s *smtptest.Server, prefix string) (lines []string) {
+	for _, l := range s.Commands() {
+		if strings.HasPrefix(l, prefix) {
+			lines = append(lines, l)
+		}
+	}
+
+	return
+}
+
+// countCommand 返回服务器收到 cmd 命令的次数。
+func countCommand(s *smtptest.Server, cmd string) (n int) {
+	for _, l := range s.Commands() {
+		if name, _, _ := strings.Cut(l, " "); strings.EqualFold(name, cmd) {
+			n++
+		}
+	}
+
+	return
+}
+
+func testComposer(to ...string) *Composer {
+	var addrs []mail.Address
+	for _, addr := range to {
+		addrs = append(addrs, mail.Address{Address: addr})
+	}
+
+	return NewComposer().
+		WithFrom(mail.Address{Address: "sender@example.com"}).
+		WithTo(addrs).
+		WithSubject("test").
+		WithBodyText([]byte("hello"))
+}
+
+func TestClientReuseConnection(t *testing.T) {
+	s, cfg := newTestServer(t, smtptest.WithAuth("user", "password"))
+	cfg.SMTPUser = "user"
+	cfg.SMTPPassword = "password"
+
+	client := NewClient(cfg)
+
+	for range 5 {
+		assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+	}
+
+	assert.Nil(t, client.Close())
+
+	assert.Equal(t, 1, s.Connections())
+	assert.Len(t, s.Messages(), 5)
+	assert.Equal(t, 1, countCommand(s, "AUTH"))
+	assert.Equal(t, 4, countCommand(s, "RSET"))
+
+	assert.Eventually(t, func() bool { return countCommand(s, "QUIT") == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, ErrClientClosed, client.Send(context.Background(), testComposer("user@example.com")))
+}
+
+func TestClientMaxMessagesPerConn(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	client := NewClient(cfg, WithMaxMessagesPerConn(2))
+	defer client.Close()
+
+	for range 5 {
+		assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+	}
+
+	assert.Equal(t, 3, s.Connections())
+	assert.Len(t, s.Messages(), 5)
+}
+
+func TestClientIdleTimeout(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	client := NewClient(cfg, WithIdleTimeout(50*time.Millisecond))
+	defer client.Close()
+
+	assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+
+	assert.Equal(t, 2, s.Connections())
+}
+
+func TestClientNoReuse(t *testing.T) {
+	s, cfg := newTestServer(t)
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+
+	assert.Equal(t, 2, s.Connections())
+	assert.Len(t, s.Messages(), 2)
+	assert.Eventually(t, func() bool { return countCommand(s, "QUIT") == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestClientRejectedRecipient(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	err := client.Send(context.Background(), testComposer("unknown@example.com"))
+	e, ok := IsSMTPError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 550, e.Code)
+	assert.Equal(t, "5.1.1", e.EnhancedCode)
+	assert.Equal(t, "User unknown", e.Message)
+
+	// The connection is still usable.
+	assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+	assert.Equal(t, 1, s.Connections())
+	assert.Equal(t, 1, countCommand(s, "RSET"))
+}
+
+func TestClientSendWithReport(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	composer := testComposer("user@example.com", "unknown@example.com").
+		WithBcc([]mail.Address{{Address: "bcc@example.com"}})
+
+	report, err := client.SendWithReport(context.Background(), composer)
+	assert.Nil(t, err)
+	assert.Equal(t, "sender@example.com", report.From)
+	assert.Equal(t, "2.0.0 OK: queued", report.Response)
+	assert.Equal(t, []string{"user@example.com", "bcc@example.com"}, report.Accepted())
+	assert.False(t, report.AllAccepted())
+	assert.Len(t, s.Messages(), 1)
+
+	rejected := report.Rejected()
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, "unknown@example.com", rejected[0].Address)
+	assert.Equal(t, 550, rejected[0].Err.Code)
+	assert.True(t, rejected[0].Err.Permanent())
+
+	// All recipients rejected.
+	report, err = client.SendWithReport(context.Background(), testComposer("unknown@example.com"))
+	assert.True(t, errors.Is(err, ErrAllRecipientsRejected))
+
+	e, ok := IsSMTPError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 550, e.Code)
+	assert.Len(t, report.Rejected(), 1)
+	assert.Equal(t, "", report.Response)
+	assert.Len(t, s.Messages(), 1)
+
+	// Connection is still reused.
+	report, err = client.SendWithReport(context.Background(), testComposer("user@example.com"))
+	assert.Nil(t, err)
+	assert.True(t, report.AllAccepted())
+	assert.Equal(t, 1, s.Connections())
+
+	_, err = client.send(context.Background(), "sender@example.com", nil, []byte("test"), EnvelopeOptions{}, true)
+	assert.Equal(t, ErrNoRecipients, err)
+}
+
+func TestClientContext(t *testing.T) {
+	_, cfg := newTestServer(t, smtptest.WithReply(smtptest.Reply{Command: smtptest.CmdDataEnd, Delay: 500 * time.Millisecond}))
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Send(ctx, testComposer("user@example.com"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, client.Send(ctx, testComposer("user@example.com")))
+}
+
+// ctx 在操作完成后才被取消时仍然返回成功，但连接不再复用。
+func TestConnWithContextCanceledAfterSuccess(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	cn := &conn{netConn: c1}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := cn.withContext(ctx, time.Second, func() error {
+		cancel()
+
+		// 等待 context.AfterFunc 开始执行。
+		time.Sleep(50 * time.Millisecond)
+
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, cn.broken)
+
+	client := NewClient(Config{})
+	client.putConn(cn, nil)
+	assert.Empty(t, client.idle)
+
+	// 连接已被关闭。
+	_, err = c1.Write([]byte("x"))
+	assert.NotNil(t, err)
+}
+
+func TestClientConcurrent(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	client := NewClient(cfg, WithMaxConns(3), WithMaxIdleConns(3))
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Len(t, s.Messages(), 20)
+	assert.LessOrEqual(t, s.Connections(), 3)
+}
+
+func TestClientWithSMTPTest(t *testing.T) {
+	s, cfg := newTestServer(t,
+		smtptest.WithTLS(),
+		smtptest.WithAuth("user", "secret"),
+		smtptest.WithAuthRequired(),
+		smtptest.WithExtensions("PIPELINING"),
+		smtptest.WithReply(smtptest.Reply{Command: smtptest.CmdDataEnd, Reply: "250 2.0.0 Ok: queued as ABC123"}),
+	)
+	cfg.StartTLS = true
+	cfg.SMTPUser, cfg.SMTPPassword = "user", "secret"
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	report, err := client.SendWithReport(context.Background(), testComposer("user@example.com", "unknown@example.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2.0.0 Ok: queued as ABC123", report.Response)
+	assert.Equal(t, []string{"user@example.com"}, report.Accepted())
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.True(t, msgs[0].TLS)
+	assert.Equal(t, "user", msgs[0].AuthUser)
+	assert.Equal(t, "sender@example.com", msgs[0].From)
+	assert.Equal(t, []string{"user@example.com"}, msgs[0].Recipients)
+	assert.Contains(t, string(msgs[0].Data), "Subject: test\r\n")
+
+	// 服务器在会话中途返回 421。
+	s, cfg = newTestServer(t, smtptest.WithReply(smtptest.Reply{Command: "DATA", Reply: "421 4.3.2 Service shutting down"}))
+	err = SendmailWithComposer(cfg, testComposer("user@example.com"))
+	e, ok := IsSMTPError(err)
+	assert.True(t, ok)
+	assert.True(t, e.Temporary())
+	assert.Empty(t, s.Messages())
+}
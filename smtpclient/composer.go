@@ -2,12 +2,21 @@ package smtpclient
 
 import (
 	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"mime"
 	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/inbucket/html2text"
 	"github.com/jhillyerd/enmime/v2"
 
 	"github.com/iredmail/goutils"
+	"github.com/iredmail/goutils/dkim"
 )
 
 // Composer 用于编写邮件。
@@ -27,12 +36,44 @@ type Composer struct {
 	headers         map[string]string
 	fileAttachments []string // Path to files
 	byteAttachments []*ByteAttachment
+	inlines         []*Inline
+	calendarMethod  string
+	calendar        []byte
+	unsubscribe     []string // header `List-Unsubscribe:`
+	oneClick        bool     // header `List-Unsubscribe-Post:`
+	dkimSigner      *dkim.Signer
+	envelope        EnvelopeOptions
 }
 
+const (
+	// CalendarMethodRequest 用于发送或更新会议邀请。
+	CalendarMethodRequest = "REQUEST"
+
+	// CalendarMethodCancel 用于取消会议。
+	CalendarMethodCancel = "CANCEL"
+)
+
 type ByteAttachment struct {
-	Name        string
+	Name string
+
+	// ContentType 可以带参数，例如 `text/csv; charset=gbk`，为空时根据 Name 的扩展名判断。
 	ContentType string
 	Bytes       []byte
+
+	// Charset 是文本附件的字符集，默认为 `utf-8`。
+	Charset string
+
+	// Disposition 是 Content-Disposition，默认为 `attachment`，为 `inline` 时邮件客户端可以直接显示附件。
+	Disposition string
+}
+
+// Inline 是嵌入 HTML 正文的内容（通常是图片），HTML 中使用 `cid:` 引用，
+// 例如 ContentID 为 `logo` 时使用 `<img src="cid:logo">`。
+type Inline struct {
+	ContentID   string
+	Name        string
+	ContentType string // 为空时根据 Name 的扩展名判断
+	Bytes       []byte
 }
 
 func NewComposer() *Composer {
@@ -119,25 +160,62 @@ func (c *Composer) WithByteAttachments(atts ...*ByteAttachment) *Composer {
 	return c
 }
 
-// Bytes 将邮件内容转换为 `[]byte`。
+// WithInlines 添加 HTML 正文引用的内嵌内容，参考 Inline。
+func (c *Composer) WithInlines(inlines ...*Inline) *Composer {
+	c.inlines = inlines
+
+	return c
+}
+
+// WithCalendar 添加 iCalendar（RFC 5545）格式的会议邀请，作为正文的 `text/calendar` 部分。
+// method 是 iTIP（RFC 5546）方法，例如 CalendarMethodRequest、CalendarMethodCancel，
+// 必须与 ics 中的 `METHOD` 属性一致。
+func (c *Composer) WithCalendar(method string, ics []byte) *Composer {
+	c.calendarMethod = strings.ToUpper(method)
+	c.calendar = ics
+
+	return c
+}
+
+// WithListUnsubscribe 设置 List-Unsubscribe 邮件头（RFC 2369），uris 是 `mailto:` 或 `https:` 地址。
+// oneClick 为 true 时同时设置 `List-Unsubscribe-Post: List-Unsubscribe=One-Click`（RFC 8058），
+// 此时 uris 中必须有 `https:` 地址，并且需要使用 DKIM 签名。
+func (c *Composer) WithListUnsubscribe(oneClick bool, uris ...string) *Composer {
+	c.unsubscribe = uris
+	c.oneClick = oneClick
+
+	return c
+}
+
+// WithDKIMSigner 使用 DKIM 对邮件签名。
+func (c *Composer) WithDKIMSigner(s *dkim.Signer) *Composer {
+	c.dkimSigner = s
+
+	return c
+}
+
+// WithDSN 请求投递状态通知（RFC 3461），服务器不支持 DSN 时忽略。
+func (c *Composer) WithDSN(dsn DSN) *Composer {
+	c.envelope.DSN = &dsn
+
+	return c
+}
+
+// WithRequireTLS 要求邮件只能通过 TLS 连接投递（RFC 8689 REQUIRETLS）。
+func (c *Composer) WithRequireTLS() *Composer {
+	c.envelope.RequireTLS = true
+
+	return c
+}
+
+// Bytes 将邮件内容转换为 `[]byte`，如果设置了 DKIM Signer 则对邮件签名。
+// 只设置了 HTML 正文时，自动生成纯文本正文。
 func (c *Composer) Bytes() (msg []byte, err error) {
 	mb := enmime.Builder().
 		From(c.from.Name, c.from.Address).
 		ToAddrs(c.to).
 		Subject(c.subject)
 
-	if len(c.bodyText) > 0 {
-		mb = mb.Text(c.bodyText)
-	}
-
-	if len(c.bodyHTML) > 0 {
-		mb = mb.HTML(c.bodyHTML)
-	}
-
-	if c.cc != nil {
-		mb = mb.CCAddrs(c.cc)
-	}
-
 	if c.cc != nil {
 		mb = mb.CCAddrs(c.cc)
 	}
@@ -165,34 +243,222 @@ func (c *Composer) Bytes() (msg []byte, err error) {
 		}
 	}
 
-	if c.fileAttachments != nil {
-		for _, pth := range c.fileAttachments {
-			mb = mb.AddFileAttachment(pth)
+	if len(c.unsubscribe) > 0 || c.oneClick {
+		var value string
+		if value, err = c.listUnsubscribe(); err != nil {
+			return
 		}
-	}
 
-	if c.byteAttachments != nil {
-		for _, att := range c.byteAttachments {
-			mb = mb.AddAttachment(att.Bytes, att.ContentType, att.Name)
+		mb = mb.Header("List-Unsubscribe", value)
+		if c.oneClick {
+			mb = mb.Header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
 		}
 	}
 
-	part, err := mb.Build()
+	// enmime 只用于生成邮件头，邮件正文由 buildBody 生成。
+	head, err := mb.Build()
+	if err != nil {
+		return
+	}
+
+	root, err := c.buildBody()
 	if err != nil {
 		return
 	}
 
+	root.Header = head.Header
+
 	var buf bytes.Buffer
-	err = part.Encode(&buf)
+	err = root.Encode(&buf)
 	if err != nil {
 		return
 	}
 
 	msg = buf.Bytes()
 
+	if c.dkimSigner != nil {
+		msg, err = c.dkimSigner.Sign(msg)
+	}
+
+	return
+}
+
+// buildBody 生成邮件正文，根据内容选择需要的 MIME 结构：
+//
+//	multipart/mixed
+//	|- multipart/related
+//	|  |- multipart/alternative
+//	|  |  |- text/plain
+//	|  |  |- text/html
+//	|  |  `- text/calendar
+//	|  `- inlines..
+//	`- attachments..
+func (c *Composer) buildBody() (root *enmime.Part, err error) {
+	text := c.bodyText
+	if len(text) == 0 && len(c.bodyHTML) > 0 {
+		var s string
+		if s, err = html2text.FromString(string(c.bodyHTML)); err != nil {
+			return nil, fmt.Errorf("smtpclient: failed to convert html to text: %w", err)
+		}
+
+		text = []byte(s)
+	}
+
+	var alternatives []*enmime.Part
+	if len(text) > 0 || (len(c.bodyHTML) == 0 && len(c.calendar) == 0) {
+		alternatives = append(alternatives, newTextPart("text/plain", text))
+	}
+
+	if len(c.bodyHTML) > 0 {
+		alternatives = append(alternatives, newTextPart("text/html", c.bodyHTML))
+	}
+
+	if len(c.calendar) > 0 {
+		if c.calendarMethod == "" {
+			return nil, errors.New("smtpclient: calendar method is empty")
+		}
+
+		part := newTextPart("text/calendar", c.calendar)
+		part.ContentTypeParams["method"] = c.calendarMethod
+		alternatives = append(alternatives, part)
+	}
+
+	root = wrapParts("multipart/alternative", alternatives...)
+
+	if len(c.inlines) > 0 {
+		parts := []*enmime.Part{root}
+		for _, inline := range c.inlines {
+			if inline.ContentID == "" {
+				return nil, fmt.Errorf("smtpclient: inline part %q has no Content-ID", inline.Name)
+			}
+
+			part := newPart(inline.ContentType, inline.Name)
+			part.Content = inline.Bytes
+			part.FileName = inline.Name
+			part.ContentID = inline.ContentID
+			part.Disposition = "inline"
+			parts = append(parts, part)
+		}
+
+		root = wrapParts("multipart/related", parts...)
+	}
+
+	if len(c.fileAttachments) > 0 || len(c.byteAttachments) > 0 {
+		parts := []*enmime.Part{root}
+		for _, pth := range c.fileAttachments {
+			var b []byte
+			if b, err = os.ReadFile(pth); err != nil {
+				return
+			}
+
+			parts = append(parts, (&ByteAttachment{Name: filepath.Base(pth), Bytes: b}).part())
+		}
+
+		for _, att := range c.byteAttachments {
+			parts = append(parts, att.part())
+		}
+
+		root = wrapParts("multipart/mixed", parts...)
+	}
+
 	return
 }
 
+// listUnsubscribe 返回 List-Unsubscribe 邮件头的值。
+func (c *Composer) listUnsubscribe() (value string, err error) {
+	hasHTTPS := false
+	values := make([]string, 0, len(c.unsubscribe))
+
+	for _, uri := range c.unsubscribe {
+		uri = strings.Trim(strings.TrimSpace(uri), "<>")
+		if uri == "" {
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToLower(uri), "https://") {
+			hasHTTPS = true
+		}
+
+		values = append(values, "<"+uri+">")
+	}
+
+	if len(values) == 0 {
+		return "", errors.New("smtpclient: no List-Unsubscribe URI")
+	}
+
+	if c.oneClick && !hasHTTPS {
+		return "", errors.New("smtpclient: one-click unsubscribe requires an https URI")
+	}
+
+	value = strings.Join(values, ", ")
+
+	return
+}
+
+// part 返回附件的 MIME part。
+func (a *ByteAttachment) part() *enmime.Part {
+	part := newPart(a.ContentType, a.Name)
+	if a.Charset != "" {
+		part.Charset = a.Charset
+	}
+
+	part.Content = a.Bytes
+	part.FileName = a.Name
+	part.Disposition = cmp.Or(strings.ToLower(a.Disposition), "attachment")
+
+	return part
+}
+
+// newPart 返回指定类型的 part。contentType 可以带参数，为空时根据文件名 name 的扩展名判断，
+// 无法判断时使用 `application/octet-stream`。
+func newPart(contentType, name string) *enmime.Part {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(name))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", nil
+	}
+
+	part := enmime.NewPart(mediaType)
+	for k, v := range params {
+		switch k {
+		case "charset":
+			part.Charset = v
+		case "name":
+			// enmime 根据 FileName 生成
+		default:
+			part.ContentTypeParams[k] = v
+		}
+	}
+
+	return part
+}
+
+// newTextPart 返回 UTF-8 编码的文本 part。
+func newTextPart(contentType string, content []byte) *enmime.Part {
+	part := enmime.NewPart(contentType)
+	part.Content = content
+	part.Charset = "utf-8"
+
+	return part
+}
+
+// wrapParts 只有一个 part 时直接返回，否则返回包含所有 part 的 multipart。
+func wrapParts(contentType string, parts ...*enmime.Part) *enmime.Part {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	root := enmime.NewPart(contentType)
+	for _, part := range parts {
+		root.AddChild(part)
+	}
+
+	return root
+}
+
 func (c *Composer) GetTo() []mail.Address  { return c.to }
 func (c *Composer) GetCc() []mail.Address  { return c.cc }
 func (c *Composer) GetBcc() []mail.Address { return c.bcc }
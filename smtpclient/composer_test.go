@@ -0,0 +1,219 @@
+package smtpclient
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dkim"
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+func TestComposerDKIM(t *testing.T) {
+	privateKey, _, err := dnsutils.GenDKIMKey(1024)
+	assert.Nil(t, err)
+
+	signer, err := dkim.NewSigner("example.com", "dkim", privateKey)
+	assert.Nil(t, err)
+
+	msg, err := testComposer("rcpt@example.net").WithDKIMSigner(signer).Bytes()
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(msg, []byte("DKIM-Signature: v=1;")))
+	assert.Contains(t, string(msg), "d=example.com;")
+
+	msg, err = testComposer("rcpt@example.net").Bytes()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(msg), "DKIM-Signature")
+}
+
+// partTypes 返回邮件所有 part 的 Content-Type（不含参数），按深度优先顺序。
+func partTypes(root *enmime.Part) (types []string) {
+	_ = root.DepthMatchAll(func(p *enmime.Part) bool {
+		types = append(types, p.ContentType)
+
+		return false
+	})
+
+	return
+}
+
+func TestComposerBody(t *testing.T) {
+	// 只有纯文本正文
+	msg, err := testComposer("rcpt@example.net").Bytes()
+	assert.Nil(t, err)
+
+	env, err := enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"text/plain"}, partTypes(env.Root))
+	assert.Equal(t, "hello", env.Text)
+	assert.Equal(t, "test", env.GetHeader("Subject"))
+	assert.Equal(t, "<rcpt@example.net>", env.GetHeader("To"))
+
+	// 只有 HTML 正文时自动生成纯文本正文。
+	msg, err = testComposer("rcpt@example.net").
+		WithBodyText(nil).
+		WithBodyHTML([]byte(`<html><body><h1>Title</h1><p>Hello <b>world</b></p></body></html>`)).
+		Bytes()
+	assert.Nil(t, err)
+
+	env, err = enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"multipart/alternative", "text/plain", "text/html"}, partTypes(env.Root))
+	assert.Contains(t, env.Text, "Title")
+	assert.Contains(t, env.Text, "Hello *world*")
+	assert.NotContains(t, env.Text, "<b>")
+
+	// 设置了纯文本正文时不自动生成。
+	msg, err = testComposer("rcpt@example.net").WithBodyHTML([]byte("<p>html</p>")).Bytes()
+	assert.Nil(t, err)
+
+	env, err = enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", env.Text)
+}
+
+func TestComposerInlines(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nfake image")
+
+	msg, err := testComposer("rcpt@example.net").
+		WithBodyHTML([]byte(`<p>Logo: <img src="cid:logo@example.com"></p>`)).
+		WithInlines(&Inline{ContentID: "logo@example.com", Name: "logo.png", Bytes: png}).
+		WithByteAttachments(&ByteAttachment{Name: "report.pdf", ContentType: "application/pdf", Bytes: []byte("%PDF")}).
+		Bytes()
+	assert.Nil(t, err)
+
+	env, err := enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"multipart/mixed",
+		"multipart/related",
+		"multipart/alternative",
+		"text/plain",
+		"text/html",
+		"image/png",
+		"application/pdf",
+	}, partTypes(env.Root))
+
+	assert.Equal(t, 1, len(env.Inlines))
+	assert.Equal(t, "logo@example.com", env.Inlines[0].ContentID)
+	assert.Equal(t, "logo.png", env.Inlines[0].FileName)
+	assert.Equal(t, png, env.Inlines[0].Content)
+
+	assert.Equal(t, 1, len(env.Attachments))
+	assert.Equal(t, "report.pdf", env.Attachments[0].FileName)
+
+	_, err = testComposer("rcpt@example.net").WithInlines(&Inline{Name: "logo.png", Bytes: png}).Bytes()
+	assert.NotNil(t, err)
+}
+
+func TestComposerCalendar(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:1@example.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+	msg, err := testComposer("rcpt@example.net").WithCalendar("request", []byte(ics)).Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(msg), "Content-Type: text/calendar; charset=utf-8; method=REQUEST")
+
+	env, err := enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"multipart/alternative", "text/plain", "text/calendar"}, partTypes(env.Root))
+
+	cal := env.Root.BreadthMatchFirst(func(p *enmime.Part) bool { return p.ContentType == "text/calendar" })
+	assert.Equal(t, ics, string(cal.Content))
+
+	// 只有会议邀请时不生成空的纯文本正文。
+	msg, err = testComposer("rcpt@example.net").WithBodyText(nil).WithCalendar(CalendarMethodCancel, []byte(ics)).Bytes()
+	assert.Nil(t, err)
+
+	env, err = enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"text/calendar"}, partTypes(env.Root))
+	assert.Contains(t, env.Root.Header.Get("Content-Type"), "method=CANCEL")
+
+	_, err = testComposer("rcpt@example.net").WithCalendar("", []byte(ics)).Bytes()
+	assert.NotNil(t, err)
+}
+
+func TestComposerAttachments(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "notes.txt")
+	assert.Nil(t, os.WriteFile(pth, []byte("notes"), 0600))
+
+	msg, err := testComposer("rcpt@example.net").
+		WithFileAttachments(pth).
+		WithByteAttachments(
+			&ByteAttachment{Name: "data.csv", ContentType: "text/csv; charset=gbk; header=present", Bytes: []byte("a,b")},
+			&ByteAttachment{Name: "page.html", Charset: "iso-8859-1", Disposition: "INLINE", Bytes: []byte("<p>x</p>")},
+			&ByteAttachment{Name: "blob", Bytes: []byte{0, 1, 2}},
+		).
+		Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(msg), `Content-Type: text/csv; charset=gbk; header=present; name=data.csv`)
+	assert.Contains(t, string(msg), `Content-Disposition: inline; filename=page.html`)
+
+	env, err := enmime.ReadEnvelope(bytes.NewReader(msg))
+	assert.Nil(t, err)
+
+	var parts []*enmime.Part
+	_ = env.Root.DepthMatchAll(func(p *enmime.Part) bool {
+		if p.FileName != "" {
+			parts = append(parts, p)
+		}
+
+		return false
+	})
+
+	assert.Equal(t, 4, len(parts))
+	assert.Equal(t, "notes.txt", parts[0].FileName)
+	assert.Equal(t, "text/plain", parts[0].ContentType)
+	assert.Equal(t, "attachment", parts[0].Disposition)
+	assert.Equal(t, "notes", string(parts[0].Content))
+
+	assert.Equal(t, "text/csv", parts[1].ContentType)
+	assert.Contains(t, parts[1].Header.Get("Content-Type"), "charset=gbk")
+
+	assert.Equal(t, "text/html", parts[2].ContentType)
+	assert.Equal(t, "inline", parts[2].Disposition)
+
+	assert.Equal(t, "application/octet-stream", parts[3].ContentType)
+	assert.Equal(t, []byte{0, 1, 2}, parts[3].Content)
+
+	_, err = testComposer("rcpt@example.net").WithFileAttachments(filepath.Join(t.TempDir(), "missing")).Bytes()
+	assert.NotNil(t, err)
+}
+
+func TestComposerListUnsubscribe(t *testing.T) {
+	privateKey, _, err := dnsutils.GenDKIMKey(1024)
+	assert.Nil(t, err)
+
+	signer, err := dkim.NewSigner("example.com", "dkim", privateKey)
+	assert.Nil(t, err)
+
+	msg, err := testComposer("rcpt@example.net").
+		WithListUnsubscribe(true, "mailto:unsubscribe@example.com", "<https://example.com/unsubscribe?id=1>").
+		WithDKIMSigner(signer).
+		Bytes()
+	assert.Nil(t, err)
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	assert.Nil(t, err)
+	assert.Equal(t, "<mailto:unsubscribe@example.com>, <https://example.com/unsubscribe?id=1>", m.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", m.Header.Get("List-Unsubscribe-Post"))
+	assert.Contains(t, strings.ReplaceAll(m.Header.Get("DKIM-Signature"), " ", ""), "List-Unsubscribe:List-Unsubscribe-Post")
+
+	msg, err = testComposer("rcpt@example.net").WithListUnsubscribe(false, "mailto:unsubscribe@example.com").Bytes()
+	assert.Nil(t, err)
+	assert.Contains(t, string(msg), "List-Unsubscribe: <mailto:unsubscribe@example.com>\r\n")
+	assert.NotContains(t, string(msg), "List-Unsubscribe-Post")
+
+	// One-Click 需要 https 地址。
+	_, err = testComposer("rcpt@example.net").WithListUnsubscribe(true, "mailto:unsubscribe@example.com").Bytes()
+	assert.NotNil(t, err)
+
+	_, err = testComposer("rcpt@example.net").WithListUnsubscribe(false, " ").Bytes()
+	assert.NotNil(t, err)
+}
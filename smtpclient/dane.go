@@ -0,0 +1,149 @@
+package smtpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// TLSA 记录的证书用途（RFC 6698 第 2.1.1 节）。RFC 7672 规定 SMTP 只使用 DANE-TA 和 DANE-EE。
+const (
+	TLSAUsagePKIXTA = 0
+	TLSAUsagePKIXEE = 1
+	TLSAUsageDANETA = 2
+	TLSAUsageDANEEE = 3
+)
+
+// TLSA 记录的选择器（RFC 6698 第 2.1.2 节）。
+const (
+	TLSASelectorCert = 0 // 完整证书
+	TLSASelectorSPKI = 1 // SubjectPublicKeyInfo
+)
+
+// TLSA 记录的匹配类型（RFC 6698 第 2.1.3 节）。
+const (
+	TLSAMatchingFull   = 0
+	TLSAMatchingSHA256 = 1
+	TLSAMatchingSHA512 = 2
+)
+
+// ErrDANEVerification 表示服务器证书与 TLSA 记录不匹配。
+var ErrDANEVerification = errors.New("smtpclient: certificate does not match TLSA records")
+
+// TLSARecord 是 DNS TLSA 记录（RFC 6698）。
+type TLSARecord struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+// TLSALookupFunc 查询 MX 主机的 TLSA 记录（即 `_<port>._tcp.<host>`），没有记录时返回空列表。
+//
+// 标准库无法查询 TLSA 记录，也不验证 DNSSEC 签名，实现者需要使用支持 DNSSEC 验证的解析器，
+// 并且只能返回通过 DNSSEC 验证的记录（RFC 7672 第 2.2 节）。
+type TLSALookupFunc func(ctx context.Context, host, port string) ([]TLSARecord, error)
+
+// usable 检查记录是否可用于 SMTP（RFC 7672 第 3.1.3 节）。
+func (r TLSARecord) usable() bool {
+	if r.Usage != TLSAUsageDANETA && r.Usage != TLSAUsageDANEEE {
+		return false
+	}
+
+	if r.Selector != TLSASelectorCert && r.Selector != TLSASelectorSPKI {
+		return false
+	}
+
+	return r.MatchingType <= TLSAMatchingSHA512
+}
+
+// match 检查证书是否与记录匹配。
+func (r TLSARecord) match(cert *x509.Certificate) bool {
+	data := cert.Raw
+	if r.Selector == TLSASelectorSPKI {
+		data = cert.RawSubjectPublicKeyInfo
+	}
+
+	switch r.MatchingType {
+	case TLSAMatchingSHA256:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case TLSAMatchingSHA512:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	}
+
+	return bytes.Equal(data, r.Data)
+}
+
+// usableTLSA 返回可用于 SMTP 的记录。
+func usableTLSA(records []TLSARecord) (usable []TLSARecord) {
+	for _, r := range records {
+		if r.usable() {
+			usable = append(usable, r)
+		}
+	}
+
+	return
+}
+
+// verifyDANE 按 RFC 7672 第 3 节验证服务器证书，records 只包含可用的记录：
+//
+//   - DANE-EE：服务器证书匹配即可，不检查主机名和有效期。
+//   - DANE-TA：证书链中的某个证书匹配，且服务器证书由它签发、在有效期内、主机名与 host 匹配。
+func verifyDANE(state tls.ConnectionState, records []TLSARecord, host string) error {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("%w: no certificate", ErrDANEVerification)
+	}
+
+	leaf := certs[0]
+
+	for _, r := range records {
+		switch r.Usage {
+		case TLSAUsageDANEEE:
+			if r.match(leaf) {
+				return nil
+			}
+		case TLSAUsageDANETA:
+			for i, ta := range certs {
+				if !r.match(ta) {
+					continue
+				}
+
+				// 服务器证书本身匹配 DANE-TA 记录时只需检查主机名。
+				if i == 0 {
+					if leaf.VerifyHostname(host) == nil {
+						return nil
+					}
+
+					continue
+				}
+
+				roots := x509.NewCertPool()
+				roots.AddCert(ta)
+
+				intermediates := x509.NewCertPool()
+				for _, c := range certs[1:i] {
+					intermediates.AddCert(c)
+				}
+
+				_, err := leaf.Verify(x509.VerifyOptions{
+					DNSName:       host,
+					Roots:         roots,
+					Intermediates: intermediates,
+				})
+				if err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrDANEVerification, host)
+}
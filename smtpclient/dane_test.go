@@ -0,0 +1,120 @@
+package smtpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCert 生成用于测试的证书，parent 为 nil 时生成自签名的 CA 证书。
+func newTestCert(t *testing.T, parent *tls.Certificate, hosts ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	if parent != nil {
+		cert.Certificate = append(cert.Certificate, parent.Certificate...)
+	}
+
+	return cert
+}
+
+func sha256TLSA(usage, selector uint8, cert *x509.Certificate) TLSARecord {
+	data := cert.Raw
+	if selector == TLSASelectorSPKI {
+		data = cert.RawSubjectPublicKeyInfo
+	}
+
+	sum := sha256.Sum256(data)
+
+	return TLSARecord{Usage: usage, Selector: selector, MatchingType: TLSAMatchingSHA256, Data: sum[:]}
+}
+
+func TestTLSARecord(t *testing.T) {
+	cert := newTestCert(t, nil, "mx.example.com").Leaf
+
+	sum := sha512.Sum512(cert.Raw)
+	assert.True(t, TLSARecord{Usage: TLSAUsageDANEEE, MatchingType: TLSAMatchingSHA512, Data: sum[:]}.match(cert))
+	assert.True(t, TLSARecord{Usage: TLSAUsageDANEEE, Selector: TLSASelectorSPKI, Data: cert.RawSubjectPublicKeyInfo}.match(cert))
+	assert.True(t, sha256TLSA(TLSAUsageDANEEE, TLSASelectorCert, cert).match(cert))
+	assert.False(t, sha256TLSA(TLSAUsageDANEEE, TLSASelectorSPKI, cert).match(newTestCert(t, nil).Leaf))
+
+	records := []TLSARecord{
+		{Usage: TLSAUsagePKIXTA},
+		{Usage: TLSAUsagePKIXEE},
+		{Usage: TLSAUsageDANEEE, Selector: 2},
+		{Usage: TLSAUsageDANEEE, MatchingType: 3},
+		{Usage: TLSAUsageDANETA, Selector: TLSASelectorSPKI, MatchingType: TLSAMatchingSHA256},
+	}
+	assert.Equal(t, records[4:], usableTLSA(records))
+}
+
+func TestVerifyDANE(t *testing.T) {
+	ca := newTestCert(t, nil)
+	server := newTestCert(t, &ca, "mx.example.com")
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.Leaf, ca.Leaf}}
+
+	// DANE-EE 不检查主机名。
+	ee := sha256TLSA(TLSAUsageDANEEE, TLSASelectorSPKI, server.Leaf)
+	assert.Nil(t, verifyDANE(state, []TLSARecord{ee}, "mx.example.com"))
+	assert.Nil(t, verifyDANE(state, []TLSARecord{ee}, "other.example.com"))
+
+	// DANE-TA 检查证书链及主机名。
+	ta := sha256TLSA(TLSAUsageDANETA, TLSASelectorCert, ca.Leaf)
+	assert.Nil(t, verifyDANE(state, []TLSARecord{ta}, "mx.example.com"))
+	assert.True(t, errors.Is(verifyDANE(state, []TLSARecord{ta}, "other.example.com"), ErrDANEVerification))
+
+	// 证书不是由匹配的 CA 签发。
+	other := newTestCert(t, nil, "mx.example.com")
+	state = tls.ConnectionState{PeerCertificates: []*x509.Certificate{other.Leaf, ca.Leaf}}
+	assert.True(t, errors.Is(verifyDANE(state, []TLSARecord{ta, ee}, "mx.example.com"), ErrDANEVerification))
+
+	// 自签名证书匹配 DANE-TA 记录。
+	ta = sha256TLSA(TLSAUsageDANETA, TLSASelectorSPKI, other.Leaf)
+	assert.Nil(t, verifyDANE(state, []TLSARecord{ta}, "mx.example.com"))
+
+	assert.True(t, errors.Is(verifyDANE(tls.ConnectionState{}, []TLSARecord{ee}, "mx.example.com"), ErrDANEVerification))
+}
@@ -0,0 +1,231 @@
+package smtpclient
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/iredmail/goutils"
+)
+
+// Dialer 用于建立到 SMTP 服务器的 TCP 连接，*net.Dialer 及 NewProxyDialer 的返回值都实现了该接口。
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// hostFQDN 是本机的完整主机名，只获取一次。
+var hostFQDN = sync.OnceValue(func() string {
+	if fqdn := goutils.GetHostFQDN(); fqdn != "" {
+		return fqdn
+	}
+
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+
+	return "localhost"
+})
+
+// heloName 返回 EHLO/HELO 命令使用的主机名，IP 地址按 RFC 5321 第 4.1.3 节转换为地址字面量，
+// 例如 `[192.0.2.1]`、`[IPv6:2001:db8::1]`。
+func (cfg Config) heloName() string {
+	name := cmp.Or(strings.TrimSpace(cfg.HeloName), hostFQDN())
+
+	if ip := net.ParseIP(name); ip != nil {
+		if ip.To4() != nil {
+			return "[" + name + "]"
+		}
+
+		return "[IPv6:" + name + "]"
+	}
+
+	return name
+}
+
+func (cfg Config) network() string {
+	switch cfg.Network {
+	case "tcp4", "tcp6":
+		return cfg.Network
+	}
+
+	return "tcp"
+}
+
+// dialer 返回建立连接使用的 Dialer：优先使用 Config.Dialer，否则使用绑定了 LocalAddr 的 net.Dialer。
+func (cfg Config) dialer() (Dialer, error) {
+	if cfg.Dialer != nil {
+		return cfg.Dialer, nil
+	}
+
+	d := &net.Dialer{Timeout: cfg.Timeout}
+
+	if cfg.LocalAddr != "" {
+		ip := net.ParseIP(cfg.LocalAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("smtpclient: invalid local address: %s", cfg.LocalAddr)
+		}
+
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	return d, nil
+}
+
+// dial 连接 Config 中指定的 SMTP 服务器。
+func (cfg Config) dial(ctx context.Context) (net.Conn, error) {
+	d, err := cfg.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.DialContext(ctx, cfg.network(), net.JoinHostPort(cfg.Host, cfg.Port))
+}
+
+// NewProxyDialer 返回通过代理服务器建立连接的 Dialer，支持以下格式的代理地址：
+//
+//   - `socks5://[user:password@]host:port`：SOCKS5 代理，由代理服务器解析 SMTP 服务器的域名。
+//   - `http://[user:password@]host:port`：支持 HTTP CONNECT 方法的代理。
+//
+// forward 用于连接代理服务器，为 nil 时使用 net.Dialer。
+func NewProxyDialer(proxyURL string, forward Dialer) (Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("smtpclient: invalid proxy URL: %w", err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("smtpclient: invalid proxy URL: %s", proxyURL)
+	}
+
+	if forward == nil {
+		forward = &net.Dialer{Timeout: defaultTimeout}
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: password}
+		}
+
+		d, err := proxy.SOCKS5("tcp", u.Host, auth, contextDialer{forward})
+		if err != nil {
+			return nil, err
+		}
+
+		return d.(Dialer), nil
+	case "http":
+		return &httpProxyDialer{addr: u.Host, user: u.User, forward: forward}, nil
+	}
+
+	return nil, fmt.Errorf("smtpclient: unsupported proxy scheme: %s", u.Scheme)
+}
+
+// contextDialer 将 Dialer 转换为 proxy.Dialer 和 proxy.ContextDialer。
+type contextDialer struct {
+	Dialer
+}
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// httpProxyDialer 通过 HTTP CONNECT 代理建立连接。
+type httpProxyDialer struct {
+	addr    string
+	user    *url.Userinfo
+	forward Dialer
+}
+
+func (d *httpProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	br, err := d.connect(ctx, conn, addr)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	// SMTP 服务器的欢迎信息可能已经被读入 br。
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// connect 发送 CONNECT 请求并读取代理服务器的响应。
+func (d *httpProxyDialer) connect(ctx context.Context, conn net.Conn, addr string) (br *bufio.Reader, err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if d.user != nil {
+		password, _ := d.user.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(d.user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+
+	if err = req.Write(conn); err != nil {
+		return
+	}
+
+	br = bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		return
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("smtpclient: proxy %s refused to connect to %s: %s", d.addr, addr, resp.Status)
+	}
+
+	err = conn.SetDeadline(time.Time{})
+
+	return
+}
+
+// bufferedConn 先读取 r 中已缓存的数据。
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
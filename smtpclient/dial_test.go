@@ -0,0 +1,203 @@
+package smtpclient
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeloName(t *testing.T) {
+	assert.Equal(t, "mail.example.com", Config{HeloName: "mail.example.com"}.heloName())
+	assert.Equal(t, "[192.0.2.1]", Config{HeloName: "192.0.2.1"}.heloName())
+	assert.Equal(t, "[IPv6:2001:db8::1]", Config{HeloName: "2001:db8::1"}.heloName())
+	assert.NotEmpty(t, Config{}.heloName())
+
+	s, cfg := newTestServer(t)
+	cfg.HeloName = "mail.example.com"
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Equal(t, []string{"EHLO mail.example.com"}, commandLines(s, "EHLO"))
+}
+
+func TestDialOptions(t *testing.T) {
+	s, cfg := newTestServer(t)
+	cfg.LocalAddr = "127.0.0.1"
+	cfg.Network = "tcp4"
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+
+	cfg.LocalAddr = "invalid"
+	assert.ErrorContains(t, SendmailWithComposer(cfg, testComposer("user@example.com")), "invalid local address")
+
+	// 只使用 IPv6 时无法连接 IPv4 地址。
+	cfg.LocalAddr = ""
+	cfg.Network = "tcp6"
+	assert.NotNil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Len(t, s.Messages(), 1)
+}
+
+// serveProxy 启动测试用的代理服务器，handshake 完成代理协议的握手并返回目标地址。
+func serveProxy(t *testing.T, handshake func(c net.Conn, r *bufio.Reader) (string, bool)) (addr string, conns *atomic.Int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	conns = &atomic.Int32{}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conns.Add(1)
+
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				target, ok := handshake(c, r)
+				if !ok {
+					return
+				}
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+
+				go func() { _, _ = io.Copy(upstream, r) }()
+				_, _ = io.Copy(c, upstream)
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), conns
+}
+
+func TestHTTPProxyDialer(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	proxyAddr, conns := serveProxy(t, func(c net.Conn, r *bufio.Reader) (string, bool) {
+		req, err := http.ReadRequest(r)
+		if err != nil || req.Method != http.MethodConnect {
+			return "", false
+		}
+
+		if user, password, ok := parseProxyAuth(req); !ok || user != "user" || password != "secret" {
+			_, _ = c.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+
+			return "", false
+		}
+
+		_, _ = c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		return req.Host, true
+	})
+
+	d, err := NewProxyDialer("http://user:secret@"+proxyAddr, nil)
+	assert.Nil(t, err)
+	cfg.Dialer = d
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Equal(t, int32(1), conns.Load())
+	assert.Len(t, s.Messages(), 1)
+
+	d, err = NewProxyDialer("http://user:wrong@"+proxyAddr, nil)
+	assert.Nil(t, err)
+	cfg.Dialer = d
+	assert.ErrorContains(t, SendmailWithComposer(cfg, testComposer("user@example.com")), "407")
+
+	_, err = NewProxyDialer("ftp://"+proxyAddr, nil)
+	assert.ErrorContains(t, err, "unsupported proxy scheme")
+
+	_, err = NewProxyDialer("localhost:1080", nil)
+	assert.NotNil(t, err)
+}
+
+func parseProxyAuth(req *http.Request) (user, password string, ok bool) {
+	r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+
+	return r.BasicAuth()
+}
+
+func TestSOCKS5ProxyDialer(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	// 最简单的 SOCKS5 服务器（RFC 1928、RFC 1929），只支持用户名密码认证及 CONNECT 命令。
+	proxyAddr, conns := serveProxy(t, func(c net.Conn, r *bufio.Reader) (string, bool) {
+		// 认证方法协商。
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return "", false
+		}
+
+		if _, err := io.ReadFull(r, make([]byte, header[1])); err != nil {
+			return "", false
+		}
+
+		_, _ = c.Write([]byte{5, 2})
+
+		// 用户名密码认证。
+		readString := func() string {
+			n, _ := r.ReadByte()
+			b := make([]byte, n)
+			_, _ = io.ReadFull(r, b)
+
+			return string(b)
+		}
+
+		_, _ = r.ReadByte()
+		if readString() != "user" || readString() != "secret" {
+			_, _ = c.Write([]byte{1, 1})
+
+			return "", false
+		}
+
+		_, _ = c.Write([]byte{1, 0})
+
+		// CONNECT 请求。
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(r, req); err != nil || req[1] != 1 {
+			return "", false
+		}
+
+		var host string
+		switch req[3] {
+		case 1:
+			ip := make([]byte, 4)
+			_, _ = io.ReadFull(r, ip)
+			host = net.IP(ip).String()
+		case 3:
+			host = readString()
+		default:
+			return "", false
+		}
+
+		port := make([]byte, 2)
+		_, _ = io.ReadFull(r, port)
+
+		_, _ = c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+	})
+
+	d, err := NewProxyDialer("socks5://user:secret@"+proxyAddr, nil)
+	assert.Nil(t, err)
+	cfg.Dialer = d
+	assert.Nil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Equal(t, int32(1), conns.Load())
+	assert.Len(t, s.Messages(), 1)
+
+	d, err = NewProxyDialer("socks5://user:wrong@"+proxyAddr, nil)
+	assert.Nil(t, err)
+	cfg.Dialer = d
+	assert.NotNil(t, SendmailWithComposer(cfg, testComposer("user@example.com")))
+	assert.Len(t, s.Messages(), 1)
+}
@@ -0,0 +1,80 @@
+package smtpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// ErrNoRecipients 表示邮件没有收件人。
+var ErrNoRecipients = errors.New("smtpclient: no recipients")
+
+// ErrAllRecipientsRejected 表示所有收件人都被 SMTP 服务器拒绝，邮件没有发送。
+var ErrAllRecipientsRejected = errors.New("smtpclient: all recipients were rejected")
+
+// reEnhancedCode 匹配 RFC 3463 定义的扩展状态码，例如 `5.1.1`。
+var reEnhancedCode = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+
+// SMTPError 是 SMTP 服务器返回的错误响应。
+type SMTPError struct {
+	// Code 是 SMTP 响应代码，例如 550。
+	Code int
+
+	// EnhancedCode 是 RFC 3463 定义的扩展状态码，例如 `5.1.1`。服务器未返回时为空。
+	EnhancedCode string
+
+	// Message 是响应的文本内容（不包含扩展状态码），多行响应以 `\n` 连接。
+	Message string
+}
+
+func (e *SMTPError) Error() string {
+	if e.EnhancedCode != "" {
+		return fmt.Sprintf("%d %s %s", e.Code, e.EnhancedCode, e.Message)
+	}
+
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Temporary 表示临时错误（4xx），稍后可以重试。
+func (e *SMTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// Permanent 表示永久错误（5xx），重试也不会成功。
+func (e *SMTPError) Permanent() bool {
+	return e.Code >= 500 && e.Code < 600
+}
+
+// newSMTPError 根据 SMTP 响应代码和文本创建 SMTPError。
+func newSMTPError(code int, msg string) *SMTPError {
+	e := &SMTPError{Code: code, Message: msg}
+
+	if enhanced, text, found := strings.Cut(msg, " "); found && reEnhancedCode.MatchString(enhanced) {
+		e.EnhancedCode = enhanced
+		e.Message = text
+	} else if reEnhancedCode.MatchString(msg) {
+		e.EnhancedCode = msg
+		e.Message = ""
+	}
+
+	return e
+}
+
+// toSMTPError 将 net/smtp 返回的 *textproto.Error 转换为 *SMTPError，其它错误原样返回。
+func toSMTPError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return newSMTPError(tpErr.Code, tpErr.Msg)
+	}
+
+	return err
+}
+
+// IsSMTPError 检查 err 是否为 SMTP 服务器返回的错误，是则返回 *SMTPError。
+func IsSMTPError(err error) (e *SMTPError, ok bool) {
+	ok = errors.As(err, &e)
+
+	return
+}
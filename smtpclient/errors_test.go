@@ -0,0 +1,51 @@
+package smtpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPError(t *testing.T) {
+	e := newSMTPError(550, "5.1.1 <unknown@example.com>: Recipient address rejected")
+	assert.Equal(t, 550, e.Code)
+	assert.Equal(t, "5.1.1", e.EnhancedCode)
+	assert.Equal(t, "<unknown@example.com>: Recipient address rejected", e.Message)
+	assert.Equal(t, "550 5.1.1 <unknown@example.com>: Recipient address rejected", e.Error())
+	assert.True(t, e.Permanent())
+	assert.False(t, e.Temporary())
+
+	e = newSMTPError(450, "4.2.0 Greylisted, please try again")
+	assert.Equal(t, "4.2.0", e.EnhancedCode)
+	assert.True(t, e.Temporary())
+	assert.False(t, e.Permanent())
+
+	e = newSMTPError(421, "Too many connections")
+	assert.Equal(t, "", e.EnhancedCode)
+	assert.Equal(t, "Too many connections", e.Message)
+	assert.Equal(t, "421 Too many connections", e.Error())
+
+	e = newSMTPError(554, "5.7.1")
+	assert.Equal(t, "5.7.1", e.EnhancedCode)
+	assert.Equal(t, "", e.Message)
+
+	// Not an enhanced status code.
+	e = newSMTPError(550, "1.2.3 something")
+	assert.Equal(t, "", e.EnhancedCode)
+
+	err := toSMTPError(&textproto.Error{Code: 552, Msg: "5.3.4 Message size exceeds fixed limit"})
+	e, ok := IsSMTPError(fmt.Errorf("wrapped: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, 552, e.Code)
+	assert.Equal(t, "5.3.4", e.EnhancedCode)
+
+	other := errors.New("other")
+	assert.Equal(t, other, toSMTPError(other))
+	assert.Nil(t, toSMTPError(nil))
+
+	_, ok = IsSMTPError(other)
+	assert.False(t, ok)
+}
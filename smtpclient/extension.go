@@ -0,0 +1,204 @@
+package smtpclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DSN NOTIFY= 参数的值（RFC 3461 第 4.1 节）。
+const (
+	DSNNotifyNever   = "NEVER"
+	DSNNotifySuccess = "SUCCESS"
+	DSNNotifyFailure = "FAILURE"
+	DSNNotifyDelay   = "DELAY"
+)
+
+// DSN RET= 参数的值（RFC 3461 第 4.3 节）。
+const (
+	DSNReturnFull    = "FULL"
+	DSNReturnHeaders = "HDRS"
+)
+
+var (
+	// ErrMessageTooLarge 表示邮件大小超过了服务器 EHLO 响应中 SIZE 声明的上限，邮件没有发送。
+	ErrMessageTooLarge = errors.New("smtpclient: message exceeds the server size limit")
+
+	// ErrSMTPUTF8NotSupported 表示发件人或收件人地址包含非 ASCII 字符，但服务器不支持 SMTPUTF8。
+	ErrSMTPUTF8NotSupported = errors.New("smtpclient: server does not support SMTPUTF8")
+
+	// ErrRequireTLSNotSupported 表示邮件要求 REQUIRETLS，但连接未加密或服务器不支持 REQUIRETLS。
+	ErrRequireTLSNotSupported = errors.New("smtpclient: REQUIRETLS is not supported")
+
+	errInvalidAddress = errors.New("smtpclient: address contains CR or LF")
+)
+
+// DSN 是 RFC 3461 定义的投递状态通知（Delivery Status Notification）参数。
+// 服务器不支持 DSN 时忽略这些参数，邮件照常发送。
+type DSN struct {
+	// Notify 是 RCPT TO 的 NOTIFY= 参数，例如 []string{DSNNotifyFailure, DSNNotifyDelay}。
+	// 为空时不发送该参数，由服务器决定（通常为 FAILURE,DELAY）。
+	Notify []string `json:"notify,omitempty"`
+
+	// Return 是 MAIL FROM 的 RET= 参数：DSNReturnFull 或 DSNReturnHeaders。
+	Return string `json:"ret,omitempty"`
+
+	// EnvelopeID 是 MAIL FROM 的 ENVID= 参数，会包含在投递状态通知中。
+	EnvelopeID string `json:"envid,omitempty"`
+
+	// OriginalRecipient 为 true 时为每个收件人发送 ORCPT=rfc822;<地址> 参数。
+	OriginalRecipient bool `json:"orcpt,omitempty"`
+}
+
+// EnvelopeOptions 是 SMTP 信封（MAIL FROM、RCPT TO 命令）的扩展参数。
+type EnvelopeOptions struct {
+	DSN *DSN `json:"dsn,omitempty"`
+
+	// RequireTLS 要求邮件只能通过 TLS 连接投递（RFC 8689）。
+	// 连接未加密或服务器不支持 REQUIRETLS 时不发送邮件，返回 ErrRequireTLSNotSupported。
+	RequireTLS bool `json:"require_tls,omitempty"`
+}
+
+// extensions 是服务器 EHLO 响应中声明支持的扩展。
+type extensions struct {
+	tls        bool
+	pipelining bool
+	smtputf8   bool
+	eightBit   bool
+	dsn        bool
+	requireTLS bool
+	hasSize    bool
+	size       int64 // 0 表示没有限制
+}
+
+// mailCommand 返回 MAIL FROM 命令。
+func (ext extensions) mailCommand(from string, recipients []string, msg []byte, opts EnvelopeOptions) (cmd string, err error) {
+	return ext.mailCommandSize(from, recipients, int64(len(msg)), !isASCII(string(msg)), opts)
+}
+
+// mailCommandSize 返回 MAIL FROM 命令。size 是邮件大小，为 -1 时表示未知，不发送 SIZE= 参数；
+// eightBit 表示邮件可能包含 8 位字符。
+func (ext extensions) mailCommandSize(from string, recipients []string, size int64, eightBit bool, opts EnvelopeOptions) (cmd string, err error) {
+	if err = validateAddress(from); err != nil {
+		return
+	}
+
+	for _, addr := range recipients {
+		if err = validateAddress(addr); err != nil {
+			return
+		}
+	}
+
+	if ext.size > 0 && size > ext.size {
+		return "", fmt.Errorf("%w (%d > %d bytes): %w", ErrMessageTooLarge, size, ext.size,
+			newSMTPError(552, "5.3.4 Message size exceeds fixed maximum message size"))
+	}
+
+	if opts.RequireTLS && (!ext.tls || !ext.requireTLS) {
+		return "", fmt.Errorf("%w: %w", ErrRequireTLSNotSupported,
+			newSMTPError(550, "5.7.30 REQUIRETLS support required"))
+	}
+
+	b := strings.Builder{}
+	b.WriteString("MAIL FROM:<" + from + ">")
+
+	if ext.hasSize && size >= 0 {
+		b.WriteString(" SIZE=" + strconv.FormatInt(size, 10))
+	}
+
+	// RFC 6152: 邮件包含 8 位字符时声明 BODY=8BITMIME。
+	if ext.eightBit && eightBit {
+		b.WriteString(" BODY=8BITMIME")
+	}
+
+	if !isASCII(from) || !allASCII(recipients) {
+		if !ext.smtputf8 {
+			return "", fmt.Errorf("%w: %w", ErrSMTPUTF8NotSupported,
+				newSMTPError(553, "5.6.7 Non-ASCII addresses not permitted for that sender/recipient"))
+		}
+
+		b.WriteString(" SMTPUTF8")
+	}
+
+	if opts.RequireTLS {
+		b.WriteString(" REQUIRETLS")
+	}
+
+	if ext.dsn && opts.DSN != nil {
+		if opts.DSN.Return != "" {
+			b.WriteString(" RET=" + strings.ToUpper(opts.DSN.Return))
+		}
+
+		if opts.DSN.EnvelopeID != "" {
+			b.WriteString(" ENVID=" + xtext(opts.DSN.EnvelopeID))
+		}
+	}
+
+	cmd = b.String()
+
+	return
+}
+
+// rcptCommand 返回 RCPT TO 命令。
+func (ext extensions) rcptCommand(addr string, opts EnvelopeOptions) string {
+	cmd := "RCPT TO:<" + addr + ">"
+
+	if !ext.dsn || opts.DSN == nil {
+		return cmd
+	}
+
+	if len(opts.DSN.Notify) > 0 {
+		cmd += " NOTIFY=" + strings.ToUpper(strings.Join(opts.DSN.Notify, ","))
+	}
+
+	// 非 ASCII 地址需要使用 RFC 6533 的 utf-8 类型，这里不发送。
+	if opts.DSN.OriginalRecipient && isASCII(addr) {
+		cmd += " ORCPT=rfc822;" + xtext(addr)
+	}
+
+	return cmd
+}
+
+// xtext 按 RFC 3461 第 4 节编码参数值：`+`、`=` 及非可打印 ASCII 字符编码为 `+HH`。
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func validateAddress(addr string) error {
+	if strings.ContainsAny(addr, "\r\n") {
+		return fmt.Errorf("%w: %q", errInvalidAddress, addr)
+	}
+
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func allASCII(addrs []string) bool {
+	for _, addr := range addrs {
+		if !isASCII(addr) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,117 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/smtptest"
+)
+
+func TestMailCommand(t *testing.T) {
+	msg := []byte("Subject: test\r\n\r\nhello\r\n")
+	all := extensions{tls: true, smtputf8: true, eightBit: true, dsn: true, requireTLS: true, hasSize: true, size: 1000}
+
+	cmd, err := extensions{}.mailCommand("sender@example.com", []string{"user@example.com"}, msg, EnvelopeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "MAIL FROM:<sender@example.com>", cmd)
+
+	opts := EnvelopeOptions{
+		DSN:        &DSN{Notify: []string{DSNNotifyFailure, "delay"}, Return: "hdrs", EnvelopeID: "QQ314159=+", OriginalRecipient: true},
+		RequireTLS: true,
+	}
+
+	cmd, err = all.mailCommand("sender@example.com", []string{"user@example.com"}, msg, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "MAIL FROM:<sender@example.com> SIZE=24 REQUIRETLS RET=HDRS ENVID=QQ314159+3D+2B", cmd)
+	assert.Equal(t, "RCPT TO:<user+foo@example.com> NOTIFY=FAILURE,DELAY ORCPT=rfc822;user+2Bfoo@example.com", all.rcptCommand("user+foo@example.com", opts))
+	assert.Equal(t, "RCPT TO:<用户@例子.测试> NOTIFY=FAILURE,DELAY", all.rcptCommand("用户@例子.测试", opts))
+	assert.Equal(t, "RCPT TO:<user@example.com>", extensions{}.rcptCommand("user@example.com", opts))
+
+	// 8 位字符及非 ASCII 地址。
+	cmd, err = all.mailCommand("发件人@example.com", []string{"user@example.com"}, []byte("Subject: 你好\r\n\r\n"), EnvelopeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "MAIL FROM:<发件人@example.com> SIZE=19 BODY=8BITMIME SMTPUTF8", cmd)
+
+	_, err = extensions{}.mailCommand("sender@example.com", []string{"用户@example.com"}, msg, EnvelopeOptions{})
+	assert.True(t, errors.Is(err, ErrSMTPUTF8NotSupported))
+	e, ok := IsSMTPError(err)
+	assert.True(t, ok)
+	assert.True(t, e.Permanent())
+
+	// SIZE
+	_, err = extensions{hasSize: true, size: 10}.mailCommand("sender@example.com", nil, msg, EnvelopeOptions{})
+	assert.True(t, errors.Is(err, ErrMessageTooLarge))
+	e, _ = IsSMTPError(err)
+	assert.Equal(t, "5.3.4", e.EnhancedCode)
+
+	// REQUIRETLS
+	_, err = extensions{requireTLS: true}.mailCommand("sender@example.com", nil, msg, EnvelopeOptions{RequireTLS: true})
+	assert.True(t, errors.Is(err, ErrRequireTLSNotSupported))
+	_, err = extensions{tls: true}.mailCommand("sender@example.com", nil, msg, EnvelopeOptions{RequireTLS: true})
+	assert.True(t, errors.Is(err, ErrRequireTLSNotSupported))
+
+	_, err = all.mailCommand("sender@example.com\r\nRCPT TO:<x@example.com>", nil, msg, EnvelopeOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestClientExtensions(t *testing.T) {
+	s, cfg := newTestServer(t, smtptest.WithExtensions("PIPELINING", "SIZE 100000", "8BITMIME", "SMTPUTF8", "DSN"))
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	composer := testComposer("user@example.com", "unknown@example.com", "用户@example.com").
+		WithDSN(DSN{Notify: []string{DSNNotifyNever}, Return: DSNReturnHeaders})
+
+	report, err := client.SendWithReport(context.Background(), composer)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user@example.com", "用户@example.com"}, report.Accepted())
+	assert.Len(t, s.Messages(), 1)
+
+	mail := commandLines(s, "MAIL")
+	assert.Len(t, mail, 1)
+	assert.Regexp(t, `^MAIL FROM:<sender@example.com> SIZE=\d+ SMTPUTF8 RET=HDRS$`, mail[0])
+	assert.Equal(t, []string{
+		"RCPT TO:<user@example.com> NOTIFY=NEVER",
+		"RCPT TO:<unknown@example.com> NOTIFY=NEVER",
+		"RCPT TO:<用户@example.com> NOTIFY=NEVER",
+	}, commandLines(s, "RCPT"))
+
+	// 服务器不支持 REQUIRETLS，邮件不发送，连接仍然可用。
+	err = client.Send(context.Background(), testComposer("user@example.com").WithRequireTLS())
+	assert.True(t, errors.Is(err, ErrRequireTLSNotSupported))
+	assert.Len(t, commandLines(s, "MAIL"), 1)
+
+	assert.Nil(t, client.Send(context.Background(), testComposer("user@example.com")))
+	assert.Equal(t, 1, s.Connections())
+
+	// 超过 SIZE 限制。
+	s2, cfg := newTestServer(t, smtptest.WithExtensions("SIZE 10"))
+	err = SendmailWithComposer(cfg, testComposer("user@example.com"))
+	assert.True(t, errors.Is(err, ErrMessageTooLarge))
+	assert.Empty(t, commandLines(s2, "MAIL"))
+}
+
+func TestQueueEnvelopeOptions(t *testing.T) {
+	s, cfg := newTestServer(t, smtptest.WithExtensions("DSN"))
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	q, err := NewQueue(filepath.Join(t.TempDir(), "queue.db"), client, WithQueueBackoff(50*time.Millisecond, 100*time.Millisecond))
+	assert.Nil(t, err)
+
+	_, err = q.Enqueue(testComposer("user@example.com").WithDSN(DSN{EnvelopeID: "id-1", Notify: []string{DSNNotifySuccess}}))
+	assert.Nil(t, err)
+
+	waitForQueue(t, q, func(s QueueStats) bool { return s.Delivered == 1 })
+	assert.Nil(t, q.Shutdown(context.Background()))
+
+	assert.Equal(t, []string{"MAIL FROM:<sender@example.com> ENVID=id-1"}, commandLines(s, "MAIL"))
+	assert.Equal(t, []string{"RCPT TO:<user@example.com> NOTIFY=SUCCESS"}, commandLines(s, "RCPT"))
+}
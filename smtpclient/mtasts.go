@@ -0,0 +1,300 @@
+package smtpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+// MTA-STS 策略模式（RFC 8461 第 3.2 节）。
+const (
+	MTASTSModeEnforce = "enforce"
+	MTASTSModeTesting = "testing"
+	MTASTSModeNone    = "none"
+)
+
+const (
+	// mtastsMaxPolicySize 是策略文件的最大长度（RFC 8461 第 3.3 节建议不超过 64 KB）。
+	mtastsMaxPolicySize = 64 << 10
+
+	// mtastsMaxAge 是策略的最长缓存时间（RFC 8461 第 3.2 节）。
+	mtastsMaxAge = 31557600 * time.Second
+)
+
+var (
+	// ErrInvalidMTASTSPolicy 表示 MTA-STS 策略文件格式错误。
+	ErrInvalidMTASTSPolicy = errors.New("smtpclient: invalid MTA-STS policy")
+
+	// reMTASTSID 匹配 `_mta-sts` TXT 记录中的 id（RFC 8461 第 3.1 节）。
+	reMTASTSID = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
+)
+
+// MTASTSPolicy 是域名的 MTA-STS 策略（RFC 8461）。
+type MTASTSPolicy struct {
+	// ID 是 `_mta-sts.<domain>` TXT 记录中的 id，用于判断策略是否有更新。
+	ID string
+
+	Mode   string
+	MX     []string // 允许的 MX 主机名，例如 `mx.example.com`、`*.example.net`
+	MaxAge time.Duration
+
+	fetchedAt time.Time
+}
+
+// ParseMTASTSPolicy 解析 MTA-STS 策略文件（RFC 8461 第 3.2 节）。
+func ParseMTASTSPolicy(data []byte) (p *MTASTSPolicy, err error) {
+	p = &MTASTSPolicy{}
+
+	var version string
+	hasMaxAge := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			p.Mode = value
+		case "mx":
+			p.MX = append(p.MX, strings.ToLower(strings.TrimSuffix(value, ".")))
+		case "max_age":
+			seconds, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || len(value) > 10 {
+				return nil, fmt.Errorf("%w: invalid max_age: %s", ErrInvalidMTASTSPolicy, value)
+			}
+
+			p.MaxAge = time.Duration(min(seconds, uint64(mtastsMaxAge/time.Second))) * time.Second
+			hasMaxAge = true
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if version != "STSv1" {
+		return nil, fmt.Errorf("%w: unsupported version: %q", ErrInvalidMTASTSPolicy, version)
+	}
+
+	switch p.Mode {
+	case MTASTSModeEnforce, MTASTSModeTesting:
+		if len(p.MX) == 0 {
+			return nil, fmt.Errorf("%w: no mx", ErrInvalidMTASTSPolicy)
+		}
+	case MTASTSModeNone:
+	default:
+		return nil, fmt.Errorf("%w: invalid mode: %q", ErrInvalidMTASTSPolicy, p.Mode)
+	}
+
+	if !hasMaxAge {
+		return nil, fmt.Errorf("%w: no max_age", ErrInvalidMTASTSPolicy)
+	}
+
+	return
+}
+
+// MatchMX 检查 MX 主机名是否在策略允许的列表中。
+func (p *MTASTSPolicy) MatchMX(host string) bool {
+	return matchMX(p.MX, host)
+}
+
+// matchMX 检查 host 是否匹配 patterns 中的任何一个。通配符 `*.` 只匹配最左边的一级域名，
+// 例如 `*.example.com` 匹配 `mx.example.com`，但不匹配 `a.mx.example.com` 和 `example.com`。
+func matchMX(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if label, rest, found := strings.Cut(host, "."); found && label != "" && rest == suffix {
+				return true
+			}
+
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *MTASTSPolicy) expired(now time.Time) bool {
+	return now.After(p.fetchedAt.Add(p.MaxAge))
+}
+
+// MTASTS 查询并缓存域名的 MTA-STS 策略，可以被多个 goroutine 同时使用。
+//
+// MTASTS.TLSPolicy 可以作为 MXDeliverer 的 TLS 策略，参考 WithTLSPolicy。
+type MTASTS struct {
+	resolver dnsutils.Resolver
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*MTASTSPolicy
+}
+
+// NewMTASTS 创建 MTASTS。resolver 为 nil 时使用 net.DefaultResolver；
+// client 用于下载策略文件，为 nil 时使用 http.DefaultClient（不会跟随重定向）。
+func NewMTASTS(resolver dnsutils.Resolver, client *http.Client) *MTASTS {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// RFC 8461 第 3.3 节：不能跟随 HTTP 重定向。
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &MTASTS{
+		resolver: resolver,
+		client:   &c,
+		cache:    make(map[string]*MTASTSPolicy),
+	}
+}
+
+// Lookup 返回域名的 MTA-STS 策略，没有策略时返回 nil。
+//
+// 按 RFC 8461 第 5.1 节的规定，DNS 查询或下载策略失败时使用缓存中未过期的策略，
+// 没有缓存时视为没有策略，此时 err 不为 nil。
+func (m *MTASTS) Lookup(ctx context.Context, domain string) (p *MTASTSPolicy, err error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	m.mu.Lock()
+	cached := m.cache[domain]
+	m.mu.Unlock()
+
+	if cached != nil && cached.expired(time.Now()) {
+		cached = nil
+	}
+
+	id, err := m.lookupID(ctx, domain)
+	if err != nil || id == "" {
+		return cached, err
+	}
+
+	if cached != nil && cached.ID == id {
+		return cached, nil
+	}
+
+	p, err = m.fetch(ctx, domain)
+	if err != nil {
+		return cached, err
+	}
+
+	p.ID = id
+	p.fetchedAt = time.Now()
+
+	m.mu.Lock()
+	m.cache[domain] = p
+	m.mu.Unlock()
+
+	return
+}
+
+// lookupID 查询 `_mta-sts.<domain>` TXT 记录中的 id，没有记录时返回空字符串。
+func (m *MTASTS) lookupID(ctx context.Context, domain string) (id string, err error) {
+	txts, err := m.resolver.LookupTXT(ctx, "_mta-sts."+domain)
+	if err != nil {
+		if dnsutils.IsNotFound(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var records []string
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, "v=STSv1;") || txt == "v=STSv1" {
+			records = append(records, txt)
+		}
+	}
+
+	// RFC 8461 第 3.1 节：有多条记录时视为没有策略。
+	if len(records) != 1 {
+		return
+	}
+
+	for _, field := range strings.Split(records[0], ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		if key == "id" && reMTASTSID.MatchString(value) {
+			return value, nil
+		}
+	}
+
+	return
+}
+
+// fetch 下载 `https://mta-sts.<domain>/.well-known/mta-sts.txt` 并解析。
+func (m *MTASTS) fetch(ctx context.Context, domain string) (p *MTASTSPolicy, err error) {
+	url := "https://mta-sts." + domain + "/.well-known/mta-sts.txt"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("smtpclient: failed in fetching MTA-STS policy of %s: %w", domain, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("smtpclient: failed in fetching MTA-STS policy of %s: %s", domain, resp.Status)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return nil, fmt.Errorf("%w: unexpected content type: %s", ErrInvalidMTASTSPolicy, resp.Header.Get("Content-Type"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, mtastsMaxPolicySize+1))
+	if err != nil {
+		return
+	}
+
+	if len(data) > mtastsMaxPolicySize {
+		return nil, fmt.Errorf("%w: policy is too large", ErrInvalidMTASTSPolicy)
+	}
+
+	return ParseMTASTSPolicy(data)
+}
+
+// TLSPolicy 返回域名的 TLS 策略：策略模式为 enforce 时要求使用经过验证的 TLS 连接，
+// 并且只投递到策略允许的 MX 主机；其它情况使用 opportunistic TLS。
+func (m *MTASTS) TLSPolicy(ctx context.Context, domain string) (policy TLSPolicy, err error) {
+	p, _ := m.Lookup(ctx, domain)
+	if p == nil || p.Mode != MTASTSModeEnforce {
+		return
+	}
+
+	policy = TLSPolicy{Mode: TLSRequire, MX: p.MX}
+
+	return
+}
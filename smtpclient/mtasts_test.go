@@ -0,0 +1,137 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+func TestParseMTASTSPolicy(t *testing.T) {
+	p, err := ParseMTASTSPolicy([]byte("version: STSv1\r\nmode: enforce\r\nmx: mx1.example.com\r\nmx: *.example.net.\r\nmax_age: 86400\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, MTASTSModeEnforce, p.Mode)
+	assert.Equal(t, []string{"mx1.example.com", "*.example.net"}, p.MX)
+	assert.Equal(t, 24*time.Hour, p.MaxAge)
+
+	assert.True(t, p.MatchMX("MX1.example.com."))
+	assert.True(t, p.MatchMX("mx.example.net"))
+	assert.False(t, p.MatchMX("example.net"))
+	assert.False(t, p.MatchMX("a.mx.example.net"))
+	assert.False(t, p.MatchMX("mx2.example.com"))
+
+	p, err = ParseMTASTSPolicy([]byte("version: STSv1\nmode: none\nmax_age: 9999999999\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, mtastsMaxAge, p.MaxAge)
+
+	invalid := []string{
+		"mode: enforce\nmx: mx.example.com\nmax_age: 86400\n",
+		"version: STSv1\nmode: enforce\nmax_age: 86400\n",
+		"version: STSv1\nmode: reject\nmx: mx.example.com\nmax_age: 86400\n",
+		"version: STSv1\nmode: testing\nmx: mx.example.com\n",
+		"version: STSv1\nmode: testing\nmx: mx.example.com\nmax_age: -1\n",
+	}
+
+	for _, s := range invalid {
+		_, err = ParseMTASTSPolicy([]byte(s))
+		assert.True(t, errors.Is(err, ErrInvalidMTASTSPolicy), s)
+	}
+}
+
+func TestMTASTS(t *testing.T) {
+	var requests atomic.Int32
+	var policy atomic.Pointer[string]
+	setPolicy := func(s string) { policy.Store(&s) }
+	setPolicy("version: STSv1\nmode: enforce\nmx: mx.example.com\nmax_age: 86400\n")
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		switch r.Host {
+		case "mta-sts.example.com":
+			if *policy.Load() == "" {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(*policy.Load()))
+		case "mta-sts.example.net":
+			http.Redirect(w, r, "https://mta-sts.example.com/.well-known/mta-sts.txt", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(*policy.Load()))
+		}
+	}))
+	defer srv.Close()
+
+	// 所有请求都发送到测试服务器，不验证证书的主机名。
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	resolver := &dnsutils.MemoryResolver{
+		TXT: map[string][]string{
+			"_mta-sts.example.com": {"v=STSv1; id=20260101"},
+			"_mta-sts.example.net": {"v=STSv1; id=1"},
+			"_mta-sts.example.org": {"v=STSv1; id=1"},
+			"_mta-sts.example.edu": {"v=STSv1; id=1", "v=STSv1; id=2"},
+		},
+	}
+
+	m := NewMTASTS(resolver, client)
+	ctx := context.Background()
+
+	p, err := m.Lookup(ctx, "Example.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, "20260101", p.ID)
+	assert.Equal(t, []string{"mx.example.com"}, p.MX)
+
+	tp, err := m.TLSPolicy(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, TLSPolicy{Mode: TLSRequire, MX: []string{"mx.example.com"}}, tp)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// id 变化时重新下载策略。
+	setPolicy("version: STSv1\nmode: testing\nmx: mx.example.com\nmax_age: 86400\n")
+	resolver.TXT["_mta-sts.example.com"] = []string{"v=STSv1; id=20260102"}
+	tp, err = m.TLSPolicy(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, TLSPolicy{}, tp)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// 下载失败时使用缓存的策略。
+	resolver.TXT["_mta-sts.example.com"] = []string{"v=STSv1; id=20260103"}
+	setPolicy("")
+	p, err = m.Lookup(ctx, "example.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, "20260102", p.ID)
+
+	// 没有 TXT 记录时使用缓存的策略。
+	delete(resolver.TXT, "_mta-sts.example.com")
+	p, err = m.Lookup(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, MTASTSModeTesting, p.Mode)
+
+	// 不跟随重定向、Content-Type 错误、多条 TXT 记录、没有 TXT 记录。
+	for _, domain := range []string{"example.net", "example.org", "example.edu", "example.info"} {
+		tp, err = m.TLSPolicy(ctx, domain)
+		assert.Nil(t, err, domain)
+		assert.Equal(t, TLSPolicy{}, tp, domain)
+
+		p, _ = m.Lookup(ctx, domain)
+		assert.Nil(t, p, domain)
+	}
+}
@@ -0,0 +1,496 @@
+package smtpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/iredmail/goutils/dnsutils"
+)
+
+// TLSMode 是直接投递到 MX 主机时使用 STARTTLS 的方式。
+type TLSMode int
+
+const (
+	// TLSOpportunistic 在服务器支持时使用 STARTTLS，但不验证证书（RFC 7435）；
+	// 服务器不支持或 TLS 握手失败时使用明文连接。
+	TLSOpportunistic TLSMode = iota
+
+	// TLSRequire 要求使用 STARTTLS 并验证证书，否则不投递到该 MX 主机。
+	TLSRequire
+
+	// TLSDisabled 不使用 STARTTLS。
+	TLSDisabled
+)
+
+// DefaultMXPort 是投递到 MX 主机使用的端口。
+const DefaultMXPort = "25"
+
+var (
+	// ErrNullMX 表示收件人域名声明不接收邮件（RFC 7505 的 Null MX 记录）。
+	ErrNullMX = errors.New("smtpclient: domain does not accept mail")
+
+	// ErrNoMXHost 表示没有可以投递的 MX 主机，例如所有主机都不在 MTA-STS 策略允许的列表中。
+	ErrNoMXHost = errors.New("smtpclient: no usable mail exchanger")
+
+	// ErrTLSRequired 表示 TLS 策略要求使用 TLS，但 MX 主机不支持 STARTTLS 或证书验证失败。
+	ErrTLSRequired = errors.New("smtpclient: TLS is required but not available")
+)
+
+// TLSPolicy 是收件人域名的 TLS 策略。
+type TLSPolicy struct {
+	Mode TLSMode
+
+	// MX 是允许投递的 MX 主机名（与 MTA-STS 策略的 mx 字段格式相同，支持 `*.example.com`），
+	// 为空时不限制。只在 Mode 为 TLSRequire 时生效。
+	MX []string
+}
+
+// TLSPolicyFunc 返回收件人域名的 TLS 策略，例如 MTASTS.TLSPolicy。返回错误时不投递该域名的邮件。
+type TLSPolicyFunc func(ctx context.Context, domain string) (TLSPolicy, error)
+
+// DomainResult 是投递到一个收件人域名的结果。
+type DomainResult struct {
+	Domain     string
+	Recipients []string
+
+	// MX 是接收邮件的 MX 主机，投递失败时为最后尝试的主机。
+	MX string
+
+	// TLS 表示使用了 TLS 连接，Verified 表示证书通过了验证（PKIX 或 DANE）。
+	TLS      bool
+	Verified bool
+
+	// Report 是 MX 主机接收邮件的结果，没有发送邮件时为 nil。
+	Report *DeliveryReport
+
+	// Err 是投递失败的原因。MX 主机返回的错误为 *SMTPError，Permanent 为 true 时不应重试。
+	Err error
+}
+
+type MXOption func(d *MXDeliverer)
+
+// WithResolver 设置查询 MX、A、AAAA 记录使用的 Resolver，默认为 net.DefaultResolver。
+func WithResolver(r dnsutils.Resolver) MXOption {
+	return func(d *MXDeliverer) {
+		d.resolver = r
+	}
+}
+
+// WithTLSPolicy 设置获取收件人域名 TLS 策略的函数，默认对所有域名使用 TLSOpportunistic。
+func WithTLSPolicy(f TLSPolicyFunc) MXOption {
+	return func(d *MXDeliverer) {
+		d.tlsPolicy = f
+	}
+}
+
+// WithTLSALookup 设置查询 TLSA 记录的函数，用于 DANE 验证（RFC 7672）。
+// MX 主机有 TLSA 记录时要求使用 TLS 并按 TLSA 记录验证证书，优先于 TLS 策略。
+func WithTLSALookup(f TLSALookupFunc) MXOption {
+	return func(d *MXDeliverer) {
+		d.tlsaLookup = f
+	}
+}
+
+// WithTLSConfig 设置 STARTTLS 使用的 tls.Config，例如自定义 RootCAs 或客户端证书。
+// ServerName 及证书验证方式由 MXDeliverer 根据 TLS 策略设置。
+func WithTLSConfig(c *tls.Config) MXOption {
+	return func(d *MXDeliverer) {
+		d.tlsConfig = c
+	}
+}
+
+// MXDeliverer 不经过中继服务器，直接将邮件投递到收件人域名的 MX 主机，可以被多个 goroutine 同时使用。
+//
+// 收件人按域名分组，每个域名：
+//
+//   - 查询 MX 记录，按优先级依次尝试（优先级相同的主机随机排序）；没有 MX 记录时使用域名的
+//     A/AAAA 记录（RFC 5321 第 5.1 节）；Null MX 记录（RFC 7505）表示不接收邮件。
+//   - 连接失败、TLS 策略无法满足或返回临时错误（4xx）时尝试下一个主机，返回永久错误（5xx）时停止。
+//   - 根据 TLS 策略（参考 WithTLSPolicy、WithTLSALookup）使用 STARTTLS。
+type MXDeliverer struct {
+	cfg        Config
+	resolver   dnsutils.Resolver
+	tlsPolicy  TLSPolicyFunc
+	tlsaLookup TLSALookupFunc
+	tlsConfig  *tls.Config
+}
+
+// NewMXDeliverer 根据 cfg 创建 MXDeliverer，只使用 cfg 中的 Port（默认为 DefaultMXPort）、
+// Timeout、HeloName、LocalAddr、Network 和 Dialer。
+func NewMXDeliverer(cfg Config, opts ...MXOption) *MXDeliverer {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.Port == "" {
+		cfg.Port = DefaultMXPort
+	}
+
+	d := &MXDeliverer{
+		cfg:      cfg,
+		resolver: net.DefaultResolver,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Send 投递 composer 编写的邮件，收件人包括 To、Cc 和 Bcc。只在无法生成邮件时返回错误，
+// 每个域名的投递结果见 DomainResult。
+func (d *MXDeliverer) Send(ctx context.Context, composer *Composer) (results []DomainResult, err error) {
+	msg, err := composer.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed in building email message from composer: %v", err)
+	}
+
+	var recipients []string
+	for _, addr := range composer.GetAllRecipients() {
+		recipients = append(recipients, addr.Address)
+	}
+
+	results = d.Deliver(ctx, composer.from.Address, recipients, msg, composer.envelope)
+
+	return
+}
+
+// Deliver 将邮件投递到所有收件人的 MX 主机，按收件人域名首次出现的顺序返回每个域名的结果。
+func (d *MXDeliverer) Deliver(ctx context.Context, from string, recipients []string, msg []byte, opts EnvelopeOptions) (results []DomainResult) {
+	for _, r := range groupByDomain(recipients) {
+		if r.Err == nil {
+			r = d.deliverDomain(ctx, r, from, msg, opts)
+		}
+
+		results = append(results, r)
+	}
+
+	return
+}
+
+// groupByDomain 按域名（小写）将收件人分组。无效的地址各自单独返回，Err 不为 nil。
+func groupByDomain(recipients []string) (results []DomainResult) {
+	index := make(map[string]int)
+
+	for _, addr := range recipients {
+		at := strings.LastIndex(addr, "@")
+		if at <= 0 || at == len(addr)-1 {
+			results = append(results, DomainResult{
+				Recipients: []string{addr},
+				Err: fmt.Errorf("smtpclient: invalid recipient address %q: %w", addr,
+					newSMTPError(553, "5.1.3 Bad recipient address syntax")),
+			})
+
+			continue
+		}
+
+		domain := strings.ToLower(addr[at+1:])
+		if i, found := index[domain]; found {
+			results[i].Recipients = append(results[i].Recipients, addr)
+
+			continue
+		}
+
+		index[domain] = len(results)
+		results = append(results, DomainResult{Domain: domain, Recipients: []string{addr}})
+	}
+
+	return
+}
+
+func (d *MXDeliverer) deliverDomain(ctx context.Context, r DomainResult, from string, msg []byte, opts EnvelopeOptions) DomainResult {
+	var policy TLSPolicy
+	if d.tlsPolicy != nil {
+		var err error
+		if policy, err = d.tlsPolicy(ctx, r.Domain); err != nil {
+			r.Err = fmt.Errorf("smtpclient: failed in getting TLS policy of %s: %w", r.Domain, err)
+
+			return r
+		}
+	}
+
+	// RFC 8689 第 4.2.1 节：REQUIRETLS 要求验证 MX 主机的证书。
+	if opts.RequireTLS {
+		policy.Mode = TLSRequire
+	}
+
+	hosts, implicit, err := d.lookupMX(ctx, r.Domain)
+	if err != nil {
+		r.Err = err
+
+		return r
+	}
+
+	var lastErr error
+	for _, host := range hosts {
+		if policy.Mode == TLSRequire && len(policy.MX) > 0 && !matchMX(policy.MX, host) {
+			lastErr = fmt.Errorf("%w: %s is not allowed by the TLS policy of %s", ErrNoMXHost, host, r.Domain)
+
+			continue
+		}
+
+		ips, err := d.lookupIP(ctx, host)
+		if err != nil {
+			// RFC 5321 第 5.1 节：没有 MX 记录并且域名没有 A/AAAA 记录时，邮件无法投递。
+			if implicit && dnsutils.IsNotFound(err) {
+				err = fmt.Errorf("smtpclient: domain %s has no MX or address records: %w", r.Domain,
+					newSMTPError(550, "5.1.2 Recipient domain not found"))
+			}
+
+			lastErr = err
+
+			continue
+		}
+
+		for _, ip := range ips {
+			r.MX = host
+			r.TLS, r.Verified = false, false
+
+			r.Report, err = d.deliverHost(ctx, &r, host, ip, policy, from, msg, opts)
+			if e, ok := IsSMTPError(err); err == nil || (ok && e.Permanent()) {
+				r.Err = err
+
+				return r
+			}
+
+			lastErr = err
+
+			if ctx.Err() != nil {
+				r.Err = ctx.Err()
+
+				return r
+			}
+		}
+	}
+
+	r.Err = lastErr
+
+	return r
+}
+
+// lookupMX 返回按优先级排序的 MX 主机。domain 是 IP 地址字面量（例如 `[192.0.2.1]`）或者
+// 没有 MX 记录时，implicit 为 true，返回 domain 本身。
+func (d *MXDeliverer) lookupMX(ctx context.Context, domain string) (hosts []string, implicit bool, err error) {
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		return []string{domain}, true, nil
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return nil, false, fmt.Errorf("smtpclient: invalid domain %s: %v: %w", domain, err,
+			newSMTPError(553, "5.1.2 Bad destination system address"))
+	}
+
+	notfound, records, err := dnsutils.LookupMXWithResolver(ctx, d.resolver, asciiDomain)
+	if err != nil {
+		return nil, false, fmt.Errorf("smtpclient: failed in querying MX records of %s: %w", domain, err)
+	}
+
+	if notfound || len(records) == 0 {
+		return []string{asciiDomain}, true, nil
+	}
+
+	if len(records) == 1 && records[0].MX == "" {
+		return nil, false, fmt.Errorf("%w: %s: %w", ErrNullMX, domain,
+			newSMTPError(556, "5.1.10 Recipient address has null MX"))
+	}
+
+	// RFC 5321 第 5.1 节：优先级相同的主机随机排序，以平衡负载。
+	for i := 0; i < len(records); {
+		j := i
+		for j < len(records) && records[j].Priority == records[i].Priority {
+			j++
+		}
+
+		group := records[i:j]
+		rand.Shuffle(len(group), func(a, b int) { group[a], group[b] = group[b], group[a] })
+
+		i = j
+	}
+
+	for _, rec := range records {
+		if rec.MX != "" {
+			hosts = append(hosts, rec.MX)
+		}
+	}
+
+	return
+}
+
+// lookupIP 返回主机的 IP 地址，host 可以是 IP 地址字面量。
+func (d *MXDeliverer) lookupIP(ctx context.Context, host string) (ips []string, err error) {
+	if literal, ok := strings.CutPrefix(host, "["); ok {
+		literal = strings.TrimPrefix(strings.TrimSuffix(literal, "]"), "IPv6:")
+		if net.ParseIP(literal) == nil {
+			return nil, fmt.Errorf("smtpclient: invalid address literal %s: %w", host,
+				newSMTPError(553, "5.1.2 Bad destination system address"))
+		}
+
+		return []string{literal}, nil
+	}
+
+	network := "ip"
+	switch d.cfg.network() {
+	case "tcp4":
+		network = "ip4"
+	case "tcp6":
+		network = "ip6"
+	}
+
+	addrs, err := d.resolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, fmt.Errorf("smtpclient: failed in resolving MX host %s: %w", host, err)
+	}
+
+	for _, ip := range addrs {
+		ips = append(ips, ip.String())
+	}
+
+	return
+}
+
+// deliverHost 连接 MX 主机的一个 IP 地址并发送邮件，同时更新 r 的 TLS 状态。
+func (d *MXDeliverer) deliverHost(ctx context.Context, r *DomainResult, host, ip string, policy TLSPolicy, from string, msg []byte, opts EnvelopeOptions) (report *DeliveryReport, err error) {
+	tlsConfig, required, verified, err := d.hostTLSConfig(ctx, host, policy)
+	if err != nil {
+		return
+	}
+
+	cn, err := d.connect(ctx, host, ip, tlsConfig, required)
+
+	// RFC 7435：opportunistic TLS 握手失败时使用明文连接重试。
+	if errors.Is(err, errSTARTTLS) && !required {
+		cn, err = d.connect(ctx, host, ip, nil, false)
+	}
+
+	if err != nil {
+		return
+	}
+
+	r.TLS = cn.ext.tls
+	r.Verified = cn.ext.tls && verified
+
+	report = &DeliveryReport{From: from}
+	err = cn.withContext(ctx, d.cfg.Timeout, func() error {
+		return cn.sendMail(report, r.Recipients, newMessage(msg), opts, true)
+	})
+
+	if _, ok := IsSMTPError(err); (err != nil && !ok) || cn.broken {
+		cn.close()
+	} else {
+		cn.quit(d.cfg.Timeout)
+	}
+
+	return
+}
+
+// errSTARTTLS 表示 STARTTLS 命令或 TLS 握手失败。
+var errSTARTTLS = errors.New("smtpclient: STARTTLS failed")
+
+// hostTLSConfig 根据 TLS 策略及 TLSA 记录返回 STARTTLS 使用的 tls.Config，
+// 为 nil 时不使用 STARTTLS。required 表示必须使用 TLS，verified 表示会验证证书。
+func (d *MXDeliverer) hostTLSConfig(ctx context.Context, host string, policy TLSPolicy) (c *tls.Config, required, verified bool, err error) {
+	if policy.Mode == TLSDisabled {
+		return
+	}
+
+	if d.tlsConfig != nil {
+		c = d.tlsConfig.Clone()
+	} else {
+		c = &tls.Config{}
+	}
+
+	c.ServerName = host
+
+	// DANE 优先于其它 TLS 策略（RFC 8461 第 2 节）。
+	if d.tlsaLookup != nil {
+		records, err := d.tlsaLookup(ctx, host, d.cfg.Port)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("smtpclient: failed in querying TLSA records of %s: %w", host, err)
+		}
+
+		if len(records) > 0 {
+			// RFC 7672 第 2.2 节：没有可用的 TLSA 记录时仍然要求使用 TLS，但不验证证书。
+			c.InsecureSkipVerify = true
+
+			if usable := usableTLSA(records); len(usable) > 0 {
+				c.VerifyConnection = func(state tls.ConnectionState) error {
+					return verifyDANE(state, usable, host)
+				}
+
+				verified = true
+			}
+
+			return c, true, verified, nil
+		}
+	}
+
+	if policy.Mode == TLSRequire {
+		return c, true, true, nil
+	}
+
+	c.InsecureSkipVerify = true
+
+	return
+}
+
+// connect 连接 MX 主机并完成 EHLO 及 STARTTLS。出错时关闭连接。
+func (d *MXDeliverer) connect(ctx context.Context, host, ip string, tlsConfig *tls.Config, required bool) (cn *conn, err error) {
+	dialer, err := d.cfg.dialer()
+	if err != nil {
+		return
+	}
+
+	netConn, err := dialer.DialContext(ctx, d.cfg.network(), net.JoinHostPort(ip, d.cfg.Port))
+	if err != nil {
+		return
+	}
+
+	cn = &conn{netConn: netConn}
+
+	err = cn.withContext(ctx, d.cfg.Timeout, func() (err error) {
+		if cn.client, err = smtp.NewClient(netConn, host); err != nil {
+			return toSMTPError(err)
+		}
+
+		if err = cn.client.Hello(d.cfg.heloName()); err != nil {
+			return toSMTPError(err)
+		}
+
+		if tlsConfig != nil {
+			if ok, _ := cn.client.Extension("STARTTLS"); ok {
+				if err = cn.client.StartTLS(tlsConfig); err != nil {
+					err = fmt.Errorf("%w: %s: %w", errSTARTTLS, host, err)
+
+					if required {
+						return fmt.Errorf("%w: %w", ErrTLSRequired, err)
+					}
+
+					return
+				}
+			} else if required {
+				return fmt.Errorf("%w: %s does not support STARTTLS", ErrTLSRequired, host)
+			}
+		}
+
+		cn.ext = loadExtensions(cn.client)
+
+		return
+	})
+
+	if err != nil {
+		cn.close()
+		cn = nil
+	}
+
+	return
+}
@@ -0,0 +1,243 @@
+package smtpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/dnsutils"
+	"github.com/iredmail/goutils/smtptest"
+)
+
+func TestGroupByDomain(t *testing.T) {
+	results := groupByDomain([]string{"a@Example.com", "invalid", "b@example.net", "c@example.com", "@example.com"})
+	assert.Equal(t, 4, len(results))
+
+	assert.Equal(t, "example.com", results[0].Domain)
+	assert.Equal(t, []string{"a@Example.com", "c@example.com"}, results[0].Recipients)
+	assert.Equal(t, "example.net", results[2].Domain)
+
+	for _, i := range []int{1, 3} {
+		e, ok := IsSMTPError(results[i].Err)
+		assert.True(t, ok)
+		assert.True(t, e.Permanent())
+	}
+}
+
+func TestLookupMX(t *testing.T) {
+	resolver := &dnsutils.MemoryResolver{
+		MX: map[string][]*net.MX{
+			"example.com": {{Host: "mx3.example.com.", Pref: 20}, {Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 10}},
+			"null.test":   {{Host: ".", Pref: 0}},
+		},
+		Errors: map[string]error{"servfail.test": errors.New("server misbehaving")},
+	}
+
+	d := NewMXDeliverer(Config{}, WithResolver(resolver))
+	ctx := context.Background()
+
+	hosts, implicit, err := d.lookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.False(t, implicit)
+	assert.ElementsMatch(t, []string{"mx1.example.com", "mx2.example.com"}, hosts[:2])
+	assert.Equal(t, "mx3.example.com", hosts[2])
+
+	hosts, implicit, err = d.lookupMX(ctx, "example.net")
+	assert.Nil(t, err)
+	assert.True(t, implicit)
+	assert.Equal(t, []string{"example.net"}, hosts)
+
+	hosts, _, err = d.lookupMX(ctx, "例子.测试")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"xn--fsqu00a.xn--0zwm56d"}, hosts)
+
+	hosts, implicit, err = d.lookupMX(ctx, "[192.0.2.1]")
+	assert.Nil(t, err)
+	assert.True(t, implicit)
+	assert.Equal(t, []string{"[192.0.2.1]"}, hosts)
+
+	ips, err := d.lookupIP(ctx, "[IPv6:2001:db8::1]")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::1"}, ips)
+
+	_, err = d.lookupIP(ctx, "[invalid]")
+	assert.NotNil(t, err)
+
+	_, _, err = d.lookupMX(ctx, "null.test")
+	assert.True(t, errors.Is(err, ErrNullMX))
+	e, _ := IsSMTPError(err)
+	assert.Equal(t, 556, e.Code)
+
+	_, _, err = d.lookupMX(ctx, "servfail.test")
+	assert.ErrorContains(t, err, "server misbehaving")
+	_, ok := IsSMTPError(err)
+	assert.False(t, ok)
+}
+
+func TestMXDeliverer(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	resolver := &dnsutils.MemoryResolver{
+		MX: map[string][]*net.MX{
+			// mx1 没有监听端口，连接失败后尝试 mx2。
+			"example.com": {{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}},
+			"null.test":   {{Host: ".", Pref: 0}},
+			"down.test":   {{Host: "mx1.example.com.", Pref: 10}, {Host: "nonexistent.test.", Pref: 20}},
+		},
+		IP: map[string][]net.IP{
+			"mx1.example.com": {net.ParseIP("127.0.0.2")},
+			"mx2.example.com": {net.ParseIP("127.0.0.1")},
+			"example.net":     {net.ParseIP("127.0.0.1")},
+		},
+	}
+
+	d := NewMXDeliverer(Config{Port: cfg.Port, Network: "tcp4"}, WithResolver(resolver))
+
+	results, err := d.Send(context.Background(), testComposer(
+		"user@example.com", "unknown@example.com", "user@example.net", "user@null.test",
+		"user@nonexistent.test", "user@down.test", "invalid",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(results))
+
+	// example.com
+	r := results[0]
+	assert.Nil(t, r.Err)
+	assert.Equal(t, "mx2.example.com", r.MX)
+	assert.False(t, r.TLS)
+	assert.Equal(t, []string{"user@example.com"}, r.Report.Accepted())
+	assert.Equal(t, "unknown@example.com", r.Report.Rejected()[0].Address)
+	assert.Equal(t, "2.0.0 OK: queued", r.Report.Response)
+
+	// 没有 MX 记录时使用 A 记录。
+	assert.Nil(t, results[1].Err)
+	assert.Equal(t, "example.net", results[1].MX)
+	assert.Len(t, s.Messages(), 2)
+
+	assert.True(t, errors.Is(results[2].Err, ErrNullMX))
+
+	e, ok := IsSMTPError(results[3].Err)
+	assert.True(t, ok)
+	assert.Equal(t, "5.1.2", e.EnhancedCode)
+
+	// 所有 MX 主机都无法连接时返回临时错误。
+	assert.NotNil(t, results[4].Err)
+	_, ok = IsSMTPError(results[4].Err)
+	assert.False(t, ok)
+
+	assert.Equal(t, "", results[5].Domain)
+	assert.NotNil(t, results[5].Err)
+
+	// 永久错误时不尝试其它主机。
+	results = d.Deliver(context.Background(), "sender@example.com", []string{"unknown@example.com"}, []byte("Subject: test\r\n\r\n"), EnvelopeOptions{})
+	assert.True(t, errors.Is(results[0].Err, ErrAllRecipientsRejected))
+	assert.Nil(t, results[0].Report.Accepted())
+}
+
+func TestMXDelivererTLS(t *testing.T) {
+	ca := newTestCert(t, nil)
+	cert := newTestCert(t, &ca, "mx.example.com")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	_, srv := newTestServer(t, smtptest.WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}))
+
+	resolver := &dnsutils.MemoryResolver{
+		MX: map[string][]*net.MX{"example.com": {{Host: "mx.example.com.", Pref: 10}}},
+		IP: map[string][]net.IP{"mx.example.com": {net.ParseIP("127.0.0.1")}},
+	}
+
+	port := srv.Port
+	cfg := Config{Port: port}
+	msg := []byte("Subject: test\r\n\r\nhello\r\n")
+
+	deliver := func(opts ...MXOption) DomainResult {
+		d := NewMXDeliverer(cfg, append([]MXOption{WithResolver(resolver)}, opts...)...)
+
+		return d.Deliver(context.Background(), "sender@example.com", []string{"user@example.com"}, msg, EnvelopeOptions{})[0]
+	}
+
+	policy := func(p TLSPolicy) MXOption {
+		return WithTLSPolicy(func(context.Context, string) (TLSPolicy, error) { return p, nil })
+	}
+
+	tlsa := func(records ...TLSARecord) MXOption {
+		return WithTLSALookup(func(_ context.Context, host, p string) ([]TLSARecord, error) {
+			assert.Equal(t, "mx.example.com", host)
+			assert.Equal(t, port, p)
+
+			return records, nil
+		})
+	}
+
+	// opportunistic TLS 不验证证书。
+	r := deliver()
+	assert.Nil(t, r.Err)
+	assert.True(t, r.TLS)
+	assert.False(t, r.Verified)
+
+	r = deliver(policy(TLSPolicy{Mode: TLSDisabled}))
+	assert.Nil(t, r.Err)
+	assert.False(t, r.TLS)
+
+	// 要求验证证书。
+	r = deliver(policy(TLSPolicy{Mode: TLSRequire, MX: []string{"*.example.com"}}), WithTLSConfig(&tls.Config{RootCAs: roots}))
+	assert.Nil(t, r.Err)
+	assert.True(t, r.TLS)
+	assert.True(t, r.Verified)
+
+	r = deliver(policy(TLSPolicy{Mode: TLSRequire}))
+	assert.True(t, errors.Is(r.Err, ErrTLSRequired))
+	assert.Nil(t, r.Report)
+
+	r = deliver(policy(TLSPolicy{Mode: TLSRequire, MX: []string{"mx.example.net"}}), WithTLSConfig(&tls.Config{RootCAs: roots}))
+	assert.True(t, errors.Is(r.Err, ErrNoMXHost))
+
+	r = deliver(WithTLSPolicy(func(context.Context, string) (TLSPolicy, error) { return TLSPolicy{}, errors.New("policy error") }))
+	assert.ErrorContains(t, r.Err, "policy error")
+
+	// DANE
+	r = deliver(tlsa(sha256TLSA(TLSAUsageDANEEE, TLSASelectorSPKI, cert.Leaf)))
+	assert.Nil(t, r.Err)
+	assert.True(t, r.Verified)
+
+	r = deliver(tlsa(sha256TLSA(TLSAUsageDANETA, TLSASelectorCert, ca.Leaf)))
+	assert.Nil(t, r.Err)
+	assert.True(t, r.Verified)
+
+	r = deliver(tlsa(sha256TLSA(TLSAUsageDANEEE, TLSASelectorSPKI, ca.Leaf)))
+	assert.True(t, errors.Is(r.Err, ErrTLSRequired))
+	assert.True(t, errors.Is(r.Err, ErrDANEVerification))
+
+	// 没有可用的 TLSA 记录时要求使用 TLS，但不验证证书。
+	r = deliver(tlsa(TLSARecord{Usage: TLSAUsagePKIXEE}))
+	assert.Nil(t, r.Err)
+	assert.True(t, r.TLS)
+	assert.False(t, r.Verified)
+
+	// TLS 握手失败时使用明文连接重试。
+	_, srv = newTestServer(t, smtptest.WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}))
+	port, cfg.Port = srv.Port, srv.Port
+	r = deliver(WithTLSConfig(&tls.Config{MaxVersion: tls.VersionTLS12}))
+	assert.Nil(t, r.Err)
+	assert.False(t, r.TLS)
+
+	// 服务器不支持 STARTTLS。
+	_, srv = newTestServer(t)
+	port, cfg.Port = srv.Port, srv.Port
+	r = deliver(policy(TLSPolicy{Mode: TLSRequire}))
+	assert.True(t, errors.Is(r.Err, ErrTLSRequired))
+
+	r = deliver(tlsa(sha256TLSA(TLSAUsageDANEEE, TLSASelectorSPKI, cert.Leaf)))
+	assert.True(t, errors.Is(r.Err, ErrTLSRequired))
+
+	r = deliver()
+	assert.Nil(t, r.Err)
+	assert.False(t, r.TLS)
+}
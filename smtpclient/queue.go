@@ -0,0 +1,527 @@
+package smtpclient
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iredmail/goutils/logger"
+	"github.com/iredmail/goutils/sqlutils"
+)
+
+const (
+	DefaultQueueWorkers     = 2
+	DefaultQueueMaxAttempts = 15
+	DefaultQueueMinBackoff  = time.Minute
+	DefaultQueueMaxBackoff  = time.Hour
+
+	queueTable = "mail_queue"
+
+	queueStatusQueued  = "queued"
+	queueStatusSending = "sending"
+	queueStatusFailed  = "failed"
+)
+
+var ErrQueueClosed = errors.New("smtpclient: queue is closed")
+
+// BounceFunc 在邮件无法投递给某个收件人时被调用（永久错误，或者重试次数超过上限）。
+// err 是最后一次投递失败的原因，SMTP 服务器返回的错误为 *SMTPError。
+type BounceFunc func(m *QueuedMessage, recipient string, err error)
+
+type QueueOption func(q *Queue)
+
+// WithQueueWorkers 设置同时投递邮件的 goroutine 数量，默认为 DefaultQueueWorkers。
+func WithQueueWorkers(n int) QueueOption {
+	return func(q *Queue) {
+		q.workers = max(n, 1)
+	}
+}
+
+// WithQueueMaxAttempts 设置每封邮件最多投递的次数，默认为 DefaultQueueMaxAttempts。
+func WithQueueMaxAttempts(n int) QueueOption {
+	return func(q *Queue) {
+		q.maxAttempts = max(n, 1)
+	}
+}
+
+// WithQueueBackoff 设置重试的间隔时间。第 n 次重试的间隔为 `minBackoff * 2^(n-1)`，
+// 但不超过 maxBackoff。
+func WithQueueBackoff(minBackoff, maxBackoff time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.minBackoff = minBackoff
+		q.maxBackoff = max(minBackoff, maxBackoff)
+	}
+}
+
+// WithQueueBounce 设置邮件无法投递时的回调函数，例如用于通知管理员或发件人。
+func WithQueueBounce(fn BounceFunc) QueueOption {
+	return func(q *Queue) {
+		q.bounce = fn
+	}
+}
+
+func WithQueueLogger(l logger.Logger) QueueOption {
+	return func(q *Queue) {
+		q.logger = l
+	}
+}
+
+// QueuedMessage 是队列中的一封邮件。
+type QueuedMessage struct {
+	ID         int64
+	From       string
+	Recipients []string // 尚未投递成功的收件人
+	Message    []byte
+	Options    EnvelopeOptions
+
+	Attempts      int // 已投递的次数
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// QueueStats 是队列的统计信息。
+type QueueStats struct {
+	Queued   int // 等待投递的邮件（包括 Deferred）
+	Deferred int // 投递失败、等待重试的邮件
+	Sending  int // 正在投递的邮件
+	Failed   int // 数据无法解析、不再投递的邮件，需要管理员处理
+
+	// 以下为 Queue 创建后的累计数量（以收件人计），程序重启后清零。
+	Delivered int64
+	Bounced   int64
+}
+
+// Queue 是保存在 SQLite 数据库中的待发邮件队列，由后台 goroutine 通过 Client 投递。
+//
+// 临时错误（4xx、网络错误等）按指数退避的间隔重试，永久错误（5xx）或重试次数超过
+// 上限时调用 BounceFunc。程序退出前应调用 Shutdown，未投递的邮件会在下次创建
+// Queue 时继续投递。
+type Queue struct {
+	db     *sql.DB
+	client *Client
+	logger logger.Logger
+
+	workers     int
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	bounce      BounceFunc
+
+	delivered atomic.Int64
+	bounced   atomic.Int64
+
+	// wake 用于通知 worker 有新邮件。
+	wake chan struct{}
+
+	// draining 关闭后 worker 投递完已到期的邮件后退出。
+	draining  chan struct{}
+	closeOnce sync.Once
+	closed    atomic.Bool
+
+	// ctx 在 Shutdown 超时时被取消，中断正在进行的投递。
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewQueue 打开（或创建）pth 指定的 SQLite 数据库并启动后台投递。
+func NewQueue(pth string, client *Client, opts ...QueueOption) (q *Queue, err error) {
+	db, err := sqlutils.InitSQLiteDB(pth, nil, 0, 0)
+	if err != nil {
+		return
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            id              INTEGER PRIMARY KEY AUTOINCREMENT,
+            sender          TEXT NOT NULL DEFAULT '',
+            recipients      TEXT NOT NULL DEFAULT '[]',
+            message         BLOB NOT NULL,
+            status          TEXT NOT NULL DEFAULT '%s',
+            attempts        INTEGER NOT NULL DEFAULT 0,
+            last_error      TEXT NOT NULL DEFAULT '',
+            created_at      INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at INTEGER NOT NULL DEFAULT 0,
+            options         TEXT NOT NULL DEFAULT ''
+        ) STRICT;
+        CREATE INDEX IF NOT EXISTS idx_%s_status_next_attempt_at ON %s (status, next_attempt_at);`,
+		queueTable, queueStatusQueued, queueTable, queueTable,
+	))
+	if err != nil {
+		_ = db.Close()
+
+		return
+	}
+
+	// 程序上次退出时正在投递的邮件重新投递。
+	_, err = db.Exec(fmt.Sprintf(`UPDATE %s SET status = $1 WHERE status = $2`, queueTable),
+		queueStatusQueued, queueStatusSending)
+	if err != nil {
+		_ = db.Close()
+
+		return
+	}
+
+	q = &Queue{
+		db:          db,
+		client:      client,
+		workers:     DefaultQueueWorkers,
+		maxAttempts: DefaultQueueMaxAttempts,
+		minBackoff:  DefaultQueueMinBackoff,
+		maxBackoff:  DefaultQueueMaxBackoff,
+		wake:        make(chan struct{}, 1),
+		draining:    make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return
+}
+
+// Enqueue 将 composer 编写的邮件加入队列，返回邮件在队列中的 ID。
+func (q *Queue) Enqueue(composer *Composer) (id int64, err error) {
+	fillFromAddress(q.client.cfg, composer)
+
+	msg, err := composer.Bytes()
+	if err != nil {
+		return 0, fmt.Errorf("failed in building email message from composer: %v", err)
+	}
+
+	var recipients []string
+	for _, addr := range composer.GetAllRecipients() {
+		recipients = append(recipients, addr.Address)
+	}
+
+	return q.enqueue(composer.from.Address, recipients, msg, composer.envelope)
+}
+
+func (q *Queue) enqueue(from string, recipients []string, msg []byte, opts EnvelopeOptions) (id int64, err error) {
+	if q.closed.Load() {
+		return 0, ErrQueueClosed
+	}
+
+	if len(recipients) == 0 {
+		return 0, ErrNoRecipients
+	}
+
+	rcpts, err := json.Marshal(recipients)
+	if err != nil {
+		return
+	}
+
+	var options []byte
+	if opts.DSN != nil || opts.RequireTLS {
+		if options, err = json.Marshal(opts); err != nil {
+			return
+		}
+	}
+
+	now := time.Now().UnixMilli()
+
+	res, err := q.db.Exec(fmt.Sprintf(`
+		INSERT INTO %s (sender, recipients, message, created_at, next_attempt_at, options)
+		            VALUES ($1, $2, $3, $4, $4, $5)`, queueTable),
+		from, string(rcpts), msg, now, string(options),
+	)
+	if err != nil {
+		return
+	}
+
+	id, err = res.LastInsertId()
+
+	q.notify()
+
+	return
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stats 返回队列的统计信息。
+func (q *Queue) Stats() (stats QueueStats, err error) {
+	err = q.db.QueryRow(fmt.Sprintf(`
+		SELECT
+			COALESCE(SUM(status = $1), 0),
+			COALESCE(SUM(status = $1 AND attempts > 0), 0),
+			COALESCE(SUM(status = $2), 0),
+			COALESCE(SUM(status = $3), 0)
+		FROM %s`, queueTable),
+		queueStatusQueued, queueStatusSending, queueStatusFailed,
+	).Scan(&stats.Queued, &stats.Deferred, &stats.Sending, &stats.Failed)
+
+	stats.Delivered = q.delivered.Load()
+	stats.Bounced = q.bounced.Load()
+
+	return
+}
+
+// Shutdown 停止接收新邮件，投递完已到期（不包括等待重试）的邮件后关闭队列。
+//
+// 如果 ctx 在投递完成前结束，则中断正在进行的投递并返回 ctx.Err()。
+// 未投递的邮件保留在数据库中，下次创建 Queue 时继续投递。
+func (q *Queue) Shutdown(ctx context.Context) (err error) {
+	q.closeOnce.Do(func() {
+		q.closed.Store(true)
+		close(q.draining)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		err = ctx.Err()
+	}
+
+	q.cancel()
+
+	// 被中断的邮件下次继续投递。
+	_, _ = q.db.Exec(fmt.Sprintf(`UPDATE %s SET status = $1 WHERE status = $2`, queueTable),
+		queueStatusQueued, queueStatusSending)
+
+	if e := q.db.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for {
+		if q.ctx.Err() != nil {
+			return
+		}
+
+		m, err := q.claim()
+		if err != nil {
+			q.logError("failed in fetching message from queue: %v", err)
+		}
+
+		if m != nil {
+			q.deliver(m)
+
+			continue
+		}
+
+		// 没有到期的邮件。
+		select {
+		case <-q.draining:
+			return
+		default:
+		}
+
+		timer := time.NewTimer(q.nextWait())
+
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		case <-q.draining:
+		case <-q.ctx.Done():
+		}
+
+		timer.Stop()
+	}
+}
+
+// claim 取出一封到期的邮件并标记为正在投递。没有到期的邮件时返回 nil。
+//
+// 收件人或信封参数无法解析时将邮件标记为 failed 并返回错误，不投递不完整的邮件。
+func (q *Queue) claim() (m *QueuedMessage, err error) {
+	var rcpts, options string
+	var createdAt, nextAttemptAt int64
+
+	m = &QueuedMessage{}
+
+	err = q.db.QueryRow(fmt.Sprintf(`
+		UPDATE %s SET status = $1
+		WHERE id = (
+			SELECT id FROM %s
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+		)
+		RETURNING id, sender, recipients, message, attempts, last_error, created_at, next_attempt_at, options`,
+		queueTable, queueTable),
+		queueStatusSending, queueStatusQueued, time.Now().UnixMilli(),
+	).Scan(&m.ID, &m.From, &rcpts, &m.Message, &m.Attempts, &m.LastError, &createdAt, &nextAttemptAt, &options)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.CreatedAt = time.UnixMilli(createdAt)
+	m.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+
+	err = json.Unmarshal([]byte(rcpts), &m.Recipients)
+	if err == nil && options != "" {
+		err = json.Unmarshal([]byte(options), &m.Options)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("smtpclient: invalid message %d in queue: %v", m.ID, err)
+		q.fail(m.ID, err)
+
+		return nil, err
+	}
+
+	return
+}
+
+// fail 将无法投递的邮件标记为 failed，邮件保留在队列中由管理员处理。
+func (q *Queue) fail(id int64, reason error) {
+	_, err := q.db.Exec(fmt.Sprintf(`UPDATE %s SET status = $1, last_error = $2 WHERE id = $3`, queueTable),
+		queueStatusFailed, reason.Error(), id)
+	if err != nil {
+		q.logError("failed in marking message %d in queue as failed: %v", id, err)
+	}
+}
+
+// nextWait 返回距离下一封邮件到期的时间，最长为 minBackoff。
+func (q *Queue) nextWait() time.Duration {
+	wait := max(q.minBackoff, time.Second)
+
+	var next sql.NullInt64
+	err := q.db.QueryRow(fmt.Sprintf(`SELECT MIN(next_attempt_at) FROM %s WHERE status = $1`, queueTable),
+		queueStatusQueued).Scan(&next)
+
+	if err == nil && next.Valid {
+		wait = min(wait, max(time.Until(time.UnixMilli(next.Int64)), 0))
+	}
+
+	return wait
+}
+
+// backoff 返回第 attempts 次投递失败后的重试间隔。
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.minBackoff
+	for i := 1; i < attempts && d < q.maxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, q.maxBackoff)
+}
+
+// deliver 投递邮件，并根据结果删除、重试或退回邮件。
+func (q *Queue) deliver(m *QueuedMessage) {
+	report, err := q.client.send(q.ctx, m.From, m.Recipients, m.Message, m.Options, true)
+
+	if q.ctx.Err() != nil {
+		// Shutdown 超时，邮件保留在队列中，不计入投递次数。
+		return
+	}
+
+	m.Attempts++
+
+	results := make(map[string]RecipientResult)
+	for _, rcpt := range report.Recipients {
+		results[rcpt.Address] = rcpt
+	}
+
+	smtpErr, isSMTPErr := IsSMTPError(err)
+	if err != nil {
+		m.LastError = err.Error()
+	}
+
+	var retry []string
+	for _, rcpt := range m.Recipients {
+		// 被拒绝的收件人。
+		if r, found := results[rcpt]; found && !r.Accepted {
+			if r.Err.Permanent() {
+				q.doBounce(m, rcpt, r.Err)
+			} else {
+				retry = append(retry, rcpt)
+				m.LastError = r.Err.Error()
+			}
+
+			continue
+		}
+
+		switch {
+		case err == nil:
+			q.delivered.Add(1)
+		case isSMTPErr && smtpErr.Permanent():
+			// 例如发件人被拒绝，或者邮件内容被拒绝。
+			q.doBounce(m, rcpt, err)
+		default:
+			retry = append(retry, rcpt)
+		}
+	}
+
+	if len(retry) > 0 && m.Attempts >= q.maxAttempts {
+		for _, rcpt := range retry {
+			q.doBounce(m, rcpt, fmt.Errorf("too many delivery attempts (%d), last error: %s", m.Attempts, m.LastError))
+		}
+
+		retry = nil
+	}
+
+	if len(retry) == 0 {
+		if _, err = q.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, queueTable), m.ID); err != nil {
+			q.logError("failed in deleting message %d from queue: %v", m.ID, err)
+		}
+
+		return
+	}
+
+	rcpts, _ := json.Marshal(retry)
+	m.NextAttemptAt = time.Now().Add(q.backoff(m.Attempts))
+
+	_, err = q.db.Exec(fmt.Sprintf(`
+		UPDATE %s
+		SET status = $1, recipients = $2, attempts = $3, last_error = $4, next_attempt_at = $5
+		WHERE id = $6`, queueTable),
+		queueStatusQueued, string(rcpts), m.Attempts, m.LastError, m.NextAttemptAt.UnixMilli(), m.ID,
+	)
+	if err != nil {
+		q.logError("failed in updating message %d in queue: %v", m.ID, err)
+	}
+}
+
+func (q *Queue) doBounce(m *QueuedMessage, recipient string, err error) {
+	q.bounced.Add(1)
+
+	if q.logger != nil {
+		q.logger.Warn("Failed in delivering message %d to %s: %v", m.ID, recipient, err)
+	}
+
+	if q.bounce != nil {
+		q.bounce(m, recipient, err)
+	}
+}
+
+func (q *Queue) logError(msg string, args ...any) {
+	if q.logger != nil {
+		q.logger.Error(msg, args...)
+	}
+}
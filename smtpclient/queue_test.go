@@ -0,0 +1,226 @@
+package smtpclient
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/smtptest"
+)
+
+type bounceRecorder struct {
+	mu         sync.Mutex
+	recipients []string
+	errs       []error
+}
+
+func (b *bounceRecorder) bounce(_ *QueuedMessage, recipient string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.recipients = append(b.recipients, recipient)
+	b.errs = append(b.errs, err)
+}
+
+func (b *bounceRecorder) get() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string{}, b.recipients...)
+}
+
+func waitForQueue(t *testing.T, q *Queue, cond func(QueueStats) bool) QueueStats {
+	var stats QueueStats
+
+	assert.Eventually(t, func() bool {
+		var err error
+		stats, err = q.Stats()
+
+		return err == nil && cond(stats)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return stats
+}
+
+func TestQueue(t *testing.T) {
+	s, cfg := newTestServer(t)
+	client := NewClient(cfg)
+	defer client.Close()
+
+	br := &bounceRecorder{}
+
+	q, err := NewQueue(filepath.Join(t.TempDir(), "queue.db"), client,
+		WithQueueBackoff(50*time.Millisecond, 100*time.Millisecond),
+		WithQueueMaxAttempts(3),
+		WithQueueBounce(br.bounce),
+	)
+	assert.Nil(t, err)
+
+	id, err := q.Enqueue(testComposer("user@example.com", "unknown@example.com", "greylist@example.com"))
+	assert.Nil(t, err)
+	assert.Greater(t, id, int64(0))
+
+	_, err = q.Enqueue(testComposer("tempfail@example.com"))
+	assert.Nil(t, err)
+
+	stats := waitForQueue(t, q, func(s QueueStats) bool { return s.Queued == 0 && s.Sending == 0 })
+	assert.Equal(t, int64(2), stats.Delivered)
+	assert.Equal(t, int64(2), stats.Bounced)
+
+	// First delivery to user@ and second delivery to greylist@.
+	assert.Len(t, s.Messages(), 2)
+
+	assert.ElementsMatch(t, []string{"unknown@example.com", "tempfail@example.com"}, br.get())
+
+	for i, rcpt := range br.recipients {
+		if rcpt == "unknown@example.com" {
+			e, ok := IsSMTPError(br.errs[i])
+			assert.True(t, ok)
+			assert.True(t, e.Permanent())
+		} else {
+			assert.Contains(t, br.errs[i].Error(), "too many delivery attempts (3)")
+			assert.Contains(t, br.errs[i].Error(), "Greylisted")
+		}
+	}
+
+	assert.Nil(t, q.Shutdown(context.Background()))
+
+	_, err = q.Enqueue(testComposer("user@example.com"))
+	assert.Equal(t, ErrQueueClosed, err)
+}
+
+func TestQueueInvalidMessage(t *testing.T) {
+	s, cfg := newTestServer(t)
+	client := NewClient(cfg)
+	defer client.Close()
+
+	br := &bounceRecorder{}
+
+	q, err := NewQueue(filepath.Join(t.TempDir(), "queue.db"), client,
+		WithQueueBackoff(time.Hour, time.Hour),
+		WithQueueBounce(br.bounce),
+	)
+	assert.Nil(t, err)
+
+	id1, err := q.Enqueue(testComposer("tempfail@example.com"))
+	assert.Nil(t, err)
+	id2, err := q.Enqueue(testComposer("tempfail@example.com").WithDSN(DSN{EnvelopeID: "id-1"}))
+	assert.Nil(t, err)
+
+	waitForQueue(t, q, func(s QueueStats) bool { return s.Deferred == 2 })
+
+	// 数据损坏的邮件不投递、不删除，也不退回。
+	_, err = q.db.Exec("UPDATE mail_queue SET recipients = 'not json', next_attempt_at = 0 WHERE id = $1", id1)
+	assert.Nil(t, err)
+	_, err = q.db.Exec("UPDATE mail_queue SET options = '{', next_attempt_at = 0 WHERE id = $1", id2)
+	assert.Nil(t, err)
+	q.notify()
+
+	stats := waitForQueue(t, q, func(s QueueStats) bool { return s.Failed == 2 })
+	assert.Equal(t, 0, stats.Queued)
+	assert.Empty(t, br.get())
+	assert.Empty(t, s.Messages())
+
+	var lastError string
+	assert.Nil(t, q.db.QueryRow("SELECT last_error FROM mail_queue WHERE id = $1", id1).Scan(&lastError))
+	assert.Contains(t, lastError, "invalid message")
+
+	assert.Nil(t, q.Shutdown(context.Background()))
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := &Queue{minBackoff: time.Minute, maxBackoff: time.Hour}
+
+	assert.Equal(t, time.Minute, q.backoff(1))
+	assert.Equal(t, 2*time.Minute, q.backoff(2))
+	assert.Equal(t, 32*time.Minute, q.backoff(6))
+	assert.Equal(t, time.Hour, q.backoff(7))
+	assert.Equal(t, time.Hour, q.backoff(100))
+}
+
+func TestQueuePersistence(t *testing.T) {
+	// 没有监听的端口，投递失败。
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	_ = ln.Close()
+
+	pth := filepath.Join(t.TempDir(), "queue.db")
+
+	client := NewClient(Config{Host: host, Port: port, Timeout: time.Second})
+	defer client.Close()
+
+	q, err := NewQueue(pth, client, WithQueueBackoff(time.Hour, time.Hour))
+	assert.Nil(t, err)
+
+	_, err = q.Enqueue(testComposer("user@example.com"))
+	assert.Nil(t, err)
+
+	stats := waitForQueue(t, q, func(s QueueStats) bool { return s.Deferred == 1 })
+	assert.Equal(t, 1, stats.Queued)
+	assert.Equal(t, int64(0), stats.Delivered)
+
+	// Deferred message is not delivered on shutdown.
+	assert.Nil(t, q.Shutdown(context.Background()))
+
+	// Deliver on restart, after the retry time.
+	s, cfg := newTestServer(t)
+	client2 := NewClient(cfg)
+	defer client2.Close()
+
+	q, err = NewQueue(pth, client2, WithQueueBackoff(time.Hour, time.Hour))
+	assert.Nil(t, err)
+
+	stats, err = q.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Deferred)
+
+	_, err = q.db.Exec("UPDATE mail_queue SET next_attempt_at = 0")
+	assert.Nil(t, err)
+	q.notify()
+
+	waitForQueue(t, q, func(s QueueStats) bool { return s.Delivered == 1 && s.Queued == 0 })
+	assert.Len(t, s.Messages(), 1)
+
+	assert.Nil(t, q.Shutdown(context.Background()))
+}
+
+func TestQueueShutdownTimeout(t *testing.T) {
+	_, cfg := newTestServer(t, smtptest.WithReply(smtptest.Reply{Command: smtptest.CmdDataEnd, Delay: time.Second}))
+
+	client := NewClient(cfg)
+	defer client.Close()
+
+	pth := filepath.Join(t.TempDir(), "queue.db")
+
+	q, err := NewQueue(pth, client)
+	assert.Nil(t, err)
+
+	_, err = q.Enqueue(testComposer("user@example.com"))
+	assert.Nil(t, err)
+
+	waitForQueue(t, q, func(s QueueStats) bool { return s.Sending == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, q.Shutdown(ctx))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// The interrupted message is kept.
+	_, cfg = newTestServer(t)
+	client2 := NewClient(cfg)
+	defer client2.Close()
+
+	q, err = NewQueue(pth, client2, WithQueueWorkers(1))
+	assert.Nil(t, err)
+
+	waitForQueue(t, q, func(s QueueStats) bool { return s.Delivered == 1 })
+	assert.Nil(t, q.Shutdown(context.Background()))
+}
@@ -0,0 +1,199 @@
+package smtpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+)
+
+// maxHeaderSize 是 WithHeaderRecipients、WithStripBcc 读取邮件头的最大长度。
+const maxHeaderSize = 1 << 20
+
+var errHeaderTooLarge = errors.New("smtpclient: message header is too large")
+
+type RawOption func(o *rawOptions)
+
+type rawOptions struct {
+	headerRecipients bool
+	stripBcc         bool
+	envelope         EnvelopeOptions
+}
+
+// WithHeaderRecipients 将邮件头 To、Cc、Bcc 中的地址添加到信封收件人（类似 `sendmail -t`），
+// 并删除 Bcc 邮件头。
+func WithHeaderRecipients() RawOption {
+	return func(o *rawOptions) {
+		o.headerRecipients = true
+		o.stripBcc = true
+	}
+}
+
+// WithStripBcc 发送前删除 Bcc 邮件头，避免其它收件人看到密送地址。
+func WithStripBcc() RawOption {
+	return func(o *rawOptions) {
+		o.stripBcc = true
+	}
+}
+
+// WithEnvelopeOptions 设置 SMTP 信封的扩展参数，例如 DSN、REQUIRETLS。
+func WithEnvelopeOptions(opts EnvelopeOptions) RawOption {
+	return func(o *rawOptions) {
+		o.envelope = opts
+	}
+}
+
+// SendRaw 使用新的 SMTP 连接发送完整的邮件（包括邮件头），发送后断开连接。
+// 参考 Client.SendRaw。
+func SendRaw(ctx context.Context, cfg Config, from string, recipients []string, r io.Reader, opts ...RawOption) (err error) {
+	client := NewClient(cfg, WithMaxIdleConns(0))
+	defer client.Close()
+
+	return client.SendRaw(ctx, from, recipients, r, opts...)
+}
+
+// SendRaw 从 r 读取完整的邮件（包括邮件头）并发送，邮件内容不会全部读入内存。
+// from 是信封发件人（可以为空，即 `MAIL FROM:<>`），每个收件人发送一条 `RCPT TO` 命令，
+// 任何一个收件人被拒绝时都不发送邮件，并返回 *SMTPError。
+//
+// 邮件内容中的 LF 会转换为 CRLF，以 `.` 开头的行会按 RFC 5321 第 4.5.2 节转义。
+func (c *Client) SendRaw(ctx context.Context, from string, recipients []string, r io.Reader, opts ...RawOption) (err error) {
+	var o rawOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	msg := message{r: r, size: -1, eightBit: true}
+	if lr, ok := r.(interface{ Len() int }); ok {
+		msg.size = int64(lr.Len())
+	}
+
+	if o.headerRecipients || o.stripBcc {
+		var headerRecipients []string
+		if msg, headerRecipients, err = processHeader(msg, o.stripBcc); err != nil {
+			return
+		}
+
+		if o.headerRecipients {
+			recipients = mergeAddresses(recipients, headerRecipients)
+		}
+	}
+
+	_, err = c.sendMessage(ctx, from, recipients, msg, o.envelope, false)
+
+	return
+}
+
+// processHeader 读取邮件头，返回 To、Cc、Bcc 中的地址，stripBcc 为 true 时删除 Bcc 邮件头。
+func processHeader(msg message, stripBcc bool) (result message, recipients []string, err error) {
+	br := bufio.NewReader(msg.r)
+
+	header, err := readHeader(br)
+	if err != nil {
+		return
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(append(bytes.Clone(header), "\r\n"...)))
+	if err != nil {
+		return result, nil, fmt.Errorf("smtpclient: invalid message header: %w", err)
+	}
+
+	for _, key := range []string{"To", "Cc", "Bcc"} {
+		addrs, err := m.Header.AddressList(key)
+		if err != nil {
+			if errors.Is(err, mail.ErrHeaderNotPresent) {
+				continue
+			}
+
+			return result, nil, fmt.Errorf("smtpclient: invalid %s header: %w", key, err)
+		}
+
+		for _, addr := range addrs {
+			recipients = append(recipients, addr.Address)
+		}
+	}
+
+	originalSize := len(header)
+	if stripBcc {
+		header = removeHeader(header, "Bcc")
+	}
+
+	result = message{r: io.MultiReader(bytes.NewReader(header), br), size: -1, eightBit: msg.eightBit}
+	if msg.size >= 0 {
+		result.size = msg.size - int64(originalSize) + int64(len(header))
+	}
+
+	return
+}
+
+// readHeader 读取邮件头，包括结束邮件头的空行（如果有）。
+func readHeader(br *bufio.Reader) (header []byte, err error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		header = append(header, line...)
+
+		if len(header) > maxHeaderSize {
+			return nil, errHeaderTooLarge
+		}
+
+		if err == io.EOF {
+			return header, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return header, nil
+		}
+	}
+}
+
+// removeHeader 删除邮件头中名称为 name（不区分大小写）的所有字段，包括折行。
+func removeHeader(header []byte, name string) []byte {
+	var out []byte
+	skipping := false
+
+	for _, line := range bytes.SplitAfter(header, []byte("\n")) {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if !skipping {
+				out = append(out, line...)
+			}
+
+			continue
+		}
+
+		key, _, found := bytes.Cut(line, []byte(":"))
+		skipping = found && strings.EqualFold(strings.TrimSpace(string(key)), name)
+
+		if !skipping {
+			out = append(out, line...)
+		}
+	}
+
+	return out
+}
+
+// mergeAddresses 合并地址列表，忽略重复的地址（不区分大小写）。
+func mergeAddresses(lists ...[]string) (merged []string) {
+	seen := make(map[string]bool)
+
+	for _, list := range lists {
+		for _, addr := range list {
+			key := strings.ToLower(addr)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			merged = append(merged, addr)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package smtpclient
+
+import (
+	"context"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iredmail/goutils/smtptest"
+)
+
+func TestSendRaw(t *testing.T) {
+	s, cfg := newTestServer(t, smtptest.WithExtensions("SIZE 10240", "8BITMIME"))
+
+	raw := "From: sender@example.com\nTo: a@example.com\nSubject: test\n\n.leading dot\n..two dots\nhello\n"
+	err := SendRaw(context.Background(), cfg, "sender@example.com", []string{"a@example.com", "b@example.com"}, strings.NewReader(raw))
+	assert.Nil(t, err)
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "sender@example.com", msgs[0].From)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, msgs[0].Recipients)
+	assert.Equal(t, strings.ReplaceAll(raw, "\n", "\r\n"), string(msgs[0].Data))
+	assert.False(t, msgs[0].TLS)
+	assert.Equal(t, "", msgs[0].AuthUser)
+
+	commands := s.Commands()
+	assert.Equal(t, "MAIL FROM:<sender@example.com> SIZE="+strconv.Itoa(len(raw))+" BODY=8BITMIME", commands[1])
+	assert.Equal(t, "RCPT TO:<a@example.com>", commands[2])
+	assert.Equal(t, "RCPT TO:<b@example.com>", commands[3])
+
+	// 邮件大小未知时不发送 SIZE 参数，空的信封发件人。
+	s.Reset()
+	err = SendRaw(context.Background(), cfg, "", []string{"a@example.com"}, io.MultiReader(strings.NewReader(raw)))
+	assert.Nil(t, err)
+	assert.Equal(t, "MAIL FROM:<> BODY=8BITMIME", s.Commands()[1])
+
+	// 任何一个收件人被拒绝时都不发送邮件。
+	s, cfg = newTestServer(t, smtptest.WithReply(smtptest.Reply{Command: "RCPT", Match: `unknown@`, Reply: "550 5.1.1 User unknown"}))
+	err = SendRaw(context.Background(), cfg, "sender@example.com", []string{"a@example.com", "unknown@example.com"}, strings.NewReader(raw))
+	e, ok := IsSMTPError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 550, e.Code)
+	assert.Empty(t, s.Messages())
+
+	err = SendRaw(context.Background(), cfg, "sender@example.com", nil, strings.NewReader(raw))
+	assert.NotNil(t, err)
+}
+
+func TestSendRawHeaderRecipients(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	raw := "From: sender@example.com\r\n" +
+		"To: A <a@example.com>, b@example.com\r\n" +
+		"Cc: c@example.com\r\n" +
+		"Bcc: hidden@example.com,\r\n" +
+		"\tsecret@example.com\r\n" +
+		"Subject: test\r\n" +
+		"\r\n" +
+		"Bcc: not a header\r\n"
+
+	err := SendRaw(context.Background(), cfg, "sender@example.com", []string{"B@example.com", "d@example.com"}, strings.NewReader(raw), WithHeaderRecipients())
+	assert.Nil(t, err)
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, []string{
+		"B@example.com",
+		"d@example.com",
+		"a@example.com",
+		"c@example.com",
+		"hidden@example.com",
+		"secret@example.com",
+	}, msgs[0].Recipients)
+	assert.Equal(t, "From: sender@example.com\r\n"+
+		"To: A <a@example.com>, b@example.com\r\n"+
+		"Cc: c@example.com\r\n"+
+		"Subject: test\r\n"+
+		"\r\n"+
+		"Bcc: not a header\r\n", string(msgs[0].Data))
+
+	// 只删除 Bcc 邮件头。
+	s.Reset()
+	err = SendRaw(context.Background(), cfg, "sender@example.com", []string{"d@example.com"}, strings.NewReader(raw), WithStripBcc())
+	assert.Nil(t, err)
+
+	msgs = s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, []string{"d@example.com"}, msgs[0].Recipients)
+	assert.NotContains(t, string(msgs[0].Data), "secret@example.com")
+
+	// 无效的地址
+	err = SendRaw(context.Background(), cfg, "sender@example.com", nil, strings.NewReader("To: invalid\r\n\r\n"), WithHeaderRecipients())
+	assert.NotNil(t, err)
+
+	err = SendRaw(context.Background(), cfg, "sender@example.com", nil, strings.NewReader(strings.Repeat("X-Long: header\r\n", maxHeaderSize/16+1)), WithStripBcc())
+	assert.ErrorIs(t, err, errHeaderTooLarge)
+}
+
+func TestSendRawTLS(t *testing.T) {
+	s, cfg := newTestServer(t, smtptest.WithTLS(), smtptest.WithAuth("user", "secret"))
+	raw := "Subject: test\r\n\r\nhello\r\n"
+
+	// 自签名证书无法通过验证。
+	cfg.StartTLS = true
+	cfg.VerifySSLCertificate = true
+	err := SendRaw(context.Background(), cfg, "sender@example.com", []string{"a@example.com"}, strings.NewReader(raw))
+	assert.NotNil(t, err)
+	assert.Empty(t, s.Messages())
+
+	cfg.VerifySSLCertificate = false
+	err = SendRaw(context.Background(), cfg, "sender@example.com", []string{"a@example.com"}, strings.NewReader(raw))
+	assert.Nil(t, err)
+
+	cfg.SMTPUser = "user"
+	cfg.SMTPPassword = "secret"
+	err = SendRaw(context.Background(), cfg, "sender@example.com", []string{"a@example.com"}, strings.NewReader(raw))
+	assert.Nil(t, err)
+
+	msgs := s.Messages()
+	assert.Equal(t, 2, len(msgs))
+	assert.True(t, msgs[0].TLS)
+	assert.Equal(t, "", msgs[0].AuthUser)
+	assert.True(t, msgs[1].TLS)
+	assert.Equal(t, "user", msgs[1].AuthUser)
+}
+
+func TestSendmailWithEml(t *testing.T) {
+	s, cfg := newTestServer(t)
+
+	raw := "From: sender@example.com\nTo: a@example.com\nSubject: test\n\nhello\n"
+	emlPath := filepath.Join(t.TempDir(), "test.eml")
+	assert.Nil(t, os.WriteFile(emlPath, []byte(raw), 0600))
+
+	err := SendmailWithEml(cfg, mail.Address{Address: "sender@example.com"}, []string{"a@example.com", "b@example.com"}, emlPath)
+	assert.Nil(t, err)
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, msgs[0].Recipients)
+	assert.Equal(t, strings.ReplaceAll(raw, "\n", "\r\n"), string(msgs[0].Data))
+
+	err = SendmailWithEml(cfg, mail.Address{Address: "sender@example.com"}, []string{"a@example.com"}, filepath.Join(t.TempDir(), "missing.eml"))
+	assert.NotNil(t, err)
+}
+
+func TestRemoveHeader(t *testing.T) {
+	header := []byte("To: a@example.com\r\nBCC: b@example.com,\r\n c@example.com\r\nSubject: test\nbcc : d@example.com\n\r\n")
+	assert.Equal(t, "To: a@example.com\r\nSubject: test\n\r\n", string(removeHeader(header, "Bcc")))
+	assert.Equal(t, string(header), string(removeHeader(header, "Cc")))
+}
+
+func TestMergeAddresses(t *testing.T) {
+	assert.Equal(t, []string{"a@example.com", "b@example.com", "c@example.com"},
+		mergeAddresses([]string{"a@example.com", "b@example.com"}, []string{"A@Example.com", "c@example.com", "b@example.com"}))
+	assert.Nil(t, mergeAddresses(nil, nil))
+}
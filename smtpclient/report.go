@@ -0,0 +1,47 @@
+package smtpclient
+
+// RecipientResult 是单个收件人的投递结果（即 `RCPT TO` 命令的结果）。
+type RecipientResult struct {
+	Address  string
+	Accepted bool
+
+	// Err 是收件人被拒绝的原因，Accepted 为 true 时为 nil。
+	Err *SMTPError
+}
+
+// DeliveryReport 是发送一封邮件的结果。
+type DeliveryReport struct {
+	From       string
+	Recipients []RecipientResult
+
+	// Response 是 SMTP 服务器接收邮件后（`DATA` 命令结束时）的响应，通常包含队列 ID，
+	// 例如 `2.0.0 Ok: queued as 4Bq0Nf2yqJz9vFC`。邮件未发送时为空。
+	Response string
+}
+
+// Accepted 返回被 SMTP 服务器接受的收件人。
+func (r *DeliveryReport) Accepted() (addrs []string) {
+	for _, rcpt := range r.Recipients {
+		if rcpt.Accepted {
+			addrs = append(addrs, rcpt.Address)
+		}
+	}
+
+	return
+}
+
+// Rejected 返回被 SMTP 服务器拒绝的收件人。
+func (r *DeliveryReport) Rejected() (results []RecipientResult) {
+	for _, rcpt := range r.Recipients {
+		if !rcpt.Accepted {
+			results = append(results, rcpt)
+		}
+	}
+
+	return
+}
+
+// AllAccepted 表示所有收件人都被 SMTP 服务器接受。
+func (r *DeliveryReport) AllAccepted() bool {
+	return len(r.Rejected()) == 0
+}
@@ -1,18 +1,15 @@
 package smtpclient
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
-	"net"
 	"net/mail"
-	"net/smtp"
 	"os"
 	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/iredmail/goutils"
-	"github.com/iredmail/goutils/emailutils"
 	"github.com/iredmail/goutils/logger"
 )
 
@@ -21,6 +18,21 @@ type Config struct {
 	Port    string
 	Timeout time.Duration
 
+	// HeloName 是 EHLO/HELO 命令使用的主机名，默认为本机的完整主机名（goutils.GetHostFQDN）。
+	// 很多 MTA 会拒绝或降低 `localhost` 等无效主机名的信誉。
+	HeloName string
+
+	// LocalAddr 是建立连接时绑定的本地 IP 地址，为空时由系统选择。设置了 Dialer 时无效。
+	LocalAddr string
+
+	// Network 是建立连接使用的网络类型：`tcp4` 只使用 IPv4，`tcp6` 只使用 IPv6，
+	// 默认为 `tcp`（同时使用 IPv4 和 IPv6）。
+	Network string
+
+	// Dialer 用于建立 TCP 连接，例如通过 SOCKS5 或 HTTP 代理连接（参考 NewProxyDialer），
+	// 为 nil 时使用 net.Dialer。
+	Dialer Dialer
+
 	StartTLS             bool
 	UseSSL               bool
 	VerifySSLCertificate bool
@@ -29,9 +41,31 @@ type Config struct {
 	DisplayName  string
 	SMTPUser     string
 	SMTPPassword string
+
+	// AuthMechanism 是 SMTP 认证方式，例如 AuthPlain、AuthLogin、AuthCRAMMD5、AuthXOAuth2、
+	// AuthOAuthBearer。为空时根据服务器 EHLO 响应中的 AUTH 列表自动选择。
+	AuthMechanism string
+
+	// TokenSource 提供 XOAUTH2、OAUTHBEARER 认证使用的 OAuth 2.0 access token，
+	// 用户名为 SMTPUser。设置后自动选择认证方式时只使用 XOAUTH2 或 OAUTHBEARER。
+	TokenSource TokenSource
+
+	// AllowInsecureAuth 允许在未加密的连接上使用 PLAIN、LOGIN、XOAUTH2 和 OAUTHBEARER 认证。
+	// 默认只允许在 TLS 连接或连接 localhost 时使用。
+	AllowInsecureAuth bool
 }
 
+// SendmailWithComposer 使用新的 SMTP 连接发送邮件，发送后断开连接。
+// 需要发送多封邮件时应使用 Client 复用连接。
 func SendmailWithComposer(c Config, composer *Composer) (err error) {
+	client := NewClient(c, WithMaxIdleConns(0))
+	defer client.Close()
+
+	return client.Send(context.Background(), composer)
+}
+
+// fillFromAddress 补全 composer 的发件人地址。
+func fillFromAddress(c Config, composer *Composer) {
 	// 如果 from 不是完整邮件地址，则将 smtp 主机名作为邮件地址的域名部分追加到 from 拼凑成完整邮件地址。
 	// 例如：user@domain.com、 user@[IP]
 	if len(composer.from.Address) > 0 && !strings.Contains(composer.from.Address, "@") {
@@ -54,96 +88,10 @@ func SendmailWithComposer(c Config, composer *Composer) (err error) {
 	if composer.from.Address == "" {
 		composer.from.Address = fmt.Sprintf("%s:%s", c.Host, c.Port)
 	}
-
-	// Export mail body before smtp connection, make sure it's valid email message.
-	msg, err := composer.Bytes()
-	if err != nil {
-		return fmt.Errorf("failed in building email message from composer: %v", err)
-	}
-
-	if c.Timeout == 0 {
-		c.Timeout = time.Second * 15
-	}
-
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.Host, c.Port), c.Timeout)
-	if err != nil {
-		return err
-	}
-
-	// 开启 ssl 安全连接
-	if c.UseSSL {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: !c.VerifySSLCertificate,
-			ServerName:         c.Host,
-		}
-
-		conn = tls.Client(conn, tlsConfig)
-	}
-
-	client, err := smtp.NewClient(conn, c.Host)
-	if err != nil {
-		return err
-	}
-
-	if c.StartTLS {
-		tc := &tls.Config{
-			InsecureSkipVerify: !c.VerifySSLCertificate,
-			ServerName:         c.Host,
-		}
-
-		if err = client.StartTLS(tc); err != nil {
-			return err
-		}
-	}
-
-	if len(c.SMTPUser) > 0 && len(c.SMTPPassword) > 0 {
-		auth := smtp.PlainAuth("", c.SMTPUser, c.SMTPPassword, c.Host)
-
-		if err = client.Auth(auth); err != nil {
-			return err
-		}
-	}
-
-	if err = client.Mail(composer.from.Address); err != nil {
-		return err
-	}
-
-	for _, addr := range composer.GetTo() {
-		if err = client.Rcpt(addr.Address); err != nil {
-			return err
-		}
-	}
-
-	for _, addr := range composer.cc {
-		if err = client.Rcpt(addr.Address); err != nil {
-			return err
-		}
-	}
-
-	for _, addr := range composer.bcc {
-		if err = client.Rcpt(addr.Address); err != nil {
-			return err
-		}
-	}
-
-	w, err := client.Data()
-	if err != nil {
-		return err
-	}
-
-	if _, err = w.Write(msg); err != nil {
-		return fmt.Errorf("failed in writing mail body: %w", err)
-	}
-
-	err = w.Close()
-	if err != nil {
-		return err
-	}
-
-	return client.Quit()
 }
 
 // SendmailWithComposerInBackground 在后台发送邮件，不阻塞当前进程。
+// 发送失败时只记录日志，不会重试；需要保证邮件送达时应使用 Queue。
 func SendmailWithComposerInBackground(c Config, composer *Composer, l logger.Logger) {
 	go func() {
 		// 捕捉 panic 并记录具体信息，便于后期排错。
@@ -180,90 +128,14 @@ func SendmailWithComposerInBackground(c Config, composer *Composer, l logger.Log
 	}()
 }
 
-// SendmailWithEml reads full email message and sends it out.
-// WARNING: This function should be just used as a tool for testing purpose, not to send general emails.
+// SendmailWithEml 读取 eml 文件中的完整邮件并发送，每个收件人发送一条 `RCPT TO` 命令，
+// 参考 SendRaw。
 func SendmailWithEml(c Config, from mail.Address, recipients []string, emlPath string) (err error) {
-	smtpServer := fmt.Sprintf("%s:%s", c.Host, c.Port)
-
-	client, err := smtp.Dial(smtpServer)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		_ = client.Close()
-	}()
-
-	// HELO
-	domain := emailutils.ExtractDomain(from.Address)
-	if domain == "" {
-		domain = "example.com"
-	}
-
-	err = client.Hello(domain)
-	if err != nil {
-		return err
-	}
-
-	// TLS
-	if c.StartTLS {
-		tlsConfig := &tls.Config{
-			// ServerName:         utils.GetHostName(),
-			InsecureSkipVerify: true,
-		}
-
-		err = client.StartTLS(tlsConfig)
-		if err != nil {
-			fmt.Printf("failed in STARTTLS directive: %v\n", err)
-			os.Exit(255)
-		}
-	}
-
-	// AUTH
-	auth := smtp.PlainAuth("", c.SMTPUser, c.SMTPPassword, c.Host)
-	err = client.Auth(auth)
-	if err != nil {
-		return err
-	}
-
-	// MAIL
-	err = client.Mail(from.Address)
-	if err != nil {
-		return err
-	}
-
-	// `RCPT TO:`
-	var toAddrs []string
-	for _, addr := range recipients {
-		toAddrs = append(toAddrs, addr)
-	}
-
-	to := strings.Join(toAddrs, ",")
-	if err = client.Rcpt(to); err != nil {
-		return err
-	}
-
-	// `DATA`
-	w, err := client.Data()
-	if err != nil {
-		return err
-	}
-
-	// 读取邮件源码文件
-	rawEmail, err := os.ReadFile(emlPath)
-	if err != nil {
-		return err
-	}
-
-	_, err = w.Write(rawEmail)
-	if err != nil {
-		return err
-	}
-
-	err = w.Close()
+	f, err := os.Open(emlPath)
 	if err != nil {
-		return err
+		return
 	}
+	defer f.Close()
 
-	return client.Quit()
+	return SendRaw(context.Background(), c, from.Address, recipients, f)
 }
@@ -0,0 +1,223 @@
+package smtptest
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultAuthMechanisms 是 EHLO 响应中默认声明的认证方式，参考 WithAuthMechanisms。
+var defaultAuthMechanisms = []string{"PLAIN", "LOGIN", "CRAM-MD5"}
+
+// oauthError 是 XOAUTH2、OAUTHBEARER 认证失败时返回的错误信息（RFC 7628 第 3.2.2 节）。
+const oauthError = `{"status":"invalid_token","schemes":"bearer","scope":"email"}`
+
+// auth 处理 AUTH 命令（RFC 4954）。
+func (sess *session) auth(arg string) (err error) {
+	s := sess.server
+
+	switch {
+	case len(s.users) == 0:
+		return sess.write("502 5.5.1 Error: authentication not enabled")
+	case sess.helo == "":
+		return sess.write("503 5.5.1 Error: send HELO/EHLO first")
+	case s.requireTLS && !sess.tls:
+		return sess.write("530 5.7.0 Must issue a STARTTLS command first")
+	case sess.authUser != "":
+		return sess.write("503 5.5.1 Error: already authenticated")
+	case sess.inTransaction:
+		return sess.write("503 5.5.1 Error: MAIL transaction in progress")
+	}
+
+	mech, initial, _ := strings.Cut(arg, " ")
+	mech = strings.ToUpper(mech)
+
+	var username string
+	var ok, canceled bool
+
+	switch mech {
+	case "PLAIN":
+		username, ok, canceled, err = sess.authPlain(initial)
+	case "LOGIN":
+		username, ok, canceled, err = sess.authLogin(initial)
+	case "CRAM-MD5":
+		username, ok, canceled, err = sess.authCRAMMD5()
+	case "XOAUTH2", "OAUTHBEARER":
+		username, ok, canceled, err = sess.authOAuth(initial)
+	default:
+		return sess.write("504 5.5.4 Unrecognized authentication type")
+	}
+
+	switch {
+	case err != nil:
+		return
+	case canceled:
+		return sess.write("501 5.7.0 Authentication aborted")
+	case !ok:
+		return sess.write("535 5.7.8 Authentication credentials invalid")
+	}
+
+	sess.authUser = username
+
+	return sess.write("235 2.7.0 Authentication successful")
+}
+
+// challenge 发送 334 响应并读取客户端的 base64 响应，客户端发送 `*` 时 canceled 为 true。
+func (sess *session) challenge(msg string) (resp string, canceled bool, err error) {
+	if err = sess.write("334 " + base64.StdEncoding.EncodeToString([]byte(msg))); err != nil {
+		return
+	}
+
+	line, err := sess.readLine()
+	if err != nil {
+		return
+	}
+
+	if line == "*" {
+		return "", true, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		// 格式错误视为认证失败，而不是断开连接。
+		return "", false, nil
+	}
+
+	return string(b), false, nil
+}
+
+func decodeInitial(initial string) string {
+	if initial == "=" {
+		return ""
+	}
+
+	b, _ := base64.StdEncoding.DecodeString(initial)
+
+	return string(b)
+}
+
+func (sess *session) authPlain(initial string) (username string, ok, canceled bool, err error) {
+	resp := decodeInitial(initial)
+	if initial == "" {
+		if resp, canceled, err = sess.challenge(""); err != nil || canceled {
+			return
+		}
+	}
+
+	// RFC 4616: [authzid] NUL authcid NUL passwd
+	parts := strings.Split(resp, "\x00")
+	if len(parts) != 3 {
+		return
+	}
+
+	username = parts[1]
+	ok = sess.server.checkPassword(username, parts[2])
+
+	return
+}
+
+func (sess *session) authLogin(initial string) (username string, ok, canceled bool, err error) {
+	username = decodeInitial(initial)
+	if initial == "" {
+		if username, canceled, err = sess.challenge("Username:"); err != nil || canceled {
+			return
+		}
+	}
+
+	password, canceled, err := sess.challenge("Password:")
+	if err != nil || canceled {
+		return
+	}
+
+	ok = sess.server.checkPassword(username, password)
+
+	return
+}
+
+func (sess *session) authCRAMMD5() (username string, ok, canceled bool, err error) {
+	// RFC 2195: <随机数.时间戳@主机名>
+	challenge := fmt.Sprintf("<%d.%d@%s>", os.Getpid(), time.Now().UnixNano(), sess.server.hostname)
+
+	resp, canceled, err := sess.challenge(challenge)
+	if err != nil || canceled {
+		return
+	}
+
+	username, digest, found := strings.Cut(resp, " ")
+	if !found {
+		return
+	}
+
+	password, exists := sess.server.password(username)
+	if !exists {
+		return
+	}
+
+	mac := hmac.New(md5.New, []byte(password))
+	mac.Write([]byte(challenge))
+	ok = hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(digest)))
+
+	return
+}
+
+// authOAuth 处理 XOAUTH2（https://developers.google.com/gmail/imap/xoauth2-protocol）和
+// OAUTHBEARER（RFC 7628）认证。认证失败时先返回 JSON 格式的错误信息，客户端响应后再返回 535。
+func (sess *session) authOAuth(initial string) (username string, ok, canceled bool, err error) {
+	resp := decodeInitial(initial)
+	if initial == "" {
+		if resp, canceled, err = sess.challenge(""); err != nil || canceled {
+			return
+		}
+	}
+
+	username, token := parseOAuth(resp)
+	if ok = token != "" && sess.server.checkPassword(username, token); ok {
+		return
+	}
+
+	_, canceled, err = sess.challenge(oauthError)
+
+	return
+}
+
+// parseOAuth 解析 XOAUTH2（`user=...^Aauth=Bearer ...^A^A`）或 OAUTHBEARER
+// （`n,a=...,^Ahost=...^Aauth=Bearer ...^A^A`）的客户端响应。
+func parseOAuth(resp string) (username, token string) {
+	for _, field := range strings.Split(resp, "\x01") {
+		switch {
+		case strings.HasPrefix(field, "user="):
+			username = strings.TrimPrefix(field, "user=")
+		case strings.HasPrefix(field, "auth="):
+			token, _ = strings.CutPrefix(strings.TrimPrefix(field, "auth="), "Bearer ")
+		case strings.HasPrefix(field, "n,"), strings.HasPrefix(field, "y,"):
+			// GS2 header，RFC 5801 第 4 节。
+			for _, attr := range strings.Split(field, ",") {
+				if name, found := strings.CutPrefix(attr, "a="); found {
+					username = strings.NewReplacer("=2C", ",", "=3D", "=").Replace(name)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func (s *Server) password(username string) (password string, exists bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	password, exists = s.users[username]
+
+	return
+}
+
+func (s *Server) checkPassword(username, password string) bool {
+	expected, exists := s.password(username)
+
+	return exists && hmac.Equal([]byte(expected), []byte(password))
+}
@@ -0,0 +1,167 @@
+package smtptest
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/smtp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loginAuth 实现 LOGIN 认证。
+type loginAuth struct {
+	username, password string
+}
+
+func (a loginAuth) Start(*smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, errors.New("unexpected challenge")
+}
+
+// oauthAuth 实现 XOAUTH2、OAUTHBEARER 认证，failed 记录服务器返回的错误信息。
+type oauthAuth struct {
+	mech, initial string
+	failed        *string
+}
+
+func (a oauthAuth) Start(*smtp.ServerInfo) (string, []byte, error) {
+	return a.mech, []byte(a.initial), nil
+}
+
+func (a oauthAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	*a.failed = string(fromServer)
+
+	if a.mech == "OAUTHBEARER" {
+		return []byte{0x01}, nil
+	}
+
+	return []byte{}, nil
+}
+
+func TestAuth(t *testing.T) {
+	s := newTestServer(t, WithAuth("user", "secret"), WithAuth("other", "password"), WithAuthRequired())
+
+	// 未认证时拒绝发送邮件。
+	c := dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+	assert.Equal(t, 530, replyCode(c.Mail("sender@example.com")))
+
+	tests := []struct {
+		auth smtp.Auth
+		code int
+	}{
+		{smtp.PlainAuth("", "user", "secret", "127.0.0.1"), 0},
+		{smtp.PlainAuth("", "user", "wrong", "127.0.0.1"), 535},
+		{smtp.PlainAuth("", "nobody", "secret", "127.0.0.1"), 535},
+		{loginAuth{"other", "password"}, 0},
+		{loginAuth{"other", "secret"}, 535},
+		{smtp.CRAMMD5Auth("user", "secret"), 0},
+		{smtp.CRAMMD5Auth("user", "wrong"), 535},
+		{smtp.CRAMMD5Auth("nobody", "secret"), 535},
+	}
+
+	for i, tt := range tests {
+		c = dial(t, s)
+		err := c.Auth(tt.auth)
+		assert.Equal(t, tt.code, replyCode(err), i)
+
+		if tt.code == 0 {
+			assert.Nil(t, err, i)
+			assert.Equal(t, 503, replyCode(c.Auth(tt.auth)), i)
+		}
+	}
+
+	c = dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+
+	cmd := func(line string, expect int) string {
+		id, err := c.Text.Cmd("%s", line)
+		assert.Nil(t, err)
+
+		c.Text.StartResponse(id)
+		defer c.Text.EndResponse(id)
+
+		code, msg, _ := c.Text.ReadResponse(0)
+		assert.Equal(t, expect, code, line)
+
+		return msg
+	}
+
+	// PLAIN 不带初始响应。
+	cmd("AUTH PLAIN", 334)
+	cmd(base64.StdEncoding.EncodeToString([]byte("\x00user\x00secret")), 235)
+
+	c = dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+
+	// LOGIN 带初始响应、取消认证、格式错误、不支持的认证方式。
+	cmd("AUTH LOGIN "+base64.StdEncoding.EncodeToString([]byte("user")), 334)
+	cmd("*", 501)
+	cmd("AUTH PLAIN", 334)
+	cmd("not-base64!", 535)
+	cmd("AUTH GSSAPI", 504)
+	cmd("AUTH PLAIN =", 535)
+
+	assert.Empty(t, s.Messages())
+}
+
+func TestAuthOAuth(t *testing.T) {
+	s := newTestServer(t,
+		WithAuth("user@example.com", "ya29.token"),
+		WithAuth("a=b,c", "token"),
+		WithAuthMechanisms("XOAUTH2", "OAUTHBEARER", "GSSAPI"),
+	)
+
+	c := dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+	_, mechs := c.Extension("AUTH")
+	assert.Equal(t, "XOAUTH2 OAUTHBEARER GSSAPI", mechs)
+
+	tests := []struct {
+		mech, initial string
+		code          int
+	}{
+		{"XOAUTH2", "user=user@example.com\x01auth=Bearer ya29.token\x01\x01", 0},
+		{"XOAUTH2", "user=user@example.com\x01auth=Bearer wrong\x01\x01", 535},
+		{"XOAUTH2", "user=user@example.com\x01\x01", 535},
+		{"OAUTHBEARER", "n,a=user@example.com,\x01host=localhost\x01port=25\x01auth=Bearer ya29.token\x01\x01", 0},
+		{"OAUTHBEARER", "n,a=a=3Db=2Cc,\x01auth=Bearer token\x01\x01", 0},
+		{"OAUTHBEARER", "n,a=user@example.com,\x01auth=Bearer token\x01\x01", 535},
+	}
+
+	for i, tt := range tests {
+		var failed string
+
+		c = dial(t, s)
+		assert.Equal(t, tt.code, replyCode(c.Auth(oauthAuth{tt.mech, tt.initial, &failed})), i)
+
+		if tt.code == 0 {
+			assert.Empty(t, failed, i)
+		} else {
+			assert.Contains(t, failed, `"status":"invalid_token"`, i)
+		}
+	}
+
+	// 声明了但不支持的认证方式。
+	c = dial(t, s)
+	assert.Equal(t, 504, replyCode(c.Auth(oauthAuth{"GSSAPI", "", new(string)})))
+}
@@ -0,0 +1,741 @@
+// Package smtptest 实现用于测试的 SMTP 服务器，监听本机（loopback）的随机端口，
+// 收到的邮件保存在内存中，便于在单元测试中检查 SMTP 客户端的行为。
+//
+// 支持：
+//
+//   - 自定义 EHLO 响应中声明的扩展，例如 PIPELINING、SIZE、8BITMIME、SMTPUTF8、DSN。
+//   - 使用自动生成的自签名证书或指定的证书支持 STARTTLS。
+//   - PLAIN、LOGIN、CRAM-MD5、XOAUTH2、OAUTHBEARER 认证。
+//   - 按命令及正则表达式指定响应，例如拒绝某些收件人、在会话中途返回 421 并断开连接、
+//     延迟响应以测试客户端超时。
+//
+// 示例：
+//
+//	s, err := smtptest.NewServer(
+//		smtptest.WithTLS(),
+//		smtptest.WithAuth("user", "secret"),
+//		smtptest.WithReply(smtptest.Reply{Command: "RCPT", Match: `unknown@`, Reply: "550 5.1.1 User unknown"}),
+//	)
+//	defer s.Close()
+//
+//	// 使用 s.Host()、s.Port() 连接服务器，然后检查 s.Messages()。
+package smtptest
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CmdGreeting 用于 Reply.Command，表示客户端连接后服务器发送的欢迎信息。
+	CmdGreeting = "GREETING"
+
+	// CmdDataEnd 用于 Reply.Command，表示邮件内容结束（`.`）后的响应，Reply.Match 匹配邮件内容。
+	CmdDataEnd = "."
+
+	// maxLineLength 是命令行的最大长度（RFC 5321 第 4.5.3.1.4 节规定为 512，这里放宽限制）。
+	maxLineLength = 4096
+)
+
+// Message 是服务器接收的一封邮件。
+type Message struct {
+	// Helo 是客户端 EHLO/HELO 命令的参数。
+	Helo string
+
+	// From 和 Recipients 是信封发件人和被接受的收件人（不包括尖括号和参数）。
+	From       string
+	Recipients []string
+
+	// Data 是邮件原始内容（已去除 dot-stuffing，以 CRLF 换行）。
+	Data []byte
+
+	// TLS 表示邮件通过 TLS 连接发送，AuthUser 是认证的用户名（未认证时为空）。
+	TLS      bool
+	AuthUser string
+}
+
+// Reply 指定服务器对某些命令的响应。
+//
+// Reply 不是 2xx、3xx 时不再按默认方式处理命令；是 2xx、3xx 时仍然按默认方式处理，
+// 只替换响应的内容（STARTTLS、AUTH、DATA 除外）。响应代码为 421 时发送响应后断开连接。
+type Reply struct {
+	// Command 是 SMTP 命令（不区分大小写），例如 `MAIL`、`RCPT`，或者 CmdGreeting、CmdDataEnd。
+	Command string
+
+	// Match 是匹配完整命令行（例如 `RCPT TO:<user@example.com>`）的正则表达式，为空时匹配所有命令。
+	Match string
+
+	// Reply 是完整的响应，例如 `550 5.1.1 User unknown`，多行响应以 `\n` 分隔。
+	Reply string
+
+	// Times 是最多使用的次数，为 0 时不限制。
+	Times int
+
+	// Delay 是发送响应前等待的时间，用于测试客户端超时。Reply 为空时只等待，仍然按默认方式处理命令。
+	Delay time.Duration
+
+	re   *regexp.Regexp
+	used int
+}
+
+type Option func(s *Server)
+
+// WithHostname 设置服务器的主机名，用于欢迎信息、EHLO 响应及证书，默认为 `localhost`。
+func WithHostname(name string) Option {
+	return func(s *Server) {
+		s.hostname = name
+	}
+}
+
+// WithExtensions 设置 EHLO 响应中声明的扩展，例如 `PIPELINING`、`SIZE 10240000`。
+// 声明了 SIZE 时拒绝超出大小的邮件。STARTTLS 和 AUTH 由 WithTLS、WithAuth 自动声明。
+func WithExtensions(ext ...string) Option {
+	return func(s *Server) {
+		s.extensions = append(s.extensions, ext...)
+	}
+}
+
+// WithTLS 使用自动生成的自签名证书支持 STARTTLS，客户端可以使用 Server.ClientTLSConfig 验证证书。
+func WithTLS() Option {
+	return func(s *Server) {
+		s.tls = true
+	}
+}
+
+// WithTLSConfig 使用指定的 tls.Config（例如由自定义 CA 签发的证书）支持 STARTTLS。
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = true
+		s.tlsConfig = config
+	}
+}
+
+// WithRequireTLS 要求客户端在认证及发送邮件前使用 STARTTLS，需要同时使用 WithTLS。
+func WithRequireTLS() Option {
+	return func(s *Server) {
+		s.tls = true
+		s.requireTLS = true
+	}
+}
+
+// WithAuth 添加允许认证的用户，可以多次使用。password 同时用作 XOAUTH2、OAUTHBEARER 认证的 access token。
+func WithAuth(username, password string) Option {
+	return func(s *Server) {
+		s.users[username] = password
+	}
+}
+
+// WithAuthMechanisms 设置 EHLO 响应中声明的认证方式，默认为 `PLAIN LOGIN CRAM-MD5`。
+// 可以声明不支持的认证方式（例如 `GSSAPI`），客户端使用时返回 504。
+func WithAuthMechanisms(mechs ...string) Option {
+	return func(s *Server) {
+		s.authMechanisms = mechs
+	}
+}
+
+// WithAuthRequired 要求客户端在发送邮件前认证，需要同时使用 WithAuth。
+func WithAuthRequired() Option {
+	return func(s *Server) {
+		s.authRequired = true
+	}
+}
+
+// WithReply 指定服务器对某些命令的响应，可以多次使用，按添加的顺序匹配。
+func WithReply(r Reply) Option {
+	return func(s *Server) {
+		s.replies = append(s.replies, &r)
+	}
+}
+
+// Server 是用于测试的 SMTP 服务器，可以被多个 goroutine 同时使用。
+type Server struct {
+	hostname       string
+	extensions     []string
+	tls            bool
+	requireTLS     bool
+	users          map[string]string
+	authMechanisms []string
+	authRequired   bool
+	sizeLimit      int64
+
+	ln        net.Listener
+	tlsConfig *tls.Config
+	certPool  *x509.CertPool
+	wg        sync.WaitGroup
+	done      chan struct{}
+
+	mu          sync.Mutex
+	replies     []*Reply
+	messages    []Message
+	commands    []string
+	connections int
+	conns       map[net.Conn]struct{}
+	closed      bool
+}
+
+// NewServer 创建并启动服务器，监听 `127.0.0.1` 的随机端口。不再使用时应调用 Close。
+func NewServer(opts ...Option) (s *Server, err error) {
+	s = &Server{
+		hostname:       "localhost",
+		users:          make(map[string]string),
+		authMechanisms: defaultAuthMechanisms,
+		conns:          make(map[net.Conn]struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, r := range s.replies {
+		r.Command = strings.ToUpper(r.Command)
+
+		if r.Match != "" {
+			if r.re, err = regexp.Compile(r.Match); err != nil {
+				return nil, fmt.Errorf("smtptest: invalid reply pattern %q: %w", r.Match, err)
+			}
+		}
+	}
+
+	for _, ext := range s.extensions {
+		if value, found := strings.CutPrefix(strings.ToUpper(ext), "SIZE "); found {
+			s.sizeLimit, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		}
+	}
+
+	if s.tls && s.tlsConfig == nil {
+		if s.tlsConfig, s.certPool, err = newTLSConfig(s.hostname); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return
+}
+
+// Addr 返回服务器的地址，例如 `127.0.0.1:25025`。
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Host 返回服务器监听的 IP 地址。
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+
+	return host
+}
+
+// Port 返回服务器监听的端口。
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr())
+
+	return port
+}
+
+// CertPool 返回包含服务器证书的 CertPool，没有使用 WithTLS（或使用 WithTLSConfig）时为 nil。
+func (s *Server) CertPool() *x509.CertPool {
+	return s.certPool
+}
+
+// ClientTLSConfig 返回客户端连接服务器时使用的 tls.Config，会验证服务器证书。
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.certPool, ServerName: s.hostname}
+}
+
+// Messages 返回已接收的邮件。
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// Commands 返回收到的所有命令行（不包括认证过程中的数据及邮件内容），例如 `MAIL FROM:<a@b.c> SIZE=100`。
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Connections 返回客户端建立的连接数。
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+// Reset 清除已接收的邮件、命令及连接数。
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+	s.commands = nil
+	s.connections = 0
+}
+
+// Close 停止服务器并断开所有连接。
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		close(s.done)
+	}
+
+	s.closed = true
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.ln.Close()
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+
+			return
+		}
+
+		s.connections++
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+
+			sess := &session{server: s, conn: c, r: bufio.NewReader(c)}
+			sess.serve()
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+
+			_ = c.Close()
+		}()
+	}
+}
+
+// reply 返回与命令匹配的响应，没有匹配时返回空字符串。匹配的 Reply 设置了 Delay 时先等待。
+func (s *Server) reply(cmd, line string) (reply string) {
+	var delay time.Duration
+
+	s.mu.Lock()
+	for _, r := range s.replies {
+		if r.Command != cmd || (r.Times > 0 && r.used >= r.Times) {
+			continue
+		}
+
+		if r.re != nil && !r.re.MatchString(line) {
+			continue
+		}
+
+		r.used++
+		reply, delay = r.Reply, r.Delay
+
+		break
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-s.done:
+		}
+	}
+
+	return
+}
+
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	s.commands = append(s.commands, line)
+	s.mu.Unlock()
+}
+
+// session 是一个客户端连接。
+type session struct {
+	server *Server
+	conn   net.Conn
+	r      *bufio.Reader
+
+	helo     string
+	tls      bool
+	authUser string
+
+	inTransaction bool
+	from          string
+	recipients    []string
+}
+
+var errQuit = errors.New("quit")
+
+func (sess *session) serve() {
+	s := sess.server
+
+	greeting := "220 " + s.hostname + " ESMTP smtptest"
+	if r := s.reply(CmdGreeting, ""); r != "" {
+		greeting = r
+	}
+
+	if err := sess.write(greeting); err != nil {
+		return
+	}
+
+	for {
+		line, err := sess.readLine()
+		if err != nil {
+			return
+		}
+
+		s.record(line)
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+
+		if err = sess.handle(cmd, arg, line); err != nil {
+			return
+		}
+	}
+}
+
+// handle 处理一条命令，返回错误时断开连接。
+func (sess *session) handle(cmd, arg, line string) (err error) {
+	scripted := sess.server.reply(cmd, line)
+	if scripted != "" && !positive(scripted) {
+		return sess.write(scripted)
+	}
+
+	var reply string
+
+	switch cmd {
+	case "EHLO", "HELO":
+		reply = sess.hello(cmd, arg)
+	case "STARTTLS":
+		return sess.startTLS(scripted)
+	case "AUTH":
+		return sess.auth(arg)
+	case "MAIL":
+		reply = sess.mail(arg)
+	case "RCPT":
+		reply = sess.rcpt(arg)
+	case "DATA":
+		return sess.data(scripted)
+	case "RSET":
+		sess.reset()
+		reply = "250 2.0.0 OK"
+	case "NOOP":
+		reply = "250 2.0.0 OK"
+	case "VRFY":
+		reply = "252 2.1.5 Cannot VRFY user"
+	case "QUIT":
+		_ = sess.write("221 2.0.0 Bye")
+
+		return errQuit
+	default:
+		reply = "502 5.5.2 Error: command not recognized"
+	}
+
+	if scripted != "" && positive(reply) {
+		reply = scripted
+	}
+
+	return sess.write(reply)
+}
+
+func (sess *session) hello(cmd, arg string) string {
+	s := sess.server
+
+	if arg == "" {
+		return "501 5.5.4 Syntax: " + cmd + " hostname"
+	}
+
+	sess.helo = arg
+	sess.reset()
+
+	if cmd == "HELO" {
+		return "250 " + s.hostname
+	}
+
+	lines := []string{s.hostname}
+	lines = append(lines, s.extensions...)
+
+	if s.tls && !sess.tls {
+		lines = append(lines, "STARTTLS")
+	}
+
+	if len(s.users) > 0 && (sess.tls || !s.requireTLS) {
+		lines = append(lines, "AUTH "+strings.Join(s.authMechanisms, " "))
+	}
+
+	for i := range lines {
+		if i == len(lines)-1 {
+			lines[i] = "250 " + lines[i]
+		} else {
+			lines[i] = "250-" + lines[i]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (sess *session) startTLS(scripted string) (err error) {
+	s := sess.server
+
+	switch {
+	case !s.tls:
+		return sess.write("502 5.5.1 Error: command not implemented")
+	case sess.tls:
+		return sess.write("503 5.5.1 Error: TLS already active")
+	}
+
+	if err = sess.write(cmp.Or(scripted, "220 2.0.0 Ready to start TLS")); err != nil {
+		return
+	}
+
+	tlsConn := tls.Server(sess.conn, s.tlsConfig)
+	if err = tlsConn.Handshake(); err != nil {
+		return
+	}
+
+	// RFC 3207 第 4.2 节：TLS 握手后丢弃之前的会话状态。
+	sess.conn = tlsConn
+	sess.r = bufio.NewReader(tlsConn)
+	sess.tls = true
+	sess.helo = ""
+	sess.authUser = ""
+	sess.reset()
+
+	return
+}
+
+// checkAccess 检查是否需要先使用 STARTTLS 或认证。
+func (sess *session) checkAccess() string {
+	s := sess.server
+
+	if s.requireTLS && !sess.tls {
+		return "530 5.7.0 Must issue a STARTTLS command first"
+	}
+
+	if s.authRequired && sess.authUser == "" {
+		return "530 5.7.0 Authentication required"
+	}
+
+	return ""
+}
+
+func (sess *session) mail(arg string) string {
+	if sess.helo == "" {
+		return "503 5.5.1 Error: send HELO/EHLO first"
+	}
+
+	if reply := sess.checkAccess(); reply != "" {
+		return reply
+	}
+
+	if sess.inTransaction {
+		return "503 5.5.1 Error: nested MAIL command"
+	}
+
+	addr, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		return "501 5.5.4 Syntax: MAIL FROM:<address>"
+	}
+
+	for _, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, "SIZE") && sess.server.sizeLimit > 0 {
+			if size, _ := strconv.ParseInt(value, 10, 64); size > sess.server.sizeLimit {
+				return "552 5.3.4 Message size exceeds fixed limit"
+			}
+		}
+	}
+
+	sess.inTransaction = true
+	sess.from = addr
+
+	return "250 2.1.0 OK"
+}
+
+func (sess *session) rcpt(arg string) string {
+	if !sess.inTransaction {
+		return "503 5.5.1 Error: need MAIL command"
+	}
+
+	addr, _, ok := parsePath(arg, "TO:")
+	if !ok || addr == "" {
+		return "501 5.5.4 Syntax: RCPT TO:<address>"
+	}
+
+	sess.recipients = append(sess.recipients, addr)
+
+	return "250 2.1.5 OK"
+}
+
+func (sess *session) data(scripted string) (err error) {
+	s := sess.server
+
+	switch {
+	case !sess.inTransaction:
+		return sess.write("503 5.5.1 Error: need MAIL command")
+	case len(sess.recipients) == 0:
+		return sess.write("554 5.5.1 Error: no valid recipients")
+	}
+
+	if err = sess.write(cmp.Or(scripted, "354 End data with <CR><LF>.<CR><LF>")); err != nil {
+		return
+	}
+
+	data, err := sess.readData()
+	if err != nil {
+		return
+	}
+
+	reply := "250 2.0.0 OK: queued"
+	if s.sizeLimit > 0 && int64(len(data)) > s.sizeLimit {
+		reply = "552 5.3.4 Message size exceeds fixed limit"
+	}
+
+	if r := s.reply(CmdDataEnd, string(data)); r != "" {
+		reply = r
+	}
+
+	if positive(reply) {
+		s.mu.Lock()
+		s.messages = append(s.messages, Message{
+			Helo:       sess.helo,
+			From:       sess.from,
+			Recipients: sess.recipients,
+			Data:       data,
+			TLS:        sess.tls,
+			AuthUser:   sess.authUser,
+		})
+		s.mu.Unlock()
+	}
+
+	sess.reset()
+
+	return sess.write(reply)
+}
+
+func (sess *session) reset() {
+	sess.inTransaction = false
+	sess.from = ""
+	sess.recipients = nil
+}
+
+// readData 读取邮件内容直到单独一行的 `.`，并去除 dot-stuffing（RFC 5321 第 4.5.2 节）。
+func (sess *session) readData() (data []byte, err error) {
+	for {
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		if line == ".\r\n" || line == ".\n" {
+			return data, nil
+		}
+
+		line = strings.TrimPrefix(line, ".")
+		if !strings.HasSuffix(line, "\r\n") {
+			line = strings.TrimSuffix(line, "\n") + "\r\n"
+		}
+
+		data = append(data, line...)
+	}
+}
+
+func (sess *session) readLine() (line string, err error) {
+	var b []byte
+	for {
+		chunk, isPrefix, err := sess.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		b = append(b, chunk...)
+		if len(b) > maxLineLength {
+			_ = sess.write("500 5.5.0 Error: line too long")
+
+			return "", io.ErrShortBuffer
+		}
+
+		if !isPrefix {
+			return string(b), nil
+		}
+	}
+}
+
+// write 发送响应，多行响应以 `\n` 分隔。响应代码为 421 时返回错误以断开连接。
+func (sess *session) write(reply string) (err error) {
+	_ = sess.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	for _, line := range strings.Split(reply, "\n") {
+		if _, err = io.WriteString(sess.conn, strings.TrimRight(line, "\r")+"\r\n"); err != nil {
+			return
+		}
+	}
+
+	if strings.HasPrefix(reply, "421") {
+		return errQuit
+	}
+
+	return
+}
+
+// parsePath 解析 `FROM:<address> PARAM=VALUE ...`，prefix 不区分大小写。
+func parsePath(arg, prefix string) (addr string, params []string, ok bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return
+	}
+
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return
+	}
+
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return
+	}
+
+	return rest[1:end], strings.Fields(rest[end+1:]), true
+}
+
+// positive 检查响应是否为 2xx 或 3xx。
+func positive(reply string) bool {
+	return strings.HasPrefix(reply, "2") || strings.HasPrefix(reply, "3")
+}
@@ -0,0 +1,293 @@
+package smtptest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	s, err := NewServer(opts...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func dial(t *testing.T, s *Server) *smtp.Client {
+	c, err := smtp.Dial(s.Addr())
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+// sendMail 发送邮件并返回第一个错误。
+func sendMail(c *smtp.Client, from string, to []string, body string) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func replyCode(err error) int {
+	if tpErr, ok := err.(*textproto.Error); ok {
+		return tpErr.Code
+	}
+
+	return 0
+}
+
+func TestServer(t *testing.T) {
+	s := newTestServer(t, WithExtensions("PIPELINING", "8BITMIME"))
+
+	c := dial(t, s)
+	assert.Nil(t, c.Hello("client.example.com"))
+
+	ok, _ := c.Extension("PIPELINING")
+	assert.True(t, ok)
+	ok, _ = c.Extension("STARTTLS")
+	assert.False(t, ok)
+	ok, _ = c.Extension("AUTH")
+	assert.False(t, ok)
+
+	body := "Subject: test\r\n\r\n.leading dot\r\nhello\n"
+	assert.Nil(t, sendMail(c, "sender@example.com", []string{"a@example.com", "b@example.com"}, body))
+	assert.Nil(t, c.Quit())
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "client.example.com", msgs[0].Helo)
+	assert.Equal(t, "sender@example.com", msgs[0].From)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, msgs[0].Recipients)
+	assert.Equal(t, "Subject: test\r\n\r\n.leading dot\r\nhello\r\n", string(msgs[0].Data))
+	assert.False(t, msgs[0].TLS)
+	assert.Equal(t, "", msgs[0].AuthUser)
+
+	assert.Equal(t, []string{
+		"EHLO client.example.com",
+		"MAIL FROM:<sender@example.com> BODY=8BITMIME",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"DATA",
+		"QUIT",
+	}, s.Commands())
+	assert.Equal(t, 1, s.Connections())
+
+	s.Reset()
+	assert.Empty(t, s.Messages())
+	assert.Empty(t, s.Commands())
+	assert.Equal(t, 0, s.Connections())
+}
+
+func TestServerSequence(t *testing.T) {
+	s := newTestServer(t)
+	conn, err := net.Dial("tcp", s.Addr())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	assert.Nil(t, err)
+
+	cmd := func(line string) int {
+		id, err := text.Cmd("%s", line)
+		assert.Nil(t, err)
+
+		text.StartResponse(id)
+		defer text.EndResponse(id)
+
+		code, _, _ := text.ReadResponse(0)
+
+		return code
+	}
+
+	assert.Equal(t, 503, cmd("MAIL FROM:<a@example.com>"))
+	assert.Equal(t, 501, cmd("HELO"))
+	assert.Equal(t, 250, cmd("HELO client"))
+	assert.Equal(t, 503, cmd("RCPT TO:<b@example.com>"))
+	assert.Equal(t, 503, cmd("DATA"))
+	assert.Equal(t, 501, cmd("MAIL FROM:a@example.com"))
+	assert.Equal(t, 250, cmd("MAIL FROM:<>"))
+	assert.Equal(t, 503, cmd("MAIL FROM:<a@example.com>"))
+	assert.Equal(t, 554, cmd("DATA"))
+	assert.Equal(t, 501, cmd("RCPT TO:<>"))
+	assert.Equal(t, 250, cmd("RSET"))
+	assert.Equal(t, 250, cmd("NOOP"))
+	assert.Equal(t, 252, cmd("VRFY user"))
+	assert.Equal(t, 502, cmd("STARTTLS"))
+	assert.Equal(t, 502, cmd("AUTH PLAIN"))
+	assert.Equal(t, 502, cmd("UNKNOWN"))
+	assert.Equal(t, 500, cmd(strings.Repeat("x", maxLineLength+1)))
+
+	// 命令过长时断开连接。
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.NotNil(t, err)
+}
+
+func TestServerReplies(t *testing.T) {
+	s := newTestServer(t,
+		WithReply(Reply{Command: "rcpt", Match: `(?i)unknown@`, Reply: "550 5.1.1 User unknown"}),
+		WithReply(Reply{Command: "RCPT", Match: `greylist@`, Reply: "450 4.2.0 Greylisted", Times: 1}),
+		WithReply(Reply{Command: "MAIL", Reply: "250 2.1.0 Sender OK custom"}),
+		WithReply(Reply{Command: CmdDataEnd, Match: `(?m)^Subject: virus`, Reply: "554 5.7.1 Virus found"}),
+		WithReply(Reply{Command: CmdDataEnd, Reply: "250 2.0.0 Ok: queued as ABC123"}),
+		WithReply(Reply{Command: "NOOP", Reply: "421 4.3.2 Service shutting down"}),
+	)
+
+	c := dial(t, s)
+
+	err := sendMail(c, "sender@example.com", []string{"Unknown@example.com"}, "")
+	assert.Equal(t, 550, replyCode(err))
+	assert.Nil(t, c.Reset())
+
+	// Times 为 1 时只使用一次。
+	assert.Equal(t, 450, replyCode(sendMail(c, "sender@example.com", []string{"greylist@example.com"}, "")))
+	assert.Nil(t, c.Reset())
+	assert.Nil(t, sendMail(c, "sender@example.com", []string{"greylist@example.com"}, "Subject: test\r\n\r\n"))
+
+	assert.Equal(t, 554, replyCode(sendMail(c, "sender@example.com", []string{"user@example.com"}, "Subject: virus\r\n\r\n")))
+	assert.Equal(t, 1, len(s.Messages()))
+
+	// 2xx 响应只替换响应内容。
+	id, err := c.Text.Cmd("MAIL FROM:<sender@example.com>")
+	assert.Nil(t, err)
+	c.Text.StartResponse(id)
+	_, msg, err := c.Text.ReadResponse(250)
+	c.Text.EndResponse(id)
+	assert.Nil(t, err)
+	assert.Equal(t, "2.1.0 Sender OK custom", msg)
+	assert.Nil(t, c.Reset())
+
+	// 421 后断开连接。
+	assert.Equal(t, 421, replyCode(c.Noop()))
+	assert.NotNil(t, c.Noop())
+
+	// 欢迎信息
+	s = newTestServer(t, WithReply(Reply{Command: CmdGreeting, Reply: "554 5.3.2 No service"}))
+	_, err = smtp.Dial(s.Addr())
+	assert.Equal(t, 554, replyCode(err))
+
+	_, err = NewServer(WithReply(Reply{Command: "RCPT", Match: "("}))
+	assert.NotNil(t, err)
+}
+
+func TestServerSize(t *testing.T) {
+	s := newTestServer(t, WithExtensions("SIZE 100"))
+	c := dial(t, s)
+
+	assert.Nil(t, c.Hello("localhost"))
+	id, err := c.Text.Cmd("MAIL FROM:<sender@example.com> SIZE=101")
+	assert.Nil(t, err)
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(250)
+	c.Text.EndResponse(id)
+	assert.Equal(t, 552, replyCode(err))
+
+	err = sendMail(c, "sender@example.com", []string{"user@example.com"}, strings.Repeat("x", 101))
+	assert.Equal(t, 552, replyCode(err))
+	assert.Empty(t, s.Messages())
+}
+
+func TestServerTLS(t *testing.T) {
+	s := newTestServer(t, WithRequireTLS(), WithAuth("user", "secret"), WithHostname("mx.example.com"))
+	assert.NotNil(t, s.CertPool())
+
+	c := dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+
+	ok, _ := c.Extension("STARTTLS")
+	assert.True(t, ok)
+	ok, _ = c.Extension("AUTH")
+	assert.False(t, ok)
+
+	assert.Equal(t, 530, replyCode(c.Mail("sender@example.com")))
+
+	assert.Nil(t, c.StartTLS(s.ClientTLSConfig()))
+
+	ok, _ = c.Extension("STARTTLS")
+	assert.False(t, ok)
+	ok, mechs := c.Extension("AUTH")
+	assert.True(t, ok)
+	assert.Equal(t, "PLAIN LOGIN CRAM-MD5", mechs)
+
+	assert.Nil(t, c.Auth(smtp.PlainAuth("", "user", "secret", "127.0.0.1")))
+	assert.Nil(t, sendMail(c, "sender@example.com", []string{"user@example.com"}, "hello\r\n"))
+
+	msgs := s.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.True(t, msgs[0].TLS)
+	assert.Equal(t, "user", msgs[0].AuthUser)
+
+	// 证书同时适用于 localhost 和 127.0.0.1。
+	for _, name := range []string{"localhost", "127.0.0.1"} {
+		c = dial(t, s)
+		cfg := s.ClientTLSConfig()
+		cfg.ServerName = name
+		assert.Nil(t, c.StartTLS(cfg), name)
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	config, pool, err := newTLSConfig("mx.example.com")
+	assert.Nil(t, err)
+
+	s := newTestServer(t, WithTLSConfig(config))
+	assert.Nil(t, s.CertPool())
+
+	c := dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+	assert.Nil(t, c.StartTLS(&tls.Config{RootCAs: pool, ServerName: "mx.example.com"}))
+	assert.Nil(t, sendMail(c, "sender@example.com", []string{"user@example.com"}, "hello\r\n"))
+	assert.True(t, s.Messages()[0].TLS)
+}
+
+func TestServerDelay(t *testing.T) {
+	s := newTestServer(t, WithReply(Reply{Command: CmdDataEnd, Delay: 200 * time.Millisecond}))
+	c := dial(t, s)
+
+	// 只设置 Delay 时仍然使用默认响应。
+	start := time.Now()
+	assert.Nil(t, sendMail(c, "sender@example.com", []string{"user@example.com"}, "hello\r\n"))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Equal(t, 1, len(s.Messages()))
+
+	// Close 时不再等待。
+	c = dial(t, s)
+	assert.Nil(t, c.Hello("localhost"))
+	assert.Nil(t, c.Mail("sender@example.com"))
+	assert.Nil(t, c.Rcpt("user@example.com"))
+	w, err := c.Data()
+	assert.Nil(t, err)
+	_, _ = w.Write([]byte("hello\r\n"))
+
+	go func() { _ = w.Close() }()
+	time.Sleep(50 * time.Millisecond)
+
+	start = time.Now()
+	assert.Nil(t, s.Close())
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+}
@@ -47,7 +47,7 @@ func createSystemTable(gdb *goqu.Database) error {
 	dialect := gdb.Dialect()
 	var exec string
 	switch dialect {
-	case dialectSQLite:
+	case dialectSQLite, dialectSQLite3:
 		exec = schemaSystemSqlite
 	case dialectMysql:
 		exec = schemaSystemMysql
@@ -60,11 +60,11 @@ func createSystemTable(gdb *goqu.Database) error {
 	return err
 }
 
-func insertSQLSchemaVersion(gdb *goqu.Database, version int) error {
+func insertSQLSchemaVersion(gdb *goqu.Database, key string, version int) error {
 	_, err := gdb.Insert(tableSystem).
 		Prepared(true).
 		Rows(goqu.Record{
-			"k": keySQLSchemaVersion,
+			"k": key,
 			"v": version,
 		}).
 		OnConflict(goqu.DoNothing()).
@@ -74,11 +74,11 @@ func insertSQLSchemaVersion(gdb *goqu.Database, version int) error {
 }
 
 // getSQLSchemaVersion 获取当前数据库结构版本
-func getSQLSchemaVersion(gdb *goqu.Database) (found bool, version int, err error) {
+func getSQLSchemaVersion(gdb *goqu.Database, key string) (found bool, version int, err error) {
 	var kv KVInt
 
 	found, err = gdb.From(tableSystem).
-		Where(goqu.Ex{"k": keySQLSchemaVersion}).
+		Where(goqu.Ex{"k": key}).
 		Limit(1).
 		ScanStruct(&kv)
 
@@ -86,10 +86,10 @@ func getSQLSchemaVersion(gdb *goqu.Database) (found bool, version int, err error
 }
 
 // updateSQLSchemaVersion 更新本地版本
-func updateSQLSchemaVersion(gdb *goqu.Database, version int) error {
+func updateSQLSchemaVersion(gdb *goqu.Database, key string, version int) error {
 	_, err := gdb.
 		Update(tableSystem).
-		Where(goqu.Ex{"k": keySQLSchemaVersion}).
+		Where(goqu.Ex{"k": key}).
 		Set(goqu.Record{"v": version}).
 		Executor().Exec()
 
@@ -129,21 +129,58 @@ func UpgradeSQLSchema(dbName string, gdb *goqu.Database, subFSSQLFiles fs.FS, la
 			return err
 		}
 
-		return insertSQLSchemaVersion(gdb, latestVersion)
+		return insertSQLSchemaVersion(gdb, keySQLSchemaVersion, latestVersion)
 	}
 
 	// 获取本地表结构版本
-	found, localVersion, err := getSQLSchemaVersion(gdb)
+	found, localVersion, err := getSQLSchemaVersion(gdb, keySQLSchemaVersion)
 	if err != nil {
 		return err
 	}
 
-	// 未找到版本信息则不更新。
-	// 正常情况是必须有一个版本号，但存在表却不存在版本号记录的情况太特殊，暂不做处理。
+	// 未找到版本信息，说明 system 表是其它模块创建的（参考 UpgradeSQLSchemaWithKey），
+	// 与初始安装相同，只记录最新版本。
 	if !found {
-		return nil
+		return insertSQLSchemaVersion(gdb, keySQLSchemaVersion, latestVersion)
+	}
+
+	return runSQLFiles(gdb, keySQLSchemaVersion, subFSSQLFiles, localVersion, latestVersion, sqlFilenameExtension)
+}
+
+// UpgradeSQLSchemaWithKey 创建或升级 sql 表结构，表结构版本记录在 `system` 表中名为 key 的记录，
+// 用于在同一个数据库中独立管理某个模块（例如 dmarcreport）的数据表，不影响 UpgradeSQLSchema
+// 使用的版本号。
+//
+// 与 UpgradeSQLSchema 不同，没有版本记录时（初始安装）依次执行所有版本的 SQL 文件，
+// 因此 SQL 文件应该可以重复执行（例如 `CREATE TABLE IF NOT EXISTS`）。
+func UpgradeSQLSchemaWithKey(dbName string, gdb *goqu.Database, key string, subFSSQLFiles fs.FS, latestVersion int, sqlFilenameExtension string) error {
+	hasTable, err := HasSystemTable(dbName, gdb)
+	if err != nil {
+		return err
+	}
+
+	if !hasTable {
+		if err = createSystemTable(gdb); err != nil {
+			return err
+		}
+	}
+
+	found, localVersion, err := getSQLSchemaVersion(gdb, key)
+	if err != nil {
+		return err
 	}
 
+	if !found {
+		if err = insertSQLSchemaVersion(gdb, key, 0); err != nil {
+			return err
+		}
+	}
+
+	return runSQLFiles(gdb, key, subFSSQLFiles, localVersion, latestVersion, sqlFilenameExtension)
+}
+
+// runSQLFiles 依次执行 localVersion 之后到 latestVersion 的 SQL 文件，每执行一个文件就更新 key 记录的版本。
+func runSQLFiles(gdb *goqu.Database, key string, subFSSQLFiles fs.FS, localVersion, latestVersion int, sqlFilenameExtension string) error {
 	if localVersion >= latestVersion {
 		return nil
 	}
@@ -171,7 +208,7 @@ func UpgradeSQLSchema(dbName string, gdb *goqu.Database, subFSSQLFiles fs.FS, la
 		}
 
 		// 立即更新本地版本
-		if err = updateSQLSchemaVersion(gdb, newVersion); err != nil {
+		if err = updateSQLSchemaVersion(gdb, key, newVersion); err != nil {
 			return err
 		}
 	}
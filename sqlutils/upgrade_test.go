@@ -0,0 +1,74 @@
+package sqlutils
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func setupUpgradeDB(t *testing.T) *goqu.Database {
+	sqliteDB, err := InitSQLiteDB(filepath.Join(t.TempDir(), "upgrade.db"), nil, 0, 0)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = sqliteDB.Close() })
+
+	return goqu.New("sqlite", sqliteDB)
+}
+
+func schemaVersion(t *testing.T, gdb *goqu.Database, key string) int {
+	found, version, err := getSQLSchemaVersion(gdb, key)
+	assert.Nil(t, err)
+	assert.True(t, found, key)
+
+	return version
+}
+
+func TestUpgradeSQLSchemaWithKey(t *testing.T) {
+	appFiles := fstest.MapFS{
+		"2.sql": {Data: []byte("CREATE TABLE app_v2 (id INTEGER);")},
+		"3.sql": {Data: []byte("CREATE TABLE app_v3 (id INTEGER);")},
+	}
+
+	moduleFiles := fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE IF NOT EXISTS module (id INTEGER);")},
+		"2.sql": {Data: []byte("ALTER TABLE module ADD COLUMN name TEXT NOT NULL DEFAULT '';")},
+	}
+
+	// 程序已经使用 UpgradeSQLSchema 初始化数据库。
+	gdb := setupUpgradeDB(t)
+	assert.Nil(t, UpgradeSQLSchema("", gdb, appFiles, 3, ".sql"))
+	assert.Equal(t, 3, schemaVersion(t, gdb, keySQLSchemaVersion))
+
+	assert.Nil(t, UpgradeSQLSchemaWithKey("", gdb, "module_version", moduleFiles, 1, ".sql"))
+	assert.Equal(t, 1, schemaVersion(t, gdb, "module_version"))
+	assert.Equal(t, 3, schemaVersion(t, gdb, keySQLSchemaVersion))
+
+	_, err := gdb.Exec("INSERT INTO module (id) VALUES (1)")
+	assert.Nil(t, err)
+
+	// 升级模块的表结构，重复执行时不做任何修改。
+	for range 2 {
+		assert.Nil(t, UpgradeSQLSchemaWithKey("", gdb, "module_version", moduleFiles, 2, ".sql"))
+		assert.Equal(t, 2, schemaVersion(t, gdb, "module_version"))
+	}
+
+	_, err = gdb.Exec("INSERT INTO module (id, name) VALUES (2, 'name')")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, schemaVersion(t, gdb, keySQLSchemaVersion))
+
+	// 模块先创建 system 表时，程序仍然按初始安装记录最新版本，之后可以正常升级。
+	gdb = setupUpgradeDB(t)
+	assert.Nil(t, UpgradeSQLSchemaWithKey("", gdb, "module_version", moduleFiles, 2, ".sql"))
+	assert.Nil(t, UpgradeSQLSchema("", gdb, appFiles, 2, ".sql"))
+	assert.Equal(t, 2, schemaVersion(t, gdb, keySQLSchemaVersion))
+	assert.Equal(t, 2, schemaVersion(t, gdb, "module_version"))
+
+	assert.Nil(t, UpgradeSQLSchema("", gdb, appFiles, 3, ".sql"))
+	assert.Equal(t, 3, schemaVersion(t, gdb, keySQLSchemaVersion))
+
+	_, err = gdb.Exec("INSERT INTO app_v3 (id) VALUES (1)")
+	assert.Nil(t, err)
+}